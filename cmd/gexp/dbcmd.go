@@ -18,19 +18,23 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/expanse-org/go-expanse/cmd/utils"
 	"github.com/expanse-org/go-expanse/common"
 	"github.com/expanse-org/go-expanse/common/hexutil"
 	"github.com/expanse-org/go-expanse/console/prompt"
+	"github.com/expanse-org/go-expanse/core"
 	"github.com/expanse-org/go-expanse/core/rawdb"
 	"github.com/expanse-org/go-expanse/ethdb"
 	"github.com/expanse-org/go-expanse/log"
+	"github.com/expanse-org/go-expanse/params"
 	"github.com/expanse-org/go-expanse/trie"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -62,6 +66,9 @@ Remove blockchain and state databases`,
 			dbPutCmd,
 			dbGetSlotsCmd,
 			dbDumpFreezerIndex,
+			dbIndexTransfersCmd,
+			dbMigrateCmd,
+			dbFreezerRecompressCmd,
 		},
 	}
 	dbInspectCmd = cli.Command{
@@ -187,6 +194,94 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		},
 		Description: "This command displays information about the freezer index.",
 	}
+	dbIndexTransfersCmd = cli.Command{
+		Action: utils.MigrateFlags(dbIndexTransfers),
+		Name:   "index-transfers",
+		Usage:  "Build the internal transfer index for the existing chain",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.CacheFlag,
+			utils.CacheDatabaseFlag,
+			utils.CacheGCFlag,
+		},
+		Description: `This command re-executes the blocks of the local chain to index the value
+transfers and contract creations made by internal calls, as served by
+eth_getAddressHistory. Historical state missing from the database is regenerated
+from the closest available ancestor, which may take a very long time. Already
+indexed sections are skipped, and the node keeps the index up to date when run
+with --index.transfers.`,
+	}
+	dbMigrateTargetFlag = cli.StringFlag{
+		Name:  "to",
+		Usage: "Database engine to migrate to ('leveldb' or 'pebble')",
+	}
+	dbMigrateCmd = cli.Command{
+		Action: utils.MigrateFlags(dbMigrate),
+		Name:   "migrate",
+		Usage:  "Migrate the chain database to another database engine",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.CacheFlag,
+			utils.CacheDatabaseFlag,
+			dbMigrateTargetFlag,
+		},
+		Description: `This command copies every entry of the key-value chain database into a new
+database of the engine given by --to, next to the existing one. The copy can be
+interrupted and is resumed where it left off when the command is run again. Once
+done, the item counts and checksums of every data category are compared between
+the two databases, and the new database replaces the old one, which is kept with
+an '.old' suffix until deleted manually. The ancient chain segments are moved over,
+not copied.`,
+	}
+	dbRecompressTablesFlag = cli.StringFlag{
+		Name:  "tables",
+		Usage: "Comma separated list of freezer tables to recompress",
+		Value: "bodies,receipts",
+	}
+	dbRecompressCodecFlag = cli.StringFlag{
+		Name:  "codec",
+		Usage: "Compression codec to use ('none', 'snappy', 'zstd' or 'zstd-dict')",
+		Value: "zstd-dict",
+	}
+	dbRecompressDictSizeFlag = cli.IntFlag{
+		Name:  "dict.size",
+		Usage: "Maximum size of the dictionary trained for 'zstd-dict' in bytes",
+		Value: 112640,
+	}
+	dbFreezerRecompressCmd = cli.Command{
+		Action: utils.MigrateFlags(dbFreezerRecompress),
+		Name:   "freezer-recompress",
+		Usage:  "Rewrite ancient chain segments with another compression codec",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.MainnetFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			dbRecompressTablesFlag,
+			dbRecompressCodecFlag,
+			dbRecompressDictSizeFlag,
+		},
+		Description: `This command rewrites the given freezer tables with the codec chosen by
+--codec, which is recorded in the table metadata and used for all data appended
+later on. For 'zstd-dict', a zstd dictionary is trained on items sampled across
+the table and stored in its metadata. Each table is rebuilt next to the original
+and swapped in once complete. An interrupted rebuild is discarded, an
+interrupted swap is finished the next time the freezer is opened. The database
+is marked with the current version, so older releases not knowing the codecs
+refuse to open it. The node must not be running.`,
+	}
 )
 
 func removeDB(ctx *cli.Context) error {
@@ -499,3 +594,105 @@ func freezerInspect(ctx *cli.Context) error {
 	}
 	return nil
 }
+
+func dbIndexTransfers(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack)
+	defer db.Close()
+	defer chain.Stop()
+
+	head := chain.CurrentBlock().NumberU64()
+	if head+1 < params.TransferIndexConfirms+params.TransferIndexBlocks {
+		log.Info("Chain too short to index transfers", "head", head)
+		return nil
+	}
+	target := (head + 1 - params.TransferIndexConfirms) / params.TransferIndexBlocks
+
+	indexer := core.NewTransferIndexer(db, chain, params.TransferIndexBlocks, params.TransferIndexConfirms, math.MaxUint64, 0)
+	defer indexer.Close()
+	indexer.Start(chain)
+
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for {
+		sections, _, _ := indexer.Sections()
+		if sections >= target {
+			log.Info("Transfer index built", "sections", sections, "blocks", sections*params.TransferIndexBlocks, "elapsed", common.PrettyDuration(time.Since(start)))
+			return nil
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Indexing transfers", "sections", sections, "target", target, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func dbMigrate(ctx *cli.Context) error {
+	engine := ctx.String(dbMigrateTargetFlag.Name)
+	if engine != rawdb.DBLeveldb && engine != rawdb.DBPebble {
+		return fmt.Errorf("invalid --%s engine %q, want 'leveldb' or 'pebble'", dbMigrateTargetFlag.Name, engine)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	if stack.Config().DataDir == "" {
+		return fmt.Errorf("no data directory configured")
+	}
+	name := "chaindata"
+	if ctx.GlobalString(utils.SyncModeFlag.Name) == "light" {
+		name = "lightchaindata"
+	}
+	cache := ctx.GlobalInt(utils.CacheFlag.Name) * ctx.GlobalInt(utils.CacheDatabaseFlag.Name) / 100
+	return rawdb.MigrateDatabase(stack.ResolvePath(name), engine, cache, utils.MakeDatabaseHandles())
+}
+
+func dbFreezerRecompress(ctx *cli.Context) error {
+	codec, err := rawdb.ParseFreezerCodec(ctx.String(dbRecompressCodecFlag.Name))
+	if err != nil {
+		return err
+	}
+	stack, config := makeConfigNode(ctx)
+	defer stack.Close()
+
+	path := config.Eth.DatabaseFreezer
+	switch {
+	case path == "":
+		path = filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+	case rawdb.IsRemoteFreezer(path):
+		return fmt.Errorf("shared ancient store %s can't be recompressed", path)
+	case !filepath.IsAbs(path):
+		path = stack.ResolvePath(path)
+	}
+	// Mark the database with the version introducing the freezer codecs, so older
+	// releases refuse to open it instead of misreading the recompressed tables
+	db, err := rawdb.Open(rawdb.OpenOptions{Directory: stack.ResolvePath("chaindata"), Cache: 16, Handles: 16})
+	if err != nil {
+		return err
+	}
+	if version := rawdb.ReadDatabaseVersion(db); version != nil && *version > core.BlockChainVersion {
+		db.Close()
+		return fmt.Errorf("database version is v%d, Gexp %s only supports v%d", *version, params.VersionWithMeta, core.BlockChainVersion)
+	}
+	rawdb.WriteDatabaseVersion(db, core.BlockChainVersion)
+	db.Close()
+
+	for _, name := range strings.Split(ctx.String(dbRecompressTablesFlag.Name), ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := rawdb.FreezerNoSnappy[name]; !ok {
+			return fmt.Errorf("unknown freezer table %q", name)
+		}
+		log.Info("Recompressing freezer table", "location", path, "table", name, "codec", codec)
+		start := time.Now()
+		before, after, err := rawdb.RecompressFreezerTable(path, name, codec, ctx.Int(dbRecompressDictSizeFlag.Name))
+		if err != nil {
+			return err
+		}
+		log.Info("Freezer table recompressed", "table", name, "before", common.StorageSize(before), "after", common.StorageSize(after), "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/expanse-org/go-expanse/cmd/utils"
+	"github.com/expanse-org/go-expanse/consensus/frkhash"
+	"github.com/expanse-org/go-expanse/core"
+	"github.com/expanse-org/go-expanse/core/types"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	simGenesisFlag = cli.StringFlag{
+		Name:  "genesis",
+		Usage: "Genesis JSON file with the chain configuration to simulate (default = network flags)",
+	}
+	simBlocksFlag = cli.Uint64Flag{
+		Name:  "blocks",
+		Usage: "Number of blocks to simulate",
+		Value: 100000,
+	}
+	simIntervalFlag = cli.Uint64Flag{
+		Name:  "interval",
+		Usage: "Number of blocks between two emitted samples",
+		Value: 1000,
+	}
+	simHashrateFlag = cli.StringFlag{
+		Name:  "hashrate",
+		Usage: "Comma separated network hashrate scenarios in H/s, either constant (10G) or a linear ramp (10G:40G)",
+	}
+	simStartNumberFlag = cli.Uint64Flag{
+		Name:  "start.number",
+		Usage: "Block number to start the simulation from (default = genesis)",
+	}
+	simStartDifficultyFlag = cli.StringFlag{
+		Name:  "start.difficulty",
+		Usage: "Difficulty of the starting block (default = genesis difficulty)",
+	}
+	simStartTimeFlag = cli.Uint64Flag{
+		Name:  "start.time",
+		Usage: "Timestamp of the starting block (default = genesis timestamp)",
+	}
+	simSeedFlag = cli.Int64Flag{
+		Name:  "seed",
+		Usage: "Seed for randomized block times, 0 uses the expected block times",
+	}
+	simFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: "Output format of the samples (csv or json)",
+		Value: "csv",
+	}
+)
+
+var (
+	difficultyCommand = cli.Command{
+		Name:     "difficulty",
+		Usage:    "A set of commands to analyse the difficulty adjustment",
+		Category: "MISCELLANEOUS COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:   "simulate",
+				Usage:  "Project difficulty and block times over hashrate scenarios",
+				Action: utils.MigrateFlags(simulateDifficulty),
+				Flags: []cli.Flag{
+					simGenesisFlag,
+					simBlocksFlag,
+					simIntervalFlag,
+					simHashrateFlag,
+					simStartNumberFlag,
+					simStartDifficultyFlag,
+					simStartTimeFlag,
+					simSeedFlag,
+					simFormatFlag,
+					utils.MainnetFlag,
+					utils.RebirthFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+gexp difficulty simulate --hashrate 10G,10G:40G [--genesis genesis.json]
+
+projects the difficulty and block times of a chain configuration offline,
+applying the frkhash difficulty adjustment rules block by block for every
+given network hashrate scenario. This allows evaluating the effect of
+scheduling (or moving) forks before they are activated.
+
+The samples are written to stdout in CSV or JSON format, reporting the
+scenario, block number, timestamp, difficulty, hashrate, the average block
+time since the previous sample and the difficulty rules in effect.`,
+			},
+		},
+	}
+)
+
+// simulateDifficulty runs a difficulty simulation for every hashrate scenario.
+func simulateDifficulty(ctx *cli.Context) error {
+	// Load the chain configuration to simulate
+	genesis := utils.MakeGenesis(ctx)
+	if path := ctx.String(simGenesisFlag.Name); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			utils.Fatalf("Failed to read genesis file: %v", err)
+		}
+		defer file.Close()
+
+		genesis = new(core.Genesis)
+		if err := json.NewDecoder(file).Decode(genesis); err != nil {
+			utils.Fatalf("Invalid genesis file: %v", err)
+		}
+	}
+	if genesis == nil {
+		genesis = core.DefaultGenesisBlock()
+	}
+	if genesis.Config == nil {
+		utils.Fatalf("Genesis has no chain configuration")
+	}
+	// Assemble the block to start simulating from
+	parent := &types.Header{
+		Number:     new(big.Int).SetUint64(ctx.Uint64(simStartNumberFlag.Name)),
+		Time:       genesis.Timestamp,
+		Difficulty: genesis.Difficulty,
+	}
+	if ctx.IsSet(simStartTimeFlag.Name) {
+		parent.Time = ctx.Uint64(simStartTimeFlag.Name)
+	}
+	if ctx.IsSet(simStartDifficultyFlag.Name) {
+		difficulty, ok := new(big.Int).SetString(ctx.String(simStartDifficultyFlag.Name), 0)
+		if !ok {
+			utils.Fatalf("Invalid start difficulty: %s", ctx.String(simStartDifficultyFlag.Name))
+		}
+		parent.Difficulty = difficulty
+	}
+	if parent.Difficulty == nil || parent.Difficulty.Sign() <= 0 {
+		utils.Fatalf("Start difficulty must be positive")
+	}
+	scenarios, err := parseHashrateScenarios(ctx.String(simHashrateFlag.Name))
+	if err != nil {
+		utils.Fatalf("Invalid hashrate scenarios: %v", err)
+	}
+	var rnd *rand.Rand
+	if seed := ctx.Int64(simSeedFlag.Name); seed != 0 {
+		rnd = rand.New(rand.NewSource(seed))
+	}
+	var (
+		blocks   = ctx.Uint64(simBlocksFlag.Name)
+		interval = ctx.Uint64(simIntervalFlag.Name)
+	)
+	out, err := newSampleWriter(os.Stdout, ctx.String(simFormatFlag.Name))
+	if err != nil {
+		utils.Fatalf("%v", err)
+	}
+	for _, scenario := range scenarios {
+		if err := frkhash.SimulateDifficulty(genesis.Config, parent, scenario, blocks, interval, rnd, out.write); err != nil {
+			utils.Fatalf("Simulation failed: %v", err)
+		}
+	}
+	return out.close()
+}
+
+// parseHashrateScenarios parses a comma separated list of hashrate scenarios,
+// each either a constant hashrate or a start:end ramp.
+func parseHashrateScenarios(spec string) ([]frkhash.DifficultyScenario, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, fmt.Errorf("no hashrate given")
+	}
+	var scenarios []frkhash.DifficultyScenario
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		bounds := strings.SplitN(entry, ":", 2)
+
+		start, err := parseHashrate(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = parseHashrate(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		scenarios = append(scenarios, frkhash.DifficultyScenario{Name: entry, Start: start, End: end})
+	}
+	return scenarios, nil
+}
+
+// parseHashrate parses a hashrate in H/s with an optional K, M, G, T or P unit.
+func parseHashrate(value string) (float64, error) {
+	multiplier := 1.0
+	if n := len(value); n > 0 {
+		if exp := strings.IndexByte("KMGTP", value[n-1]); exp >= 0 {
+			for i := 0; i <= exp; i++ {
+				multiplier *= 1000
+			}
+			value = value[:n-1]
+		}
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hashrate %q", value)
+	}
+	if rate <= 0 {
+		return 0, fmt.Errorf("hashrate %q must be positive", value)
+	}
+	return rate * multiplier, nil
+}
+
+// sampleWriter writes difficulty simulation samples in CSV or JSON format.
+type sampleWriter struct {
+	csv *csv.Writer // CSV encoder, nil if writing JSON
+	out io.Writer
+	n   int // Number of JSON samples written
+}
+
+func newSampleWriter(out io.Writer, format string) (*sampleWriter, error) {
+	switch format {
+	case "csv":
+		w := &sampleWriter{csv: csv.NewWriter(out)}
+		return w, w.csv.Write([]string{"scenario", "number", "timestamp", "difficulty", "hashrate", "blocktime", "rules"})
+	case "json":
+		return &sampleWriter{out: out}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+func (w *sampleWriter) write(sample *frkhash.DifficultySample) error {
+	if w.csv != nil {
+		return w.csv.Write([]string{
+			sample.Scenario,
+			strconv.FormatUint(sample.Number, 10),
+			strconv.FormatUint(sample.Time, 10),
+			sample.Difficulty.String(),
+			strconv.FormatFloat(sample.Hashrate, 'g', -1, 64),
+			strconv.FormatFloat(sample.BlockTime, 'f', 3, 64),
+			sample.Rules,
+		})
+	}
+	// Stream the samples as a single JSON array
+	prefix := ",\n"
+	if w.n == 0 {
+		prefix = "[\n"
+	}
+	w.n++
+	if _, err := io.WriteString(w.out, prefix); err != nil {
+		return err
+	}
+	blob, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	_, err = w.out.Write(blob)
+	return err
+}
+
+func (w *sampleWriter) close() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	if w.n == 0 {
+		_, err := io.WriteString(w.out, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(w.out, "\n]\n")
+	return err
+}
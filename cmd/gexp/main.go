@@ -60,6 +60,7 @@ var (
 		utils.BootnodesFlag,
 		utils.DataDirFlag,
 		utils.AncientFlag,
+		utils.DBEngineFlag,
 		utils.MinFreeDiskSpaceFlag,
 		utils.KeyStoreDirFlag,
 		utils.ExternalSignerFlag,
@@ -86,11 +87,16 @@ var (
 		utils.TxPoolAccountQueueFlag,
 		utils.TxPoolGlobalQueueFlag,
 		utils.TxPoolLifetimeFlag,
+		utils.TxPoolPrivateDeadlineFlag,
+		utils.TxPoolPolicyFlag,
 		utils.SyncModeFlag,
 		utils.ExitWhenSyncedFlag,
 		utils.GCModeFlag,
 		utils.SnapshotFlag,
 		utils.TxLookupLimitFlag,
+		utils.ReorgMaxDepthFlag,
+		utils.TransferIndexFlag,
+		utils.HistoryRetainFlag,
 		utils.LightServeFlag,
 		utils.LightIngressFlag,
 		utils.LightEgressFlag,
@@ -124,7 +130,13 @@ var (
 		utils.MinerEtherbaseFlag,
 		utils.MinerExtraDataFlag,
 		utils.MinerRecommitIntervalFlag,
+		utils.MinerStrategyFlag,
 		utils.MinerNoVerfiyFlag,
+		utils.MinerStratumFlag,
+		utils.MinerStratumDifficultyFlag,
+		utils.MinerStratumShareTimeFlag,
+		utils.MinerStratumPasswordFlag,
+		utils.MinerStratumMaxConnsFlag,
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
@@ -176,12 +188,25 @@ var (
 		utils.WSApiFlag,
 		utils.WSAllowedOriginsFlag,
 		utils.WSPathPrefixFlag,
+		utils.AuthJWTSecretFlag,
+		utils.AuthListenFlag,
+		utils.AuthPortFlag,
+		utils.AuthVirtualHostsFlag,
+		utils.AuthApiFlag,
 		utils.IPCDisabledFlag,
 		utils.IPCPathFlag,
 		utils.InsecureUnlockAllowedFlag,
 		utils.RPCGlobalGasCapFlag,
 		utils.RPCGlobalTxFeeCapFlag,
 		utils.AllowUnprotectedTxs,
+		utils.RPCBatchRequestLimitFlag,
+		utils.RPCBatchResponseMaxSizeFlag,
+		utils.RPCRateLimitFlag,
+		utils.RPCRateLimitBurstFlag,
+		utils.RPCMethodRateLimitsFlag,
+		utils.RPCTrustedProxiesFlag,
+		utils.RPCCallTimeoutFlag,
+		utils.RPCMethodTimeoutsFlag,
 	}
 
 	metricsFlags = []cli.Flag{
@@ -238,6 +263,8 @@ func init() {
 		utils.ShowDeprecated,
 		// See snapshot.go
 		snapshotCommand,
+		// See difficultycmd.go
+		difficultyCommand,
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 
@@ -47,6 +47,7 @@ import (
 	"github.com/expanse-org/go-expanse/eth"
 	"github.com/expanse-org/go-expanse/eth/downloader"
 	"github.com/expanse-org/go-expanse/eth/ethconfig"
+	"github.com/expanse-org/go-expanse/eth/filters"
 	"github.com/expanse-org/go-expanse/eth/gasprice"
 	"github.com/expanse-org/go-expanse/eth/tracers"
 	"github.com/expanse-org/go-expanse/ethdb"
@@ -66,6 +67,7 @@ import (
 	"github.com/expanse-org/go-expanse/p2p/nat"
 	"github.com/expanse-org/go-expanse/p2p/netutil"
 	"github.com/expanse-org/go-expanse/params"
+	"github.com/expanse-org/go-expanse/rpc"
 	pcsclite "github.com/gballet/go-libpcsclite"
 	gopsutil "github.com/shirou/gopsutil/mem"
 	"gopkg.in/urfave/cli.v1"
@@ -115,7 +117,12 @@ var (
 	}
 	AncientFlag = DirectoryFlag{
 		Name:  "datadir.ancient",
-		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
+		Usage: "Data directory for ancient chain segments (default = inside chaindata), or a file:// or http(s):// URL of a shared read-only freezer",
+	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Backing database implementation to use for new databases ('leveldb' or 'pebble')",
+		Value: "leveldb",
 	}
 	MinFreeDiskSpaceFlag = DirectoryFlag{
 		Name:  "datadir.minfreedisk",
@@ -226,6 +233,19 @@ var (
 		Usage: "Number of recent blocks to maintain transactions index for (default = about one year, 0 = entire chain)",
 		Value: ethconfig.Defaults.TxLookupLimit,
 	}
+	ReorgMaxDepthFlag = cli.Uint64Flag{
+		Name:  "reorg.maxdepth",
+		Usage: "Maximum number of blocks below head a chain reorganisation may reach (0 = unlimited)",
+		Value: ethconfig.Defaults.ReorgMaxDepth,
+	}
+	TransferIndexFlag = cli.BoolFlag{
+		Name:  "index.transfers",
+		Usage: "Index the internal value transfers of the chain for address history lookups (requires historical state)",
+	}
+	HistoryRetainFlag = cli.Uint64Flag{
+		Name:  "history.retain",
+		Usage: "Number of recent blocks to keep bodies and receipts for, older ones are pruned from the ancient store (0 = entire chain)",
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -379,6 +399,15 @@ var (
 		Usage: "Maximum amount of time non-executable transaction are queued",
 		Value: ethconfig.Defaults.TxPool.Lifetime,
 	}
+	TxPoolPrivateDeadlineFlag = cli.Uint64Flag{
+		Name:  "txpool.privatedeadline",
+		Usage: "Number of blocks after which unmined private transactions are broadcast (0 = never)",
+		Value: ethconfig.Defaults.TxPool.PrivateDeadline,
+	}
+	TxPoolPolicyFlag = cli.StringFlag{
+		Name:  "txpool.policy",
+		Usage: "JSON file with transaction admission policies, reloaded when changed",
+	}
 	// Performance tuning settings
 	CacheFlag = cli.IntFlag{
 		Name:  "cache",
@@ -465,10 +494,35 @@ var (
 		Usage: "Time interval to recreate the block being mined",
 		Value: ethconfig.Defaults.Miner.Recommit,
 	}
+	MinerStrategyFlag = cli.StringFlag{
+		Name:  "miner.strategy",
+		Usage: "Strategy to order the transactions of mined blocks (price, fairshare, ageboost)",
+		Value: "price",
+	}
 	MinerNoVerfiyFlag = cli.BoolFlag{
 		Name:  "miner.noverify",
 		Usage: "Disable remote sealing verification",
 	}
+	MinerStratumFlag = cli.StringFlag{
+		Name:  "miner.stratum",
+		Usage: "Listening address of the stratum mining server (e.g. 0.0.0.0:8008, disabled if empty)",
+	}
+	MinerStratumDifficultyFlag = cli.Uint64Flag{
+		Name:  "miner.stratum.difficulty",
+		Usage: "Initial share difficulty of stratum workers, in hashes (default = 2^32)",
+	}
+	MinerStratumShareTimeFlag = cli.DurationFlag{
+		Name:  "miner.stratum.sharetime",
+		Usage: "Target interval between shares of a stratum worker for difficulty retargeting (default = 10s)",
+	}
+	MinerStratumPasswordFlag = cli.StringFlag{
+		Name:  "miner.stratum.password",
+		Usage: "Password stratum workers have to authorize with (any worker is accepted if empty)",
+	}
+	MinerStratumMaxConnsFlag = cli.IntFlag{
+		Name:  "miner.stratum.maxconnsperip",
+		Usage: "Maximum number of concurrent stratum connections from a single IP address (default = 16)",
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -602,6 +656,31 @@ var (
 		Usage: "HTTP path prefix on which JSON-RPC is served. Use '/' to serve on all paths.",
 		Value: "",
 	}
+	AuthJWTSecretFlag = cli.StringFlag{
+		Name:  "authrpc.jwtsecret",
+		Usage: "Path to a JWT secret to enable the authenticated HTTP and WS-RPC server (generated if missing)",
+		Value: "",
+	}
+	AuthListenFlag = cli.StringFlag{
+		Name:  "authrpc.addr",
+		Usage: "Listening address for the authenticated HTTP and WS-RPC server",
+		Value: node.DefaultAuthHost,
+	}
+	AuthPortFlag = cli.IntFlag{
+		Name:  "authrpc.port",
+		Usage: "Listening port for the authenticated HTTP and WS-RPC server",
+		Value: node.DefaultAuthPort,
+	}
+	AuthVirtualHostsFlag = cli.StringFlag{
+		Name:  "authrpc.vhosts",
+		Usage: "Comma separated list of virtual hostnames from which to accept requests on the authenticated server (server enforced). Accepts '*' wildcard.",
+		Value: strings.Join(node.DefaultConfig.AuthVirtualHosts, ","),
+	}
+	AuthApiFlag = cli.StringFlag{
+		Name:  "authrpc.api",
+		Usage: "API's offered over the authenticated HTTP and WS-RPC server (default = all)",
+		Value: "",
+	}
 	ExecFlag = cli.StringFlag{
 		Name:  "exec",
 		Usage: "Execute JavaScript statement",
@@ -614,6 +693,38 @@ var (
 		Name:  "rpc.allow-unprotected-txs",
 		Usage: "Allow for unprotected (non EIP155 signed) transactions to be submitted via RPC",
 	}
+	RPCBatchRequestLimitFlag = cli.IntFlag{
+		Name:  "rpc.batch-request-limit",
+		Usage: "Maximum number of requests in a HTTP/WS-RPC batch (0 = unlimited)",
+	}
+	RPCBatchResponseMaxSizeFlag = cli.IntFlag{
+		Name:  "rpc.batch-response-max-size",
+		Usage: "Maximum number of bytes returned from a HTTP/WS-RPC batch (0 = unlimited)",
+	}
+	RPCRateLimitFlag = cli.Float64Flag{
+		Name:  "rpc.ratelimit",
+		Usage: "Maximum HTTP/WS-RPC requests per second allowed per remote IP (0 = unlimited)",
+	}
+	RPCRateLimitBurstFlag = cli.IntFlag{
+		Name:  "rpc.ratelimit.burst",
+		Usage: "Maximum HTTP/WS-RPC requests allowed at once per remote IP above the rate limit (0 = one second worth)",
+	}
+	RPCMethodRateLimitsFlag = cli.StringFlag{
+		Name:  "rpc.ratelimit.methods",
+		Usage: "Comma separated HTTP/WS-RPC requests per second allowed per remote IP for single methods (e.g. eth_getLogs=5,eth_call=20)",
+	}
+	RPCTrustedProxiesFlag = cli.StringFlag{
+		Name:  "rpc.trustedproxies",
+		Usage: "Comma separated IPs or CIDR ranges of reverse proxies whose X-Forwarded-For header identifies HTTP/WS-RPC clients for rate limiting",
+	}
+	RPCCallTimeoutFlag = cli.DurationFlag{
+		Name:  "rpc.calltimeout",
+		Usage: "Maximum execution time of a HTTP/WS-RPC method call (0 = unlimited). Up to 64 timed out calls ignoring their cancellation keep running in the background, further ones answer once they return",
+	}
+	RPCMethodTimeoutsFlag = cli.StringFlag{
+		Name:  "rpc.calltimeout.methods",
+		Usage: "Comma separated HTTP/WS-RPC execution timeouts for single methods (e.g. eth_getLogs=10s,debug_traceTransaction=1m)",
+	}
 
 	// Network Settings
 	MaxPeersFlag = cli.IntFlag{
@@ -1019,6 +1130,87 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setAuthRPC creates the authenticated HTTP and WS-RPC server configuration
+// from the set command line flags.
+func setAuthRPC(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(AuthJWTSecretFlag.Name) {
+		cfg.JWTSecret = ctx.GlobalString(AuthJWTSecretFlag.Name)
+	}
+	if ctx.GlobalIsSet(AuthListenFlag.Name) {
+		cfg.AuthAddr = ctx.GlobalString(AuthListenFlag.Name)
+	}
+	if ctx.GlobalIsSet(AuthPortFlag.Name) {
+		cfg.AuthPort = ctx.GlobalInt(AuthPortFlag.Name)
+	}
+	if ctx.GlobalIsSet(AuthVirtualHostsFlag.Name) {
+		cfg.AuthVirtualHosts = SplitAndTrim(ctx.GlobalString(AuthVirtualHostsFlag.Name))
+	}
+	if ctx.GlobalIsSet(AuthApiFlag.Name) {
+		cfg.AuthModules = SplitAndTrim(ctx.GlobalString(AuthApiFlag.Name))
+	}
+}
+
+// setRPCLimits creates the HTTP and WS-RPC resource limits from the set command
+// line flags.
+func setRPCLimits(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCBatchRequestLimitFlag.Name) {
+		cfg.RPCLimits.BatchItems = ctx.GlobalInt(RPCBatchRequestLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCBatchResponseMaxSizeFlag.Name) {
+		cfg.RPCLimits.BatchResponseSize = ctx.GlobalInt(RPCBatchResponseMaxSizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCRateLimitFlag.Name) {
+		cfg.RPCLimits.RequestRate = ctx.GlobalFloat64(RPCRateLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCRateLimitBurstFlag.Name) {
+		cfg.RPCLimits.RequestBurst = ctx.GlobalInt(RPCRateLimitBurstFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCMethodRateLimitsFlag.Name) {
+		cfg.RPCLimits.MethodRates = make(map[string]float64)
+		for method, value := range splitMethodLimits(ctx.GlobalString(RPCMethodRateLimitsFlag.Name)) {
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				Fatalf("Invalid --%s rate for %s: %v", RPCMethodRateLimitsFlag.Name, method, err)
+			}
+			cfg.RPCLimits.MethodRates[method] = rate
+		}
+	}
+	if ctx.GlobalIsSet(RPCTrustedProxiesFlag.Name) {
+		cfg.RPCLimits.TrustedProxies = SplitAndTrim(ctx.GlobalString(RPCTrustedProxiesFlag.Name))
+		for _, proxy := range cfg.RPCLimits.TrustedProxies {
+			if _, err := rpc.ParseTrustedProxy(proxy); err != nil {
+				Fatalf("Invalid --%s entry %q: %v", RPCTrustedProxiesFlag.Name, proxy, err)
+			}
+		}
+	}
+	if ctx.GlobalIsSet(RPCCallTimeoutFlag.Name) {
+		cfg.RPCLimits.CallTimeout = ctx.GlobalDuration(RPCCallTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCMethodTimeoutsFlag.Name) {
+		cfg.RPCLimits.MethodTimeouts = make(map[string]time.Duration)
+		for method, value := range splitMethodLimits(ctx.GlobalString(RPCMethodTimeoutsFlag.Name)) {
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				Fatalf("Invalid --%s timeout for %s: %v", RPCMethodTimeoutsFlag.Name, method, err)
+			}
+			cfg.RPCLimits.MethodTimeouts[method] = timeout
+		}
+	}
+}
+
+// splitMethodLimits splits a comma separated list of method=value pairs.
+func splitMethodLimits(input string) map[string]string {
+	limits := make(map[string]string)
+	for _, entry := range SplitAndTrim(input) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			Fatalf("Invalid method limit %q, want method=value", entry)
+		}
+		limits[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return limits
+}
+
 // setIPC creates an IPC path configuration from the set command line flags,
 // returning an empty string if IPC was explicitly disabled, or the set path.
 func setIPC(ctx *cli.Context, cfg *node.Config) {
@@ -1225,8 +1417,11 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setHTTP(ctx, cfg)
 	setGraphQL(ctx, cfg)
 	setWS(ctx, cfg)
+	setAuthRPC(ctx, cfg)
+	setRPCLimits(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 	setDataDir(ctx, cfg)
+	setDBEngine(ctx, cfg)
 	setSmartCard(ctx, cfg)
 
 	if ctx.GlobalIsSet(ExternalSignerFlag.Name) {
@@ -1273,6 +1468,25 @@ func setSmartCard(ctx *cli.Context, cfg *node.Config) {
 	cfg.SmartCardDaemonPath = path
 }
 
+// setDBEngine configures the database backend used for new databases from the
+// set command line flags.
+func setDBEngine(ctx *cli.Context, cfg *node.Config) {
+	if !ctx.GlobalIsSet(DBEngineFlag.Name) {
+		return
+	}
+	switch engine := ctx.GlobalString(DBEngineFlag.Name); engine {
+	case rawdb.DBLeveldb:
+		cfg.DBEngine = engine
+	case rawdb.DBPebble:
+		if !rawdb.PebbleEnabled {
+			Fatalf("Invalid --%s: pebble is not supported on this platform", DBEngineFlag.Name)
+		}
+		cfg.DBEngine = engine
+	default:
+		Fatalf("Invalid --%s %q, want 'leveldb' or 'pebble'", DBEngineFlag.Name, engine)
+	}
+}
+
 func setDataDir(ctx *cli.Context, cfg *node.Config) {
 	switch {
 	case ctx.GlobalIsSet(DataDirFlag.Name):
@@ -1361,6 +1575,12 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolPrivateDeadlineFlag.Name) {
+		cfg.PrivateDeadline = ctx.GlobalUint64(TxPoolPrivateDeadlineFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolPolicyFlag.Name) {
+		cfg.PolicyFile = ctx.GlobalString(TxPoolPolicyFlag.Name)
+	}
 }
 
 func setEthash(ctx *cli.Context, cfg *ethconfig.Config) {
@@ -1407,9 +1627,27 @@ func setMiner(ctx *cli.Context, cfg *miner.Config) {
 	if ctx.GlobalIsSet(MinerRecommitIntervalFlag.Name) {
 		cfg.Recommit = ctx.GlobalDuration(MinerRecommitIntervalFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerStrategyFlag.Name) {
+		cfg.Strategy = ctx.GlobalString(MinerStrategyFlag.Name)
+	}
 	if ctx.GlobalIsSet(MinerNoVerfiyFlag.Name) {
 		cfg.Noverify = ctx.GlobalBool(MinerNoVerfiyFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerStratumFlag.Name) {
+		cfg.Stratum = ctx.GlobalString(MinerStratumFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerStratumDifficultyFlag.Name) {
+		cfg.StratumDifficulty = ctx.GlobalUint64(MinerStratumDifficultyFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerStratumShareTimeFlag.Name) {
+		cfg.StratumShareTime = ctx.GlobalDuration(MinerStratumShareTimeFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerStratumPasswordFlag.Name) {
+		cfg.StratumPassword = ctx.GlobalString(MinerStratumPasswordFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerStratumMaxConnsFlag.Name) {
+		cfg.StratumMaxConnsPerIP = ctx.GlobalInt(MinerStratumMaxConnsFlag.Name)
+	}
 	if ctx.GlobalIsSet(LegacyMinerGasTargetFlag.Name) {
 		log.Warn("The generic --miner.gastarget flag is deprecated and will be removed in the future!")
 	}
@@ -1556,6 +1794,21 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(ReorgMaxDepthFlag.Name) {
+		cfg.ReorgMaxDepth = ctx.GlobalUint64(ReorgMaxDepthFlag.Name)
+	}
+	if ctx.GlobalIsSet(TransferIndexFlag.Name) {
+		cfg.TransferIndex = ctx.GlobalBool(TransferIndexFlag.Name)
+	}
+	if ctx.GlobalIsSet(HistoryRetainFlag.Name) {
+		cfg.HistoryRetain = ctx.GlobalUint64(HistoryRetainFlag.Name)
+	}
+	// History is only pruned from the ancient store, never retain less than what
+	// is kept in the key-value store anyway
+	if cfg.HistoryRetain != 0 && cfg.HistoryRetain < params.FullImmutabilityThreshold {
+		log.Warn("Sanitizing history retention", "provided", cfg.HistoryRetain, "updated", params.FullImmutabilityThreshold)
+		cfg.HistoryRetain = params.FullImmutabilityThreshold
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -1751,7 +2004,9 @@ func RegisterEthStatsService(stack *node.Node, backend ethapi.Backend, url strin
 
 // RegisterGraphQLService is a utility function to construct a new service and register it against a node.
 func RegisterGraphQLService(stack *node.Node, backend ethapi.Backend, cfg node.Config) {
-	if err := graphql.New(stack, backend, cfg.GraphQLCors, cfg.GraphQLVirtualHosts); err != nil {
+	_, light := backend.(*les.LesApiBackend)
+	events := filters.NewEventSystem(backend, light)
+	if err := graphql.New(stack, backend, events, cfg.GraphQLCors, cfg.GraphQLVirtualHosts); err != nil {
 		Fatalf("Failed to register the GraphQL service: %v", err)
 	}
 }
@@ -17,9 +17,16 @@
 package frkhash
 
 import (
+	"crypto/sha512"
 	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
 
 	"github.com/expanse-org/go-expanse/crypto"
+	"github.com/expanse-org/go-expanse/crypto/blake2b"
+	"github.com/expanse-org/go-expanse/params"
+	"golang.org/x/crypto/sha3"
 )
 
 const (
@@ -36,6 +43,115 @@ const (
 	loopAccesses       = 64      // Number of accesses in hashimoto loop
 )
 
+// DefaultAlgorithm is the seal algorithm used until the first scheduled
+// algorithm fork of a chain.
+const DefaultAlgorithm = "frankomoto"
+
+// Algorithm is a frkhash proof-of-work seal function. It returns the mix digest
+// stored in the block header and the result which has to be below the target
+// derived from the block difficulty for the given seal hash and nonce.
+type Algorithm func(hash []byte, nonce uint64) (digest []byte, result []byte)
+
+var (
+	algorithmsLock sync.RWMutex
+
+	// algorithms is the registry of seal functions selectable by name in the
+	// frkhash algorithm schedule of the chain config.
+	algorithms = map[string]Algorithm{
+		DefaultAlgorithm: frankomoto,
+		"sha3":           sha3moto,
+		"sha512_256":     sha512moto,
+		"blake2b":        blake2bmoto,
+	}
+)
+
+// RegisterAlgorithm adds a seal function to the registry, making it available
+// for scheduling by name. Registering an already existing name fails.
+func RegisterAlgorithm(name string, algo Algorithm) error {
+	algorithmsLock.Lock()
+	defer algorithmsLock.Unlock()
+
+	if _, ok := algorithms[name]; ok {
+		return fmt.Errorf("frkhash algorithm %q already registered", name)
+	}
+	algorithms[name] = algo
+	return nil
+}
+
+// LookupAlgorithm retrieves the seal function registered with the given name.
+func LookupAlgorithm(name string) (Algorithm, bool) {
+	algorithmsLock.RLock()
+	defer algorithmsLock.RUnlock()
+
+	algo, ok := algorithms[name]
+	return algo, ok
+}
+
+// Algorithms returns the sorted names of all registered seal functions.
+func Algorithms() []string {
+	algorithmsLock.RLock()
+	defer algorithmsLock.RUnlock()
+
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateSchedule checks that the algorithm schedule is well ordered and that
+// every scheduled algorithm is registered. It is meant to be run when the chain
+// config is loaded, so misconfigured nodes fail at startup instead of sealing
+// or verifying with the wrong algorithm.
+func ValidateSchedule(config *params.FrkhashConfig) error {
+	if err := config.CheckSchedule(); err != nil {
+		return err
+	}
+	if config == nil {
+		return nil
+	}
+	for _, fork := range config.AlgorithmSchedule {
+		if _, ok := LookupAlgorithm(fork.Algorithm); !ok {
+			return fmt.Errorf("%w %q at block %v", errUnknownAlgorithm, fork.Algorithm, fork.Block)
+		}
+	}
+	return nil
+}
+
+// sealWith builds a seal function from a 64 byte wide and a 32 byte narrow hash.
+// The seal hash and nonce are hashed with the wide function, whose upper half
+// becomes the mix digest, the whole wide hash is then hashed with the narrow
+// function to produce the result.
+func sealWith(wide func([]byte) []byte, narrow func([]byte) []byte) Algorithm {
+	return func(hash []byte, nonce uint64) ([]byte, []byte) {
+		seed := make([]byte, 40)
+		copy(seed, hash)
+		binary.LittleEndian.PutUint64(seed[32:], nonce)
+
+		digest := wide(seed)
+		return digest[32:], narrow(digest)
+	}
+}
+
+var (
+	// sha3moto is the frankomoto construction using the NIST SHA3 hashes.
+	sha3moto = sealWith(
+		func(data []byte) []byte { h := sha3.Sum512(data); return h[:] },
+		func(data []byte) []byte { h := sha3.Sum256(data); return h[:] },
+	)
+	// sha512moto is the frankomoto construction using the SHA-2 hashes.
+	sha512moto = sealWith(
+		func(data []byte) []byte { h := sha512.Sum512(data); return h[:] },
+		func(data []byte) []byte { h := sha512.Sum512_256(data); return h[:] },
+	)
+	// blake2bmoto is the frankomoto construction using the BLAKE2b hashes.
+	blake2bmoto = sealWith(
+		func(data []byte) []byte { h := blake2b.Sum512(data); return h[:] },
+		func(data []byte) []byte { h := blake2b.Sum256(data); return h[:] },
+	)
+)
+
 func frankomoto(hash []byte, nonce uint64) ([]byte, []byte) {
 
 	// Combine header+nonce into a 64 byte seed
@@ -18,9 +18,11 @@ package frkhash
 
 import (
 	"bytes"
+	"math/big"
 	"testing"
 
 	"github.com/expanse-org/go-expanse/common/hexutil"
+	"github.com/expanse-org/go-expanse/params"
 )
 
 // Tests whether the hashimoto lookup works for both light as well as the full
@@ -42,6 +44,66 @@ func TestFrankomoto(t *testing.T) {
 	}
 }
 
+// Tests the seal functions of the algorithm registry against known vectors.
+func TestAlgorithms(t *testing.T) {
+	hash := hexutil.MustDecode("0xc9149cc0386e689d789a1c2f3d5d169a61a6218ed30e74414dc736e442ef3d1f")
+
+	tests := []struct {
+		name   string
+		nonce  uint64
+		digest string
+		result string
+	}{
+		{"frankomoto", 0, "0x5c763662184d57157ef85c4672c3a68acd6fd2e35533f55abaa13c238023b506", "0x74d692675960275b0523dc248bf3d5783f13e6ec2bc045a661dd2641e95ef2e2"},
+		{"sha3", 0, "0x02db7387b9d664742880be96b5a00384745672ed950812bc6d8656934255a14c", "0xde41dbfb84b66751e1bfa9d2996c97be1b947dc67f2705f8c869c2cf8e6f23c5"},
+		{"sha3", 0x1234567890abcdef, "0x1e89bde5d00a39dcd1421cb590f6980836bc1314a65001d5ab85be85c9b02911", "0x7be32ea7799c4399c7fd654fc22d24fbcabf5acbc132fb3771ef925b0c739d68"},
+		{"sha512_256", 0, "0x808176dab606534d3e4e7732633e18f8034721860e86bd950d89ee5b12d009a4", "0xbc9cf73758db7c642d4c61a672512b68bfb5f0f5c23009c53f67a53ed7ab5947"},
+		{"sha512_256", 0x1234567890abcdef, "0x53da19b336fbc57030198a7ba15126add6cdf899b38fafc7451b3000833dd074", "0x86ed35783d11533c781a30af2abd4b39ae0bccb79d6081a60d86ffbea2233844"},
+		{"blake2b", 0, "0x23c2bc0f7a308ec0e414db1dc0028bbb7bba6b2bb1bf1d7604e1a827680cf2f6", "0xac4d2fd57ffdb975310d239902775a6641e607e4005ebaab6254990e5c29bb73"},
+		{"blake2b", 0x1234567890abcdef, "0xc5f0913c1e76f76dad8ee56824ef50df6edf9a91b3d051073daf5f1a6c0fb770", "0x1250b87104322e0bdf9172fb4a7c912b08d59101a188821c288e683ce6048f46"},
+	}
+	for i, tt := range tests {
+		algo, ok := LookupAlgorithm(tt.name)
+		if !ok {
+			t.Fatalf("test %d: algorithm %q not registered", i, tt.name)
+		}
+		digest, result := algo(hash, tt.nonce)
+		if want := hexutil.MustDecode(tt.digest); !bytes.Equal(digest, want) {
+			t.Errorf("test %d: %s digest mismatch: have %x, want %x", i, tt.name, digest, want)
+		}
+		if want := hexutil.MustDecode(tt.result); !bytes.Equal(result, want) {
+			t.Errorf("test %d: %s result mismatch: have %x, want %x", i, tt.name, result, want)
+		}
+	}
+}
+
+// Tests that algorithm schedules are resolved against the registry.
+func TestAlgorithmSchedule(t *testing.T) {
+	if err := RegisterAlgorithm(DefaultAlgorithm, frankomoto); err == nil {
+		t.Errorf("duplicate algorithm registration accepted")
+	}
+	tests := []struct {
+		schedule []params.FrkhashAlgorithmFork
+		fail     bool
+	}{
+		{nil, false},
+		{[]params.FrkhashAlgorithmFork{{Block: big.NewInt(10), Algorithm: "sha3"}, {Block: big.NewInt(20), Algorithm: "blake2b"}}, false},
+		{[]params.FrkhashAlgorithmFork{{Block: big.NewInt(10), Algorithm: "scrypt"}}, true},
+		{[]params.FrkhashAlgorithmFork{{Block: big.NewInt(10), Algorithm: "sha3"}, {Block: big.NewInt(20), Algorithm: "scrypt"}}, true},
+		{[]params.FrkhashAlgorithmFork{{Block: nil, Algorithm: "sha3"}}, true},
+		{[]params.FrkhashAlgorithmFork{{Block: big.NewInt(20), Algorithm: "sha3"}, {Block: big.NewInt(10), Algorithm: "blake2b"}}, true},
+	}
+	for i, tt := range tests {
+		err := ValidateSchedule(&params.FrkhashConfig{AlgorithmSchedule: tt.schedule})
+		if tt.fail && err == nil {
+			t.Errorf("test %d: invalid schedule accepted", i)
+		}
+		if !tt.fail && err != nil {
+			t.Errorf("test %d: valid schedule rejected: %v", i, err)
+		}
+	}
+}
+
 // Benchmarks the light verification performance.
 func BenchmarkFrankomoto(b *testing.B) {
 	hash := hexutil.MustDecode("0xc9149cc0386e689d789a1c2f3d5d169a61a6218ed30e74414dc736e442ef3d1f")
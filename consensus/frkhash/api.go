@@ -18,10 +18,13 @@ package frkhash
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/expanse-org/go-expanse/common"
 	"github.com/expanse-org/go-expanse/common/hexutil"
+	"github.com/expanse-org/go-expanse/consensus"
 	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/rpc"
 )
 
 var errEthashStopped = errors.New("frkhash stopped")
@@ -29,6 +32,7 @@ var errEthashStopped = errors.New("frkhash stopped")
 // API exposes frkhash related methods for the RPC interface.
 type API struct {
 	frkhash *Frkhash
+	chain   consensus.ChainHeaderReader
 }
 
 // GetWork returns a work package for external miner.
@@ -67,20 +71,7 @@ func (api *API) SubmitWork(nonce types.BlockNonce, hash, digest common.Hash) boo
 	if api.frkhash.remote == nil {
 		return false
 	}
-
-	var errc = make(chan error, 1)
-	select {
-	case api.frkhash.remote.submitWorkCh <- &mineResult{
-		nonce:     nonce,
-		mixDigest: digest,
-		hash:      hash,
-		errc:      errc,
-	}:
-	case <-api.frkhash.remote.exitCh:
-		return false
-	}
-	err := <-errc
-	return err == nil
+	return api.frkhash.remote.submit(nonce, digest, hash)
 }
 
 // SubmitHashrate can be used for remote miners to submit their hash rate.
@@ -106,7 +97,183 @@ func (api *API) SubmitHashrate(rate hexutil.Uint64, id common.Hash) bool {
 	return true
 }
 
+// GetShareWork returns a work package for the given external worker, with the
+// boundary condition (result[2]) set to the worker's share target instead of the
+// block target.
+func (api *API) GetShareWork(worker string) ([4]string, error) {
+	if api.frkhash.remote == nil {
+		return [4]string{}, errors.New("not supported")
+	}
+	if worker == "" {
+		return [4]string{}, errors.New("worker name required")
+	}
+	var (
+		workCh = make(chan [4]string, 1)
+		errc   = make(chan error, 1)
+	)
+	select {
+	case api.frkhash.remote.fetchWorkCh <- &sealWork{worker: worker, errc: errc, res: workCh}:
+	case <-api.frkhash.remote.exitCh:
+		return [4]string{}, errEthashStopped
+	}
+	select {
+	case work := <-workCh:
+		return work, nil
+	case err := <-errc:
+		return [4]string{}, err
+	}
+}
+
+// SubmitShare can be used by external workers to submit a share mined on a work
+// package obtained via GetShareWork. Shares meeting the block target are sealed
+// into blocks. It returns an indication if the share was accepted.
+func (api *API) SubmitShare(nonce types.BlockNonce, hash common.Hash, worker string) bool {
+	if api.frkhash.remote == nil || worker == "" {
+		return false
+	}
+	return api.frkhash.remote.shareSubmit(worker, nonce, hash, 0).err == nil
+}
+
+// GetWorkers returns the share accounting and the estimated effective hashrate
+// of the external workers, including the ones connected over stratum.
+func (api *API) GetWorkers() ([]WorkerStats, error) {
+	if api.frkhash.remote == nil {
+		return nil, errors.New("not supported")
+	}
+	var res = make(chan []WorkerStats, 1)
+	select {
+	case api.frkhash.remote.fetchWorkersCh <- res:
+	case <-api.frkhash.remote.exitCh:
+		return nil, errEthashStopped
+	}
+	return <-res, nil
+}
+
+// GetStratumSessions returns the share accounting of the miners connected to the
+// stratum server.
+func (api *API) GetStratumSessions() ([]StratumSession, error) {
+	if api.frkhash.remote == nil || api.frkhash.remote.stratum == nil {
+		return nil, errors.New("stratum server not running")
+	}
+	return api.frkhash.remote.stratum.Sessions(), nil
+}
+
 // GetHashrate returns the current hashrate for local CPU miner and remote miner.
 func (api *API) GetHashrate() uint64 {
 	return uint64(api.frkhash.Hashrate())
 }
+
+// EthAPI exposes the original remote mining methods of the frkhash API under the
+// eth namespace for backward compatibility. The share, stratum and reward methods
+// are only available under the frkhash namespace.
+type EthAPI struct {
+	api *API
+}
+
+// GetWork returns a work package for external miner.
+func (api *EthAPI) GetWork() ([4]string, error) {
+	return api.api.GetWork()
+}
+
+// SubmitWork can be used by external miner to submit their POW solution.
+func (api *EthAPI) SubmitWork(nonce types.BlockNonce, hash, digest common.Hash) bool {
+	return api.api.SubmitWork(nonce, hash, digest)
+}
+
+// SubmitHashrate can be used for remote miners to submit their hash rate.
+func (api *EthAPI) SubmitHashrate(rate hexutil.Uint64, id common.Hash) bool {
+	return api.api.SubmitHashrate(rate, id)
+}
+
+// GetHashrate returns the current hashrate for local CPU miner and remote miner.
+func (api *EthAPI) GetHashrate() uint64 {
+	return api.api.GetHashrate()
+}
+
+// UncleReward is the reward paid to the coinbase of an included uncle.
+type UncleReward struct {
+	Hash     common.Hash    `json:"hash"`
+	Number   *hexutil.Big   `json:"number"`
+	Coinbase common.Address `json:"coinbase"`
+	Reward   *hexutil.Big   `json:"reward"`
+}
+
+// BlockReward is the breakdown of the rewards paid out for mining a block.
+type BlockReward struct {
+	Hash           common.Hash     `json:"hash"`
+	Number         *hexutil.Big    `json:"number"`
+	BlockReward    *hexutil.Big    `json:"blockReward"`
+	Miner          common.Address  `json:"miner"`
+	MinerReward    *hexutil.Big    `json:"minerReward"`
+	Uncles         []UncleReward   `json:"uncles"`
+	Treasury       *common.Address `json:"treasury,omitempty"`
+	TreasuryReward *hexutil.Big    `json:"treasuryReward"`
+}
+
+// GetBlockReward returns the breakdown of the rewards paid out for mining the
+// canonical block with the given number.
+func (api *API) GetBlockReward(number rpc.BlockNumber) (*BlockReward, error) {
+	reader, ok := api.chain.(consensus.ChainReader)
+	if !ok {
+		return nil, errors.New("not supported")
+	}
+	var header *types.Header
+	switch number {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
+		header = reader.CurrentHeader()
+	default:
+		header = reader.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	block := reader.GetBlock(header.Hash(), header.Number.Uint64())
+	if block == nil {
+		return nil, fmt.Errorf("block %x not found", header.Hash())
+	}
+	var (
+		uncles  = block.Uncles()
+		rewards = CalcRewards(reader.Config(), header, uncles)
+	)
+	result := &BlockReward{
+		Hash:           header.Hash(),
+		Number:         (*hexutil.Big)(header.Number),
+		BlockReward:    (*hexutil.Big)(rewards.Block),
+		Miner:          header.Coinbase,
+		MinerReward:    (*hexutil.Big)(rewards.Miner),
+		Uncles:         make([]UncleReward, len(uncles)),
+		Treasury:       rewards.Fund,
+		TreasuryReward: (*hexutil.Big)(rewards.Treasury),
+	}
+	for i, uncle := range uncles {
+		result.Uncles[i] = UncleReward{
+			Hash:     uncle.Hash(),
+			Number:   (*hexutil.Big)(uncle.Number),
+			Coinbase: uncle.Coinbase,
+			Reward:   (*hexutil.Big)(rewards.Uncles[i]),
+		}
+	}
+	return result, nil
+}
+
+// PrivateMinerAPI exposes the frkhash remote sealer settings reserved to the
+// node operator.
+type PrivateMinerAPI struct {
+	frkhash *Frkhash
+}
+
+// SetWorkerDifficulty assigns the share difficulty of an external worker, used
+// for the work packages and shares of GetShareWork and SubmitShare.
+func (api *PrivateMinerAPI) SetWorkerDifficulty(worker string, difficulty hexutil.Uint64) bool {
+	if api.frkhash.remote == nil || worker == "" || difficulty == 0 {
+		return false
+	}
+	var done = make(chan struct{})
+	select {
+	case api.frkhash.remote.setDifficultyCh <- &workerDifficulty{worker: worker, difficulty: uint64(difficulty), done: done}:
+	case <-api.frkhash.remote.exitCh:
+		return false
+	}
+	<-done
+	return true
+}
@@ -78,6 +78,7 @@ var (
 	errInvalidDifficulty = errors.New("non-positive difficulty")
 	errInvalidMixDigest  = errors.New("invalid mix digest")
 	errInvalidPoW        = errors.New("invalid proof-of-work")
+	errUnknownAlgorithm  = errors.New("unknown frkhash algorithm")
 )
 
 // Author implements consensus.Engine, returning the header's coinbase as the
@@ -322,20 +323,33 @@ func (frkhash *Frkhash) CalcDifficulty(chain consensus.ChainHeaderReader, time u
 // the difficulty that a new block should have when created at time
 // given the parent block's time and difficulty.
 func CalcDifficulty(config *params.ChainConfig, time uint64, parent *types.Header) *big.Int {
-	next := new(big.Int).Add(parent.Number, big1)
+	_, calculator := difficultyCalculator(config, new(big.Int).Add(parent.Number, big1))
+	return calculator(time, parent)
+}
+
+// DifficultyRules returns the name of the difficulty adjustment rules in effect
+// at the given block number.
+func DifficultyRules(config *params.ChainConfig, number *big.Int) string {
+	name, _ := difficultyCalculator(config, number)
+	return name
+}
+
+// difficultyCalculator returns the difficulty adjustment algorithm in effect at
+// the given block number, along with the name of its rule set.
+func difficultyCalculator(config *params.ChainConfig, number *big.Int) (string, func(uint64, *types.Header) *big.Int) {
 	switch {
-	case config.IsCatalyst(next):
-		return big.NewInt(1)
-	case config.IsMuirGlacier(next):
-		return calcDifficultyConstantinople(time, parent)
-	case config.IsConstantinople(next):
-		return calcDifficultyConstantinople(time, parent)
-	case config.IsByzantium(next):
-		return calcDifficultyByzantium(time, parent)
-	case config.IsHomestead(next):
-		return calcDifficultyHomestead(time, parent)
+	case config.IsCatalyst(number):
+		return "catalyst", func(uint64, *types.Header) *big.Int { return big.NewInt(1) }
+	case config.IsMuirGlacier(number):
+		return "muirglacier", calcDifficultyConstantinople
+	case config.IsConstantinople(number):
+		return "constantinople", calcDifficultyConstantinople
+	case config.IsByzantium(number):
+		return "byzantium", calcDifficultyByzantium
+	case config.IsHomestead(number):
+		return "homestead", calcDifficultyHomestead
 	default:
-		return calcDifficultyFrontier(time, parent)
+		return "frontier", calcDifficultyFrontier
 	}
 }
 
@@ -535,10 +549,6 @@ func (frkhash *Frkhash) verifySeal(chain consensus.ChainHeaderReader, header *ty
 		}
 		return nil
 	}
-	// If we're running a shared PoW, delegate verification to it
-	if frkhash.shared != nil {
-		return frkhash.shared.verifySeal(chain, header, fulldag)
-	}
 	// Ensure that we have a valid difficulty for the block
 	if header.Difficulty.Sign() <= 0 {
 		return errInvalidDifficulty
@@ -549,7 +559,11 @@ func (frkhash *Frkhash) verifySeal(chain consensus.ChainHeaderReader, header *ty
 		result []byte
 	)
 
-	digest, result = frankomoto(frkhash.SealHash(header).Bytes(), header.Nonce.Uint64())
+	algo, err := frkhash.algorithm(header.Number.Uint64())
+	if err != nil {
+		return err
+	}
+	digest, result = algo(frkhash.SealHash(header).Bytes(), header.Nonce.Uint64())
 
 	// Verify the calculated values against the ones provided in the header
 	// Mix Digest == Last 32 Bytes of the keccak512 64byte hash.
@@ -621,39 +635,109 @@ func (frkhash *Frkhash) SealHash(header *types.Header) (hash common.Hash) {
 
 // Some weird constants to avoid constant memory allocs for them.
 var (
-	big8  = big.NewInt(8)
-	big32 = big.NewInt(32)
+	big8   = big.NewInt(8)
+	big32  = big.NewInt(32)
+	big100 = big.NewInt(100)
 )
 
+// Rewards is the breakdown of the rewards paid out for mining a block.
+type Rewards struct {
+	Block    *big.Int        // Base block reward in effect at the block
+	Miner    *big.Int        // Total reward of the block coinbase, including uncle inclusion rewards
+	Uncles   []*big.Int      // Rewards of the included uncles' coinbases, in inclusion order
+	Treasury *big.Int        // Share of the block reward paid to the treasury
+	Fund     *common.Address // Treasury address, nil if no treasury is configured
+}
+
+// blockReward returns the base block reward and the reward rules scheduled at
+// the given block. The rules are nil if the protocol rewards are in effect.
+func blockReward(config *params.ChainConfig, number *big.Int) (*big.Int, *params.FrkhashRewardFork) {
+	if rules := config.Frkhash.Reward(number); rules != nil {
+		reward := new(big.Int).Set(rules.BlockReward)
+		if rules.EraLength > 0 && rules.EraReductionPercent > 0 {
+			// Reduce the reward era by era, truncating in each step. Stop as
+			// soon as the reward is depleted to avoid spinning on far eras.
+			era := new(big.Int).Sub(number, rules.Block).Uint64() / rules.EraLength
+			keep := new(big.Int).SetUint64(100 - rules.EraReductionPercent)
+			for i := uint64(0); i < era && reward.Sign() > 0; i++ {
+				reward.Mul(reward, keep)
+				reward.Div(reward, big100)
+			}
+		}
+		return reward, rules
+	}
+	// Select the correct block reward based on chain progression
+	reward := FrontierBlockReward
+	if config.IsByzantium(number) {
+		reward = ByzantiumBlockReward
+	}
+	if config.IsConstantinople(number) {
+		reward = ConstantinopleBlockReward
+	}
+	return new(big.Int).Set(reward), nil
+}
+
+// CalcRewards computes the rewards paid out for mining the given block with the
+// given uncles. The uncle rewards are scaled by their distance from the block,
+// the miner receives the block reward less the treasury share, and an extra
+// 1/32 of the block reward for each included uncle.
+func CalcRewards(config *params.ChainConfig, header *types.Header, uncles []*types.Header) *Rewards {
+	rewards := &Rewards{
+		Block:    new(big.Int),
+		Miner:    new(big.Int),
+		Uncles:   make([]*big.Int, len(uncles)),
+		Treasury: new(big.Int),
+	}
+	// Skip block reward in catalyst mode
+	if config.IsCatalyst(header.Number) {
+		for i := range uncles {
+			rewards.Uncles[i] = new(big.Int)
+		}
+		return rewards
+	}
+	reward, rules := blockReward(config, header.Number)
+	rewards.Block = reward
+
+	divisor := big8
+	if rules != nil {
+		if rules.UncleRewardDivisor > 0 {
+			divisor = new(big.Int).SetUint64(rules.UncleRewardDivisor)
+		}
+		if rules.TreasuryPercent > 0 {
+			rewards.Treasury.Mul(reward, new(big.Int).SetUint64(rules.TreasuryPercent))
+			rewards.Treasury.Div(rewards.Treasury, big100)
+			rewards.Fund = rules.TreasuryAddress
+		}
+	}
+	// Accumulate the rewards for the miner and any included uncles
+	rewards.Miner.Sub(reward, rewards.Treasury)
+	for i, uncle := range uncles {
+		r := new(big.Int).Add(uncle.Number, big8)
+		r.Sub(r, header.Number)
+		r.Mul(r, reward)
+		r.Div(r, divisor)
+		rewards.Uncles[i] = r
+
+		rewards.Miner.Add(rewards.Miner, new(big.Int).Div(reward, big32))
+	}
+	return rewards
+}
+
 // AccumulateRewards credits the coinbase of the given block with the mining
 // reward. The total reward consists of the static block reward and rewards for
-// included uncles. The coinbase of each uncle block is also rewarded.
+// included uncles. The coinbase of each uncle block is also rewarded, as is the
+// treasury if the reward schedule configures one.
 func accumulateRewards(config *params.ChainConfig, state *state.StateDB, header *types.Header, uncles []*types.Header) {
 	// Skip block reward in catalyst mode
 	if config.IsCatalyst(header.Number) {
 		return
 	}
-	// Select the correct block reward based on chain progression
-	// common.HexToAddress("0x93decab0cd745598860f782ac1e8f046cb99e898")
-	blockReward := FrontierBlockReward
-	if config.IsByzantium(header.Number) {
-		blockReward = ByzantiumBlockReward
+	rewards := CalcRewards(config, header, uncles)
+	for i, uncle := range uncles {
+		state.AddBalance(uncle.Coinbase, rewards.Uncles[i])
 	}
-	if config.IsConstantinople(header.Number) {
-		blockReward = ConstantinopleBlockReward
-	}
-	// Accumulate the rewards for the miner and any included uncles
-	reward := new(big.Int).Set(blockReward)
-	r := new(big.Int)
-	for _, uncle := range uncles {
-		r.Add(uncle.Number, big8)
-		r.Sub(r, header.Number)
-		r.Mul(r, blockReward)
-		r.Div(r, big8)
-		state.AddBalance(uncle.Coinbase, r)
-
-		r.Div(blockReward, big32)
-		reward.Add(reward, r)
+	if rewards.Fund != nil && rewards.Treasury.Sign() > 0 {
+		state.AddBalance(*rewards.Fund, rewards.Treasury)
 	}
-	state.AddBalance(header.Coinbase, reward)
+	state.AddBalance(header.Coinbase, rewards.Miner)
 }
@@ -25,6 +25,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/expanse-org/go-expanse/common"
 	"github.com/expanse-org/go-expanse/common/math"
 	"github.com/expanse-org/go-expanse/core/types"
 	"github.com/expanse-org/go-expanse/params"
@@ -96,3 +97,71 @@ func randSlice(min, max uint32) []byte {
 	rand.Read(out)
 	return out
 }
+
+// Tests the block reward breakdown against the protocol defaults and the
+// configurable reward schedule.
+func TestCalcRewards(t *testing.T) {
+	var (
+		treasury = common.Address{0xfe}
+		ether    = big.NewInt(1e18)
+	)
+	protocol := &params.ChainConfig{ByzantiumBlock: big.NewInt(100)}
+	scheduled := &params.ChainConfig{ByzantiumBlock: big.NewInt(0), Frkhash: &params.FrkhashConfig{
+		RewardSchedule: []params.FrkhashRewardFork{
+			{Block: big.NewInt(1000), BlockReward: new(big.Int).Mul(big.NewInt(10), ether), UncleRewardDivisor: 16},
+			{Block: big.NewInt(2000), BlockReward: new(big.Int).Mul(big.NewInt(10), ether),
+				TreasuryAddress: &treasury, TreasuryPercent: 20, EraLength: 100, EraReductionPercent: 50},
+		},
+	}}
+	gwei := func(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e9)) }
+
+	tests := []struct {
+		config   *params.ChainConfig
+		number   int64
+		uncles   []int64
+		block    *big.Int
+		miner    *big.Int
+		rewards  []*big.Int
+		treasury *big.Int
+	}{
+		// Protocol rewards without a schedule
+		{protocol, 10, nil, gwei(8e9), gwei(8e9), nil, new(big.Int)},
+		{protocol, 100, []int64{99}, gwei(4e9), gwei(4125e6), []*big.Int{gwei(35e8)}, new(big.Int)},
+		// Protocol rewards until the first scheduled fork
+		{scheduled, 999, []int64{997}, gwei(4e9), gwei(4125e6), []*big.Int{gwei(3e9)}, new(big.Int)},
+		// Scheduled reward with a custom uncle divisor
+		{scheduled, 1000, []int64{999}, gwei(10e9), gwei(103125e5), []*big.Int{gwei(4375e6)}, new(big.Int)},
+		// Treasury share deducted from the miner, halving every era
+		{scheduled, 2000, nil, gwei(10e9), gwei(8e9), nil, gwei(2e9)},
+		{scheduled, 2099, nil, gwei(10e9), gwei(8e9), nil, gwei(2e9)},
+		{scheduled, 2100, nil, gwei(5e9), gwei(4e9), nil, gwei(1e9)},
+		{scheduled, 2250, []int64{2249}, gwei(25e8), gwei(2078125e3), []*big.Int{gwei(21875e5)}, gwei(5e8)},
+		// Reward depleted in far eras
+		{scheduled, 100000, nil, new(big.Int), new(big.Int), nil, new(big.Int)},
+	}
+	for i, tt := range tests {
+		header := &types.Header{Number: big.NewInt(tt.number)}
+		var uncles []*types.Header
+		for _, number := range tt.uncles {
+			uncles = append(uncles, &types.Header{Number: big.NewInt(number)})
+		}
+		rewards := CalcRewards(tt.config, header, uncles)
+		if rewards.Block.Cmp(tt.block) != 0 {
+			t.Errorf("test %d: block reward mismatch: have %v, want %v", i, rewards.Block, tt.block)
+		}
+		if rewards.Miner.Cmp(tt.miner) != 0 {
+			t.Errorf("test %d: miner reward mismatch: have %v, want %v", i, rewards.Miner, tt.miner)
+		}
+		if rewards.Treasury.Cmp(tt.treasury) != 0 {
+			t.Errorf("test %d: treasury reward mismatch: have %v, want %v", i, rewards.Treasury, tt.treasury)
+		}
+		if tt.treasury.Sign() > 0 && (rewards.Fund == nil || *rewards.Fund != treasury) {
+			t.Errorf("test %d: treasury address mismatch: have %v, want %v", i, rewards.Fund, treasury)
+		}
+		for j, want := range tt.rewards {
+			if rewards.Uncles[j].Cmp(want) != 0 {
+				t.Errorf("test %d: uncle %d reward mismatch: have %v, want %v", i, j, rewards.Uncles[j], want)
+			}
+		}
+	}
+}
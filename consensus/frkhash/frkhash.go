@@ -19,6 +19,7 @@ package frkhash
 
 import (
 	"errors"
+	"fmt"
 	"math/big"
 	"math/rand"
 	"sync"
@@ -29,6 +30,7 @@ import (
 	"github.com/expanse-org/go-expanse/consensus/ethash"
 	"github.com/expanse-org/go-expanse/log"
 	"github.com/expanse-org/go-expanse/metrics"
+	"github.com/expanse-org/go-expanse/params"
 	"github.com/expanse-org/go-expanse/rpc"
 )
 
@@ -72,6 +74,14 @@ type Config struct {
 	// be block header JSON objects instead of work package arrays.
 	NotifyFull bool
 
+	// Schedule is the seal algorithm fork schedule of the chain. If nil, the
+	// default algorithm is used for every block.
+	Schedule *params.FrkhashConfig `toml:"-"`
+
+	// Stratum configures the stratum server serving the remote sealer's work
+	// to miners over TCP. The server is only started if an address is set.
+	Stratum StratumConfig `toml:"-"`
+
 	Log log.Logger `toml:"-"`
 }
 
@@ -103,7 +113,6 @@ func New(config Config, notify []string, noverify bool) *Frkhash {
 	if config.Log == nil {
 		config.Log = log.Root()
 	}
-
 	frkhash := &Frkhash{
 		config:   config,
 		update:   make(chan struct{}),
@@ -172,9 +181,32 @@ func NewFullFaker() *Frkhash {
 }
 
 // NewShared creates a full sized frkhash PoW shared between all requesters running
-// in the same process.
-func NewShared() *Frkhash {
-	return &Frkhash{shared: sharedFrkhash}
+// in the same process, sealing and verifying with the given algorithm schedule.
+func NewShared(schedule *params.FrkhashConfig) *Frkhash {
+	return &Frkhash{
+		config: Config{
+			PowMode:  ModeShared,
+			Schedule: schedule,
+			Log:      log.Root(),
+		},
+		shared: sharedFrkhash,
+	}
+}
+
+// algorithm returns the seal function scheduled for the given block number. It
+// is the single place the schedule is looked up, both for sealing and for
+// verification. A shared PoW doesn't know about the chain being sealed, so the
+// algorithm is always resolved from the local engine's schedule.
+func (frkhash *Frkhash) algorithm(number uint64) (Algorithm, error) {
+	name := frkhash.config.Schedule.Algorithm(new(big.Int).SetUint64(number))
+	if name == "" {
+		name = DefaultAlgorithm
+	}
+	algo, ok := LookupAlgorithm(name)
+	if !ok {
+		return nil, fmt.Errorf("%w %q at block %d", errUnknownAlgorithm, name, number)
+	}
+	return algo, nil
 }
 
 // Close closes the exit channel to notify all backend threads exiting.
@@ -246,19 +278,25 @@ func (frkhash *Frkhash) Hashrate() float64 {
 // APIs implements consensus.Engine, returning the user facing RPC APIs.
 func (frkhash *Frkhash) APIs(chain consensus.ChainHeaderReader) []rpc.API {
 	// In order to ensure backward compatibility, we exposes frkhash RPC APIs
-	// to both eth and frkhash namespaces.
+	// to both eth and frkhash namespaces. The eth namespace only carries the
+	// original remote mining methods.
 	return []rpc.API{
 		{
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   &API{frkhash},
+			Service:   &EthAPI{&API{frkhash, chain}},
 			Public:    true,
 		},
 		{
 			Namespace: "frkhash",
 			Version:   "1.0",
-			Service:   &API{frkhash},
+			Service:   &API{frkhash, chain},
 			Public:    true,
 		},
+		{
+			Namespace: "miner",
+			Version:   "1.0",
+			Service:   &PrivateMinerAPI{frkhash},
+		},
 	}
 }
@@ -17,6 +17,8 @@
 package frkhash
 
 import (
+	"bytes"
+	"errors"
 	"math/big"
 	"math/rand"
 	"sync"
@@ -26,6 +28,8 @@ import (
 	"github.com/expanse-org/go-expanse/common"
 	"github.com/expanse-org/go-expanse/common/hexutil"
 	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/params"
+	"github.com/expanse-org/go-expanse/rpc"
 )
 
 // Tests that frkhash works correctly in test mode.
@@ -52,6 +56,72 @@ func TestFrkhashTestMode(t *testing.T) {
 	}
 }
 
+// Tests that blocks are sealed and verified with the algorithm scheduled for
+// their number.
+func TestFrkhashAlgorithmSchedule(t *testing.T) {
+	schedule := &params.FrkhashConfig{AlgorithmSchedule: []params.FrkhashAlgorithmFork{
+		{Block: big.NewInt(2), Algorithm: "blake2b"},
+	}}
+	frkhash := New(Config{PowMode: ModeTest, Schedule: schedule}, nil, false)
+	defer frkhash.Close()
+
+	for _, number := range []int64{1, 2, 3} {
+		header := &types.Header{Number: big.NewInt(number), Difficulty: big.NewInt(100)}
+
+		results := make(chan *types.Block)
+		if err := frkhash.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+			t.Fatalf("block %d: failed to seal block: %v", number, err)
+		}
+		select {
+		case block := <-results:
+			header.Nonce = types.EncodeNonce(block.Nonce())
+			header.MixDigest = block.MixDigest()
+		case <-time.NewTimer(4 * time.Second).C:
+			t.Fatalf("block %d: sealing result timeout", number)
+		}
+		if err := frkhash.verifySeal(nil, header, false); err != nil {
+			t.Fatalf("block %d: unexpected verification error: %v", number, err)
+		}
+		algo, err := frkhash.algorithm(uint64(number))
+		if err != nil {
+			t.Fatalf("block %d: failed to resolve algorithm: %v", number, err)
+		}
+		digest, _ := algo(frkhash.SealHash(header).Bytes(), header.Nonce.Uint64())
+		want, _ := frankomoto(frkhash.SealHash(header).Bytes(), header.Nonce.Uint64())
+		if scheduled := number >= 2; scheduled == bytes.Equal(digest, want) {
+			t.Errorf("block %d: sealed with wrong algorithm", number)
+		}
+	}
+}
+
+// Tests that shared engines seal with their own algorithm schedule, and that an
+// unknown algorithm is reported as an error instead of taking the node down.
+func TestFrkhashSharedSchedule(t *testing.T) {
+	shared := NewShared(&params.FrkhashConfig{AlgorithmSchedule: []params.FrkhashAlgorithmFork{
+		{Block: big.NewInt(2), Algorithm: "blake2b"},
+	}})
+	algo, err := shared.algorithm(2)
+	if err != nil {
+		t.Fatalf("failed to resolve algorithm: %v", err)
+	}
+	blake2b, _ := LookupAlgorithm("blake2b")
+
+	have, _ := algo(make([]byte, 32), 0)
+	want, _ := blake2b(make([]byte, 32), 0)
+	if !bytes.Equal(have, want) {
+		t.Errorf("shared engine ignored the algorithm schedule")
+	}
+	broken := NewFaker()
+	broken.config.PowMode = ModeNormal
+	broken.config.Schedule = &params.FrkhashConfig{AlgorithmSchedule: []params.FrkhashAlgorithmFork{
+		{Block: big.NewInt(1), Algorithm: "scrypt"},
+	}}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+	if err := broken.verifySeal(nil, header, false); !errors.Is(err, errUnknownAlgorithm) {
+		t.Errorf("verification error mismatch: have %v, want %v", err, errUnknownAlgorithm)
+	}
+}
+
 func verifyFrkhashTest(wg *sync.WaitGroup, e *Frkhash, workerIndex, epochs int) {
 	defer wg.Done()
 
@@ -71,7 +141,7 @@ func TestFrkhashRemoteSealer(t *testing.T) {
 	frkhash := NewTester(nil, false)
 	defer frkhash.Close()
 
-	api := &API{frkhash}
+	api := &API{frkhash: frkhash}
 	if _, err := api.GetWork(); err != errNoMiningWork {
 		t.Error("expect to return an error indicate there is no mining work")
 	}
@@ -118,7 +188,7 @@ func TestFrkhashHashrate(t *testing.T) {
 		t.Error("expect the result should be zero")
 	}
 
-	api := &API{frkhash}
+	api := &API{frkhash: frkhash}
 	for i := 0; i < len(hashrate); i += 1 {
 		if res := api.SubmitHashrate(hashrate[i], ids[i]); !res {
 			t.Error("remote miner submit hashrate failed")
@@ -135,7 +205,7 @@ func TestFrkhashClosedRemoteSealer(t *testing.T) {
 	time.Sleep(1 * time.Second) // ensure exit channel is listening
 	frkhash.Close()
 
-	api := &API{frkhash}
+	api := &API{frkhash: frkhash}
 	if _, err := api.GetWork(); err != errEthashStopped {
 		t.Error("expect to return an error to indicate frkhash is stopped")
 	}
@@ -144,3 +214,38 @@ func TestFrkhashClosedRemoteSealer(t *testing.T) {
 		t.Error("expect to return false when submit hashrate to a stopped frkhash")
 	}
 }
+
+// Tests that the share, stratum and reward methods are only served under the
+// frkhash namespace, leaving the eth namespace with the original methods.
+func TestFrkhashAPINamespaces(t *testing.T) {
+	frkhash := NewTester(nil, false)
+	defer frkhash.Close()
+
+	server := rpc.NewServer()
+	defer server.Stop()
+	for _, api := range frkhash.APIs(nil) {
+		if err := server.RegisterName(api.Namespace, api.Service); err != nil {
+			t.Fatalf("failed to register %s API: %v", api.Namespace, err)
+		}
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	for _, method := range []string{"getHashrate", "getWorkers"} {
+		var res interface{}
+		if err := client.Call(&res, "frkhash_"+method); err != nil {
+			t.Errorf("frkhash_%s failed: %v", method, err)
+		}
+	}
+	var hashrate uint64
+	if err := client.Call(&hashrate, "eth_getHashrate"); err != nil {
+		t.Errorf("eth_getHashrate failed: %v", err)
+	}
+	for _, method := range []string{"getShareWork", "submitShare", "getWorkers", "getStratumSessions", "getBlockReward"} {
+		var res interface{}
+		err := client.Call(&res, "eth_"+method)
+		if rpcErr, ok := err.(rpc.Error); !ok || rpcErr.ErrorCode() != -32601 {
+			t.Errorf("eth_%s: expected method not found, got %v", method, err)
+		}
+	}
+}
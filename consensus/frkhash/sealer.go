@@ -60,10 +60,21 @@ func (frkhash *Frkhash) Seal(chain consensus.ChainHeaderReader, block *types.Blo
 		}
 		return nil
 	}
+	algo, err := frkhash.algorithm(block.NumberU64())
+	if err != nil {
+		return err
+	}
+
 	// If we're running a shared PoW, delegate sealing to it
 	if frkhash.shared != nil {
-		return frkhash.shared.Seal(chain, block, results, stop)
+		return frkhash.shared.seal(chain, block, algo, results, stop)
 	}
+	return frkhash.seal(chain, block, algo, results, stop)
+}
+
+// seal starts the local search threads and pushes the work to the remote sealer,
+// using the given algorithm to seal the block.
+func (frkhash *Frkhash) seal(chain consensus.ChainHeaderReader, block *types.Block, algo Algorithm, results chan<- *types.Block, stop <-chan struct{}) error {
 	// Create a runner and the multiple search threads it directs
 	abort := make(chan struct{})
 
@@ -96,7 +107,7 @@ func (frkhash *Frkhash) Seal(chain consensus.ChainHeaderReader, block *types.Blo
 		pend.Add(1)
 		go func(id int, nonce uint64) {
 			defer pend.Done()
-			frkhash.mine(block, id, nonce, abort, locals)
+			frkhash.mine(block, algo, id, nonce, abort, locals)
 		}(i, uint64(frkhash.rand.Int63()))
 	}
 	// Wait until sealing is terminated or a nonce is found
@@ -117,7 +128,7 @@ func (frkhash *Frkhash) Seal(chain consensus.ChainHeaderReader, block *types.Blo
 		case <-frkhash.update:
 			// Thread count was changed on user request, restart
 			close(abort)
-			if err := frkhash.Seal(chain, block, results, stop); err != nil {
+			if err := frkhash.seal(chain, block, algo, results, stop); err != nil {
 				frkhash.config.Log.Error("Failed to restart sealing after update", "err", err)
 			}
 		}
@@ -128,8 +139,8 @@ func (frkhash *Frkhash) Seal(chain consensus.ChainHeaderReader, block *types.Blo
 }
 
 // mine is the actual proof-of-work miner that searches for a nonce starting from
-// seed that results in correct final block difficulty.
-func (frkhash *Frkhash) mine(block *types.Block, id int, seed uint64, abort chan struct{}, found chan *types.Block) {
+// seed that results in correct final block difficulty using the given algorithm.
+func (frkhash *Frkhash) mine(block *types.Block, algo Algorithm, id int, seed uint64, abort chan struct{}, found chan *types.Block) {
 	// Extract some data from the header
 	var (
 		header = block.Header()
@@ -162,7 +173,7 @@ search:
 				attempts = 0
 			}
 			// Compute the PoW value of this nonce
-			digest, result := frankomoto(hash, nonce)
+			digest, result := algo(hash, nonce)
 			if new(big.Int).SetBytes(result).Cmp(target) <= 0 {
 				// Correct nonce found, create a new header with it
 				header = types.CopyHeader(header)
@@ -192,6 +203,8 @@ const remoteSealerTimeout = 1 * time.Second
 type remoteSealer struct {
 	works        map[common.Hash]*types.Block
 	rates        map[common.Hash]hashrate
+	workers      map[string]*workerShares                      // Share accounting of remote workers
+	shares       map[common.Hash]map[types.BlockNonce]struct{} // Nonces of shares submitted per work, for duplicates
 	currentBlock *types.Block
 	currentWork  [4]string
 	notifyCtx    context.Context
@@ -201,14 +214,19 @@ type remoteSealer struct {
 	frkhash      *Frkhash
 	noverify     bool
 	notifyURLs   []string
+	stratum      *stratumServer // Stratum server pushing work to miners, nil if disabled
 	results      chan<- *types.Block
 	workCh       chan *sealTask   // Notification channel to push new work and relative result channel to remote sealer
 	fetchWorkCh  chan *sealWork   // Channel used for remote sealer to fetch mining work
 	submitWorkCh chan *mineResult // Channel used for remote sealer to submit their mining result
 	fetchRateCh  chan chan uint64 // Channel used to gather submitted hash rate for local or remote sealer.
 	submitRateCh chan *hashrate   // Channel used for remote sealer to submit their mining hashrate
-	requestExit  chan struct{}
-	exitCh       chan struct{}
+
+	submitShareCh   chan *share             // Channel used for remote workers to submit their shares
+	fetchWorkersCh  chan chan []WorkerStats // Channel used to gather the share accounting of remote workers
+	setDifficultyCh chan *workerDifficulty  // Channel used to assign share difficulties to remote workers
+	requestExit     chan struct{}
+	exitCh          chan struct{}
 }
 
 // sealTask wraps a seal block with relative result channel for remote sealer thread.
@@ -237,6 +255,8 @@ type hashrate struct {
 
 // sealWork wraps a seal work package for remote sealer.
 type sealWork struct {
+	worker string // Worker to target the work package at with its share target, empty for the block target
+
 	errc chan error
 	res  chan [4]string
 }
@@ -251,13 +271,26 @@ func startRemoteSealer(frkhash *Frkhash, urls []string, noverify bool) *remoteSe
 		cancelNotify: cancel,
 		works:        make(map[common.Hash]*types.Block),
 		rates:        make(map[common.Hash]hashrate),
+		workers:      make(map[string]*workerShares),
+		shares:       make(map[common.Hash]map[types.BlockNonce]struct{}),
 		workCh:       make(chan *sealTask),
 		fetchWorkCh:  make(chan *sealWork),
 		submitWorkCh: make(chan *mineResult),
 		fetchRateCh:  make(chan chan uint64),
 		submitRateCh: make(chan *hashrate),
-		requestExit:  make(chan struct{}),
-		exitCh:       make(chan struct{}),
+
+		submitShareCh:   make(chan *share),
+		fetchWorkersCh:  make(chan chan []WorkerStats),
+		setDifficultyCh: make(chan *workerDifficulty),
+		requestExit:     make(chan struct{}),
+		exitCh:          make(chan struct{}),
+	}
+	if config := frkhash.config.Stratum; config.Addr != "" {
+		stratum, err := startStratumServer(s, config)
+		if err != nil {
+			frkhash.config.Log.Error("Failed to start stratum server", "addr", config.Addr, "err", err)
+		}
+		s.stratum = stratum
 	}
 	go s.loop()
 	return s
@@ -268,6 +301,9 @@ func (s *remoteSealer) loop() {
 		s.frkhash.config.Log.Trace("Frkhash remote sealer is exiting")
 		s.cancelNotify()
 		s.reqWG.Wait()
+		if s.stratum != nil {
+			s.stratum.close()
+		}
 		close(s.exitCh)
 	}()
 
@@ -282,13 +318,24 @@ func (s *remoteSealer) loop() {
 			s.results = work.results
 			s.makeWork(work.block)
 			s.notifyWork()
+			if s.stratum != nil {
+				s.stratum.setWork(work.block, s.currentWork)
+			}
 
 		case work := <-s.fetchWorkCh:
 			// Return current mining work to remote miner.
 			if s.currentBlock == nil {
 				work.errc <- errNoMiningWork
-			} else {
+			} else if work.worker == "" {
 				work.res <- s.currentWork
+			} else {
+				// Replace the block target with the worker's share target
+				worker := s.worker(work.worker)
+				worker.active = time.Now()
+
+				res := s.currentWork
+				res[2] = common.BytesToHash(shareTarget(worker.shareDifficulty(), s.currentBlock).Bytes()).Hex()
+				work.res <- res
 			}
 
 		case result := <-s.submitWorkCh:
@@ -299,6 +346,20 @@ func (s *remoteSealer) loop() {
 				result.errc <- errInvalidSealResult
 			}
 
+		case share := <-s.submitShareCh:
+			// Verify and account the submitted share.
+			share.errc <- s.submitShare(share)
+
+		case req := <-s.fetchWorkersCh:
+			// Gather the share accounting of all remote workers.
+			req <- s.workerStats()
+
+		case req := <-s.setDifficultyCh:
+			// Assign the share difficulty of a remote worker.
+			worker := s.worker(req.worker)
+			worker.difficulty, worker.active = req.difficulty, time.Now()
+			close(req.done)
+
 		case result := <-s.submitRateCh:
 			// Trace remote sealer's hash rate by submitted value.
 			s.rates[result.id] = hashrate{rate: result.rate, ping: time.Now()}
@@ -325,9 +386,16 @@ func (s *remoteSealer) loop() {
 				for hash, block := range s.works {
 					if block.NumberU64()+staleThreshold <= s.currentBlock.NumberU64() {
 						delete(s.works, hash)
+						delete(s.shares, hash)
 					}
 				}
 			}
+			// Clear inactive workers
+			for name, worker := range s.workers {
+				if time.Since(worker.active) > workerExpiry {
+					delete(s.workers, name)
+				}
+			}
 
 		case <-s.requestExit:
 			return
@@ -399,6 +467,41 @@ func (s *remoteSealer) sendNotification(ctx context.Context, url string, json []
 	}
 }
 
+// submit hands a pow solution to the sealer loop for verification, returning
+// whether it was accepted.
+func (s *remoteSealer) submit(nonce types.BlockNonce, mixDigest common.Hash, sealhash common.Hash) bool {
+	var errc = make(chan error, 1)
+	select {
+	case s.submitWorkCh <- &mineResult{
+		nonce:     nonce,
+		mixDigest: mixDigest,
+		hash:      sealhash,
+		errc:      errc,
+	}:
+	case <-s.requestExit:
+		return false
+	case <-s.exitCh:
+		return false
+	}
+	err := <-errc
+	return err == nil
+}
+
+// shareSubmit hands a share to the sealer loop for verification, returning the
+// outcome. A zero difficulty verifies the share against the worker's assigned
+// share difficulty.
+func (s *remoteSealer) shareSubmit(worker string, nonce types.BlockNonce, sealhash common.Hash, difficulty uint64) *shareResult {
+	errc := make(chan *shareResult, 1)
+	select {
+	case s.submitShareCh <- &share{worker: worker, nonce: nonce, hash: sealhash, difficulty: difficulty, errc: errc}:
+	case <-s.requestExit:
+		return &shareResult{err: errEthashStopped}
+	case <-s.exitCh:
+		return &shareResult{err: errEthashStopped}
+	}
+	return <-errc
+}
+
 // submitWork verifies the submitted pow solution, returning
 // whether the solution was accepted or not (not can be both a bad pow as well as
 // any other error, like no pending work or stale mining result).
@@ -18,6 +18,7 @@ package frkhash
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"net/http"
@@ -217,7 +218,7 @@ func TestFrkhashRemoteMultiNotifyFull(t *testing.T) {
 func TestFrkhashStaleSubmission(t *testing.T) {
 	frkhash := NewTester(nil, true)
 	defer frkhash.Close()
-	api := &API{frkhash}
+	api := &API{frkhash: frkhash}
 
 	fakeNonce, fakeDigest := types.BlockNonce{0x01, 0x02, 0x03}, common.HexToHash("deadbeef")
 
@@ -296,3 +297,134 @@ func TestFrkhashStaleSubmission(t *testing.T) {
 		}
 	}
 }
+
+// Tests the share verification and accounting of remote workers.
+func TestFrkhashRemoteShares(t *testing.T) {
+	frkhash := NewTester(nil, false)
+	defer frkhash.Close()
+	api := &API{frkhash: frkhash}
+	miner := &PrivateMinerAPI{frkhash: frkhash}
+
+	results := make(chan *types.Block, 1)
+	header := &types.Header{Number: big.NewInt(1), Difficulty: new(big.Int).Lsh(big.NewInt(1), 250)}
+	frkhash.remote.workCh <- &sealTask{block: types.NewBlockWithHeader(header), results: results}
+
+	// Fetch work with the worker's share target
+	if !miner.SetWorkerDifficulty("rig", 1) {
+		t.Fatalf("failed to set worker difficulty")
+	}
+	work, err := api.GetShareWork("rig")
+	if err != nil {
+		t.Fatalf("failed to fetch share work: %v", err)
+	}
+	if want := common.BytesToHash(new(big.Int).Sub(two256, common.Big1).Bytes()).Hex(); work[2] != want {
+		t.Fatalf("share target mismatch: have %s, want %s", work[2], want)
+	}
+	sealhash := frkhash.SealHash(header)
+	if !api.SubmitShare(types.EncodeNonce(1), sealhash, "rig") {
+		t.Fatalf("valid share rejected")
+	}
+	if api.SubmitShare(types.EncodeNonce(1), sealhash, "rig") {
+		t.Fatalf("duplicate share accepted")
+	}
+	if api.SubmitShare(types.EncodeNonce(2), common.Hash{0x01}, "rig") {
+		t.Fatalf("stale share accepted")
+	}
+	// Raise the share difficulty to the block difficulty, failing further shares
+	miner.SetWorkerDifficulty("rig", 1<<62)
+	if api.SubmitShare(types.EncodeNonce(3), sealhash, "rig") {
+		t.Fatalf("low difficulty share accepted")
+	}
+	workers, err := api.GetWorkers()
+	if err != nil {
+		t.Fatalf("failed to retrieve workers: %v", err)
+	}
+	if len(workers) != 1 {
+		t.Fatalf("worker count mismatch: have %d, want 1", len(workers))
+	}
+	if w := workers[0]; w.Worker != "rig" || w.Accepted != 1 || w.Stale != 1 || w.Invalid != 2 || w.Blocks != 0 || w.Hashrate != 1 {
+		t.Fatalf("worker accounting mismatch: %+v", w)
+	}
+	// Shares meeting the block target must be sealed
+	header = &types.Header{Number: big.NewInt(2), Difficulty: big.NewInt(1)}
+	frkhash.remote.workCh <- &sealTask{block: types.NewBlockWithHeader(header), results: results}
+
+	if !api.SubmitShare(types.EncodeNonce(4), frkhash.SealHash(header), "rig") {
+		t.Fatalf("block solution rejected")
+	}
+	select {
+	case block := <-results:
+		if block.Nonce() != 4 {
+			t.Fatalf("sealed nonce mismatch: have %d, want 4", block.Nonce())
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("block solution not delivered")
+	}
+	if workers, _ := api.GetWorkers(); workers[0].Accepted != 2 || workers[0].Blocks != 1 {
+		t.Fatalf("worker accounting mismatch: %+v", workers[0])
+	}
+}
+
+// Tests the effective hashrate estimation from accepted shares.
+func TestFrkhashShareHashrate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		shares []shareEntry
+		want   uint64
+	}{
+		{nil, 0},
+		{[]shareEntry{{now.Add(-time.Minute), 6000}}, 100},
+		{[]shareEntry{{now.Add(-time.Minute), 6000}, {now.Add(-time.Second), 6000}}, 200},
+		{[]shareEntry{{now.Add(-time.Hour), 1 << 40}, {now.Add(-10 * time.Minute), 6000}}, 10},
+		{[]shareEntry{{now.Add(-time.Hour), 1 << 40}}, 0},
+		{[]shareEntry{{now, 500}}, 500},
+	}
+	for i, tt := range tests {
+		worker := &workerShares{window: tt.shares}
+		if have := worker.hashrate(now); have != tt.want {
+			t.Errorf("test %d: hashrate mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that accepted shares are dropped from the hashrate window as new ones are
+// accounted, even if the hashrate is never queried.
+func TestFrkhashShareWindowExpiry(t *testing.T) {
+	var (
+		start  = time.Now()
+		worker = new(workerShares)
+	)
+	for i := 0; i < 60; i++ {
+		worker.account(1000, &shareResult{}, start.Add(time.Duration(i)*time.Minute))
+	}
+	if have, want := len(worker.window), int(shareHashrateWindow/time.Minute)+1; have != want {
+		t.Fatalf("window size mismatch: have %d, want %d", have, want)
+	}
+	if have, want := worker.window[0].time, start.Add(59*time.Minute-shareHashrateWindow); !have.Equal(want) {
+		t.Fatalf("oldest share mismatch: have %v, want %v", have, want)
+	}
+	if worker.stats.Accepted != 60 {
+		t.Fatalf("accepted share count mismatch: have %d, want %d", worker.stats.Accepted, 60)
+	}
+}
+
+// Tests that the number of tracked workers is bounded, dropping the least
+// recently active one.
+func TestFrkhashWorkerLimit(t *testing.T) {
+	sealer := &remoteSealer{workers: make(map[string]*workerShares)}
+	for i := 0; i < maxWorkers; i++ {
+		sealer.worker(fmt.Sprintf("rig-%d", i)).active = time.Unix(int64(i+1), 0)
+	}
+	sealer.worker("rig-0").active = time.Unix(maxWorkers+1, 0)
+	sealer.worker("intruder")
+
+	if len(sealer.workers) != maxWorkers {
+		t.Fatalf("worker count mismatch: have %d, want %d", len(sealer.workers), maxWorkers)
+	}
+	if _, ok := sealer.workers["rig-1"]; ok {
+		t.Fatalf("least recently active worker not dropped")
+	}
+	if _, ok := sealer.workers["rig-0"]; !ok {
+		t.Fatalf("recently active worker dropped")
+	}
+}
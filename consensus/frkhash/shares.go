@@ -0,0 +1,255 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package frkhash
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core/types"
+)
+
+const (
+	defaultShareDifficulty = 1 << 32          // Share difficulty of workers without an explicit one, 1.0 in stratum units
+	shareHashrateWindow    = 10 * time.Minute // Time window of accepted shares the effective hashrate is estimated over
+	workerExpiry           = time.Hour        // Time after the last activity a worker's accounting is dropped
+	maxWorkers             = 1024             // Maximum number of workers tracked, the least recently active is dropped beyond
+)
+
+var (
+	errStaleShare     = errors.New("stale share")
+	errDuplicateShare = errors.New("duplicate share")
+	errLowDiffShare   = errors.New("low difficulty share")
+)
+
+// WorkerStats is the share accounting of a single remote mining worker.
+type WorkerStats struct {
+	Worker     string    `json:"worker"`
+	Difficulty uint64    `json:"difficulty"` // Share difficulty of the last share, or the assigned one
+	Accepted   uint64    `json:"accepted"`
+	Stale      uint64    `json:"stale"`
+	Invalid    uint64    `json:"invalid"`
+	Blocks     uint64    `json:"blocks"`   // Number of accepted shares that were full block solutions
+	Hashrate   uint64    `json:"hashrate"` // Effective hashrate estimated from the accepted shares
+	LastShare  time.Time `json:"lastShare"`
+}
+
+// share wraps a share submitted by a remote worker for verification.
+type share struct {
+	worker     string
+	nonce      types.BlockNonce
+	hash       common.Hash // Seal hash of the work the share was mined on
+	difficulty uint64      // Share difficulty to verify against, 0 for the worker's assigned one
+
+	errc chan *shareResult
+}
+
+// shareResult is the outcome of a share verification.
+type shareResult struct {
+	err   error // Reason the share was rejected, nil if accepted
+	block bool  // Whether the share was a full block solution
+}
+
+// workerDifficulty wraps a share difficulty assignment for a worker.
+type workerDifficulty struct {
+	worker     string
+	difficulty uint64
+
+	done chan struct{}
+}
+
+// workerShares tracks the share accounting of a single worker.
+type workerShares struct {
+	stats      WorkerStats
+	difficulty uint64       // Assigned share difficulty, 0 for the default
+	active     time.Time    // Last time the worker fetched work or submitted a share
+	window     []shareEntry // Accepted shares within the hashrate window
+}
+
+// shareEntry is an accepted share within the hashrate window.
+type shareEntry struct {
+	time       time.Time
+	difficulty uint64
+}
+
+// shareDifficulty returns the share difficulty assigned to the worker.
+func (w *workerShares) shareDifficulty() uint64 {
+	if w == nil || w.difficulty == 0 {
+		return defaultShareDifficulty
+	}
+	return w.difficulty
+}
+
+// account records the outcome of a share verification.
+func (w *workerShares) account(difficulty uint64, res *shareResult, now time.Time) {
+	w.active = now
+	switch res.err {
+	case nil:
+		w.stats.Accepted++
+		w.stats.Difficulty = difficulty
+		w.stats.LastShare = now
+		if res.block {
+			w.stats.Blocks++
+		}
+		w.window = append(w.window, shareEntry{time: now, difficulty: difficulty})
+		w.expire(now)
+	case errStaleShare:
+		w.stats.Stale++
+	default:
+		w.stats.Invalid++
+	}
+}
+
+// expire drops the accepted shares that fell out of the hashrate window, keeping
+// the window bounded for workers whose stats are never queried.
+func (w *workerShares) expire(now time.Time) {
+	cutoff := now.Add(-shareHashrateWindow)
+	for len(w.window) > 0 && w.window[0].time.Before(cutoff) {
+		w.window = w.window[1:]
+	}
+}
+
+// hashrate estimates the effective hashrate of the worker as the expected number
+// of hashes needed to find the shares accepted within the hashrate window. The
+// window is shortened to the worker's first share if it started recently.
+func (w *workerShares) hashrate(now time.Time) uint64 {
+	w.expire(now)
+	if len(w.window) == 0 {
+		return 0
+	}
+	span := shareHashrateWindow
+	if first := now.Sub(w.window[0].time); first < span {
+		span = first
+	}
+	if span < time.Second {
+		span = time.Second
+	}
+	work := new(big.Int)
+	for _, entry := range w.window {
+		work.Add(work, new(big.Int).SetUint64(entry.difficulty))
+	}
+	work.Mul(work, big.NewInt(int64(time.Second)))
+	work.Div(work, big.NewInt(int64(span)))
+	if !work.IsUint64() {
+		return ^uint64(0)
+	}
+	return work.Uint64()
+}
+
+// shareTarget returns the target a share of the given difficulty must meet,
+// which is never harder than the block target.
+func shareTarget(difficulty uint64, block *types.Block) *big.Int {
+	target := new(big.Int).Div(two256, new(big.Int).SetUint64(difficulty))
+	if target.Cmp(two256) >= 0 {
+		target.Sub(two256, common.Big1)
+	}
+	if limit := new(big.Int).Div(two256, block.Difficulty()); target.Cmp(limit) < 0 {
+		return limit
+	}
+	return target
+}
+
+// worker returns the share accounting of the named worker, creating it if the
+// worker is not yet known. Worker names are chosen by the remote miners, so the
+// least recently active worker is dropped if too many are tracked already.
+func (s *remoteSealer) worker(name string) *workerShares {
+	worker := s.workers[name]
+	if worker == nil {
+		if len(s.workers) >= maxWorkers {
+			var idle string
+			for name, worker := range s.workers {
+				if idle == "" || worker.active.Before(s.workers[idle].active) {
+					idle = name
+				}
+			}
+			delete(s.workers, idle)
+		}
+		worker = &workerShares{stats: WorkerStats{Worker: name}, active: time.Now()}
+		s.workers[name] = worker
+	}
+	return worker
+}
+
+// submitShare verifies a share against the worker's share target and the
+// pending work, forwarding full block solutions to the miner. The outcome is
+// recorded in the worker's accounting.
+func (s *remoteSealer) submitShare(share *share) *shareResult {
+	worker := s.worker(share.worker)
+	difficulty := share.difficulty
+	if difficulty == 0 {
+		difficulty = worker.shareDifficulty()
+	}
+	res := s.verifyShare(share.nonce, share.hash, difficulty)
+	worker.account(difficulty, res, time.Now())
+	return res
+}
+
+// verifyShare checks a share against the pending work, returning the outcome.
+func (s *remoteSealer) verifyShare(nonce types.BlockNonce, sealhash common.Hash, difficulty uint64) *shareResult {
+	block := s.works[sealhash]
+	if block == nil || s.currentBlock == nil || block.NumberU64()+staleThreshold <= s.currentBlock.NumberU64() {
+		return &shareResult{err: errStaleShare}
+	}
+	nonces := s.shares[sealhash]
+	if nonces == nil {
+		nonces = make(map[types.BlockNonce]struct{})
+		s.shares[sealhash] = nonces
+	}
+	if _, ok := nonces[nonce]; ok {
+		return &shareResult{err: errDuplicateShare}
+	}
+	nonces[nonce] = struct{}{}
+
+	algo, err := s.frkhash.algorithm(block.NumberU64())
+	if err != nil {
+		return &shareResult{err: err}
+	}
+	digest, result := algo(sealhash.Bytes(), nonce.Uint64())
+
+	value := new(big.Int).SetBytes(result)
+	if value.Cmp(shareTarget(difficulty, block)) > 0 {
+		return &shareResult{err: errLowDiffShare}
+	}
+	if value.Cmp(new(big.Int).Div(two256, block.Difficulty())) > 0 {
+		return &shareResult{}
+	}
+	// The share is a full solution, hand it to the miner
+	if !s.submitWork(nonce, common.BytesToHash(digest), sealhash) {
+		return &shareResult{err: errStaleShare}
+	}
+	return &shareResult{block: true}
+}
+
+// workerStats returns the share accounting of all the known workers, sorted by
+// worker name.
+func (s *remoteSealer) workerStats() []WorkerStats {
+	now := time.Now()
+
+	stats := make([]WorkerStats, 0, len(s.workers))
+	for _, worker := range s.workers {
+		worker.stats.Hashrate = worker.hashrate(now)
+		if worker.stats.Accepted == 0 {
+			worker.stats.Difficulty = worker.shareDifficulty()
+		}
+		stats = append(stats, worker.stats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Worker < stats[j].Worker })
+	return stats
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package frkhash
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"math/rand"
+
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/params"
+)
+
+// DifficultyScenario describes the network hashrate during a difficulty
+// simulation. The hashrate changes linearly from the first to the last block.
+type DifficultyScenario struct {
+	Name  string  // Name of the scenario, reported in the samples
+	Start float64 // Network hashrate in hashes per second at the first simulated block
+	End   float64 // Network hashrate in hashes per second at the last simulated block
+}
+
+// DifficultySample is a single data point of a difficulty simulation.
+type DifficultySample struct {
+	Scenario   string   `json:"scenario"`
+	Number     uint64   `json:"number"`
+	Time       uint64   `json:"timestamp"`
+	Difficulty *big.Int `json:"difficulty"`
+	Hashrate   float64  `json:"hashrate"`
+	BlockTime  float64  `json:"blockTime"` // Average block time in seconds since the previous sample
+	Rules      string   `json:"rules"`     // Difficulty adjustment rules in effect at the block
+}
+
+// SimulateDifficulty projects the difficulty and block times of the chain for
+// the given number of blocks on top of parent, with the network hashrate of the
+// scenario. Blocks are found after their expected time at the current hashrate,
+// or after an exponentially distributed time if a random source is given. A
+// sample is emitted every interval blocks and for the last simulated block.
+func SimulateDifficulty(config *params.ChainConfig, parent *types.Header, scenario DifficultyScenario, blocks, interval uint64, rnd *rand.Rand, emit func(*DifficultySample) error) error {
+	if scenario.Start <= 0 || scenario.End <= 0 {
+		return errors.New("hashrate must be positive")
+	}
+	if interval == 0 {
+		interval = 1
+	}
+	header := &types.Header{
+		Number:     new(big.Int).Set(parent.Number),
+		Time:       parent.Time,
+		Difficulty: new(big.Int).Set(parent.Difficulty),
+		UncleHash:  types.EmptyUncleHash,
+	}
+	var (
+		clock      = float64(parent.Time) // Precise time of the last block, timestamps are truncated
+		lastNumber = header.Number.Uint64()
+		lastTime   = header.Time
+	)
+	for i := uint64(1); i <= blocks; i++ {
+		// Interpolate the hashrate and find the next block at the current difficulty
+		hashrate := scenario.Start
+		if blocks > 1 {
+			hashrate += (scenario.End - scenario.Start) * float64(i-1) / float64(blocks-1)
+		}
+		difficulty, _ := new(big.Float).SetInt(header.Difficulty).Float64()
+		elapsed := difficulty / hashrate
+		if rnd != nil {
+			elapsed *= rnd.ExpFloat64()
+		}
+		clock += elapsed
+
+		timestamp := uint64(math.Floor(clock))
+		if timestamp <= header.Time {
+			timestamp = header.Time + 1
+			clock = float64(timestamp)
+		}
+		next := &types.Header{
+			Number:     new(big.Int).Add(header.Number, big1),
+			Time:       timestamp,
+			Difficulty: CalcDifficulty(config, timestamp, header),
+			UncleHash:  types.EmptyUncleHash,
+		}
+		header = next
+
+		if i%interval != 0 && i != blocks {
+			continue
+		}
+		number := header.Number.Uint64()
+		sample := &DifficultySample{
+			Scenario:   scenario.Name,
+			Number:     number,
+			Time:       header.Time,
+			Difficulty: new(big.Int).Set(header.Difficulty),
+			Hashrate:   hashrate,
+			BlockTime:  float64(header.Time-lastTime) / float64(number-lastNumber),
+			Rules:      DifficultyRules(config, header.Number),
+		}
+		if err := emit(sample); err != nil {
+			return err
+		}
+		lastNumber, lastTime = number, header.Time
+	}
+	return nil
+}
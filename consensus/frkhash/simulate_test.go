@@ -0,0 +1,99 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package frkhash
+
+import (
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/params"
+)
+
+// simulate runs a difficulty simulation, collecting all the samples.
+func simulate(t *testing.T, config *params.ChainConfig, scenario DifficultyScenario, blocks, interval uint64, rnd *rand.Rand) []*DifficultySample {
+	var (
+		parent  = &types.Header{Number: big.NewInt(0), Difficulty: big.NewInt(1 << 30)}
+		samples []*DifficultySample
+	)
+	err := SimulateDifficulty(config, parent, scenario, blocks, interval, rnd, func(sample *DifficultySample) error {
+		samples = append(samples, sample)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("simulation failed: %v", err)
+	}
+	return samples
+}
+
+// Tests that the simulated block time settles within the adjustment band of the
+// difficulty rules and that the difficulty follows the hashrate.
+func TestSimulateDifficulty(t *testing.T) {
+	// Constant hashrate must converge into the constantinople adjustment dead band
+	samples := simulate(t, params.TestChainConfig, DifficultyScenario{"flat", 1e7, 1e7}, 10000, 1000, nil)
+	if len(samples) != 10 {
+		t.Fatalf("sample count mismatch: have %d, want 10", len(samples))
+	}
+	last := samples[len(samples)-1]
+	if last.Number != 10000 || last.Rules != "constantinople" {
+		t.Fatalf("last sample mismatch: %+v", last)
+	}
+	if last.BlockTime < 15 || last.BlockTime >= 30 {
+		t.Fatalf("block time did not settle: have %v, want [15, 30)", last.BlockTime)
+	}
+	// Quadrupling the hashrate must raise the difficulty, keeping the block time
+	// within the adjustment dead band
+	ramp := simulate(t, params.TestChainConfig, DifficultyScenario{"ramp", 1e7, 4e7}, 20000, 7000, nil)
+	if len(ramp) != 3 {
+		t.Fatalf("sample count mismatch: have %d, want 3", len(ramp))
+	}
+	if ramp[2].Difficulty.Cmp(last.Difficulty) <= 0 {
+		t.Fatalf("difficulty did not follow hashrate: have %v, flat %v", ramp[2].Difficulty, last.Difficulty)
+	}
+	if ramp[2].BlockTime < 14 || ramp[2].BlockTime >= 30 {
+		t.Fatalf("block time out of bounds: have %v, want [14, 30)", ramp[2].BlockTime)
+	}
+	if ramp[2].Hashrate != 4e7 {
+		t.Fatalf("final hashrate mismatch: have %v, want %v", ramp[2].Hashrate, 4e7)
+	}
+	// Randomized simulations must be reproducible with the same seed
+	a := simulate(t, params.TestChainConfig, DifficultyScenario{"rand", 1e7, 1e7}, 1000, 100, rand.New(rand.NewSource(1)))
+	b := simulate(t, params.TestChainConfig, DifficultyScenario{"rand", 1e7, 1e7}, 1000, 100, rand.New(rand.NewSource(1)))
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("seeded simulations differ")
+	}
+	if reflect.DeepEqual(a, samples) {
+		t.Fatalf("randomized simulation matches deterministic one")
+	}
+}
+
+// Tests that the difficulty rules are reported by fork.
+func TestDifficultyRules(t *testing.T) {
+	config := &params.ChainConfig{
+		HomesteadBlock:      big.NewInt(10),
+		ByzantiumBlock:      big.NewInt(20),
+		ConstantinopleBlock: big.NewInt(30),
+		MuirGlacierBlock:    big.NewInt(40),
+	}
+	for number, want := range map[int64]string{0: "frontier", 10: "homestead", 25: "byzantium", 30: "constantinople", 40: "muirglacier"} {
+		if have := DifficultyRules(config, big.NewInt(number)); have != want {
+			t.Errorf("block %d: rules mismatch: have %s, want %s", number, have, want)
+		}
+	}
+}
@@ -0,0 +1,652 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package frkhash
+
+import (
+	"bufio"
+	crand "crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core/types"
+)
+
+const (
+	stratumProtocol = "EthereumStratum/1.0.0"
+
+	stratumDefaultDifficulty = 1 << 32          // Initial share difficulty, 1.0 in stratum units
+	stratumDefaultShareTime  = 10 * time.Second // Default vardiff target interval between shares
+	stratumMinDifficulty     = 1 << 16          // Minimum share difficulty vardiff may retarget to
+	stratumRetargetShares    = 4                // Number of share intervals after which vardiff retargets
+	stratumRetargetFactor    = 4                // Maximum difficulty change factor in a single retarget
+
+	stratumIdleTimeout  = 10 * time.Minute // Maximum time a session may stay silent before being dropped
+	stratumWriteTimeout = 5 * time.Second  // Maximum time a single message write may take
+	stratumMaxLine      = 16 * 1024        // Maximum size of a single stratum request
+	stratumSendQueue    = 16               // Number of messages queued for a session before it is dropped
+	stratumMaxSessions  = 0x10000          // Number of concurrent sessions, one per extranonce prefix
+	stratumMaxConnsIP   = 16               // Default number of concurrent sessions from a single IP address
+)
+
+// Stratum error codes, as used by the various stratum protocol flavours.
+var (
+	errStratumOther        = &stratumError{20, "Other/Unknown"}
+	errStratumJobNotFound  = &stratumError{21, "Job not found"}
+	errStratumDuplicate    = &stratumError{22, "Duplicate share"}
+	errStratumLowDiff      = &stratumError{23, "Low difficulty share"}
+	errStratumUnauthorized = &stratumError{24, "Unauthorized worker"}
+	errStratumNotSubscribe = &stratumError{25, "Not subscribed"}
+)
+
+// StratumConfig are the configuration parameters of the stratum server.
+type StratumConfig struct {
+	Addr       string        // TCP listening address of the server, empty to disable it
+	Difficulty uint64        // Initial share difficulty assigned to new sessions (0 = stratum difficulty 1)
+	ShareTime  time.Duration // Target interval between shares of a session for vardiff (0 = 10s)
+
+	Password      string // Password workers have to authorize with, empty to accept any worker
+	MaxConnsPerIP int    // Maximum number of concurrent sessions from a single IP address (0 = 16)
+}
+
+// StratumSession is the accounting of a single stratum connection.
+type StratumSession struct {
+	ID         string    `json:"id"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Worker     string    `json:"worker"`
+	Extranonce string    `json:"extranonce"`
+	Difficulty uint64    `json:"difficulty"` // Current share difficulty in hashes
+	Connected  time.Time `json:"connected"`
+	LastShare  time.Time `json:"lastShare"`
+	Accepted   uint64    `json:"accepted"`
+	Stale      uint64    `json:"stale"`
+	Invalid    uint64    `json:"invalid"`
+	Blocks     uint64    `json:"blocks"` // Number of shares that were full block solutions
+}
+
+type stratumError struct {
+	code    int
+	message string
+}
+
+func (e *stratumError) Error() string { return e.message }
+
+// MarshalJSON encodes the error in the [code, message, traceback] stratum form.
+func (e *stratumError) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.code, e.message, nil})
+}
+
+type stratumRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type stratumResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result interface{}     `json:"result"`
+	Error  interface{}     `json:"error"`
+}
+
+type stratumNotification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// stratumJob is a work package handed out to the stratum sessions.
+type stratumJob struct {
+	id       string
+	sealhash common.Hash
+	seedhash common.Hash
+	number   uint64
+	target   *big.Int // Block target, used to cap the share difficulty
+}
+
+// stratumServer serves the work of the remote sealer to miners connecting over
+// the EthereumStratum/1.0.0 (NiceHash) protocol. Every session is assigned an
+// extranonce prefix partitioning the nonce space and its own share difficulty,
+// adjusted to reach the configured share interval.
+type stratumServer struct {
+	sealer   *remoteSealer
+	config   StratumConfig
+	listener net.Listener
+
+	lock       sync.Mutex
+	sessions   map[*stratumSession]struct{}
+	extranonce map[uint16]*stratumSession // Extranonce prefixes in use
+	conns      map[string]int             // Number of sessions from every remote IP address
+	jobs       map[string]*stratumJob     // Jobs still accepting shares
+	current    *stratumJob                // Latest job handed out
+	jobSeq     uint64
+	nonceSeq   uint16
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// stratumSession is a single miner connection.
+type stratumSession struct {
+	server *stratumServer
+	conn   net.Conn
+	send   chan interface{}
+	quit   chan struct{}
+	once   sync.Once
+
+	lock         sync.Mutex
+	stats        StratumSession
+	extranonce   uint16
+	subscribed   bool
+	authorized   bool
+	difficulty   uint64            // Share difficulty applied to new jobs
+	announced    uint64            // Share difficulty last announced to the miner
+	difficulties map[string]uint64 // Share difficulty each outstanding job was sent with
+	retarget     time.Time         // Start of the current vardiff window
+	shares       uint64            // Shares accepted in the current vardiff window
+}
+
+// startStratumServer opens the stratum listener and starts accepting miners.
+func startStratumServer(sealer *remoteSealer, config StratumConfig) (*stratumServer, error) {
+	if config.Difficulty == 0 {
+		config.Difficulty = stratumDefaultDifficulty
+	}
+	if config.ShareTime == 0 {
+		config.ShareTime = stratumDefaultShareTime
+	}
+	if config.MaxConnsPerIP == 0 {
+		config.MaxConnsPerIP = stratumMaxConnsIP
+	}
+	listener, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &stratumServer{
+		sealer:     sealer,
+		config:     config,
+		listener:   listener,
+		sessions:   make(map[*stratumSession]struct{}),
+		extranonce: make(map[uint16]*stratumSession),
+		conns:      make(map[string]int),
+		jobs:       make(map[string]*stratumJob),
+		quit:       make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.acceptLoop()
+
+	sealer.frkhash.config.Log.Info("Started stratum server", "addr", listener.Addr())
+	return s, nil
+}
+
+// close stops accepting new miners and drops all connected sessions.
+func (s *stratumServer) close() {
+	close(s.quit)
+	s.listener.Close()
+
+	s.lock.Lock()
+	for session := range s.sessions {
+		session.close()
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+}
+
+// acceptLoop accepts inbound miner connections until the server is closed.
+func (s *stratumServer) acceptLoop() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			s.sealer.frkhash.config.Log.Warn("Failed to accept stratum connection", "err", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		session, err := s.newSession(conn)
+		if err != nil {
+			s.sealer.frkhash.config.Log.Warn("Rejected stratum connection", "remote", conn.RemoteAddr(), "err", err)
+			conn.Close()
+			continue
+		}
+		s.wg.Add(2)
+		go session.readLoop()
+		go session.writeLoop()
+	}
+}
+
+// newSession registers a new miner connection, assigning it a unique extranonce.
+func (s *stratumServer) newSession(conn net.Conn) (*stratumSession, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ip := remoteIP(conn)
+	if s.conns[ip] >= s.config.MaxConnsPerIP {
+		return nil, errors.New("too many connections from address")
+	}
+	// Every extranonce may be taken, make sure the search below terminates
+	if len(s.extranonce) >= stratumMaxSessions {
+		return nil, errors.New("extranonce space exhausted")
+	}
+	for {
+		s.nonceSeq++
+		if _, ok := s.extranonce[s.nonceSeq]; !ok {
+			break
+		}
+	}
+	var id [16]byte
+	crand.Read(id[:])
+
+	session := &stratumSession{
+		server:       s,
+		conn:         conn,
+		send:         make(chan interface{}, stratumSendQueue),
+		quit:         make(chan struct{}),
+		extranonce:   s.nonceSeq,
+		difficulty:   s.config.Difficulty,
+		difficulties: make(map[string]uint64),
+		retarget:     time.Now(),
+		stats: StratumSession{
+			ID:         hex.EncodeToString(id[:]),
+			RemoteAddr: conn.RemoteAddr().String(),
+			Extranonce: fmt.Sprintf("%04x", s.nonceSeq),
+			Connected:  time.Now(),
+		},
+	}
+	s.sessions[session] = struct{}{}
+	s.extranonce[session.extranonce] = session
+	s.conns[ip]++
+	return session, nil
+}
+
+// remoteIP returns the IP address of the remote end of a connection.
+func remoteIP(conn net.Conn) string {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return conn.RemoteAddr().String()
+}
+
+// removeSession drops a disconnected session, releasing its extranonce.
+func (s *stratumServer) removeSession(session *stratumSession) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.sessions[session]; !ok {
+		return
+	}
+	delete(s.sessions, session)
+	if s.extranonce[session.extranonce] == session {
+		delete(s.extranonce, session.extranonce)
+	}
+	if ip := remoteIP(session.conn); s.conns[ip] > 1 {
+		s.conns[ip]--
+	} else {
+		delete(s.conns, ip)
+	}
+}
+
+// setWork creates a new job from the work package of the remote sealer and
+// pushes it to all the subscribed sessions. Jobs too old for their solutions to
+// be accepted by the sealer are discarded.
+func (s *stratumServer) setWork(block *types.Block, work [4]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.jobSeq++
+	job := &stratumJob{
+		id:       strconv.FormatUint(s.jobSeq, 16),
+		sealhash: common.HexToHash(work[0]),
+		seedhash: common.HexToHash(work[1]),
+		number:   block.NumberU64(),
+		target:   new(big.Int).Div(two256, block.Difficulty()),
+	}
+	for id, old := range s.jobs {
+		if old.number+staleThreshold <= job.number {
+			delete(s.jobs, id)
+		}
+	}
+	s.jobs[job.id] = job
+	s.current = job
+
+	for session := range s.sessions {
+		session.notify(job)
+	}
+}
+
+// job returns the job with the given id, nil if it is unknown or stale.
+func (s *stratumServer) job(id string) *stratumJob {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.jobs[id]
+}
+
+// Sessions returns the accounting of all connected stratum sessions.
+func (s *stratumServer) Sessions() []StratumSession {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sessions := make([]StratumSession, 0, len(s.sessions))
+	for session := range s.sessions {
+		session.lock.Lock()
+		stats := session.stats
+		stats.Difficulty = session.difficulty
+		session.lock.Unlock()
+
+		sessions = append(sessions, stats)
+	}
+	return sessions
+}
+
+// close terminates the session's connection.
+func (s *stratumSession) close() {
+	s.once.Do(func() {
+		close(s.quit)
+		s.conn.Close()
+	})
+}
+
+// readLoop reads and handles the requests of the miner until it disconnects.
+func (s *stratumSession) readLoop() {
+	defer s.server.wg.Done()
+	defer s.server.removeSession(s)
+	defer s.close()
+
+	scanner := bufio.NewScanner(s.conn)
+	scanner.Buffer(make([]byte, 0, 1024), stratumMaxLine)
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(stratumIdleTimeout))
+		if !scanner.Scan() {
+			return
+		}
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var req stratumRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.server.sealer.frkhash.config.Log.Debug("Malformed stratum request", "remote", s.stats.RemoteAddr, "err", err)
+			return
+		}
+		result, err := s.handle(&req)
+		res := &stratumResponse{ID: req.ID, Result: result}
+		if err != nil {
+			res.Result, res.Error = false, err
+		}
+		if !s.write(res) {
+			return
+		}
+		// Hand out the current job to newly authorized workers
+		if req.Method == "mining.authorize" && err == nil {
+			s.server.lock.Lock()
+			if job := s.server.current; job != nil {
+				s.notify(job)
+			}
+			s.server.lock.Unlock()
+		}
+	}
+}
+
+// writeLoop sends the queued messages to the miner.
+func (s *stratumSession) writeLoop() {
+	defer s.server.wg.Done()
+
+	enc := json.NewEncoder(s.conn)
+	for {
+		select {
+		case msg := <-s.send:
+			s.conn.SetWriteDeadline(time.Now().Add(stratumWriteTimeout))
+			if err := enc.Encode(msg); err != nil {
+				s.close()
+				return
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// write queues a message to be sent to the miner, dropping the session if it
+// does not keep up with reading its messages.
+func (s *stratumSession) write(msg interface{}) bool {
+	select {
+	case s.send <- msg:
+		return true
+	case <-s.quit:
+		return false
+	default:
+		s.server.sealer.frkhash.config.Log.Debug("Dropping slow stratum session", "remote", s.stats.RemoteAddr)
+		s.close()
+		return false
+	}
+}
+
+// handle executes a single stratum request.
+func (s *stratumSession) handle(req *stratumRequest) (interface{}, error) {
+	var params []string
+	if len(req.Params) > 0 && string(req.Params) != "null" {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, errStratumOther
+		}
+	}
+	switch req.Method {
+	case "mining.subscribe":
+		return s.subscribe(), nil
+	case "mining.extranonce.subscribe":
+		// The extranonce of a session never changes, nothing to do
+		return true, nil
+	case "mining.authorize":
+		return s.authorize(params)
+	case "mining.submit":
+		return s.submit(params)
+	default:
+		return nil, &stratumError{20, fmt.Sprintf("Unsupported method %q", req.Method)}
+	}
+}
+
+// subscribe subscribes the session to new jobs, returning the subscription and
+// the extranonce assigned to the session.
+func (s *stratumSession) subscribe() interface{} {
+	s.lock.Lock()
+	s.subscribed = true
+	s.lock.Unlock()
+
+	return []interface{}{
+		[]string{"mining.notify", s.stats.ID, stratumProtocol},
+		s.stats.Extranonce,
+	}
+}
+
+// authorize authorizes the worker to submit shares, checking its password if
+// the server requires one.
+func (s *stratumSession) authorize(params []string) (interface{}, error) {
+	if len(params) < 1 || params[0] == "" {
+		return nil, errStratumUnauthorized
+	}
+	if password := s.server.config.Password; password != "" {
+		if len(params) < 2 || subtle.ConstantTimeCompare([]byte(params[1]), []byte(password)) != 1 {
+			return nil, errStratumUnauthorized
+		}
+	}
+	s.lock.Lock()
+	if !s.subscribed {
+		s.lock.Unlock()
+		return nil, errStratumNotSubscribe
+	}
+	s.authorized = true
+	s.stats.Worker = params[0]
+	s.lock.Unlock()
+
+	return true, nil
+}
+
+// notify sends a job to the session, preceded by the share difficulty if it
+// changed since the last job. Older jobs remain valid until they go stale.
+//
+// The caller must hold the server lock.
+func (s *stratumSession) notify(job *stratumJob) {
+	s.lock.Lock()
+	if !s.authorized {
+		s.lock.Unlock()
+		return
+	}
+	s.retargetDifficulty(job, time.Now())
+	difficulty, announced := s.difficulty, s.announced
+	s.announced = difficulty
+
+	for id := range s.difficulties {
+		if _, ok := s.server.jobs[id]; !ok {
+			delete(s.difficulties, id)
+		}
+	}
+	s.difficulties[job.id] = difficulty
+	s.lock.Unlock()
+
+	if difficulty != announced {
+		s.write(&stratumNotification{
+			Method: "mining.set_difficulty",
+			Params: []interface{}{float64(difficulty) / stratumDefaultDifficulty},
+		})
+	}
+	s.write(&stratumNotification{
+		Method: "mining.notify",
+		Params: []interface{}{job.id, hex.EncodeToString(job.seedhash[:]), hex.EncodeToString(job.sealhash[:]), true},
+	})
+}
+
+// retargetDifficulty adjusts the share difficulty of the session to reach the
+// configured share interval, once enough time passed since the last retarget.
+// The difficulty never exceeds the block difficulty of the job.
+//
+// The caller must hold the session lock.
+func (s *stratumSession) retargetDifficulty(job *stratumJob, now time.Time) {
+	var (
+		shareTime = s.server.config.ShareTime
+		elapsed   = now.Sub(s.retarget)
+	)
+	if elapsed >= stratumRetargetShares*shareTime {
+		// Scale the difficulty by the ratio of the expected and observed share
+		// count, treating an idle window as a single share to always back off
+		expected := float64(elapsed) / float64(shareTime)
+		observed := float64(s.shares)
+		if observed == 0 {
+			observed = 1
+		}
+		factor := observed / expected
+		if factor > stratumRetargetFactor {
+			factor = stratumRetargetFactor
+		}
+		if factor < 1.0/stratumRetargetFactor {
+			factor = 1.0 / stratumRetargetFactor
+		}
+		difficulty := uint64(float64(s.difficulty) * factor)
+		if difficulty < stratumMinDifficulty {
+			difficulty = stratumMinDifficulty
+		}
+		s.difficulty, s.retarget, s.shares = difficulty, now, 0
+	}
+	if limit := new(big.Int).Div(two256, job.target); limit.IsUint64() && s.difficulty > limit.Uint64() {
+		s.difficulty = limit.Uint64()
+	}
+}
+
+// submit verifies a share submitted by the miner, forwarding it to the remote
+// sealer if it is a full solution for the block.
+func (s *stratumSession) submit(params []string) (interface{}, error) {
+	if len(params) < 3 {
+		return nil, errStratumOther
+	}
+	s.lock.Lock()
+	authorized, worker, extranonce := s.authorized, s.stats.Worker, s.stats.Extranonce
+	difficulty, known := s.difficulties[params[1]]
+	s.lock.Unlock()
+
+	if !authorized {
+		return nil, errStratumUnauthorized
+	}
+	// Reconstruct the full nonce from the extranonce and the miner's suffix
+	suffix := strings.TrimPrefix(params[2], "0x")
+	if len(suffix) == 16 {
+		if !strings.HasPrefix(suffix, extranonce) {
+			s.account(&shareResult{err: errInvalidSealResult})
+			return nil, errStratumOther
+		}
+		suffix = suffix[len(extranonce):]
+	}
+	blob, err := hex.DecodeString(extranonce + suffix)
+	if err != nil || len(blob) != 8 {
+		s.account(&shareResult{err: errInvalidSealResult})
+		return nil, errStratumOther
+	}
+	nonce := types.EncodeNonce(binary.BigEndian.Uint64(blob))
+
+	// Hand the share to the sealer for verification against the difficulty the
+	// job was sent with. Shares for unknown jobs are accounted as stale.
+	var sealhash common.Hash
+	if job := s.server.job(params[1]); job != nil && known {
+		sealhash = job.sealhash
+	}
+	res := s.server.sealer.shareSubmit(worker, nonce, sealhash, difficulty)
+	s.account(res)
+
+	switch res.err {
+	case nil:
+		return true, nil
+	case errStaleShare:
+		return nil, errStratumJobNotFound
+	case errDuplicateShare:
+		return nil, errStratumDuplicate
+	case errLowDiffShare:
+		return nil, errStratumLowDiff
+	default:
+		return nil, errStratumOther
+	}
+}
+
+// account records the outcome of a share submission.
+func (s *stratumSession) account(res *shareResult) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch res.err {
+	case nil:
+		s.stats.Accepted++
+		s.stats.LastShare = time.Now()
+		s.shares++
+		if res.block {
+			s.stats.Blocks++
+		}
+	case errStaleShare:
+		s.stats.Stale++
+	default:
+		s.stats.Invalid++
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package frkhash
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/expanse-org/go-expanse/core/types"
+)
+
+// stratumTester is a raw stratum client connected to a test engine.
+type stratumTester struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	notes  []stratumNotification
+}
+
+func newStratumTester(t *testing.T, frkhash *Frkhash) *stratumTester {
+	conn, err := net.Dial("tcp", frkhash.remote.stratum.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial stratum server: %v", err)
+	}
+	return &stratumTester{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// read reads the next message from the server.
+func (st *stratumTester) read() map[string]json.RawMessage {
+	st.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	line, err := st.reader.ReadBytes('\n')
+	if err != nil {
+		st.t.Fatalf("failed to read stratum message: %v", err)
+	}
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		st.t.Fatalf("failed to decode stratum message %q: %v", line, err)
+	}
+	return msg
+}
+
+// call sends a request and waits for its response, buffering any notifications
+// received meanwhile.
+func (st *stratumTester) call(id int, method string, params ...string) (json.RawMessage, json.RawMessage) {
+	req, _ := json.Marshal(map[string]interface{}{"id": id, "method": method, "params": params})
+	if _, err := st.conn.Write(append(req, '\n')); err != nil {
+		st.t.Fatalf("failed to send stratum request: %v", err)
+	}
+	for {
+		msg := st.read()
+		if string(msg["id"]) == "null" {
+			st.buffer(msg)
+			continue
+		}
+		var have int
+		if err := json.Unmarshal(msg["id"], &have); err != nil || have != id {
+			st.t.Fatalf("response id mismatch: have %s, want %d", msg["id"], id)
+		}
+		return msg["result"], msg["error"]
+	}
+}
+
+// notification returns the next notification from the server.
+func (st *stratumTester) notification() stratumNotification {
+	for len(st.notes) == 0 {
+		st.buffer(st.read())
+	}
+	note := st.notes[0]
+	st.notes = st.notes[1:]
+	return note
+}
+
+func (st *stratumTester) buffer(msg map[string]json.RawMessage) {
+	var note stratumNotification
+	json.Unmarshal(msg["method"], &note.Method)
+	json.Unmarshal(msg["params"], &note.Params)
+	st.notes = append(st.notes, note)
+}
+
+// Tests the stratum session lifecycle: subscription, authorization, job
+// notification, share submission and share accounting.
+func TestStratumShares(t *testing.T) {
+	frkhash := New(Config{PowMode: ModeTest, Stratum: StratumConfig{Addr: "127.0.0.1:0", Difficulty: 1}}, nil, false)
+	defer frkhash.Close()
+
+	st := newStratumTester(t, frkhash)
+	defer st.conn.Close()
+
+	// Submitting before authorizing must fail
+	if _, err := st.call(1, "mining.submit", "worker", "1", "000000000001"); string(err) == "null" {
+		t.Fatalf("unauthorized share accepted")
+	}
+	result, _ := st.call(2, "mining.subscribe", "tester/1.0.0", stratumProtocol)
+	var sub []json.RawMessage
+	if err := json.Unmarshal(result, &sub); err != nil || len(sub) != 2 {
+		t.Fatalf("invalid subscription result: %s", result)
+	}
+	var extranonce string
+	json.Unmarshal(sub[1], &extranonce)
+	if len(extranonce) != 4 {
+		t.Fatalf("invalid extranonce %q", extranonce)
+	}
+	if result, _ := st.call(3, "mining.authorize", "0xdeadbeef.rig1", "x"); string(result) != "true" {
+		t.Fatalf("authorization failed: %s", result)
+	}
+	// Push a block too hard to be solved by any share and wait for the job
+	header := &types.Header{Number: big.NewInt(1), Difficulty: new(big.Int).Lsh(big.NewInt(1), 250)}
+	frkhash.remote.workCh <- &sealTask{block: types.NewBlockWithHeader(header), results: make(chan *types.Block, 1)}
+
+	if note := st.notification(); note.Method != "mining.set_difficulty" || note.Params[0].(float64) != 1.0/stratumDefaultDifficulty {
+		t.Fatalf("invalid difficulty notification: %+v", note)
+	}
+	note := st.notification()
+	if note.Method != "mining.notify" || len(note.Params) != 4 {
+		t.Fatalf("invalid job notification: %+v", note)
+	}
+	job := note.Params[0].(string)
+	if want := frkhash.SealHash(header); note.Params[2] != hex.EncodeToString(want[:]) {
+		t.Fatalf("job header hash mismatch: have %v, want %x", note.Params[2], want)
+	}
+	// Submit a valid share, a duplicate and a share for an unknown job
+	if result, err := st.call(4, "mining.submit", "0xdeadbeef.rig1", job, "000000000001"); string(result) != "true" {
+		t.Fatalf("valid share rejected: %s", err)
+	}
+	if _, err := st.call(5, "mining.submit", "0xdeadbeef.rig1", job, extranonce+"000000000001"); string(err) != `[22,"Duplicate share",null]` {
+		t.Fatalf("duplicate share error mismatch: %s", err)
+	}
+	if _, err := st.call(6, "mining.submit", "0xdeadbeef.rig1", "ffff", "000000000002"); string(err) != `[21,"Job not found",null]` {
+		t.Fatalf("stale share error mismatch: %s", err)
+	}
+	sessions := frkhash.remote.stratum.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("session count mismatch: have %d, want 1", len(sessions))
+	}
+	if s := sessions[0]; s.Worker != "0xdeadbeef.rig1" || s.Extranonce != extranonce || s.Accepted != 1 || s.Stale != 1 || s.Invalid != 1 || s.Blocks != 0 {
+		t.Fatalf("session accounting mismatch: %+v", s)
+	}
+	// The shares must be accounted to the worker by the remote sealer too
+	workers, _ := (&API{frkhash: frkhash}).GetWorkers()
+	if len(workers) != 1 {
+		t.Fatalf("worker count mismatch: have %d, want 1", len(workers))
+	}
+	if w := workers[0]; w.Worker != "0xdeadbeef.rig1" || w.Accepted != 1 || w.Stale != 1 || w.Invalid != 1 || w.Difficulty != 1 {
+		t.Fatalf("worker accounting mismatch: %+v", w)
+	}
+}
+
+// Tests that shares meeting the block difficulty are submitted to the sealer.
+func TestStratumBlockSolution(t *testing.T) {
+	frkhash := New(Config{PowMode: ModeTest, Stratum: StratumConfig{Addr: "127.0.0.1:0", Difficulty: 1}}, nil, false)
+	defer frkhash.Close()
+
+	st := newStratumTester(t, frkhash)
+	defer st.conn.Close()
+
+	result, _ := st.call(1, "mining.subscribe")
+	var sub []json.RawMessage
+	json.Unmarshal(result, &sub)
+	var extranonce string
+	json.Unmarshal(sub[1], &extranonce)
+	st.call(2, "mining.authorize", "rig", "")
+
+	results := make(chan *types.Block, 1)
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1)}
+	frkhash.remote.workCh <- &sealTask{block: types.NewBlockWithHeader(header), results: results}
+
+	st.notification()
+	job := st.notification().Params[0].(string)
+	if result, err := st.call(3, "mining.submit", "rig", job, "00000000002a"); string(result) != "true" {
+		t.Fatalf("block solution rejected: %s", err)
+	}
+	select {
+	case block := <-results:
+		nonce, _ := hex.DecodeString(extranonce + "00000000002a")
+		if have := block.Header().Nonce; hex.EncodeToString(have[:]) != hex.EncodeToString(nonce) {
+			t.Fatalf("sealed nonce mismatch: have %x, want %x", have, nonce)
+		}
+		if err := frkhash.verifySeal(nil, block.Header(), false); err != nil {
+			t.Fatalf("sealed block invalid: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("block solution not delivered")
+	}
+	if s := frkhash.remote.stratum.Sessions()[0]; s.Accepted != 1 || s.Blocks != 1 {
+		t.Fatalf("session accounting mismatch: %+v", s)
+	}
+}
+
+// Tests the variable share difficulty retargeting.
+func TestStratumRetarget(t *testing.T) {
+	var (
+		server = &stratumServer{config: StratumConfig{ShareTime: 10 * time.Second}}
+		job    = &stratumJob{target: new(big.Int).Div(two256, big.NewInt(1<<40))}
+		start  = time.Now()
+	)
+	tests := []struct {
+		difficulty uint64
+		elapsed    time.Duration
+		shares     uint64
+		want       uint64
+	}{
+		{1 << 30, 10 * time.Second, 100, 1 << 30},  // Window not over yet
+		{1 << 30, 40 * time.Second, 4, 1 << 30},    // On target
+		{1 << 30, 40 * time.Second, 8, 1 << 31},    // Twice too many shares
+		{1 << 30, 40 * time.Second, 1000, 1 << 32}, // Far too many shares, capped
+		{1 << 30, 40 * time.Second, 2, 1 << 29},    // Too few shares
+		{1 << 30, 80 * time.Second, 0, 1 << 28},    // Idle, capped
+		{1 << 17, 80 * time.Second, 0, 1 << 16},    // Minimum difficulty
+		{1 << 39, 40 * time.Second, 16, 1 << 40},   // Limited by block difficulty
+	}
+	for i, tt := range tests {
+		session := &stratumSession{server: server, difficulty: tt.difficulty, retarget: start, shares: tt.shares}
+		session.retargetDifficulty(job, start.Add(tt.elapsed))
+		if session.difficulty != tt.want {
+			t.Errorf("test %d: difficulty mismatch: have %d, want %d", i, session.difficulty, tt.want)
+		}
+	}
+}
+
+// Tests that workers have to present the configured password to authorize.
+func TestStratumPassword(t *testing.T) {
+	frkhash := New(Config{PowMode: ModeTest, Stratum: StratumConfig{Addr: "127.0.0.1:0", Password: "secret"}}, nil, false)
+	defer frkhash.Close()
+
+	st := newStratumTester(t, frkhash)
+	defer st.conn.Close()
+
+	st.call(1, "mining.subscribe", "tester/1.0.0", stratumProtocol)
+	if _, err := st.call(2, "mining.authorize", "worker"); string(err) == "null" {
+		t.Fatalf("worker without password authorized")
+	}
+	if _, err := st.call(3, "mining.authorize", "worker", "wrong"); string(err) == "null" {
+		t.Fatalf("worker with wrong password authorized")
+	}
+	if _, err := st.call(4, "mining.authorize", "worker", "secret"); string(err) != "null" {
+		t.Fatalf("worker with correct password rejected: %s", err)
+	}
+}
+
+// Tests that the number of sessions is limited per IP address and in total,
+// without stalling the server once the extranonce space is exhausted.
+func TestStratumSessionLimits(t *testing.T) {
+	server := &stratumServer{
+		config:     StratumConfig{MaxConnsPerIP: 2},
+		sessions:   make(map[*stratumSession]struct{}),
+		extranonce: make(map[uint16]*stratumSession),
+		conns:      make(map[string]int),
+	}
+	var sessions []*stratumSession
+	for i := 0; i < 2; i++ {
+		conn, _ := net.Pipe()
+		session, err := server.newSession(conn)
+		if err != nil {
+			t.Fatalf("session %d: failed to create session: %v", i, err)
+		}
+		sessions = append(sessions, session)
+	}
+	conn, _ := net.Pipe()
+	if _, err := server.newSession(conn); err == nil {
+		t.Fatalf("session over the per IP limit accepted")
+	}
+	server.removeSession(sessions[0])
+	if _, err := server.newSession(conn); err != nil {
+		t.Fatalf("failed to create session after disconnect: %v", err)
+	}
+	// Fill up the extranonce space and ensure new sessions are rejected
+	server.config.MaxConnsPerIP = stratumMaxSessions + 1
+	for i := 0; i < stratumMaxSessions; i++ {
+		server.extranonce[uint16(i)] = sessions[1]
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := server.newSession(conn)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("session accepted with exhausted extranonce space")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("session creation stalled with exhausted extranonce space")
+	}
+}
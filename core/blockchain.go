@@ -114,7 +114,10 @@ const (
 	// - Version 8
 	//  The following incompatible database changes were added:
 	//    * New scheme for contract code in order to separate the codes and trie nodes
-	BlockChainVersion uint64 = 8
+	// - Version 9
+	//  The following incompatible database changes were added:
+	//    * Freezer tables may be recompressed with zstd, recorded in per-table metadata
+	BlockChainVersion uint64 = 9
 )
 
 // CacheConfig contains the configuration values for the trie caching/pruning
@@ -173,6 +176,10 @@ type BlockChain struct {
 	//  * nil: disable tx reindexer/deleter, but still index new blocks
 	txLookupLimit uint64
 
+	// historyRetain is the number of recent blocks whose bodies and receipts are
+	// kept, older ones are pruned from the ancient store (0 = keep everything).
+	historyRetain uint64 // Accessed atomically
+
 	hc            *HeaderChain
 	rmLogsFeed    event.Feed
 	chainFeed     event.Feed
@@ -196,6 +203,9 @@ type BlockChain struct {
 	txLookupCache *lru.Cache     // Cache for the most recent transaction lookup data.
 	futureBlocks  *lru.Cache     // future blocks are blocks added for later processing
 
+	reorgGuard reorgGuard // Maximum reorg depth policy and manual overrides
+	pirlGuard  pirlGuard  // Runtime statistics of the side chain penalty checks
+
 	quit          chan struct{}  // blockchain quit channel
 	wg            sync.WaitGroup // chain processing wait group for shutting down
 	running       int32          // 0 if chain is running, 1 when stopped
@@ -307,8 +317,9 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 			}
 		}
 	}
-	// Ensure that a previous crash in SetHead doesn't leave extra ancients
-	if frozen, err := bc.db.Ancients(); err == nil && frozen > 0 {
+	// Ensure that a previous crash in SetHead doesn't leave extra ancients. Shared
+	// ancients are maintained by another node and are expected to run ahead.
+	if frozen, err := bc.db.Ancients(); err == nil && frozen > 0 && !rawdb.HasRemoteAncients(bc.db) {
 		var (
 			needRewind bool
 			low        uint64
@@ -375,6 +386,9 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	}
 	// Take ownership of this particular state
 	go bc.update()
+
+	bc.wg.Add(1)
+	go bc.maintainHistory()
 	if txLookupLimit != nil {
 		bc.txLookupLimit = *txLookupLimit
 
@@ -500,6 +514,9 @@ func (bc *BlockChain) SetHeadBeyondRoot(head uint64, root common.Hash) (uint64,
 	pivot := rawdb.ReadLastPivotNumber(bc.db)
 	frozen, _ := bc.db.Ancients()
 
+	// Shared ancients are read only, only the local chain data can be rewound
+	remote := rawdb.HasRemoteAncients(bc.db)
+
 	updateFn := func(db ethdb.KeyValueWriter, header *types.Header) (uint64, bool) {
 		// Rewind the block chain, ensuring we don't end up with a stateless head
 		// block. Note, depth equality is permitted to allow using SetHead as a
@@ -574,7 +591,7 @@ func (bc *BlockChain) SetHeadBeyondRoot(head uint64, root common.Hash) (uint64,
 		// intent afterwards is full block importing, delete the chain segment
 		// between the stateful-block and the sethead target.
 		var wipe bool
-		if head+1 < frozen {
+		if head+1 < frozen && !remote {
 			wipe = pivot == nil || head >= *pivot
 		}
 		return head, wipe // Only force wipe if full synced
@@ -583,7 +600,7 @@ func (bc *BlockChain) SetHeadBeyondRoot(head uint64, root common.Hash) (uint64,
 	delFn := func(db ethdb.KeyValueWriter, hash common.Hash, num uint64) {
 		// Ignore the error here since light client won't hit this path
 		frozen, _ := bc.db.Ancients()
-		if num+1 <= frozen {
+		if num+1 <= frozen && !remote {
 			// Truncate all relative data(header, total difficulty, body, receipt
 			// and canonical hash) from ancient store.
 			if err := bc.db.TruncateAncients(num); err != nil {
@@ -1691,11 +1708,9 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 	abort, results := bc.engine.VerifyHeaders(bc, headers, seals)
 	defer close(abort)
 
-	errChain := error(nil)
-
-	//if(bc.CurrentBlock().NumberU64() > bc.chainConfig.PirlGuardBlock){
-	//	errChain = bc.checkChainForAttack(chain, bc.chainConfig.PirlGuardLength)
-	//}
+	// Reject side chains forking off below the finality depth or which were
+	// withheld from the network for too long
+	rejected, errChain := bc.checkSideChain(chain)
 
 	// Peek the error for the first block to decide the directing import logic
 	it := newInsertIterator(chain, results, bc.validator)
@@ -1744,6 +1759,14 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		// Falls through to the block import
 	}
 	switch {
+	// Side chain was refused by the reorg policies, reject it before any import
+	case errors.Is(errChain, ErrReorgTooDeep) || errors.Is(errChain, ErrPenaltyInChain):
+		if rejected != nil && it.verifyHeaders() == nil {
+			bc.rejectReorg(rejected)
+		}
+		stats.ignored += len(it.chain)
+		return it.index, errChain
+
 	// First block is pruned, insert as sidechain and reorg only if TD grows enough
 	case errors.Is(err, consensus.ErrPrunedAncestor):
 		log.Debug("Pruned ancestor, inserting as sidechain", "number", block.Number(), "hash", block.Hash())
@@ -1764,11 +1787,6 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		// If there are any still remaining, mark as ignored
 		return it.index, err
 
-	case errChain == ErrPenaltyInChain:
-		stats.ignored += len(it.chain)
-		bc.reportBlock(block, nil, errChain)
-		return it.index, errChain
-
 	// Some other error occurred, abort
 	case err != nil:
 		bc.futureBlocks.Remove(block.Hash())
@@ -142,6 +142,20 @@ func (it *insertIterator) peek() (*types.Block, error) {
 	return it.chain[it.index+1], nil
 }
 
+// verifyHeaders waits for the header verification of all the blocks in the
+// iterator and returns the first failure, without advancing the iterator.
+func (it *insertIterator) verifyHeaders() error {
+	for len(it.errors) < len(it.chain) {
+		it.errors = append(it.errors, <-it.results)
+	}
+	for _, err := range it.errors {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // previous returns the previous header that was being processed, or nil.
 func (it *insertIterator) previous() *types.Header {
 	if it.index < 1 {
@@ -2295,6 +2295,83 @@ func TestSkipStaleTxIndicesInFastSync(t *testing.T) {
 	check(&tail, chain)
 }
 
+// Tests that a chain opened on a shared ancient store maintained by another node
+// doesn't try to truncate the ancients if its local head lags behind them, and
+// that it can still catch up and rewind its local chain.
+func TestBlockChainWithLaggingRemoteAncients(t *testing.T) {
+	var (
+		gendb   = rawdb.NewMemoryDatabase()
+		gspec   = &Genesis{Config: params.TestChainConfig, BaseFee: big.NewInt(params.InitialBaseFee)}
+		genesis = gspec.MustCommit(gendb)
+	)
+	blocks, receipts := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 64, nil)
+
+	// Fill the shared ancient store the way the maintaining node would
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "", false)
+	if err != nil {
+		t.Fatalf("failed to create temp freezer db: %v", err)
+	}
+	gspec.MustCommit(ancientDb)
+	chain, err := NewBlockChain(ancientDb, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if n, err := chain.InsertHeaderChain(headers, 0); err != nil {
+		t.Fatalf("failed to insert header %d: %v", n, err)
+	}
+	if n, err := chain.InsertReceiptChain(blocks, receipts, 64); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	chain.Stop()
+	ancientDb.Close()
+
+	// Open a fresh node on top of the shared ancients, its head is the genesis
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), "file://"+frdir, "", false)
+	if err != nil {
+		t.Fatalf("failed to open database with remote ancients: %v", err)
+	}
+	defer db.Close()
+	gspec.MustCommit(db)
+
+	chain, err = NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if head := chain.CurrentBlock().NumberU64(); head != 0 {
+		t.Fatalf("head block mismatch: have %d, want 0", head)
+	}
+	if frozen, _ := db.Ancients(); frozen != 65 {
+		t.Fatalf("ancients mismatch: have %d, want 65", frozen)
+	}
+	// Catch up with the chain and rewind it again, leaving the ancients alone
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != 64 {
+		t.Fatalf("head block mismatch: have %d, want 64", head)
+	}
+	if err := chain.SetHead(32); err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != 32 {
+		t.Fatalf("head block mismatch: have %d, want 32", head)
+	}
+	if frozen, _ := db.Ancients(); frozen != 65 {
+		t.Fatalf("ancients mismatch after rewind: have %d, want 65", frozen)
+	}
+}
+
 // Benchmarks large blocks with value transfers to non-existing accounts
 func benchmarkLargeNumberOfValueToNonexisting(b *testing.B, numTxs, numBlocks int, recipientFn func(uint64) common.Address, dataFn func(uint64) []byte) {
 	var (
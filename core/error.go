@@ -53,6 +53,10 @@ var (
 	// In that case the chain must be discarded and peer dropped.
 	ErrPenaltyInChain = errors.New("penalty in chain")
 
+	// ErrReorgTooDeep is returned if the provided chain forks off the canonical
+	// chain deeper below the head than the local reorg depth limit allows.
+	ErrReorgTooDeep = errors.New("reorg exceeds maximum depth")
+
 	// ErrGasLimitReached is returned by the gas pool if the amount of gas required
 	// by a transaction is higher than what's left in the block.
 	ErrGasLimitReached = errors.New("gas limit reached")
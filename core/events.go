@@ -24,6 +24,13 @@ import (
 // NewTxsEvent is posted when a batch of transactions enter the transaction pool.
 type NewTxsEvent struct{ Txs []*types.Transaction }
 
+// PrivateTxsReleasedEvent is posted when private transactions pass their
+// deadline without being mined and may be broadcast to the network.
+type PrivateTxsReleasedEvent struct{ Txs []*types.Transaction }
+
+// TxLifecycleEvent is posted when transactions change state in the pool.
+type TxLifecycleEvent struct{ Changes []*TxLifecycle }
+
 // NewMinedBlockEvent is posted when a block has been imported.
 type NewMinedBlockEvent struct{ Block *types.Block }
 
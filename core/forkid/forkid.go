@@ -22,9 +22,6 @@ import (
 	"errors"
 	"hash/crc32"
 	"math"
-	"math/big"
-	"reflect"
-	"strings"
 
 	"github.com/expanse-org/go-expanse/common"
 	"github.com/expanse-org/go-expanse/core/types"
@@ -213,24 +210,11 @@ func checksumToBytes(hash uint32) [4]byte {
 
 // gatherForks gathers all the known forks and creates a sorted list out of them.
 func gatherForks(config *params.ChainConfig) []uint64 {
-	// Gather all the fork block numbers via reflection
-	kind := reflect.TypeOf(params.ChainConfig{})
-	conf := reflect.ValueOf(config).Elem()
-
+	// Gather all the scheduled fork block numbers
 	var forks []uint64
-	for i := 0; i < kind.NumField(); i++ {
-		// Fetch the next field and skip non-fork rules
-		field := kind.Field(i)
-		if !strings.HasSuffix(field.Name, "Block") {
-			continue
-		}
-		if field.Type != reflect.TypeOf(new(big.Int)) {
-			continue
-		}
-		// Extract the fork rule block number and aggregate it
-		rule := conf.Field(i).Interface().(*big.Int)
-		if rule != nil {
-			forks = append(forks, rule.Uint64())
+	for _, fork := range config.Forks() {
+		if fork.Block != nil {
+			forks = append(forks, fork.Block.Uint64())
 		}
 	}
 	// Sort the fork block numbers to permit chronological XOR
@@ -18,7 +18,9 @@ package forkid
 
 import (
 	"bytes"
+	"encoding/binary"
 	"math"
+	"math/big"
 	"testing"
 
 	"github.com/expanse-org/go-expanse/common"
@@ -223,6 +225,92 @@ func TestValidation(t *testing.T) {
 	}
 }
 
+// Tests that node-local chain policies such as the Pirl Guard are not treated as
+// forks, so enabling them doesn't change the fork ID announced to peers.
+func TestPolicyExclusion(t *testing.T) {
+	config := *params.MainnetChainConfig
+	config.PirlGuardBlock = big.NewInt(1_234_567)
+	config.PirlGuardLength = 1
+
+	for _, head := range []uint64{0, 1_234_567, 10_000_000} {
+		want := NewID(params.MainnetChainConfig, params.MainnetGenesisHash, head)
+		if have := NewID(&config, params.MainnetGenesisHash, head); have != want {
+			t.Errorf("head %d: fork ID mismatch: have %x, want %x", head, have, want)
+		}
+	}
+}
+
+// Tests that the frkhash seal algorithm transitions are part of the fork ID, so
+// that nodes disagreeing on the seal function don't peer.
+func TestFrkhashAlgorithmForks(t *testing.T) {
+	config := *params.MainnetChainConfig
+	config.Frkhash = &params.FrkhashConfig{
+		AlgorithmSchedule: []params.FrkhashAlgorithmFork{
+			{Block: big.NewInt(20_000_000), Algorithm: "sha3-256"},
+			{Block: big.NewInt(30_000_000), Algorithm: "blake2b"},
+		},
+	}
+	var (
+		genesis = params.MainnetGenesisHash
+		base    = NewID(params.MainnetChainConfig, genesis, 10_000_000).Hash
+		first   = checksumUpdate(binary.BigEndian.Uint32(base[:]), 20_000_000)
+		second  = checksumUpdate(first, 30_000_000)
+	)
+	tests := []struct {
+		head uint64
+		want ID
+	}{
+		{10_000_000, ID{Hash: base, Next: 20_000_000}},
+		{19_999_999, ID{Hash: base, Next: 20_000_000}},
+		{20_000_000, ID{Hash: checksumToBytes(first), Next: 30_000_000}},
+		{30_000_000, ID{Hash: checksumToBytes(second), Next: 0}},
+	}
+	for i, tt := range tests {
+		if have := NewID(&config, genesis, tt.head); have != tt.want {
+			t.Errorf("test %d: fork ID mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+	// A node without the algorithm schedule must be rejected past the transition
+	filter := newFilter(&config, genesis, func() uint64 { return 20_000_000 })
+	if err := filter(NewID(params.MainnetChainConfig, genesis, 20_000_000)); err != ErrRemoteStale {
+		t.Errorf("unscheduled peer: have %v, want %v", err, ErrRemoteStale)
+	}
+}
+
+// Tests that the frkhash reward transitions are part of the fork ID, so that
+// nodes disagreeing on the block rewards don't peer.
+func TestFrkhashRewardForks(t *testing.T) {
+	config := *params.MainnetChainConfig
+	config.Frkhash = &params.FrkhashConfig{
+		AlgorithmSchedule: []params.FrkhashAlgorithmFork{
+			{Block: big.NewInt(20_000_000), Algorithm: "sha3-256"},
+		},
+		RewardSchedule: []params.FrkhashRewardFork{
+			{Block: big.NewInt(20_000_000), BlockReward: big.NewInt(2e18)},
+			{Block: big.NewInt(25_000_000), BlockReward: big.NewInt(1e18)},
+		},
+	}
+	var (
+		genesis = params.MainnetGenesisHash
+		base    = NewID(params.MainnetChainConfig, genesis, 10_000_000).Hash
+		first   = checksumUpdate(binary.BigEndian.Uint32(base[:]), 20_000_000)
+		second  = checksumUpdate(first, 25_000_000)
+	)
+	tests := []struct {
+		head uint64
+		want ID
+	}{
+		{10_000_000, ID{Hash: base, Next: 20_000_000}},
+		{20_000_000, ID{Hash: checksumToBytes(first), Next: 25_000_000}}, // Shared with the algorithm fork
+		{25_000_000, ID{Hash: checksumToBytes(second), Next: 0}},
+	}
+	for i, tt := range tests {
+		if have := NewID(&config, genesis, tt.head); have != tt.want {
+			t.Errorf("test %d: fork ID mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+}
+
 // Tests that IDs are properly RLP encoded (specifically important because we
 // use uint32 to store the hash, but we need to encode it as [4]byte).
 func TestEncoding(t *testing.T) {
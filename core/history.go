@@ -0,0 +1,89 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"sync/atomic"
+
+	"github.com/expanse-org/go-expanse/core/rawdb"
+	"github.com/expanse-org/go-expanse/log"
+)
+
+// SetHistoryRetain sets the number of recent blocks whose bodies and receipts
+// are kept. Older ones are pruned from the ancient store as the chain advances.
+// Zero retains the entire history.
+func (bc *BlockChain) SetHistoryRetain(blocks uint64) {
+	atomic.StoreUint64(&bc.historyRetain, blocks)
+}
+
+// HistoryRetain returns the number of recent blocks whose bodies and receipts
+// are kept, zero if the entire history is retained.
+func (bc *BlockChain) HistoryRetain() uint64 {
+	return atomic.LoadUint64(&bc.historyRetain)
+}
+
+// HistoryTail returns the number of the oldest block whose body and receipts
+// are still available.
+func (bc *BlockChain) HistoryTail() uint64 {
+	return rawdb.ReadHistoryTail(bc.db)
+}
+
+// maintainHistory is responsible for the deletion of the bodies and receipts
+// of the blocks older than the configured history retention.
+//
+// Only the ancient store is pruned, so history is never dropped before being
+// frozen. Since the freezer deletes whole data files, some blocks below the
+// tail may physically remain, but they are not served anymore.
+func (bc *BlockChain) maintainHistory() {
+	defer bc.wg.Done()
+
+	var (
+		done   chan struct{}                  // Non-nil if background pruning routine is active.
+		headCh = make(chan ChainHeadEvent, 1) // Buffered to avoid locking up the event feed
+	)
+	sub := bc.SubscribeChainHeadEvent(headCh)
+	if sub == nil {
+		return
+	}
+	defer sub.Unsubscribe()
+
+	prune := func(tail uint64, done chan struct{}) {
+		defer func() { done <- struct{}{} }()
+
+		if _, err := rawdb.PruneHistory(bc.db, tail, bc.quit); err != nil {
+			log.Error("Failed to prune chain history", "tail", tail, "err", err)
+		}
+	}
+	for {
+		select {
+		case head := <-headCh:
+			retain, number := bc.HistoryRetain(), head.Block.NumberU64()
+			if done == nil && retain != 0 && number >= retain {
+				done = make(chan struct{})
+				go prune(number-retain+1, done)
+			}
+		case <-done:
+			done = nil
+		case <-bc.quit:
+			if done != nil {
+				log.Info("Waiting background history pruner to exit")
+				<-done
+			}
+			return
+		}
+	}
+}
@@ -1,137 +1,159 @@
+// Copyright 2014 The go-ethereum Authors
+// Copyright 2018 Pirl Sprl
+// This file is part of the go-ethereum library modified with Pirl Security Protocol.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see http://www.gnu.org/licenses/.
+
 package core
 
 import (
-	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/expanse-org/go-expanse/common"
 	"github.com/expanse-org/go-expanse/core/types"
 	"github.com/expanse-org/go-expanse/log"
-	//"github.com/expanse-org/go-expanse/params"
-	"sort"
+	"github.com/expanse-org/go-expanse/metrics"
 )
 
-var syncStatus bool
-func (bc *BlockChain) checkChainForAttack(blocks types.Blocks, PenaltyCheckLength uint64) error {
-	// Copyright 2014 The go-ethereum Authors
-	// Copyright 2018 Pirl Sprl
-	// This file is part of the go-ethereum library modified with Pirl Security Protocol.
-	//
-	// The go-ethereum library is free software: you can redistribute it and/or modify
-	// it under the terms of the GNU Lesser General Public License as published by
-	// the Free Software Foundation, either version 3 of the License, or
-	// (at your option) any later version.
-	//
-	// The go-ethereum library is distributed in the hope that it will be useful,
-	// but WITHOUT ANY WARRANTY; without even the implied warranty of
-	// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
-	// GNU Lesser General Public License for more details.
-	//
-	// You should have received a copy of the GNU Lesser General Public License
-	// along with the go-ethereum library. If not, see http://www.gnu.org/licenses/.
-	// Package core implements the Ethereum consensus protocol modified with Pirl Security Protocol.
-
-	err := errors.New("")
-	err = nil
-	timeMap := make(map[uint64]int64)
-	tipOfTheMainChain := bc.CurrentBlock().NumberU64()
-
-	if !syncStatus {
-		if tipOfTheMainChain == blocks[0].NumberU64() - 1 {
-			//fmt.Println("We are synced")
-			syncStatus = true
-		} else {
-			//fmt.Println("Still syncing!")
-			syncStatus = false
-		}
-	}
+var (
+	pirlGuardCheckMeter   = metrics.NewRegisteredMeter("chain/pirlguard/checks", nil)
+	pirlGuardRejectMeter  = metrics.NewRegisteredMeter("chain/pirlguard/rejects", nil)
+	pirlGuardPenaltyGauge = metrics.NewRegisteredGauge("chain/pirlguard/penalty", nil)
+)
 
+// PirlGuardStatus is a snapshot of the Pirl Guard configuration and the outcome
+// of the side chain checks it ran since the node started.
+type PirlGuardStatus struct {
+	Enabled         bool     `json:"enabled"`         // Whether the guard is active at the current head
+	ActivationBlock *big.Int `json:"activationBlock"` // Block number the guard activates at (nil = never)
+	Length          uint64   `json:"length"`          // Reorg depth tolerated without a penalty check
 
-	if len(blocks) > 0 {
-		if syncStatus && len(blocks) > int(PenaltyCheckLength) {
-			for _, b := range blocks {
-				timeMap[b.NumberU64()] = calculatePenaltyTimeForBlock(tipOfTheMainChain, b.NumberU64())
-			}
-		}
-	}
-	p := make(PairList, len(timeMap))
-	index := 0
-	for k, v := range timeMap {
-		p[index] = Pair {k, v}
-		index++
-	}
-	sort.Sort(p)
-	var penalty int64
-	for _, v := range p {
-		penalty += v.Value
-	}
+	Checks   uint64 `json:"checks"`   // Number of side chains the penalty was computed for
+	Rejected uint64 `json:"rejected"` // Number of side chains rejected with a penalty
 
-	multi := calculateMulti(bc.CurrentBlock().Difficulty().Uint64())
-	penalty = penalty * int64(multi)
+	LastPenalty        int64       `json:"lastPenalty"`        // Penalty of the most recently checked side chain
+	LastForkNumber     uint64      `json:"lastForkNumber"`     // Fork point of the most recently checked side chain
+	LastRejectedHash   common.Hash `json:"lastRejectedHash"`   // Hash of the first block of the last rejected side chain
+	LastRejectedNumber uint64      `json:"lastRejectedNumber"` // Number of the first block of the last rejected side chain
+}
 
-	if penalty < 0 {
-		penalty = 0
-	}
+// pirlGuard tracks the runtime statistics of the reorg penalty checks.
+type pirlGuard struct {
+	lock   sync.Mutex
+	status PirlGuardStatus
+}
 
-	context := []interface{}{
-		"synced", syncStatus, "number", tipOfTheMainChain, "incoming_number", blocks[0].NumberU64() - 1, "penalty", penalty ,"implementation", "EXP / Pirl Teams",
-	}
-  // this log could probably be turned off or turned on with debug
-	log.Debug("Checking legitimacy of the chain", context... )
-
-	if penalty > 0 {
-		context := []interface{}{
-			"penalty", penalty,
-		}
-		log.Error("Malicious chain detected and we should reject it", context... )
-		err = ErrPenaltyInChain
+// PirlGuardStatus returns the current configuration and statistics of the Pirl
+// Guard reorg penalty subsystem.
+func (bc *BlockChain) PirlGuardStatus() PirlGuardStatus {
+	bc.pirlGuard.lock.Lock()
+	status := bc.pirlGuard.status
+	bc.pirlGuard.lock.Unlock()
+
+	status.Enabled = bc.chainConfig.IsPirlGuard(bc.CurrentBlock().Number())
+	if bc.chainConfig.PirlGuardBlock != nil {
+		status.ActivationBlock = new(big.Int).Set(bc.chainConfig.PirlGuardBlock)
 	}
+	status.Length = bc.chainConfig.PirlGuardLength
+	return status
+}
 
+// checkChainForAttack verifies whether the given side chain, forking off the
+// canonical chain at the given header, was withheld from the network for an
+// unreasonable time before being released. The chain is measured from its fork
+// point, so plain chain extensions (i.e. syncing) are never penalised.
+// ErrPenaltyInChain is returned if the side chain should be rejected.
+func (bc *BlockChain) checkChainForAttack(chain types.Blocks, fork *types.Header) error {
+	current := bc.CurrentBlock()
+	if !bc.chainConfig.IsPirlGuard(current.Number()) {
+		return nil
+	}
+	var (
+		head   = current.NumberU64()
+		number = fork.Number.Uint64()
+		tip    = chain[len(chain)-1].NumberU64()
+	)
+	if number >= head || head-number <= bc.chainConfig.PirlGuardLength {
+		return nil
+	}
+	penalty := pirlGuardPenalty(head, number, tip, current.Difficulty())
+
+	pirlGuardCheckMeter.Mark(1)
+	pirlGuardPenaltyGauge.Update(penalty)
+
+	bc.pirlGuard.lock.Lock()
+	defer bc.pirlGuard.lock.Unlock()
+
+	bc.pirlGuard.status.Checks++
+	bc.pirlGuard.status.LastPenalty = penalty
+	bc.pirlGuard.status.LastForkNumber = number
+
+	log.Debug("Checking legitimacy of the chain", "number", head, "fork", number, "tip", tip, "penalty", penalty)
 	if penalty == 0 {
-		err = nil
+		return nil
 	}
+	pirlGuardRejectMeter.Mark(1)
+	bc.pirlGuard.status.Rejected++
+	bc.pirlGuard.status.LastRejectedHash = chain[0].Hash()
+	bc.pirlGuard.status.LastRejectedNumber = chain[0].NumberU64()
+
+	log.Error("Malicious chain detected, rejecting", "number", chain[0].Number(), "hash", chain[0].Hash(),
+		"fork", number, "depth", head-number, "penalty", penalty)
+	return ErrPenaltyInChain
+}
 
-	return err
+// pirlGuardPenalty computes the penalty of a side chain forking off the canonical
+// chain after block fork and reaching up to block tip, measured against the local
+// head. Every side chain block at or below the head is penalised by the number of
+// blocks it lags behind the head, every block extending past the head reduces the
+// penalty by one. The result is scaled by the difficulty multiplier and is never
+// negative.
+func pirlGuardPenalty(head, fork, tip uint64, difficulty *big.Int) int64 {
+	var penalty int64
+	for number := fork + 1; number <= tip; number++ {
+		penalty += calculatePenaltyTimeForBlock(head, number)
+	}
+	penalty *= int64(calculateMulti(difficulty.Uint64()))
+	if penalty < 0 {
+		penalty = 0
+	}
+	return penalty
 }
 
-func calculatePenaltyTimeForBlock(tipOfTheMainChain , incomingBlock uint64) int64 {
+func calculatePenaltyTimeForBlock(tipOfTheMainChain, incomingBlock uint64) int64 {
 	if incomingBlock < tipOfTheMainChain {
 		return int64(tipOfTheMainChain - incomingBlock)
 	}
 	if incomingBlock == tipOfTheMainChain {
 		return 0
 	}
-	if incomingBlock > tipOfTheMainChain {
-		return -1
-	}
-	return 0
+	return -1
 }
 
 func calculateMulti(diff uint64) uint64 {
 	if diff <= 500000000 {
 		return 5
 	}
-	if diff >= 500000000 && diff < 20000000000 {
+	if diff < 20000000000 {
 		return 4
 	}
-	if diff >= 20000000000 && diff < 30000000000 {
+	if diff < 30000000000 {
 		return 3
 	}
-	if diff >= 30000000000 && diff < 50000000000 {
+	if diff < 50000000000 {
 		return 2
 	}
-	if diff >= 50000000000 {
-		return 1
-	}
 	return 1
 }
-
-// A data structure to hold key/value pairs
-type Pair struct {
-	Key   uint64
-	Value int64
-}
-
-// A slice of pairs that implements sort.Interface to sort by values
-type PairList []Pair
-
-func (p PairList) Len() int           { return len(p) }
-func (p PairList) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
-func (p PairList) Less(i, j int) bool { return p[i].Key < p[j].Key }
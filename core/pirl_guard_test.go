@@ -0,0 +1,127 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/consensus/ethash"
+	"github.com/expanse-org/go-expanse/core/rawdb"
+	"github.com/expanse-org/go-expanse/core/vm"
+	"github.com/expanse-org/go-expanse/params"
+)
+
+// Tests the penalty computation against the fork point of a side chain.
+func TestPirlGuardPenalty(t *testing.T) {
+	var (
+		easy = big.NewInt(131072)
+		hard = big.NewInt(60000000000)
+	)
+	tests := []struct {
+		head, fork, tip uint64
+		difficulty      *big.Int
+		penalty         int64
+	}{
+		{100, 100, 110, easy, 0},  // Plain chain extension
+		{100, 99, 101, easy, 0},   // Single block reorg overtaking the head
+		{100, 97, 103, easy, 0},   // Reorg released early enough to overtake
+		{100, 90, 101, easy, 220}, // Ten blocks withheld, one block on top: (45 - 1) * 5
+		{100, 90, 101, hard, 44},  // Same as above on a high difficulty chain
+		{100, 90, 95, easy, 175},  // Side chain still behind the head: (9+8+7+6+5) * 5
+		{100, 80, 300, easy, 0},   // Deep fork, but extended far past the head
+	}
+	for i, tt := range tests {
+		if penalty := pirlGuardPenalty(tt.head, tt.fork, tt.tip, tt.difficulty); penalty != tt.penalty {
+			t.Errorf("test %d: penalty mismatch: have %d, want %d", i, penalty, tt.penalty)
+		}
+	}
+}
+
+// Tests that honest reorgs pass the Pirl Guard, whereas side chains that were
+// mined in private and released late are rejected.
+func TestPirlGuardReorgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		depth    int // Number of canonical blocks the side chain forks off below the head
+		extra    int // Number of side chain blocks past the current head
+		rejected bool
+	}{
+		{"extension", true, 0, 5, false},
+		{"uncle", true, 1, 0, false},
+		{"honest single block reorg", true, 1, 1, false},
+		{"honest reorg at guard length", true, 3, 1, false},
+		{"deep reorg released early", true, 6, 20, false},
+		{"delayed release", true, 10, 1, true},
+		{"delayed release behind head", true, 12, 0, true},
+		{"delayed long release", true, 24, 4, true},
+		{"delayed release guard disabled", false, 10, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := *params.TestChainConfig
+			if tt.enabled {
+				config.PirlGuardBlock = big.NewInt(0)
+				config.PirlGuardLength = 3
+			}
+			var (
+				db      = rawdb.NewMemoryDatabase()
+				genesis = (&Genesis{Config: &config, BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+				engine  = ethash.NewFaker()
+			)
+			canon, _ := GenerateChain(&config, genesis, engine, db, 32, func(i int, b *BlockGen) {})
+
+			chain, err := NewBlockChain(db, nil, &config, engine, vm.Config{}, nil, nil)
+			if err != nil {
+				t.Fatalf("failed to create tester chain: %v", err)
+			}
+			defer chain.Stop()
+
+			if _, err := chain.InsertChain(canon); err != nil {
+				t.Fatalf("failed to insert canonical chain: %v", err)
+			}
+			head := chain.CurrentBlock()
+
+			parent := canon[len(canon)-1-tt.depth]
+			side, _ := GenerateChain(&config, parent, engine, db, tt.depth+tt.extra, func(i int, b *BlockGen) {
+				b.SetCoinbase(common.Address{0x01})
+			})
+			_, err = chain.InsertChain(side)
+			if tt.rejected {
+				if !errors.Is(err, ErrPenaltyInChain) {
+					t.Fatalf("side chain error mismatch: have %v, want %v", err, ErrPenaltyInChain)
+				}
+				if chain.CurrentBlock().Hash() != head.Hash() {
+					t.Fatalf("head changed after rejected side chain")
+				}
+				if status := chain.PirlGuardStatus(); status.Rejected != 1 || status.LastRejectedHash != side[0].Hash() {
+					t.Fatalf("rejection not recorded: %+v", status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to insert honest side chain: %v", err)
+			}
+			if status := chain.PirlGuardStatus(); status.Enabled != tt.enabled || status.Rejected != 0 {
+				t.Fatalf("status mismatch: %+v", status)
+			}
+		})
+	}
+}
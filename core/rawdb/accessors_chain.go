@@ -252,6 +252,24 @@ func WriteTxIndexTail(db ethdb.KeyValueWriter, number uint64) {
 	}
 }
 
+// ReadHistoryTail retrieves the number of the oldest block whose body and
+// receipts are retained. Everything below was pruned by history expiry.
+func ReadHistoryTail(db ethdb.KeyValueReader) uint64 {
+	data, _ := db.Get(historyTailKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteHistoryTail stores the number of the oldest block whose body and receipts
+// are retained into database.
+func WriteHistoryTail(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(historyTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the history tail", "err", err)
+	}
+}
+
 // ReadFastTxLookupLimit retrieves the tx lookup limit used in fast sync.
 func ReadFastTxLookupLimit(db ethdb.KeyValueReader) *uint64 {
 	data, _ := db.Get(fastTxLookupLimitKey)
@@ -799,6 +817,70 @@ func DeleteBadBlocks(db ethdb.KeyValueWriter) {
 	}
 }
 
+// RejectedReorg is a side chain that was refused by the local reorg depth policy.
+type RejectedReorg struct {
+	Number     uint64      `json:"number"`     // Number of the first rejected side chain block
+	Hash       common.Hash `json:"hash"`       // Hash of the first rejected side chain block
+	ForkNumber uint64      `json:"forkNumber"` // Number of the common ancestor with the canonical chain
+	HeadNumber uint64      `json:"headNumber"` // Local head block number at the time of rejection
+	Origin     string      `json:"origin"`     // Identifier of the peer the side chain was received from
+	Time       uint64      `json:"time"`       // Unix timestamp of the rejection
+}
+
+// ReadRejectedReorg retrieves the rejected side chain record of the given block.
+func ReadRejectedReorg(db ethdb.KeyValueReader, hash common.Hash, number uint64) *RejectedReorg {
+	blob, err := db.Get(rejectedReorgKey(number, hash))
+	if err != nil || len(blob) == 0 {
+		return nil
+	}
+	var reorg RejectedReorg
+	if err := rlp.DecodeBytes(blob, &reorg); err != nil {
+		log.Error("Invalid rejected reorg RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return &reorg
+}
+
+// ReadAllRejectedReorgs retrieves all the rejected side chain records in the
+// database, ordered by block number.
+func ReadAllRejectedReorgs(db ethdb.Iteratee) []*RejectedReorg {
+	it := db.NewIterator(rejectedReorgPrefix, nil)
+	defer it.Release()
+
+	var reorgs []*RejectedReorg
+	for it.Next() {
+		if len(it.Key()) != len(rejectedReorgPrefix)+8+common.HashLength {
+			continue
+		}
+		var reorg RejectedReorg
+		if err := rlp.DecodeBytes(it.Value(), &reorg); err != nil {
+			log.Error("Invalid rejected reorg RLP", "key", it.Key(), "err", err)
+			continue
+		}
+		reorgs = append(reorgs, &reorg)
+	}
+	return reorgs
+}
+
+// WriteRejectedReorg stores the record of a side chain refused by the reorg
+// depth policy.
+func WriteRejectedReorg(db ethdb.KeyValueWriter, reorg *RejectedReorg) {
+	data, err := rlp.EncodeToBytes(reorg)
+	if err != nil {
+		log.Crit("Failed to RLP encode rejected reorg", "err", err)
+	}
+	if err := db.Put(rejectedReorgKey(reorg.Number, reorg.Hash), data); err != nil {
+		log.Crit("Failed to store rejected reorg", "err", err)
+	}
+}
+
+// DeleteRejectedReorg removes the rejected side chain record of the given block.
+func DeleteRejectedReorg(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
+	if err := db.Delete(rejectedReorgKey(number, hash)); err != nil {
+		log.Crit("Failed to delete rejected reorg", "err", err)
+	}
+}
+
 // FindCommonAncestor returns the last common ancestor of two block headers
 func FindCommonAncestor(db ethdb.Reader, a, b *types.Header) *types.Header {
 	for bn := b.Number.Uint64(); a.Number.Uint64() > bn; {
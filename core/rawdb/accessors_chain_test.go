@@ -258,6 +258,34 @@ func TestBadBlockStorage(t *testing.T) {
 	}
 }
 
+// Tests rejected reorg storage and retrieval operations.
+func TestRejectedReorgStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	first := &RejectedReorg{Number: 20, Hash: common.Hash{0x01}, ForkNumber: 10, HeadNumber: 30, Origin: "peer-1", Time: 1}
+	second := &RejectedReorg{Number: 5, Hash: common.Hash{0x02}, ForkNumber: 2, HeadNumber: 31, Time: 2}
+
+	if entry := ReadRejectedReorg(db, first.Hash, first.Number); entry != nil {
+		t.Fatalf("Non existent rejected reorg returned: %v", entry)
+	}
+	WriteRejectedReorg(db, first)
+	WriteRejectedReorg(db, second)
+
+	if entry := ReadRejectedReorg(db, first.Hash, first.Number); entry == nil {
+		t.Fatalf("Stored rejected reorg not found")
+	} else if *entry != *first {
+		t.Fatalf("Retrieved rejected reorg mismatch: have %v, want %v", entry, first)
+	}
+	reorgs := ReadAllRejectedReorgs(db)
+	if len(reorgs) != 2 || *reorgs[0] != *second || *reorgs[1] != *first {
+		t.Fatalf("Rejected reorg listing mismatch: have %v", reorgs)
+	}
+	DeleteRejectedReorg(db, first.Hash, first.Number)
+	if entry := ReadRejectedReorg(db, first.Hash, first.Number); entry != nil {
+		t.Fatalf("Deleted rejected reorg returned: %v", entry)
+	}
+}
+
 // Tests block total difficulty storage and retrieval operations.
 func TestTdStorage(t *testing.T) {
 	db := NewMemoryDatabase()
@@ -175,3 +175,85 @@ func DeleteBloombits(db ethdb.Database, bit uint, from uint64, to uint64) {
 		log.Crit("Failed to delete bloom bits", "err", it.Error())
 	}
 }
+
+// ReadTransfers retrieves at most limit value transfers touching the given
+// address, in chain order, starting at the given block number and position
+// within the block.
+func ReadTransfers(db ethdb.Iteratee, address common.Address, number uint64, index uint32, limit int) []*types.Transfer {
+	prefix := append(append([]byte{}, transferPrefix...), address.Bytes()...)
+	it := db.NewIterator(prefix, transferKey(address, number, index)[len(prefix):])
+	defer it.Release()
+
+	var transfers []*types.Transfer
+	for len(transfers) < limit && it.Next() {
+		if len(it.Key()) != len(prefix)+12 {
+			continue
+		}
+		transfer := new(types.Transfer)
+		if err := rlp.DecodeBytes(it.Value(), transfer); err != nil {
+			log.Error("Invalid transfer RLP", "address", address, "key", it.Key(), "err", err)
+			return nil
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers
+}
+
+// WriteTransfers stores the value transfers executed in a block, indexed by
+// both their sender and their recipient.
+func WriteTransfers(db ethdb.KeyValueWriter, number uint64, transfers []*types.Transfer) {
+	var (
+		addresses []common.Address
+		seen      = make(map[common.Address]struct{})
+	)
+	for _, transfer := range transfers {
+		blob, err := rlp.EncodeToBytes(transfer)
+		if err != nil {
+			log.Crit("Failed to encode transfer", "err", err)
+		}
+		for _, address := range []common.Address{transfer.From, transfer.To} {
+			if err := db.Put(transferKey(address, number, uint32(transfer.Index)), blob); err != nil {
+				log.Crit("Failed to store transfer", "err", err)
+			}
+			if _, ok := seen[address]; !ok {
+				seen[address] = struct{}{}
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		return
+	}
+	blob, err := rlp.EncodeToBytes(addresses)
+	if err != nil {
+		log.Crit("Failed to encode transfer addresses", "err", err)
+	}
+	if err := db.Put(transferBlockKey(number), blob); err != nil {
+		log.Crit("Failed to store transfer addresses", "err", err)
+	}
+}
+
+// DeleteTransfers removes all the value transfers indexed for a block.
+func DeleteTransfers(db ethdb.KeyValueStore, number uint64) {
+	blob, _ := db.Get(transferBlockKey(number))
+	if len(blob) == 0 {
+		return
+	}
+	var addresses []common.Address
+	if err := rlp.DecodeBytes(blob, &addresses); err != nil {
+		log.Crit("Invalid transfer addresses RLP", "number", number, "err", err)
+	}
+	for _, address := range addresses {
+		prefix := append(append(append([]byte{}, transferPrefix...), address.Bytes()...), encodeBlockNumber(number)...)
+		it := db.NewIterator(prefix, nil)
+		for it.Next() {
+			if err := db.Delete(it.Key()); err != nil {
+				log.Crit("Failed to delete transfer", "err", err)
+			}
+		}
+		it.Release()
+	}
+	if err := db.Delete(transferBlockKey(number)); err != nil {
+		log.Crit("Failed to delete transfer addresses", "err", err)
+	}
+}
@@ -173,6 +173,10 @@ func iterateTransactions(db ethdb.Database, from uint64, to uint64, reverse bool
 // There is a passed channel, the whole procedure will be interrupted if any
 // signal received.
 func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool) {
+	// Bodies below the history tail are gone, nothing to index there
+	if tail := ReadHistoryTail(db); from < tail {
+		from = tail
+	}
 	// short circuit for invalid range
 	if from >= to {
 		return
@@ -264,6 +268,10 @@ func indexTransactionsForTesting(db ethdb.Database, from uint64, to uint64, inte
 // There is a passed channel, the whole procedure will be interrupted if any
 // signal received.
 func unindexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool) {
+	// Bodies below the history tail are gone, their indices were dropped with them
+	if tail := ReadHistoryTail(db); from < tail {
+		from = tail
+	}
 	// short circuit for invalid range
 	if from >= to {
 		return
@@ -345,3 +353,41 @@ func UnindexTransactions(db ethdb.Database, from uint64, to uint64, interrupt ch
 func unindexTransactionsForTesting(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool) {
 	unindexTransactions(db, from, to, interrupt, hook)
 }
+
+// PruneHistory drops the block bodies and receipts below the given number from
+// the ancient store and records the new history tail. The transactions of the
+// pruned blocks are unindexed first, since that needs their bodies. The tail is
+// capped at the number of ancient blocks, the resulting history tail is returned.
+//
+// There is a passed channel, the whole procedure will be interrupted if any
+// signal received.
+func PruneHistory(db ethdb.Database, tail uint64, interrupt chan struct{}) (uint64, error) {
+	frozen, err := db.Ancients()
+	if err != nil {
+		return 0, err
+	}
+	if tail > frozen {
+		tail = frozen
+	}
+	current := ReadHistoryTail(db)
+	if tail <= current {
+		return current, nil
+	}
+	var indexed uint64
+	if txtail := ReadTxIndexTail(db); txtail != nil {
+		indexed = *txtail
+	}
+	if indexed < tail {
+		UnindexTransactions(db, indexed, tail, interrupt)
+		if txtail := ReadTxIndexTail(db); txtail == nil || *txtail < tail {
+			return current, nil // interrupted
+		}
+	}
+	// Mark the history pruned before deleting, so it's never served half-gone
+	WriteHistoryTail(db, tail)
+	if err := db.TruncateTail(tail); err != nil {
+		return tail, err
+	}
+	log.Info("Pruned chain history", "tail", tail)
+	return tail, nil
+}
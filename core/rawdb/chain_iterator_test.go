@@ -17,7 +17,9 @@
 package rawdb
 
 import (
+	"io/ioutil"
 	"math/big"
+	"os"
 	"reflect"
 	"sort"
 	"sync"
@@ -206,3 +208,67 @@ func TestIndexTransactions(t *testing.T) {
 	verify(8, 11, true, 8)
 	verify(0, 8, false, 8)
 }
+
+func TestPruneHistory(t *testing.T) {
+	// Construct a test chain db with all blocks frozen
+	dir, err := ioutil.TempDir("", "prune-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chainDb, err := NewDatabaseWithFreezer(NewMemoryDatabase(), dir, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chainDb.Close()
+
+	var txs []*types.Transaction
+	to := common.BytesToAddress([]byte{0x11})
+	for i := uint64(0); i <= 10; i++ {
+		var body []*types.Transaction
+		if i > 0 {
+			tx := types.NewTransaction(i, to, big.NewInt(111), 1111, big.NewInt(11111), []byte{0x11, 0x11, 0x11})
+			txs = append(txs, tx)
+			body = append(body, tx)
+		}
+		block := types.NewBlock(&types.Header{Number: big.NewInt(int64(i))}, body, nil, nil, newHasher())
+		WriteAncientBlock(chainDb, block, nil, big.NewInt(int64(i)))
+	}
+	IndexTransactions(chainDb, 0, 11, nil)
+
+	tail, err := PruneHistory(chainDb, 6, nil)
+	if err != nil {
+		t.Fatalf("Failed to prune history: %v", err)
+	}
+	if tail != 6 || ReadHistoryTail(chainDb) != 6 {
+		t.Fatalf("History tail mismatch: have %d/%d, want %d", tail, ReadHistoryTail(chainDb), 6)
+	}
+	for i, tx := range txs {
+		number := ReadTxLookupEntry(chainDb, tx.Hash())
+		if i+1 < 6 && number != nil {
+			t.Fatalf("Transaction index %d is not deleted", i+1)
+		}
+		if i+1 >= 6 && number == nil {
+			t.Fatalf("Transaction index %d missing", i+1)
+		}
+	}
+	if number := ReadTxIndexTail(chainDb); number == nil || *number != 6 {
+		t.Fatalf("Transaction tail mismatch")
+	}
+	// Retained history must still be readable, re-indexing must not go below the tail
+	if ReadBlock(chainDb, ReadCanonicalHash(chainDb, 8), 8) == nil {
+		t.Fatalf("Retained block missing")
+	}
+	IndexTransactions(chainDb, 0, 11, nil)
+	if number := ReadTxIndexTail(chainDb); number == nil || *number != 6 {
+		t.Fatalf("Transactions indexed below the history tail")
+	}
+	// Pruning is capped at the ancient store and never goes backwards
+	if tail, _ := PruneHistory(chainDb, 100, nil); tail != 11 {
+		t.Fatalf("History tail not capped: have %d, want %d", tail, 11)
+	}
+	if tail, _ := PruneHistory(chainDb, 3, nil); tail != 11 {
+		t.Fatalf("History tail moved backwards: have %d", tail)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 	"time"
 
@@ -58,22 +59,39 @@ func (frdb *freezerdb) Close() error {
 // a freeze cycle completes, without having to sleep for a minute to trigger the
 // automatic background run.
 func (frdb *freezerdb) Freeze(threshold uint64) error {
-	if frdb.AncientStore.(*freezer).readonly {
+	// Remote freezers are maintained by another node, nothing to freeze
+	f, ok := frdb.AncientStore.(*freezer)
+	if !ok || f.readonly {
 		return errReadOnly
 	}
 	// Set the freezer threshold to a temporary value
 	defer func(old uint64) {
-		atomic.StoreUint64(&frdb.AncientStore.(*freezer).threshold, old)
-	}(atomic.LoadUint64(&frdb.AncientStore.(*freezer).threshold))
-	atomic.StoreUint64(&frdb.AncientStore.(*freezer).threshold, threshold)
+		atomic.StoreUint64(&f.threshold, old)
+	}(atomic.LoadUint64(&f.threshold))
+	atomic.StoreUint64(&f.threshold, threshold)
 
 	// Trigger a freeze cycle and block until it's done
 	trigger := make(chan struct{}, 1)
-	frdb.AncientStore.(*freezer).trigger <- trigger
+	f.trigger <- trigger
 	<-trigger
 	return nil
 }
 
+// HasRemoteAncients reports whether the ancient store of the database is a shared
+// freezer maintained by another node. Such stores may run ahead of the local
+// chain and can't be truncated.
+func HasRemoteAncients(db ethdb.Database) bool {
+	switch db := db.(type) {
+	case *freezerdb:
+		_, ok := db.AncientStore.(*remoteFreezer)
+		return ok
+	case *table:
+		return HasRemoteAncients(db.db)
+	default:
+		return false
+	}
+}
+
 // nofreezedb is a database wrapper that disables freezer data retrievals.
 type nofreezedb struct {
 	ethdb.KeyValueStore
@@ -114,6 +132,11 @@ func (db *nofreezedb) TruncateAncients(items uint64) error {
 	return errNotSupported
 }
 
+// TruncateTail returns an error as we don't have a backing chain freezer.
+func (db *nofreezedb) TruncateTail(tail uint64) error {
+	return errNotSupported
+}
+
 // Sync returns an error as we don't have a backing chain freezer.
 func (db *nofreezedb) Sync() error {
 	return errNotSupported
@@ -129,10 +152,21 @@ func NewDatabase(db ethdb.KeyValueStore) ethdb.Database {
 
 // NewDatabaseWithFreezer creates a high level database on top of a given key-
 // value data store with a freezer moving immutable chain segments into cold
-// storage.
-func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace string, readonly bool) (ethdb.Database, error) {
+// storage. If the freezer location is a file:// or http(s):// URL, a shared
+// read-only freezer maintained by another node is attached instead.
+func NewDatabaseWithFreezer(db ethdb.KeyValueStore, ancient string, namespace string, readonly bool) (ethdb.Database, error) {
 	// Create the idle freezer instance
-	frdb, err := newFreezer(freezer, namespace, readonly)
+	var (
+		frdb  ethdb.AncientStore
+		local *freezer
+		err   error
+	)
+	if IsRemoteFreezer(ancient) {
+		frdb, err = newRemoteFreezer(ancient, namespace)
+	} else {
+		local, err = newFreezer(ancient, namespace, readonly)
+		frdb = local
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -201,11 +235,11 @@ func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace st
 		}
 	}
 	// Freezer is consistent with the key-value database, permit combining the two
-	if !frdb.readonly {
-		frdb.wg.Add(1)
+	if local != nil && !local.readonly {
+		local.wg.Add(1)
 		go func() {
-			frdb.freeze(db)
-			frdb.wg.Done()
+			local.freeze(db)
+			local.wg.Done()
 		}()
 	}
 	return &freezerdb{
@@ -252,6 +286,75 @@ func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer
 	return frdb, nil
 }
 
+const (
+	DBPebble  = "pebble"  // Database engine based on pebble
+	DBLeveldb = "leveldb" // Database engine based on LevelDB
+)
+
+// PreexistingDatabase checks the given data directory whether a database is
+// already instantiated at that location, and if so, returns the type of the
+// database engine (or the empty string).
+func PreexistingDatabase(path string) string {
+	if _, err := os.Stat(filepath.Join(path, "CURRENT")); err != nil {
+		return "" // No pre-existing db
+	}
+	// Pebble persists its options into a file, LevelDB doesn't
+	if matches, _ := filepath.Glob(filepath.Join(path, "OPTIONS*")); len(matches) > 0 {
+		return DBPebble
+	}
+	return DBLeveldb
+}
+
+// OpenOptions contains the options to apply when opening a persistent database.
+type OpenOptions struct {
+	Type              string // Database engine to use, detected or LevelDB if empty
+	Directory         string // Directory of the key-value database
+	AncientsDirectory string // Directory of the freezer, none is attached if empty
+	Namespace         string // Prefix for the database metrics
+	Cache             int    // Memory allowance in megabytes
+	Handles           int    // Number of open file handles
+	ReadOnly          bool   // Whether to open the database in read only mode
+}
+
+// openKeyValueDatabase opens a persistent key-value database without a freezer
+// moving immutable chain segments into cold storage. The requested engine must
+// match the one of an already existing database. Without an explicit choice, the
+// engine of the existing database is used, defaulting to LevelDB for new ones.
+func openKeyValueDatabase(o OpenOptions) (ethdb.Database, error) {
+	existing := PreexistingDatabase(o.Directory)
+	if existing != "" && o.Type != "" && o.Type != existing {
+		return nil, fmt.Errorf("db.engine choice was %v but found pre-existing %v database in specified data directory", o.Type, existing)
+	}
+	switch engine := o.Type; {
+	case engine == DBPebble || existing == DBPebble:
+		log.Info("Using pebble as the backing database")
+		return NewPebbleDBDatabase(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+	case engine == "" || engine == DBLeveldb:
+		log.Info("Using leveldb as the backing database")
+		return NewLevelDBDatabase(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+	default:
+		return nil, fmt.Errorf("unknown db.engine %v", engine)
+	}
+}
+
+// Open opens both a persistent key-value database and, if an ancients directory
+// is configured, a freezer moving immutable chain segments into cold storage.
+func Open(o OpenOptions) (ethdb.Database, error) {
+	kvdb, err := openKeyValueDatabase(o)
+	if err != nil {
+		return nil, err
+	}
+	if o.AncientsDirectory == "" {
+		return kvdb, nil
+	}
+	frdb, err := NewDatabaseWithFreezer(kvdb, o.AncientsDirectory, o.Namespace, o.ReadOnly)
+	if err != nil {
+		kvdb.Close()
+		return nil, err
+	}
+	return frdb, nil
+}
+
 type counter uint64
 
 func (c counter) String() string {
@@ -282,6 +385,107 @@ func (s *stat) Count() string {
 	return s.count.String()
 }
 
+// Categories of the key-value store entries, as classified by KeyCategory.
+const (
+	CategoryHeaders         = "Headers"
+	CategoryBodies          = "Bodies"
+	CategoryReceipts        = "Receipt lists"
+	CategoryDifficulties    = "Difficulties"
+	CategoryNumHash         = "Block number->hash"
+	CategoryHashNum         = "Block hash->number"
+	CategoryTxLookups       = "Transaction index"
+	CategoryBloomBits       = "Bloombit index"
+	CategoryTransfers       = "Transfer index"
+	CategoryCodes           = "Contract codes"
+	CategoryTries           = "Trie nodes"
+	CategoryPreimages       = "Trie preimages"
+	CategoryAccountSnapshot = "Account snapshot"
+	CategoryStorageSnapshot = "Storage snapshot"
+	CategoryCliqueSnapshots = "Clique snapshots"
+	CategoryRejectedReorgs  = "Rejected reorgs"
+	CategoryMetadata        = "Singleton metadata"
+	CategoryCHTTrieNodes    = "CHT trie nodes"
+	CategoryBloomTrieNodes  = "Bloom trie nodes"
+	CategoryUnaccounted     = "Unaccounted"
+)
+
+// KeyValueCategories lists the categories of the chain data in the key-value
+// store, followed by the ones of the light client data.
+var KeyValueCategories = []string{
+	CategoryHeaders, CategoryBodies, CategoryReceipts, CategoryDifficulties,
+	CategoryNumHash, CategoryHashNum, CategoryTxLookups, CategoryBloomBits,
+	CategoryTransfers, CategoryCodes, CategoryTries, CategoryPreimages,
+	CategoryAccountSnapshot, CategoryStorageSnapshot, CategoryCliqueSnapshots,
+	CategoryRejectedReorgs, CategoryMetadata, CategoryCHTTrieNodes, CategoryBloomTrieNodes,
+}
+
+// KeyCategory classifies a key of the key-value store by the kind of data it
+// holds, returning CategoryUnaccounted for keys of an unknown schema.
+func KeyCategory(key []byte) string {
+	switch {
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == (len(headerPrefix)+8+common.HashLength):
+		return CategoryHeaders
+	case bytes.HasPrefix(key, blockBodyPrefix) && len(key) == (len(blockBodyPrefix)+8+common.HashLength):
+		return CategoryBodies
+	case bytes.HasPrefix(key, blockReceiptsPrefix) && len(key) == (len(blockReceiptsPrefix)+8+common.HashLength):
+		return CategoryReceipts
+	case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerTDSuffix):
+		return CategoryDifficulties
+	case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerHashSuffix):
+		return CategoryNumHash
+	case bytes.HasPrefix(key, headerNumberPrefix) && len(key) == (len(headerNumberPrefix)+common.HashLength):
+		return CategoryHashNum
+	case len(key) == common.HashLength:
+		return CategoryTries
+	case bytes.HasPrefix(key, CodePrefix) && len(key) == len(CodePrefix)+common.HashLength:
+		return CategoryCodes
+	case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
+		return CategoryTxLookups
+	case bytes.HasPrefix(key, SnapshotAccountPrefix) && len(key) == (len(SnapshotAccountPrefix)+common.HashLength):
+		return CategoryAccountSnapshot
+	case bytes.HasPrefix(key, SnapshotStoragePrefix) && len(key) == (len(SnapshotStoragePrefix)+2*common.HashLength):
+		return CategoryStorageSnapshot
+	case bytes.HasPrefix(key, preimagePrefix) && len(key) == (len(preimagePrefix)+common.HashLength):
+		return CategoryPreimages
+	case bytes.HasPrefix(key, configPrefix) && len(key) == (len(configPrefix)+common.HashLength):
+		return CategoryMetadata
+	case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == (len(bloomBitsPrefix)+10+common.HashLength):
+		return CategoryBloomBits
+	case bytes.HasPrefix(key, BloomBitsIndexPrefix):
+		return CategoryBloomBits
+	case bytes.HasPrefix(key, transferPrefix) && len(key) == (len(transferPrefix)+common.AddressLength+12):
+		return CategoryTransfers
+	case bytes.HasPrefix(key, transferBlockPrefix) && len(key) == (len(transferBlockPrefix)+8):
+		return CategoryTransfers
+	case bytes.HasPrefix(key, TransferIndexPrefix):
+		return CategoryTransfers
+	case bytes.HasPrefix(key, rejectedReorgPrefix) && len(key) == (len(rejectedReorgPrefix)+8+common.HashLength):
+		return CategoryRejectedReorgs
+	case bytes.HasPrefix(key, []byte("clique-")) && len(key) == 7+common.HashLength:
+		return CategoryCliqueSnapshots
+	case bytes.HasPrefix(key, []byte("cht-")) ||
+		bytes.HasPrefix(key, []byte("chtIndexV2-")) ||
+		bytes.HasPrefix(key, []byte("chtRootV2-")): // Canonical hash trie
+		return CategoryCHTTrieNodes
+	case bytes.HasPrefix(key, []byte("blt-")) ||
+		bytes.HasPrefix(key, []byte("bltIndex-")) ||
+		bytes.HasPrefix(key, []byte("bltRoot-")): // Bloomtrie sub
+		return CategoryBloomTrieNodes
+	default:
+		for _, meta := range [][]byte{
+			databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, lastPivotKey,
+			fastTrieProgressKey, snapshotDisabledKey, snapshotRootKey, snapshotJournalKey,
+			snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey,
+			uncleanShutdownKey, badBlockKey, historyTailKey,
+		} {
+			if bytes.Equal(key, meta) {
+				return CategoryMetadata
+			}
+		}
+		return CategoryUnaccounted
+	}
+}
+
 // InspectDatabase traverses the entire database and checks the size
 // of all different categories of data.
 func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
@@ -294,20 +498,7 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		logged = time.Now()
 
 		// Key-value store statistics
-		headers         stat
-		bodies          stat
-		receipts        stat
-		tds             stat
-		numHashPairings stat
-		hashNumPairings stat
-		tries           stat
-		codes           stat
-		txLookups       stat
-		accountSnaps    stat
-		storageSnaps    stat
-		preimages       stat
-		bloomBits       stat
-		cliqueSnaps     stat
+		stats = make(map[string]*stat)
 
 		// Ancient store statistics
 		ancientHeadersSize  common.StorageSize
@@ -316,17 +507,12 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		ancientTdsSize      common.StorageSize
 		ancientHashesSize   common.StorageSize
 
-		// Les statistic
-		chtTrieNodes   stat
-		bloomTrieNodes stat
-
-		// Meta- and unaccounted data
-		metadata    stat
-		unaccounted stat
-
 		// Totals
 		total common.StorageSize
 	)
+	for _, category := range append(KeyValueCategories, CategoryUnaccounted) {
+		stats[category] = new(stat)
+	}
 	// Inspect key-value database first.
 	for it.Next() {
 		var (
@@ -334,65 +520,8 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 			size = common.StorageSize(len(key) + len(it.Value()))
 		)
 		total += size
-		switch {
-		case bytes.HasPrefix(key, headerPrefix) && len(key) == (len(headerPrefix)+8+common.HashLength):
-			headers.Add(size)
-		case bytes.HasPrefix(key, blockBodyPrefix) && len(key) == (len(blockBodyPrefix)+8+common.HashLength):
-			bodies.Add(size)
-		case bytes.HasPrefix(key, blockReceiptsPrefix) && len(key) == (len(blockReceiptsPrefix)+8+common.HashLength):
-			receipts.Add(size)
-		case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerTDSuffix):
-			tds.Add(size)
-		case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerHashSuffix):
-			numHashPairings.Add(size)
-		case bytes.HasPrefix(key, headerNumberPrefix) && len(key) == (len(headerNumberPrefix)+common.HashLength):
-			hashNumPairings.Add(size)
-		case len(key) == common.HashLength:
-			tries.Add(size)
-		case bytes.HasPrefix(key, CodePrefix) && len(key) == len(CodePrefix)+common.HashLength:
-			codes.Add(size)
-		case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
-			txLookups.Add(size)
-		case bytes.HasPrefix(key, SnapshotAccountPrefix) && len(key) == (len(SnapshotAccountPrefix)+common.HashLength):
-			accountSnaps.Add(size)
-		case bytes.HasPrefix(key, SnapshotStoragePrefix) && len(key) == (len(SnapshotStoragePrefix)+2*common.HashLength):
-			storageSnaps.Add(size)
-		case bytes.HasPrefix(key, preimagePrefix) && len(key) == (len(preimagePrefix)+common.HashLength):
-			preimages.Add(size)
-		case bytes.HasPrefix(key, configPrefix) && len(key) == (len(configPrefix)+common.HashLength):
-			metadata.Add(size)
-		case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == (len(bloomBitsPrefix)+10+common.HashLength):
-			bloomBits.Add(size)
-		case bytes.HasPrefix(key, BloomBitsIndexPrefix):
-			bloomBits.Add(size)
-		case bytes.HasPrefix(key, []byte("clique-")) && len(key) == 7+common.HashLength:
-			cliqueSnaps.Add(size)
-		case bytes.HasPrefix(key, []byte("cht-")) ||
-			bytes.HasPrefix(key, []byte("chtIndexV2-")) ||
-			bytes.HasPrefix(key, []byte("chtRootV2-")): // Canonical hash trie
-			chtTrieNodes.Add(size)
-		case bytes.HasPrefix(key, []byte("blt-")) ||
-			bytes.HasPrefix(key, []byte("bltIndex-")) ||
-			bytes.HasPrefix(key, []byte("bltRoot-")): // Bloomtrie sub
-			bloomTrieNodes.Add(size)
-		default:
-			var accounted bool
-			for _, meta := range [][]byte{
-				databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, lastPivotKey,
-				fastTrieProgressKey, snapshotDisabledKey, snapshotRootKey, snapshotJournalKey,
-				snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey,
-				uncleanShutdownKey, badBlockKey,
-			} {
-				if bytes.Equal(key, meta) {
-					metadata.Add(size)
-					accounted = true
-					break
-				}
-			}
-			if !accounted {
-				unaccounted.Add(size)
-			}
-		}
+		stats[KeyCategory(key)].Add(size)
+
 		count++
 		if count%1000 == 0 && time.Since(logged) > 8*time.Second {
 			log.Info("Inspecting database", "count", count, "elapsed", common.PrettyDuration(time.Since(start)))
@@ -413,37 +542,29 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		ancients = counter(count)
 	}
 	// Display the database statistic.
-	stats := [][]string{
-		{"Key-Value store", "Headers", headers.Size(), headers.Count()},
-		{"Key-Value store", "Bodies", bodies.Size(), bodies.Count()},
-		{"Key-Value store", "Receipt lists", receipts.Size(), receipts.Count()},
-		{"Key-Value store", "Difficulties", tds.Size(), tds.Count()},
-		{"Key-Value store", "Block number->hash", numHashPairings.Size(), numHashPairings.Count()},
-		{"Key-Value store", "Block hash->number", hashNumPairings.Size(), hashNumPairings.Count()},
-		{"Key-Value store", "Transaction index", txLookups.Size(), txLookups.Count()},
-		{"Key-Value store", "Bloombit index", bloomBits.Size(), bloomBits.Count()},
-		{"Key-Value store", "Contract codes", codes.Size(), codes.Count()},
-		{"Key-Value store", "Trie nodes", tries.Size(), tries.Count()},
-		{"Key-Value store", "Trie preimages", preimages.Size(), preimages.Count()},
-		{"Key-Value store", "Account snapshot", accountSnaps.Size(), accountSnaps.Count()},
-		{"Key-Value store", "Storage snapshot", storageSnaps.Size(), storageSnaps.Count()},
-		{"Key-Value store", "Clique snapshots", cliqueSnaps.Size(), cliqueSnaps.Count()},
-		{"Key-Value store", "Singleton metadata", metadata.Size(), metadata.Count()},
+	var table [][]string
+	for _, category := range KeyValueCategories {
+		if category == CategoryCHTTrieNodes || category == CategoryBloomTrieNodes {
+			continue // Reported with the light client data
+		}
+		table = append(table, []string{"Key-Value store", category, stats[category].Size(), stats[category].Count()})
+	}
+	table = append(table, [][]string{
 		{"Ancient store", "Headers", ancientHeadersSize.String(), ancients.String()},
 		{"Ancient store", "Bodies", ancientBodiesSize.String(), ancients.String()},
 		{"Ancient store", "Receipt lists", ancientReceiptsSize.String(), ancients.String()},
 		{"Ancient store", "Difficulties", ancientTdsSize.String(), ancients.String()},
 		{"Ancient store", "Block number->hash", ancientHashesSize.String(), ancients.String()},
-		{"Light client", "CHT trie nodes", chtTrieNodes.Size(), chtTrieNodes.Count()},
-		{"Light client", "Bloom trie nodes", bloomTrieNodes.Size(), bloomTrieNodes.Count()},
-	}
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Database", "Category", "Size", "Items"})
-	table.SetFooter([]string{"", "Total", total.String(), " "})
-	table.AppendBulk(stats)
-	table.Render()
-
-	if unaccounted.size > 0 {
+		{"Light client", CategoryCHTTrieNodes, stats[CategoryCHTTrieNodes].Size(), stats[CategoryCHTTrieNodes].Count()},
+		{"Light client", CategoryBloomTrieNodes, stats[CategoryBloomTrieNodes].Size(), stats[CategoryBloomTrieNodes].Count()},
+	}...)
+	writer := tablewriter.NewWriter(os.Stdout)
+	writer.SetHeader([]string{"Database", "Category", "Size", "Items"})
+	writer.SetFooter([]string{"", "Total", total.String(), " "})
+	writer.AppendBulk(table)
+	writer.Render()
+
+	if unaccounted := stats[CategoryUnaccounted]; unaccounted.size > 0 {
 		log.Error("Database contains unaccounted data", "size", unaccounted.size, "count", unaccounted.count)
 	}
 
@@ -15,3 +15,63 @@
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
 package rawdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that the database engine of an existing database is detected on open,
+// and that conflicting engine choices are rejected.
+func TestOpenDetectsEngine(t *testing.T) {
+	if !PebbleEnabled {
+		t.Skip("pebble not supported on this platform")
+	}
+	datadir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	for _, engine := range []string{DBLeveldb, DBPebble} {
+		var (
+			dir     = filepath.Join(datadir, engine)
+			ancient = filepath.Join(dir, "ancient")
+		)
+		if have := PreexistingDatabase(dir); have != "" {
+			t.Fatalf("%s: engine detected before creation: %q", engine, have)
+		}
+		db, err := Open(OpenOptions{Type: engine, Directory: dir, AncientsDirectory: ancient})
+		if err != nil {
+			t.Fatalf("%s: failed to create database: %v", engine, err)
+		}
+		if err := db.Put([]byte("key"), []byte("value")); err != nil {
+			t.Fatalf("%s: failed to write: %v", engine, err)
+		}
+		db.Close()
+
+		if have := PreexistingDatabase(dir); have != engine {
+			t.Fatalf("engine mismatch: have %q, want %q", have, engine)
+		}
+		// Reopening without a choice should use the existing engine
+		if db, err = Open(OpenOptions{Directory: dir, AncientsDirectory: ancient}); err != nil {
+			t.Fatalf("%s: failed to reopen database: %v", engine, err)
+		}
+		if value, err := db.Get([]byte("key")); err != nil || string(value) != "value" {
+			t.Fatalf("%s: value mismatch: have %q (%v), want %q", engine, value, err, "value")
+		}
+		db.Close()
+
+		// Reopening with a different engine should be rejected
+		other := DBPebble
+		if engine == DBPebble {
+			other = DBLeveldb
+		}
+		if db, err := Open(OpenOptions{Type: other, Directory: dir}); err == nil {
+			db.Close()
+			t.Fatalf("%s: opened as %s", engine, other)
+		}
+	}
+}
@@ -110,6 +110,11 @@ func newFreezer(datadir string, namespace string, readonly bool) (*freezer, erro
 	if err != nil {
 		return nil, err
 	}
+	// Complete any table swap interrupted during recompression
+	if err := repairRecompression(datadir); err != nil {
+		lock.Release()
+		return nil, err
+	}
 	// Open all the supported data tables
 	freezer := &freezer{
 		readonly:     readonly,
@@ -272,6 +277,20 @@ func (f *freezer) TruncateAncients(items uint64) error {
 	return nil
 }
 
+// TruncateTail discards the block bodies and receipts below the provided number.
+// Hashes, headers and difficulties are kept to retain a verifiable chain.
+func (f *freezer) TruncateTail(tail uint64) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	for _, kind := range freezerHistoryTables {
+		if err := f.tables[kind].truncateTail(tail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Sync flushes all data tables to disk.
 func (f *freezer) Sync() error {
 	var errs []error
@@ -0,0 +1,277 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/expanse-org/go-expanse/crypto"
+	"github.com/expanse-org/go-expanse/rlp"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// FreezerCodec identifies the compression algorithm used by a freezer table.
+type FreezerCodec uint8
+
+const (
+	FreezerCodecNone     FreezerCodec = iota // Items are stored uncompressed
+	FreezerCodecSnappy                       // Items are snappy compressed (legacy default)
+	FreezerCodecZstd                         // Items are zstd compressed
+	FreezerCodecZstdDict                     // Items are zstd compressed with a trained table dictionary
+)
+
+// freezerMetaVersion is the current version of the freezer table metadata.
+const freezerMetaVersion = 1
+
+// errUnknownCodec is returned if a freezer table is configured with a codec
+// this version does not know.
+var errUnknownCodec = errors.New("unknown freezer codec")
+
+// String implements fmt.Stringer.
+func (c FreezerCodec) String() string {
+	switch c {
+	case FreezerCodecNone:
+		return "none"
+	case FreezerCodecSnappy:
+		return "snappy"
+	case FreezerCodecZstd:
+		return "zstd"
+	case FreezerCodecZstdDict:
+		return "zstd-dict"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(c))
+	}
+}
+
+// ParseFreezerCodec converts a codec name into a FreezerCodec.
+func ParseFreezerCodec(name string) (FreezerCodec, error) {
+	for c := FreezerCodecNone; c <= FreezerCodecZstdDict; c++ {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", errUnknownCodec, name)
+}
+
+// freezerTableMeta is the metadata of a freezer table, stored RLP encoded next
+// to the index file. Only recompressed tables have one, all the others use the
+// legacy snappy or no compression based on FreezerNoSnappy.
+type freezerTableMeta struct {
+	Version uint16
+	Codec   uint8
+	DictID  uint32 `rlp:"optional"` // Id of the FreezerCodecZstdDict dictionary
+	Dict    []byte `rlp:"optional"` // Trained zstd dictionary for FreezerCodecZstdDict
+}
+
+// metaFile returns the path of the metadata file of the named table.
+func metaFile(path string, name string) string {
+	return filepath.Join(path, fmt.Sprintf("%s.meta", name))
+}
+
+// readTableMeta loads the metadata of the named table, returning nil if the
+// table has none.
+func readTableMeta(path string, name string) (*freezerTableMeta, error) {
+	blob, err := ioutil.ReadFile(metaFile(path, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeTableMeta(blob)
+}
+
+// decodeTableMeta parses and validates a table metadata blob.
+func decodeTableMeta(blob []byte) (*freezerTableMeta, error) {
+	meta := new(freezerTableMeta)
+	if err := rlp.DecodeBytes(blob, meta); err != nil {
+		return nil, fmt.Errorf("invalid freezer table metadata: %v", err)
+	}
+	if meta.Version > freezerMetaVersion {
+		return nil, fmt.Errorf("unsupported freezer table metadata version %d", meta.Version)
+	}
+	if FreezerCodec(meta.Codec) > FreezerCodecZstdDict {
+		return nil, fmt.Errorf("%w: %d", errUnknownCodec, meta.Codec)
+	}
+	if FreezerCodec(meta.Codec) == FreezerCodecZstdDict {
+		if len(meta.Dict) == 0 {
+			return nil, errors.New("missing zstd dictionary")
+		}
+		info, err := zstd.InspectDictionary(meta.Dict)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd dictionary: %v", err)
+		}
+		if info.ID() != meta.DictID {
+			return nil, fmt.Errorf("zstd dictionary id mismatch: have %d, want %d", info.ID(), meta.DictID)
+		}
+	}
+	return meta, nil
+}
+
+// writeTableMeta atomically replaces the metadata of the named table.
+func writeTableMeta(path string, name string, meta *freezerTableMeta) error {
+	blob, err := rlp.EncodeToBytes(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(metaFile(path, name), blob)
+}
+
+// writeFileAtomic writes the blob into a temporary file, flushes it to disk and
+// moves it in place of the given file.
+func writeFileAtomic(filename string, blob []byte) error {
+	f, err := os.OpenFile(filename+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(blob); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// freezerCompressor encodes and decodes the items of a freezer table.
+type freezerCompressor struct {
+	codec FreezerCodec
+	enc   *zstd.Encoder
+	dec   *zstd.Decoder
+}
+
+// newFreezerCompressor creates the compressor for the given codec. The dict
+// is only used by FreezerCodecZstdDict.
+func newFreezerCompressor(codec FreezerCodec, dict []byte) (*freezerCompressor, error) {
+	c := &freezerCompressor{codec: codec}
+	switch codec {
+	case FreezerCodecNone, FreezerCodecSnappy:
+		return c, nil
+
+	case FreezerCodecZstd, FreezerCodecZstdDict:
+		// Appends are serialised by the table lock, so a single encoder suffices,
+		// but reads run concurrently and get a decoder per CPU.
+		var (
+			eopts = []zstd.EOption{zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedBetterCompression)}
+			dopts = []zstd.DOption{zstd.WithDecoderConcurrency(0)}
+		)
+		if codec == FreezerCodecZstdDict {
+			if len(dict) == 0 {
+				return nil, errors.New("missing zstd dictionary")
+			}
+			eopts = append(eopts, zstd.WithEncoderDict(dict))
+			dopts = append(dopts, zstd.WithDecoderDicts(dict))
+		}
+		enc, err := zstd.NewWriter(nil, eopts...)
+		if err != nil {
+			return nil, err
+		}
+		dec, err := zstd.NewReader(nil, dopts...)
+		if err != nil {
+			enc.Close()
+			return nil, err
+		}
+		c.enc, c.dec = enc, dec
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: %d", errUnknownCodec, codec)
+}
+
+// compress encodes a single item.
+func (c *freezerCompressor) compress(blob []byte) []byte {
+	switch c.codec {
+	case FreezerCodecSnappy:
+		return snappy.Encode(nil, blob)
+	case FreezerCodecZstd, FreezerCodecZstdDict:
+		return c.enc.EncodeAll(blob, nil)
+	}
+	return blob
+}
+
+// decompress decodes a single item.
+func (c *freezerCompressor) decompress(blob []byte) ([]byte, error) {
+	switch c.codec {
+	case FreezerCodecSnappy:
+		return snappy.Decode(nil, blob)
+	case FreezerCodecZstd, FreezerCodecZstdDict:
+		return c.dec.DecodeAll(blob, nil)
+	}
+	return blob, nil
+}
+
+// close releases the resources held by the zstd encoder and decoder.
+func (c *freezerCompressor) close() {
+	if c.enc != nil {
+		c.enc.Close()
+	}
+	if c.dec != nil {
+		c.dec.Close()
+	}
+}
+
+// freezerDictID derives the zstd dictionary id from the dictionary content.
+// Ids below 32768 are reserved by the zstd format, so they are avoided.
+func freezerDictID(content []byte) uint32 {
+	return binary.BigEndian.Uint32(crypto.Keccak256(content)[:4]) | 0x80000000
+}
+
+// TrainFreezerDict trains a zstd dictionary on sample items of a table, with at
+// most size bytes of content. Samples are expected in table order: the content
+// is filled from the most recent ones, which zstd matches most cheaply against,
+// while the entropy tables are fitted on all of them.
+func TrainFreezerDict(samples [][]byte, size int) (dict []byte, err error) {
+	// The trainer divides by zero if the samples yield less than 512 sequences,
+	// report that as an error instead of crashing.
+	defer func() {
+		if r := recover(); r != nil {
+			dict, err = nil, errors.New("not enough samples to train zstd dictionary")
+		}
+	}()
+	var (
+		first = len(samples)
+		total int
+	)
+	for first > 0 && total < size {
+		first--
+		total += len(samples[first])
+	}
+	content := make([]byte, 0, total)
+	for _, sample := range samples[first:] {
+		content = append(content, sample...)
+	}
+	if len(content) > size {
+		content = content[len(content)-size:]
+	}
+	return zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       freezerDictID(content),
+		Contents: samples,
+		History:  content,
+		Offsets:  [3]int{1, 4, 8},
+		Level:    zstd.SpeedBetterCompression,
+	})
+}
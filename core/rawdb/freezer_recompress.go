@@ -0,0 +1,323 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/log"
+	"github.com/expanse-org/go-expanse/metrics"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/tsdb/fileutil"
+)
+
+const (
+	// recompressDir is the directory inside the freezer where tables are rebuilt
+	// before being swapped in place of the originals.
+	recompressDir = "recompress"
+
+	// recompressBatchItems and recompressBatchBytes limit the amount of items
+	// read from the source table at once.
+	recompressBatchItems = 1024
+	recompressBatchBytes = 16 * 1024 * 1024
+
+	// recompressDictSamples is the number of items sampled from a table to
+	// train its zstd dictionary.
+	recompressDictSamples = 4096
+)
+
+// isFreezerTableFile reports whether the file belongs to the named table.
+func isFreezerTableFile(file string, name string) bool {
+	if !strings.HasPrefix(file, name+".") {
+		return false
+	}
+	for _, ext := range []string{".meta", ".ridx", ".cidx", ".rdat", ".cdat"} {
+		if strings.HasSuffix(file, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// freezerTableFilesSize returns the total size of the index and data files of
+// the named table.
+func freezerTableFilesSize(datadir string, name string) (uint64, error) {
+	files, err := ioutil.ReadDir(datadir)
+	if err != nil {
+		return 0, err
+	}
+	var size uint64
+	for _, file := range files {
+		if isFreezerTableFile(file.Name(), name) && !strings.HasSuffix(file.Name(), ".meta") {
+			size += uint64(file.Size())
+		}
+	}
+	return size, nil
+}
+
+// RecompressFreezerTable rewrites the named table of the freezer in datadir with
+// the given codec. For FreezerCodecZstdDict, a dictionary of at most dictSize
+// bytes is trained on samples of the table.
+//
+// The new table is built next to the original one and only swapped in once it
+// is complete, the swap itself being resumed on the next freezer open if it's
+// interrupted. The freezer must not be in use while recompressing. The sizes of
+// the table before and after recompression are returned.
+func RecompressFreezerTable(datadir string, name string, codec FreezerCodec, dictSize int) (uint64, uint64, error) {
+	noSnappy, ok := FreezerNoSnappy[name]
+	if !ok {
+		return 0, 0, errUnknownTable
+	}
+	lock, _, err := fileutil.Flock(filepath.Join(datadir, "FLOCK"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer lock.Release()
+
+	// Finish or discard any previous recompression before starting a new one
+	if err := repairRecompression(datadir); err != nil {
+		return 0, 0, err
+	}
+	before, err := freezerTableFilesSize(datadir, name)
+	if err != nil {
+		return 0, 0, err
+	}
+	src, err := newTable(datadir, name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, noSnappy)
+	if err != nil {
+		return 0, 0, err
+	}
+	tmpdir := filepath.Join(datadir, recompressDir)
+	if err := rebuildFreezerTable(src, tmpdir, codec, dictSize); err != nil {
+		src.Close()
+		os.RemoveAll(tmpdir)
+		return 0, 0, err
+	}
+	src.Close()
+
+	// The rebuilt table is complete, record the files making it up. From here on
+	// the swap is resumed on crash instead of being discarded.
+	files, err := ioutil.ReadDir(tmpdir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var names []string
+	for _, file := range files {
+		if isFreezerTableFile(file.Name(), name) {
+			names = append(names, file.Name())
+		}
+	}
+	marker := filepath.Join(tmpdir, fmt.Sprintf("%s.done", name))
+	if err := writeFileAtomic(marker, []byte(strings.Join(names, "\n"))); err != nil {
+		return 0, 0, err
+	}
+	if err := finishRecompression(datadir, name); err != nil {
+		return 0, 0, err
+	}
+	if err := os.RemoveAll(tmpdir); err != nil {
+		return 0, 0, err
+	}
+	after, err := freezerTableFilesSize(datadir, name)
+	if err != nil {
+		return 0, 0, err
+	}
+	return before, after, nil
+}
+
+// rebuildFreezerTable copies all the items of the source table into a new table
+// with the given codec in the target directory.
+func rebuildFreezerTable(src *freezerTable, dir string, codec FreezerCodec, dictSize int) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var (
+		items  = src.items
+		offset = uint64(src.itemOffset)
+		meta   = &freezerTableMeta{Version: freezerMetaVersion, Codec: uint8(codec)}
+	)
+	if codec == FreezerCodecZstdDict {
+		if items == offset {
+			return errors.New("cannot train dictionary for an empty table")
+		}
+		var (
+			samples [][]byte
+			span    = items - offset
+			count   = uint64(recompressDictSamples)
+		)
+		if count > span {
+			count = span
+		}
+		for i := uint64(0); i < count; i++ {
+			blob, err := src.Retrieve(offset + i*span/count)
+			if err != nil {
+				return err
+			}
+			if len(blob) > 0 {
+				samples = append(samples, blob)
+			}
+		}
+		dict, err := TrainFreezerDict(samples, dictSize)
+		if err != nil {
+			return fmt.Errorf("failed to train zstd dictionary: %v", err)
+		}
+		info, err := zstd.InspectDictionary(dict)
+		if err != nil {
+			return err
+		}
+		meta.DictID, meta.Dict = info.ID(), dict
+	}
+	if err := writeTableMeta(dir, src.name, meta); err != nil {
+		return err
+	}
+	// Items deleted from the tail are not carried over, the new table is written
+	// from zero and the offset is restored in its first index entry at the end.
+	dst, err := newCustomTable(dir, src.name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, src.maxFileSize, codec == FreezerCodecNone)
+	if err != nil {
+		return err
+	}
+
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for next := offset; next < items; {
+		blobs, err := src.RetrieveItems(next, recompressBatchItems, recompressBatchBytes)
+		if err != nil {
+			dst.Close()
+			return err
+		}
+		for _, blob := range blobs {
+			if err := dst.Append(next-offset, blob); err != nil {
+				dst.Close()
+				return err
+			}
+			next++
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Recompressing freezer table", "table", src.name, "codec", codec, "items", next-offset, "total", items-offset, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if offset > 0 {
+		if err := setFreezerTableTail(dir, src.name, codec, offset); err != nil {
+			return err
+		}
+	}
+	log.Info("Recompressed freezer table", "table", src.name, "codec", codec, "items", items-offset, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// setFreezerTableTail records the number of items deleted from the tail of a
+// table in its first index entry.
+func setFreezerTableTail(dir string, name string, codec FreezerCodec, offset uint64) error {
+	idxName := fmt.Sprintf("%s.cidx", name)
+	if codec == FreezerCodecNone {
+		idxName = fmt.Sprintf("%s.ridx", name)
+	}
+	index, err := os.OpenFile(filepath.Join(dir, idxName), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	tail := indexEntry{offset: uint32(offset)}
+	if _, err := index.WriteAt(tail.marshallBinary(), 0); err != nil {
+		index.Close()
+		return err
+	}
+	if err := index.Sync(); err != nil {
+		index.Close()
+		return err
+	}
+	return index.Close()
+}
+
+// finishRecompression moves a completely rebuilt table from the recompression
+// directory in place of the original one. It is idempotent, so an interrupted
+// swap can simply be run again.
+func finishRecompression(datadir string, name string) error {
+	tmpdir := filepath.Join(datadir, recompressDir)
+	marker := filepath.Join(tmpdir, fmt.Sprintf("%s.done", name))
+
+	blob, err := ioutil.ReadFile(marker)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Move over the new files, replacing any old ones with the same name
+	keep := make(map[string]bool)
+	for _, file := range strings.Fields(string(blob)) {
+		keep[file] = true
+		if _, err := os.Stat(filepath.Join(tmpdir, file)); os.IsNotExist(err) {
+			continue // moved before the interruption
+		}
+		if err := os.Rename(filepath.Join(tmpdir, file), filepath.Join(datadir, file)); err != nil {
+			return err
+		}
+	}
+	// Delete all the remaining files of the original table
+	files, err := ioutil.ReadDir(datadir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if isFreezerTableFile(file.Name(), name) && !keep[file.Name()] {
+			if err := os.Remove(filepath.Join(datadir, file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Remove(marker)
+}
+
+// repairRecompression completes the swap of every table whose recompression
+// finished and discards any partially rebuilt tables.
+func repairRecompression(datadir string) error {
+	tmpdir := filepath.Join(datadir, recompressDir)
+	files, err := ioutil.ReadDir(tmpdir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if name := strings.TrimSuffix(file.Name(), ".done"); name != file.Name() {
+			log.Info("Resuming freezer table swap", "table", name)
+			if err := finishRecompression(datadir, name); err != nil {
+				return err
+			}
+		}
+	}
+	return os.RemoveAll(tmpdir)
+}
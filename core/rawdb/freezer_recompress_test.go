@@ -0,0 +1,273 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/expanse-org/go-expanse/metrics"
+	"github.com/expanse-org/go-expanse/rlp"
+	"github.com/klauspost/compress/zstd"
+)
+
+// codecTestItem generates a compressible item resembling chain data.
+func codecTestItem(i int) []byte {
+	return []byte(fmt.Sprintf("item %d: %s", i, bytes.Repeat([]byte(fmt.Sprintf("receipt-log-%d;", i%7)), 20+i%13)))
+}
+
+// codecTestSamples generates enough items to train a zstd dictionary on.
+func codecTestSamples() [][]byte {
+	samples := make([][]byte, 2048)
+	for i := range samples {
+		samples[i] = codecTestItem(i)
+	}
+	return samples
+}
+
+// Tests that every codec round trips items through a freezer table and that the
+// codec is picked up from the metadata when reopening.
+func TestFreezerCodecs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-codecs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for codec := FreezerCodecNone; codec <= FreezerCodecZstdDict; codec++ {
+		name := fmt.Sprintf("table-%s", codec)
+		meta := &freezerTableMeta{Version: freezerMetaVersion, Codec: uint8(codec)}
+		if codec == FreezerCodecZstdDict {
+			dict, err := TrainFreezerDict(codecTestSamples(), 1024)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, _ := zstd.InspectDictionary(dict)
+			meta.DictID, meta.Dict = info.ID(), dict
+		}
+		if err := writeTableMeta(dir, name, meta); err != nil {
+			t.Fatal(err)
+		}
+		table, err := newCustomTable(dir, name, metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 1000, false)
+		if err != nil {
+			t.Fatalf("%v: failed to open table: %v", codec, err)
+		}
+		for i := 0; i < 50; i++ {
+			if err := table.Append(uint64(i), codecTestItem(i)); err != nil {
+				t.Fatalf("%v: failed to append item %d: %v", codec, i, err)
+			}
+		}
+		table.Close()
+
+		// Reopen with the opposite legacy setting, the metadata must win
+		if table, err = newCustomTable(dir, name, metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 1000, true); err != nil {
+			t.Fatalf("%v: failed to reopen table: %v", codec, err)
+		}
+		for i := 0; i < 50; i++ {
+			blob, err := table.Retrieve(uint64(i))
+			if err != nil {
+				t.Fatalf("%v: failed to retrieve item %d: %v", codec, i, err)
+			}
+			if !bytes.Equal(blob, codecTestItem(i)) {
+				t.Fatalf("%v: item %d mismatch: have %q", codec, i, blob)
+			}
+		}
+		table.Close()
+	}
+}
+
+// Tests that table metadata with a dictionary not matching the recorded id is
+// rejected.
+func TestFreezerDictIDMismatch(t *testing.T) {
+	dict, err := TrainFreezerDict(codecTestSamples(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, ok := range map[uint32]bool{info.ID(): true, info.ID() + 1: false} {
+		blob, _ := rlp.EncodeToBytes(&freezerTableMeta{Version: freezerMetaVersion, Codec: uint8(FreezerCodecZstdDict), DictID: id, Dict: dict})
+		if _, err := decodeTableMeta(blob); (err == nil) != ok {
+			t.Errorf("dictionary id %d: have error %v, want ok %v", id, err, ok)
+		}
+	}
+}
+
+// Tests that opening legacy tables doesn't write any metadata, so read only
+// freezers are left untouched.
+func TestFreezerLegacyTableNoMeta(t *testing.T) {
+	dir := fillTestFreezer(t, 10)
+	defer os.RemoveAll(dir)
+
+	checkTestFreezer(t, dir, 10)
+	for name := range FreezerNoSnappy {
+		if _, err := os.Stat(metaFile(dir, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s: metadata written for legacy table: %v", name, err)
+		}
+	}
+}
+
+// fillTestFreezer creates a freezer in a temporary directory with the given
+// number of blocks.
+func fillTestFreezer(t *testing.T, blocks int) string {
+	dir, err := ioutil.TempDir("", "freezer-recompress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := newFreezer(dir, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < blocks; i++ {
+		hash := make([]byte, 32)
+		hash[0] = byte(i)
+		if err := f.AppendAncient(uint64(i), hash, codecTestItem(i), codecTestItem(i+1), codecTestItem(i+2), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+	return dir
+}
+
+// checkTestFreezer verifies that the freezer contains the blocks created by
+// fillTestFreezer.
+func checkTestFreezer(t *testing.T, dir string, blocks int) {
+	f, err := newFreezer(dir, "", true)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	defer f.Close()
+
+	if frozen, _ := f.Ancients(); frozen != uint64(blocks) {
+		t.Fatalf("ancients mismatch: have %d, want %d", frozen, blocks)
+	}
+	for i := 0; i < blocks; i++ {
+		for kind, want := range map[string][]byte{
+			freezerHeaderTable:  codecTestItem(i),
+			freezerBodiesTable:  codecTestItem(i + 1),
+			freezerReceiptTable: codecTestItem(i + 2),
+		} {
+			blob, err := f.Ancient(kind, uint64(i))
+			if err != nil {
+				t.Fatalf("%s: failed to read item %d: %v", kind, i, err)
+			}
+			if !bytes.Equal(blob, want) {
+				t.Fatalf("%s: item %d mismatch: have %q", kind, i, blob)
+			}
+		}
+	}
+}
+
+// Tests that freezer tables can be recompressed in place.
+func TestRecompressFreezerTable(t *testing.T) {
+	dir := fillTestFreezer(t, 200)
+	defer os.RemoveAll(dir)
+
+	for kind, codec := range map[string]FreezerCodec{
+		freezerBodiesTable:  FreezerCodecZstd,
+		freezerReceiptTable: FreezerCodecZstdDict,
+		freezerHashTable:    FreezerCodecSnappy,
+	} {
+		before, after, err := RecompressFreezerTable(dir, kind, codec, 4096)
+		if err != nil {
+			t.Fatalf("%s: failed to recompress: %v", kind, err)
+		}
+		// Small items only shrink reliably with a dictionary
+		if codec == FreezerCodecZstdDict && after >= before {
+			t.Errorf("%s: table did not shrink: %d -> %d", kind, before, after)
+		}
+		meta, err := readTableMeta(dir, kind)
+		if err != nil || meta == nil {
+			t.Fatalf("%s: failed to read metadata: %v", kind, err)
+		}
+		if FreezerCodec(meta.Codec) != codec {
+			t.Fatalf("%s: codec mismatch: have %v, want %v", kind, FreezerCodec(meta.Codec), codec)
+		}
+		if codec == FreezerCodecZstdDict && meta.DictID == 0 {
+			t.Fatalf("%s: dictionary id not recorded", kind)
+		}
+	}
+	// The hashes moved from raw to compressed files, the old ones must be gone
+	if _, err := os.Stat(filepath.Join(dir, "hashes.ridx")); !os.IsNotExist(err) {
+		t.Fatalf("stale raw index left behind: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, recompressDir)); !os.IsNotExist(err) {
+		t.Fatalf("recompression directory left behind: %v", err)
+	}
+	checkTestFreezer(t, dir, 200)
+
+	if _, _, err := RecompressFreezerTable(dir, "unknown", FreezerCodecZstd, 0); err != errUnknownTable {
+		t.Fatalf("unknown table: have %v, want %v", err, errUnknownTable)
+	}
+}
+
+// Tests that an interrupted recompression is discarded before the swap started
+// and completed once it did.
+func TestRecompressFreezerTableCrash(t *testing.T) {
+	dir := fillTestFreezer(t, 100)
+	defer os.RemoveAll(dir)
+
+	// Crash while rebuilding: the partial table must be dropped
+	src, err := newTable(dir, freezerBodiesTable, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpdir := filepath.Join(dir, recompressDir)
+	if err := rebuildFreezerTable(src, tmpdir, FreezerCodecZstd, 0); err != nil {
+		t.Fatal(err)
+	}
+	src.Close()
+	checkTestFreezer(t, dir, 100)
+	if _, err := os.Stat(tmpdir); !os.IsNotExist(err) {
+		t.Fatalf("partial table not discarded: %v", err)
+	}
+	if meta, _ := readTableMeta(dir, freezerBodiesTable); meta != nil {
+		t.Fatalf("codec changed: %v", FreezerCodec(meta.Codec))
+	}
+	// Crash in the middle of the swap: the new table must be completed
+	if src, err = newTable(dir, freezerBodiesTable, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := rebuildFreezerTable(src, tmpdir, FreezerCodecZstd, 0); err != nil {
+		t.Fatal(err)
+	}
+	src.Close()
+
+	files, _ := ioutil.ReadDir(tmpdir)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, freezerBodiesTable+".done"), []byte(strings.Join(names, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Move only the index, leaving the old data files in place
+	if err := os.Rename(filepath.Join(tmpdir, freezerBodiesTable+".cidx"), filepath.Join(dir, freezerBodiesTable+".cidx")); err != nil {
+		t.Fatal(err)
+	}
+	checkTestFreezer(t, dir, 100)
+	if meta, _ := readTableMeta(dir, freezerBodiesTable); FreezerCodec(meta.Codec) != FreezerCodecZstd {
+		t.Fatalf("codec not switched: %v", FreezerCodec(meta.Codec))
+	}
+}
@@ -0,0 +1,631 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/expanse-org/go-expanse/log"
+	"github.com/expanse-org/go-expanse/metrics"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// remoteFreezerCacheItems is the number of ancient items kept in the local
+	// cache of a remote freezer.
+	remoteFreezerCacheItems = 8192
+
+	// remoteFreezerRefreshInterval is the minimum time between two checks of
+	// the remote freezer for newly appended items.
+	remoteFreezerRefreshInterval = 30 * time.Second
+
+	// remoteFreezerTimeout is the maximum duration of a single HTTP request
+	// against a remote freezer.
+	remoteFreezerTimeout = 30 * time.Second
+)
+
+// errRemoteNotFound is returned by a remote freezer backend if the requested
+// file does not exist.
+var errRemoteNotFound = errors.New("remote file not found")
+
+// IsRemoteFreezer reports whether the given ancient location refers to a shared
+// read-only freezer (file://, http:// or https://) instead of a local directory.
+func IsRemoteFreezer(location string) bool {
+	for _, scheme := range []string{"file://", "http://", "https://"} {
+		if strings.HasPrefix(strings.ToLower(location), scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteBackend is the minimal file access a remote freezer needs: the size
+// of a file and random reads from it.
+type remoteBackend interface {
+	// size returns the current length of the named file.
+	size(name string) (int64, error)
+
+	// readAt reads length bytes from the named file, starting at offset.
+	readAt(name string, offset int64, length int) ([]byte, error)
+
+	// close releases any resources held by the backend.
+	close() error
+}
+
+// dirBackend serves freezer files from a (possibly network mounted) directory
+// that is concurrently maintained by some other node.
+type dirBackend struct {
+	dir   string
+	files map[string]*os.File
+	lock  sync.Mutex
+}
+
+func newDirBackend(dir string) *dirBackend {
+	return &dirBackend{dir: dir, files: make(map[string]*os.File)}
+}
+
+// open returns a cached read-only handle to the named file.
+func (b *dirBackend) open(name string) (*os.File, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if f, ok := b.files[name]; ok {
+		return f, nil
+	}
+	f, err := os.Open(filepath.Join(b.dir, name))
+	if os.IsNotExist(err) {
+		return nil, errRemoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.files[name] = f
+	return f, nil
+}
+
+func (b *dirBackend) size(name string) (int64, error) {
+	f, err := b.open(name)
+	if err != nil {
+		return 0, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+func (b *dirBackend) readAt(name string, offset int64, length int) ([]byte, error) {
+	f, err := b.open(name)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, length)
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (b *dirBackend) close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var errs []error
+	for name, f := range b.files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(b.files, name)
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// httpBackend serves freezer files from an HTTP server supporting range
+// requests, e.g. a path-style S3 bucket or any static file server.
+type httpBackend struct {
+	base   string
+	client *http.Client
+}
+
+func newHTTPBackend(base string) *httpBackend {
+	return &httpBackend{
+		base:   strings.TrimSuffix(base, "/"),
+		client: &http.Client{Timeout: remoteFreezerTimeout},
+	}
+}
+
+func (b *httpBackend) url(name string) string {
+	return b.base + "/" + url.PathEscape(name)
+}
+
+func (b *httpBackend) size(name string) (int64, error) {
+	resp, err := b.client.Head(b.url(name))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return 0, errRemoteNotFound
+	default:
+		return 0, fmt.Errorf("unexpected status %q for %s", resp.Status, name)
+	}
+	if resp.ContentLength < 0 {
+		return 0, fmt.Errorf("missing content length for %s", name)
+	}
+	return resp.ContentLength, nil
+}
+
+func (b *httpBackend) readAt(name string, offset int64, length int) ([]byte, error) {
+	if length == 0 {
+		return []byte{}, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, b.url(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-"+strconv.FormatInt(offset+int64(length)-1, 10))
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// The server ignored the range, skip to the requested section
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+			return nil, err
+		}
+	case http.StatusNotFound:
+		return nil, errRemoteNotFound
+	default:
+		return nil, fmt.Errorf("unexpected status %q for %s", resp.Status, name)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (b *httpBackend) close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
+
+// remoteTable is a read-only view of a single freezer table that is accessed
+// through a remote backend. It understands the on-disk layout of freezerTable.
+type remoteTable struct {
+	backend       remoteBackend
+	name          string
+	noCompression bool
+	compressor    *freezerCompressor
+}
+
+// newRemoteTable opens a remote table, loading its codec from the metadata or
+// falling back to the legacy default for tables without one.
+func newRemoteTable(backend remoteBackend, name string, noCompression bool) (*remoteTable, error) {
+	var (
+		codec = FreezerCodecSnappy
+		dict  []byte
+	)
+	if noCompression {
+		codec = FreezerCodecNone
+	}
+	file := fmt.Sprintf("%s.meta", name)
+	size, err := backend.size(file)
+	switch {
+	case err == nil:
+		blob, err := backend.readAt(file, 0, int(size))
+		if err != nil {
+			return nil, err
+		}
+		meta, err := decodeTableMeta(blob)
+		if err != nil {
+			return nil, err
+		}
+		codec, dict = FreezerCodec(meta.Codec), meta.Dict
+	case err != errRemoteNotFound:
+		return nil, err
+	}
+	compressor, err := newFreezerCompressor(codec, dict)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteTable{
+		backend:       backend,
+		name:          name,
+		noCompression: codec == FreezerCodecNone,
+		compressor:    compressor,
+	}, nil
+}
+
+// indexFile returns the name of the index file of the table.
+func (t *remoteTable) indexFile() string {
+	if t.noCompression {
+		return fmt.Sprintf("%s.ridx", t.name)
+	}
+	return fmt.Sprintf("%s.cidx", t.name)
+}
+
+// dataFile returns the name of the data file with the given number.
+func (t *remoteTable) dataFile(num uint32) string {
+	if t.noCompression {
+		return fmt.Sprintf("%s.%04d.rdat", t.name, num)
+	}
+	return fmt.Sprintf("%s.%04d.cdat", t.name, num)
+}
+
+// bounds returns the item offset (number of items deleted from the tail) and
+// the total number of items of the table, including the deleted ones.
+func (t *remoteTable) bounds() (uint64, uint64, error) {
+	size, err := t.backend.size(t.indexFile())
+	if err == errRemoteNotFound {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	entries := size / indexEntrySize
+	if entries == 0 {
+		return 0, 0, nil
+	}
+	blob, err := t.backend.readAt(t.indexFile(), 0, indexEntrySize)
+	if err != nil {
+		return 0, 0, err
+	}
+	var first indexEntry
+	first.unmarshalBinary(blob)
+	return uint64(first.offset), uint64(first.offset) + uint64(entries-1), nil
+}
+
+// size returns the total size of the index and data files of the table.
+func (t *remoteTable) size() (uint64, error) {
+	size, err := t.backend.size(t.indexFile())
+	if err == errRemoteNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	entries := size / indexEntrySize
+	if entries == 0 {
+		return uint64(size), nil
+	}
+	var first, last indexEntry
+	blob, err := t.backend.readAt(t.indexFile(), 0, indexEntrySize)
+	if err != nil {
+		return 0, err
+	}
+	first.unmarshalBinary(blob)
+	if blob, err = t.backend.readAt(t.indexFile(), (entries-1)*indexEntrySize, indexEntrySize); err != nil {
+		return 0, err
+	}
+	last.unmarshalBinary(blob)
+
+	total := uint64(size)
+	for num := first.filenum; num <= last.filenum; num++ {
+		// The last data file may still be longer than the index says, count
+		// only the indexed part of it.
+		if num == last.filenum {
+			total += uint64(last.offset)
+			break
+		}
+		n, err := t.backend.size(t.dataFile(num))
+		if err != nil {
+			return 0, err
+		}
+		total += uint64(n)
+	}
+	return total, nil
+}
+
+// retrieve reads up to count items from the table starting at start, stopping
+// early once maxBytes is exceeded (returning at least one item). The caller
+// must ensure the requested range is within the bounds of the table.
+func (t *remoteTable) retrieve(offset, start, count, maxBytes uint64) ([][]byte, error) {
+	// Read all the needed index entries in one go
+	from := start - offset
+	blob, err := t.backend.readAt(t.indexFile(), int64(from*indexEntrySize), int((count+1)*indexEntrySize))
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]indexEntry, count+1)
+	for i := range indices {
+		indices[i].unmarshalBinary(blob[i*indexEntrySize:])
+	}
+	if from == 0 {
+		// The first index entry holds the tail metadata, see getIndices
+		indices[0].offset = 0
+		indices[0].filenum = indices[1].filenum
+	}
+	// Group consecutive items residing in the same data file into single reads
+	var (
+		output [][]byte
+		total  uint64
+	)
+	for i := 0; i < int(count); {
+		var (
+			filenum uint32
+			begin   uint32
+			end     uint32
+			sizes   []uint32
+		)
+		for ; i < int(count); i++ {
+			first, last, num := indices[i].bounds(&indices[i+1])
+			if len(sizes) > 0 && num != filenum {
+				break
+			}
+			if len(output)+len(sizes) > 0 && total+uint64(last-first) > maxBytes {
+				count = uint64(i) // abort the outer loop as well
+				break
+			}
+			if len(sizes) == 0 {
+				filenum, begin = num, first
+			}
+			end = last
+			sizes = append(sizes, last-first)
+			total += uint64(last - first)
+		}
+		if len(sizes) == 0 {
+			break
+		}
+		data, err := t.backend.readAt(t.dataFile(filenum), int64(begin), int(end-begin))
+		if err != nil {
+			return nil, err
+		}
+		for _, size := range sizes {
+			item := data[:size]
+			data = data[size:]
+			if item, err = t.compressor.decompress(item); err != nil {
+				return nil, err
+			}
+			output = append(output, item)
+		}
+	}
+	return output, nil
+}
+
+// remoteFreezer is a read-only ancient store backed by freezer files that are
+// maintained by another node and shared through a directory or an HTTP server.
+// Retrieved items are kept in a local cache to avoid repeated remote reads.
+type remoteFreezer struct {
+	location string
+	backend  remoteBackend
+	tables   map[string]*remoteTable
+	cache    *lru.Cache
+
+	offset    uint64    // Number of items deleted from the tail of the tables
+	frozen    uint64    // Number of items available in all the tables
+	refreshed time.Time // Time of the last item count refresh
+	lock      sync.Mutex
+
+	readMeter metrics.Meter
+	hitMeter  metrics.Meter
+	missMeter metrics.Meter
+}
+
+// newRemoteFreezer opens a read-only view of a shared freezer. The location is
+// either a file:// URL of a shared directory or an http(s):// URL of a server
+// exposing the freezer files with range request support.
+func newRemoteFreezer(location string, namespace string) (*remoteFreezer, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ancient location %q: %v", location, err)
+	}
+	var backend remoteBackend
+	switch strings.ToLower(u.Scheme) {
+	case "file":
+		dir := u.Path
+		if u.Host != "" {
+			// Tolerate relative paths such as file://shared/ancient
+			dir = filepath.Join(u.Host, u.Path)
+		}
+		backend = newDirBackend(dir)
+	case "http", "https":
+		backend = newHTTPBackend(location)
+	default:
+		return nil, fmt.Errorf("unsupported ancient location scheme %q", u.Scheme)
+	}
+	cache, _ := lru.New(remoteFreezerCacheItems)
+	f := &remoteFreezer{
+		location:  location,
+		backend:   backend,
+		tables:    make(map[string]*remoteTable),
+		cache:     cache,
+		readMeter: metrics.NewRegisteredMeter(namespace+"ancient/remote/read", nil),
+		hitMeter:  metrics.NewRegisteredMeter(namespace+"ancient/remote/hit", nil),
+		missMeter: metrics.NewRegisteredMeter(namespace+"ancient/remote/miss", nil),
+	}
+	for name, disableSnappy := range FreezerNoSnappy {
+		table, err := newRemoteTable(backend, name, disableSnappy)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f.tables[name] = table
+	}
+	if err := f.refresh(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	log.Info("Opened remote ancient database", "location", location, "items", f.frozen)
+	return f, nil
+}
+
+// refresh updates the number of items available in the remote freezer. Tables
+// are appended one by one, so the usable count is the minimum across them.
+func (f *remoteFreezer) refresh() error {
+	var (
+		offset uint64
+		frozen uint64
+		first  = true
+	)
+	for _, table := range f.tables {
+		tail, items, err := table.bounds()
+		if err != nil {
+			return err
+		}
+		if first || items < frozen {
+			frozen = items
+		}
+		if first || tail > offset {
+			offset = tail
+		}
+		first = false
+	}
+	if frozen < offset {
+		frozen = offset
+	}
+	f.offset, f.frozen, f.refreshed = offset, frozen, time.Now()
+	return nil
+}
+
+// bounds returns the current item range of the remote freezer, refreshing it
+// if it became stale.
+func (f *remoteFreezer) bounds() (uint64, uint64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if time.Since(f.refreshed) > remoteFreezerRefreshInterval {
+		if err := f.refresh(); err != nil {
+			log.Warn("Failed to refresh remote ancient database", "location", f.location, "err", err)
+			f.refreshed = time.Now() // Don't hammer a failing remote
+		}
+	}
+	return f.offset, f.frozen
+}
+
+// Close releases the resources held by the remote freezer.
+func (f *remoteFreezer) Close() error {
+	for _, table := range f.tables {
+		table.compressor.close()
+	}
+	return f.backend.close()
+}
+
+// HasAncient returns an indicator whether the specified ancient data exists
+// in the remote freezer.
+func (f *remoteFreezer) HasAncient(kind string, number uint64) (bool, error) {
+	if _, ok := f.tables[kind]; !ok {
+		return false, nil
+	}
+	offset, frozen := f.bounds()
+	return number >= offset && number < frozen, nil
+}
+
+// Ancient retrieves an ancient binary blob from the remote freezer.
+func (f *remoteFreezer) Ancient(kind string, number uint64) ([]byte, error) {
+	if _, ok := f.tables[kind]; !ok {
+		return nil, errUnknownTable
+	}
+	items, err := f.ReadAncients(kind, number, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// ReadAncients retrieves multiple items in sequence, starting from the index 'start'.
+// It will return
+//  - at most 'count' items,
+//  - at least 1 item (even if exceeding the maxBytes), but will otherwise
+//   return as many items as fit into maxBytes.
+func (f *remoteFreezer) ReadAncients(kind string, start, count, maxBytes uint64) ([][]byte, error) {
+	table := f.tables[kind]
+	if table == nil {
+		return nil, errUnknownTable
+	}
+	offset, frozen := f.bounds()
+	if start < offset || start >= frozen || count == 0 {
+		return nil, errOutOfBounds
+	}
+	if start+count > frozen {
+		count = frozen - start
+	}
+	// Single item lookups are served from the local cache if possible
+	key := kind + strconv.FormatUint(start, 10)
+	if count == 1 {
+		if blob, ok := f.cache.Get(key); ok {
+			f.hitMeter.Mark(1)
+			return [][]byte{blob.([]byte)}, nil
+		}
+		f.missMeter.Mark(1)
+	}
+	items, err := table.retrieve(offset, start, count, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		f.cache.Add(kind+strconv.FormatUint(start+uint64(i), 10), item)
+		f.readMeter.Mark(int64(len(item)))
+	}
+	return items, nil
+}
+
+// Ancients returns the number of items available in the remote freezer.
+func (f *remoteFreezer) Ancients() (uint64, error) {
+	_, frozen := f.bounds()
+	return frozen, nil
+}
+
+// AncientSize returns the ancient size of the specified category.
+func (f *remoteFreezer) AncientSize(kind string) (uint64, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.size()
+	}
+	return 0, errUnknownTable
+}
+
+// AppendAncient returns an error as the remote freezer is read only.
+func (f *remoteFreezer) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
+	return errReadOnly
+}
+
+// TruncateAncients returns an error as the remote freezer is read only.
+func (f *remoteFreezer) TruncateAncients(items uint64) error {
+	return errReadOnly
+}
+
+// TruncateTail returns an error as the remote freezer is read only.
+func (f *remoteFreezer) TruncateTail(tail uint64) error {
+	return errReadOnly
+}
+
+// Sync is a noop as the remote freezer is never written to.
+func (f *remoteFreezer) Sync() error {
+	return nil
+}
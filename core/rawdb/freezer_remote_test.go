@@ -0,0 +1,191 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/expanse-org/go-expanse/ethdb/memorydb"
+	"github.com/expanse-org/go-expanse/metrics"
+)
+
+// newSharedFreezer creates freezer tables with tiny data files in a temporary
+// directory and fills every table with the given number of items.
+func newSharedFreezer(t *testing.T, items int) (string, map[string]*freezerTable) {
+	dir, err := ioutil.TempDir("", "shared-freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := make(map[string]*freezerTable)
+	for name, disableSnappy := range FreezerNoSnappy {
+		table, err := newCustomTable(dir, name, metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 50, disableSnappy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < items; i++ {
+			if err := table.Append(uint64(i), getChunk(15, i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		table.Sync()
+		tables[name] = table
+	}
+	return dir, tables
+}
+
+func testRemoteFreezer(t *testing.T, location string, dir string, tables map[string]*freezerTable, items int) {
+	f, err := newRemoteFreezer(location, "")
+	if err != nil {
+		t.Fatalf("failed to open remote freezer: %v", err)
+	}
+	defer f.Close()
+
+	if frozen, _ := f.Ancients(); frozen != uint64(items) {
+		t.Fatalf("ancients mismatch: have %d, want %d", frozen, items)
+	}
+	for name, table := range tables {
+		for i := 0; i < items; i++ {
+			blob, err := f.Ancient(name, uint64(i))
+			if err != nil {
+				t.Fatalf("%s: failed to read item %d: %v", name, i, err)
+			}
+			if !bytes.Equal(blob, getChunk(15, i)) {
+				t.Fatalf("%s: item %d mismatch: have %x", name, i, blob)
+			}
+		}
+		if ok, _ := f.HasAncient(name, uint64(items)); ok {
+			t.Fatalf("%s: reported item beyond the end", name)
+		}
+		if _, err := f.Ancient(name, uint64(items)); err != errOutOfBounds {
+			t.Fatalf("%s: reading beyond the end: have %v, want %v", name, err, errOutOfBounds)
+		}
+		// Ranged reads must match the local table, including the byte limits
+		// and items crossing data file boundaries
+		for _, limit := range []uint64{0, 40, 100, 10000} {
+			have, err := f.ReadAncients(name, 2, 10, limit)
+			if err != nil {
+				t.Fatalf("%s: failed to read range with limit %d: %v", name, limit, err)
+			}
+			want, err := table.RetrieveItems(2, 10, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(have) != len(want) {
+				t.Fatalf("%s: range length mismatch with limit %d: have %d, want %d", name, limit, len(have), len(want))
+			}
+			for i := range want {
+				if !bytes.Equal(have[i], want[i]) {
+					t.Fatalf("%s: range item %d mismatch: have %x, want %x", name, i, have[i], want[i])
+				}
+			}
+		}
+		// The local table only estimates its size, so compare to the files
+		files, _ := ioutil.ReadDir(dir)
+		var want uint64
+		for _, file := range files {
+			if strings.HasPrefix(file.Name(), name+".") && !strings.HasSuffix(file.Name(), ".meta") {
+				want += uint64(file.Size())
+			}
+		}
+		if have, _ := f.AncientSize(name); have != want {
+			t.Fatalf("%s: size mismatch: have %d, want %d", name, have, want)
+		}
+	}
+	if _, err := f.Ancient("unknown", 0); err != errUnknownTable {
+		t.Fatalf("unknown table: have %v, want %v", err, errUnknownTable)
+	}
+	if err := f.AppendAncient(uint64(items), nil, nil, nil, nil, nil); err != errReadOnly {
+		t.Fatalf("append: have %v, want %v", err, errReadOnly)
+	}
+	if err := f.TruncateAncients(0); err != errReadOnly {
+		t.Fatalf("truncate: have %v, want %v", err, errReadOnly)
+	}
+}
+
+// Tests that a freezer can be shared through a directory.
+func TestRemoteFreezerDirectory(t *testing.T) {
+	dir, tables := newSharedFreezer(t, 20)
+	defer os.RemoveAll(dir)
+	for _, table := range tables {
+		defer table.Close()
+	}
+	testRemoteFreezer(t, "file://"+dir, dir, tables, 20)
+}
+
+// Tests that a freezer can be shared through an HTTP server with range support,
+// standing in for an S3 compatible object store.
+func TestRemoteFreezerHTTP(t *testing.T) {
+	dir, tables := newSharedFreezer(t, 20)
+	defer os.RemoveAll(dir)
+	for _, table := range tables {
+		defer table.Close()
+	}
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.StripPrefix("/bucket/ancient", http.FileServer(http.Dir(dir))).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	testRemoteFreezer(t, server.URL+"/bucket/ancient", dir, tables, 20)
+
+	// Repeated single item reads should be served from the local cache
+	f, err := newRemoteFreezer(server.URL+"/bucket/ancient", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Ancient(freezerHeaderTable, 5); err != nil {
+		t.Fatal(err)
+	}
+	before := atomic.LoadInt32(&requests)
+	if _, err := f.Ancient(freezerHeaderTable, 5); err != nil {
+		t.Fatal(err)
+	}
+	if after := atomic.LoadInt32(&requests); after != before {
+		t.Fatalf("cached item fetched remotely: %d requests", after-before)
+	}
+}
+
+// Tests that a database can be opened on top of a shared freezer and that it
+// refuses to freeze into it.
+func TestDatabaseWithRemoteFreezer(t *testing.T) {
+	dir, tables := newSharedFreezer(t, 5)
+	defer os.RemoveAll(dir)
+	for _, table := range tables {
+		defer table.Close()
+	}
+	db, err := NewDatabaseWithFreezer(memorydb.New(), "file://"+dir, "", false)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if frozen, _ := db.Ancients(); frozen != 5 {
+		t.Fatalf("ancients mismatch: have %d, want %d", frozen, 5)
+	}
+	if err := db.(*freezerdb).Freeze(0); err != errReadOnly {
+		t.Fatalf("freeze: have %v, want %v", err, errReadOnly)
+	}
+}
@@ -29,7 +29,6 @@ import (
 	"github.com/expanse-org/go-expanse/common"
 	"github.com/expanse-org/go-expanse/log"
 	"github.com/expanse-org/go-expanse/metrics"
-	"github.com/golang/snappy"
 )
 
 var (
@@ -43,6 +42,10 @@ var (
 
 	// errNotSupported is returned if the database doesn't support the required operation.
 	errNotSupported = errors.New("this operation is not supported")
+
+	// errTruncationBelowTail is returned if the head of a table is truncated below
+	// the items already deleted from its tail.
+	errTruncationBelowTail = errors.New("truncation below the table tail")
 )
 
 // indexEntry contains the number/id of the file that the data resides in, aswell as the
@@ -84,16 +87,18 @@ func (start *indexEntry) bounds(end *indexEntry) (startOffset, endOffset, fileId
 }
 
 // freezerTable represents a single chained data table within the freezer (e.g. blocks).
-// It consists of a data file (snappy encoded arbitrary data blobs) and an indexEntry
-// file (uncompressed 64 bit indices into the data file).
+// It consists of a data file (compressed arbitrary data blobs), an indexEntry file
+// (uncompressed 64 bit indices into the data file) and a metadata file recording
+// the compression codec of the table.
 type freezerTable struct {
 	// WARNING: The `items` field is accessed atomically. On 32 bit platforms, only
 	// 64-bit aligned fields can be atomic. The struct is guaranteed to be so aligned,
 	// so take advantage of that (https://golang.org/pkg/sync/atomic/#pkg-note-BUG).
 	items uint64 // Number of items stored in the table (including items removed from tail)
 
-	noCompression bool   // if true, disables snappy compression. Note: does not work retroactively
-	maxFileSize   uint32 // Max file size for data-files
+	noCompression bool               // if true, disables compression. Note: does not work retroactively
+	compressor    *freezerCompressor // Codec used to encode and decode the items
+	maxFileSize   uint32             // Max file size for data-files
 	name          string
 	path          string
 
@@ -172,6 +177,28 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, err
 	}
+	// Load the table codec, falling back to the legacy default for tables without
+	// metadata. It's not written here, so read only opens never modify the table.
+	meta, err := readTableMeta(path, name)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		codec = FreezerCodecSnappy
+		dict  []byte
+	)
+	if noCompression {
+		codec = FreezerCodecNone
+	}
+	if meta != nil {
+		codec, dict = FreezerCodec(meta.Codec), meta.Dict
+	}
+	noCompression = codec == FreezerCodecNone
+
+	compressor, err := newFreezerCompressor(codec, dict)
+	if err != nil {
+		return nil, err
+	}
 	var idxName string
 	if noCompression {
 		// Raw idx
@@ -182,6 +209,7 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 	}
 	offsets, err := openFreezerFileForAppend(filepath.Join(path, idxName))
 	if err != nil {
+		compressor.close()
 		return nil, err
 	}
 	// Create the table and repair any past inconsistency
@@ -195,6 +223,7 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 		path:          path,
 		logger:        log.New("database", path, "table", name),
 		noCompression: noCompression,
+		compressor:    compressor,
 		maxFileSize:   maxFilesize,
 	}
 	if err := tab.repair(); err != nil {
@@ -255,6 +284,10 @@ func (t *freezerTable) repair() error {
 
 	t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
 	lastIndex.unmarshalBinary(buffer)
+	if offsetsSize == indexEntrySize {
+		// Only the tail entry is left, which holds the item offset instead
+		lastIndex.offset = 0
+	}
 	t.head, err = t.openFile(lastIndex.filenum, openFreezerFileForAppend)
 	if err != nil {
 		return err
@@ -286,6 +319,9 @@ func (t *freezerTable) repair() error {
 			t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
 			var newLastIndex indexEntry
 			newLastIndex.unmarshalBinary(buffer)
+			if offsetsSize == indexEntrySize {
+				newLastIndex.offset = 0
+			}
 			// We might have slipped back into an earlier head-file here
 			if newLastIndex.filenum != lastIndex.filenum {
 				// Release earlier opened file
@@ -362,17 +398,26 @@ func (t *freezerTable) truncate(items uint64) error {
 	if existing > items+1 {
 		log = t.logger.Warn // Only loud warn if we delete multiple items
 	}
+	// Items deleted from the tail can't be brought back
+	if items < uint64(t.itemOffset) {
+		return errTruncationBelowTail
+	}
 	log("Truncating freezer table", "items", existing, "limit", items)
-	if err := truncateFreezerFile(t.index, int64(items+1)*indexEntrySize); err != nil {
+	retained := items - uint64(t.itemOffset)
+	if err := truncateFreezerFile(t.index, int64(retained+1)*indexEntrySize); err != nil {
 		return err
 	}
 	// Calculate the new expected size of the data file and truncate it
 	buffer := make([]byte, indexEntrySize)
-	if _, err := t.index.ReadAt(buffer, int64(items*indexEntrySize)); err != nil {
+	if _, err := t.index.ReadAt(buffer, int64(retained*indexEntrySize)); err != nil {
 		return err
 	}
 	var expected indexEntry
 	expected.unmarshalBinary(buffer)
+	if retained == 0 {
+		// The tail entry holds the item offset, the table is empty from here
+		expected = indexEntry{filenum: t.tailId}
+	}
 
 	// We might need to truncate back to older files
 	if expected.filenum != t.headId {
@@ -406,6 +451,101 @@ func (t *freezerTable) truncate(items uint64) error {
 	return nil
 }
 
+// truncateTail discards the data below the provided item number. Data is only
+// deleted in whole files, so the items sharing a data file with the first one
+// to keep are retained too. The number of discarded items is recorded in the
+// first index entry, which is swapped in atomically before deleting any files.
+func (t *freezerTable) truncateTail(tail uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	items := atomic.LoadUint64(&t.items)
+	if tail > items {
+		tail = items
+	}
+	if tail <= uint64(t.itemOffset) {
+		return nil
+	}
+	// Find the data file holding the tail, nothing to do if it's the first one
+	filenum := t.headId
+	if tail < items {
+		buffer := make([]byte, indexEntrySize)
+		if _, err := t.index.ReadAt(buffer, int64(tail-uint64(t.itemOffset)+1)*indexEntrySize); err != nil {
+			return err
+		}
+		var e indexEntry
+		e.unmarshalBinary(buffer)
+		filenum = e.filenum
+	}
+	if filenum == t.tailId {
+		return nil
+	}
+	// Load the index entries to rewrite them without the dropped items
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	indices := make([]byte, stat.Size())
+	if _, err := t.index.ReadAt(indices, 0); err != nil {
+		return err
+	}
+	entry := func(i uint64) (e indexEntry) {
+		e.unmarshalBinary(indices[i*indexEntrySize:])
+		return e
+	}
+	// Entries are ordered by file, find the first item stored in the new tail file
+	var (
+		first = uint64(1)
+		last  = uint64(len(indices)/indexEntrySize - 1)
+	)
+	for first < last {
+		mid := (first + last) / 2
+		if entry(mid).filenum < filenum {
+			first = mid + 1
+		} else {
+			last = mid
+		}
+	}
+	offset := uint64(t.itemOffset) + first - 1
+
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	// Write the new index next to the old one and move it in place
+	head := indexEntry{filenum: filenum, offset: uint32(offset)}
+	if err := writeFileAtomic(t.index.Name(), append(head.marshallBinary(), indices[first*indexEntrySize:]...)); err != nil {
+		return err
+	}
+	index, err := openFreezerFileForAppend(t.index.Name())
+	if err != nil {
+		return err
+	}
+	t.index.Close()
+	t.index = index
+
+	// The new index is in place, drop the data files no longer referenced
+	for num := t.tailId; num < filenum; num++ {
+		t.releaseFile(num)
+		if err := os.Remove(t.fileName(num)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	t.logger.Info("Truncated freezer table tail", "items", offset-uint64(t.itemOffset), "tail", offset)
+	t.tailId = filenum
+	t.itemOffset = uint32(offset)
+
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+	return nil
+}
+
 // Close closes all opened files.
 func (t *freezerTable) Close() error {
 	t.lock.Lock()
@@ -423,6 +563,7 @@ func (t *freezerTable) Close() error {
 		}
 	}
 	t.head = nil
+	t.compressor.close()
 
 	if errs != nil {
 		return fmt.Errorf("%v", errs)
@@ -434,13 +575,7 @@ func (t *freezerTable) Close() error {
 func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error)) (f *os.File, err error) {
 	var exist bool
 	if f, exist = t.files[num]; !exist {
-		var name string
-		if t.noCompression {
-			name = fmt.Sprintf("%s.%04d.rdat", t.name, num)
-		} else {
-			name = fmt.Sprintf("%s.%04d.cdat", t.name, num)
-		}
-		f, err = opener(filepath.Join(t.path, name))
+		f, err = opener(t.fileName(num))
 		if err != nil {
 			return nil, err
 		}
@@ -449,6 +584,14 @@ func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error
 	return f, err
 }
 
+// fileName returns the path of the data file with the given number.
+func (t *freezerTable) fileName(num uint32) string {
+	if t.noCompression {
+		return filepath.Join(t.path, fmt.Sprintf("%s.%04d.rdat", t.name, num))
+	}
+	return filepath.Join(t.path, fmt.Sprintf("%s.%04d.cdat", t.name, num))
+}
+
 // releaseFile closes a file, and removes it from the open file cache.
 // Assumes that the caller holds the write lock
 func (t *freezerTable) releaseFile(num uint32) {
@@ -479,9 +622,7 @@ func (t *freezerTable) releaseFilesAfter(num uint32, remove bool) {
 // fsync before irreversibly deleting data from the database.
 func (t *freezerTable) Append(item uint64, blob []byte) error {
 	// Encode the blob before the lock portion
-	if !t.noCompression {
-		blob = snappy.Encode(nil, blob)
-	}
+	blob = t.compressor.compress(blob)
 	// Read lock prevents competition with truncate
 	retry, err := t.append(item, blob, false)
 	if err != nil {
@@ -624,23 +765,15 @@ func (t *freezerTable) RetrieveItems(start, count, maxBytes uint64) ([][]byte, e
 	for i, diskSize := range sizes {
 		item := diskData[offset : offset+diskSize]
 		offset += diskSize
-		decompressedSize := diskSize
-		if !t.noCompression {
-			decompressedSize, _ = snappy.DecodedLen(item)
+		data, err := t.compressor.decompress(item)
+		if err != nil {
+			return nil, err
 		}
-		if i > 0 && uint64(outputSize+decompressedSize) > maxBytes {
+		if i > 0 && uint64(outputSize+len(data)) > maxBytes {
 			break
 		}
-		if !t.noCompression {
-			data, err := snappy.Decode(nil, item)
-			if err != nil {
-				return nil, err
-			}
-			output = append(output, data)
-		} else {
-			output = append(output, item)
-		}
-		outputSize += decompressedSize
+		output = append(output, data)
+		outputSize += len(data)
 	}
 	return output, nil
 }
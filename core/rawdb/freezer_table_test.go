@@ -807,3 +807,71 @@ func TestSequentialReadByteLimit(t *testing.T) {
 		}
 	}
 }
+
+// TestFreezerTruncateTail tests that items can be discarded from the tail of a
+// table in whole data files and that the table keeps working across reopens.
+func TestFreezerTruncateTail(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("truncate-tail-%d", rand.Uint64())
+
+	// Fill table, 3 items per data file
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 30; x++ {
+		f.Append(uint64(x), getChunk(15, x))
+	}
+	// Item 7 lives in the third file, so only the first two can be dropped
+	if err := f.truncateTail(7); err != nil {
+		t.Fatal(err)
+	}
+	check := func(from, to int) {
+		for y := from; y < to; y++ {
+			got, err := f.Retrieve(uint64(y))
+			if err != nil {
+				t.Fatalf("reading item %d: %v", y, err)
+			}
+			if !bytes.Equal(got, getChunk(15, y)) {
+				t.Fatalf("item %d mismatch: %x", y, got)
+			}
+		}
+	}
+	if f.itemOffset != 6 {
+		t.Fatalf("item offset mismatch: have %d, want %d", f.itemOffset, 6)
+	}
+	if _, err := os.Stat(filepath.Join(os.TempDir(), fmt.Sprintf("%s.0001.rdat", fname))); !os.IsNotExist(err) {
+		t.Fatalf("dropped data file still present: %v", err)
+	}
+	if _, err := f.Retrieve(5); err == nil {
+		t.Fatalf("retrieved item below the tail")
+	}
+	check(6, 30)
+
+	// Reopen and truncate the head, which must not go below the tail
+	f.Close()
+	if f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	check(6, 30)
+	if err := f.truncate(5); err != errTruncationBelowTail {
+		t.Fatalf("truncation below tail: have %v, want %v", err, errTruncationBelowTail)
+	}
+	if err := f.truncate(10); err != nil {
+		t.Fatal(err)
+	}
+	check(6, 10)
+
+	// Truncate everything past the tail and refill
+	if err := f.truncate(6); err != nil {
+		t.Fatal(err)
+	}
+	for x := 6; x < 20; x++ {
+		if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(6, 20)
+}
@@ -0,0 +1,275 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/common/hexutil"
+	"github.com/expanse-org/go-expanse/crypto"
+	"github.com/expanse-org/go-expanse/ethdb"
+	"github.com/expanse-org/go-expanse/log"
+	"github.com/olekukonko/tablewriter"
+)
+
+// migrationProgressKey tracks the progress of a database migration in the target
+// database. It is written atomically with the copied entries, holding either the
+// last copied key prefixed with migrationRunning, or migrationDone once all of
+// the entries were copied. It is deleted before the target replaces the source,
+// or if the verification of the copy fails.
+var migrationProgressKey = []byte("MigrationProgress")
+
+const (
+	migrationRunning = 0x00 // Copying entries, followed by the last copied key
+	migrationDone    = 0x01 // All entries copied, pending verification
+)
+
+// MigrateDatabase copies the key-value database in the given directory into a
+// new one of the given engine, verifies it and swaps the two directories. An
+// interrupted migration is resumed by calling it again.
+func MigrateDatabase(path string, engine string, cache int, handles int) error {
+	var (
+		target = path + ".migrate"
+		backup = path + ".old"
+	)
+	// If a previous run was interrupted while swapping, finish the swap
+	if !common.FileExist(path) && common.FileExist(target) && common.FileExist(backup) {
+		log.Warn("Finishing interrupted database swap", "path", path)
+		return swapDatabases(path, target, backup)
+	}
+	if common.FileExist(backup) {
+		return fmt.Errorf("database from a previous migration exists at %s, remove it first", backup)
+	}
+	existing := PreexistingDatabase(path)
+	switch existing {
+	case "":
+		return fmt.Errorf("no database found at %s", path)
+	case engine:
+		return fmt.Errorf("database at %s already uses %s", path, engine)
+	}
+	src, err := Open(OpenOptions{Type: existing, Directory: path, Cache: cache / 2, Handles: handles / 2, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to open source database: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := Open(OpenOptions{Type: engine, Directory: target, Cache: cache / 2, Handles: handles / 2})
+	if err != nil {
+		return fmt.Errorf("failed to open target database: %v", err)
+	}
+	defer dst.Close()
+
+	log.Info("Migrating database", "path", path, "from", existing, "to", engine)
+	if err := copyDatabase(src, dst); err != nil {
+		return err
+	}
+	if err := verifyMigration(src, dst); err != nil {
+		// Clear the progress marker so the next run copies everything again
+		// instead of skipping straight to verifying the same broken copy
+		if err := dst.Delete(migrationProgressKey); err != nil {
+			log.Error("Failed to reset database migration progress", "err", err)
+		}
+		return err
+	}
+	if err := dst.Delete(migrationProgressKey); err != nil {
+		return err
+	}
+	src.Close()
+	dst.Close()
+
+	return swapDatabases(path, target, backup)
+}
+
+// copyDatabase streams all the entries of the source database into the target,
+// resuming after the last key copied by a previous run.
+func copyDatabase(src, dst ethdb.KeyValueStore) error {
+	var start []byte
+	if progress, _ := dst.Get(migrationProgressKey); len(progress) > 0 {
+		if progress[0] == migrationDone {
+			log.Info("Database already copied")
+			return nil
+		}
+		start = progress[1:]
+		log.Info("Resuming database copy", "key", hexutil.Encode(start))
+	}
+	var (
+		it     = src.NewIterator(nil, start)
+		batch  = dst.NewBatch()
+		count  uint64
+		size   common.StorageSize
+		begin  = time.Now()
+		logged = time.Now()
+	)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if bytes.Equal(key, start) || bytes.Equal(key, migrationProgressKey) {
+			continue
+		}
+		if err := batch.Put(key, it.Value()); err != nil {
+			return err
+		}
+		count++
+		size += common.StorageSize(len(key) + len(it.Value()))
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			// Record the progress in the same batch, so it never gets ahead of the data
+			if err := batch.Put(migrationProgressKey, append([]byte{migrationRunning}, key...)); err != nil {
+				return err
+			}
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Copying database", "entries", count, "size", size, "key", hexutil.Encode(key), "elapsed", common.PrettyDuration(time.Since(begin)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if err := batch.Put(migrationProgressKey, []byte{migrationDone}); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Copied database", "entries", count, "size", size, "elapsed", common.PrettyDuration(time.Since(begin)))
+	return nil
+}
+
+// migrationStat is the item count and running checksum of the entries of a data
+// category in a database.
+type migrationStat struct {
+	count uint64
+	hash  hash.Hash
+}
+
+// inspectMigration computes the item count and checksum of each data category
+// in the database, skipping the migration progress marker.
+func inspectMigration(db ethdb.KeyValueStore) (map[string]*migrationStat, error) {
+	stats := make(map[string]*migrationStat)
+
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	var length [4]byte
+	for it.Next() {
+		key := it.Key()
+		if bytes.Equal(key, migrationProgressKey) {
+			continue
+		}
+		category := KeyCategory(key)
+		stat := stats[category]
+		if stat == nil {
+			stat = &migrationStat{hash: crypto.NewKeccakState()}
+			stats[category] = stat
+		}
+		stat.count++
+
+		binary.BigEndian.PutUint32(length[:], uint32(len(key)))
+		stat.hash.Write(length[:])
+		stat.hash.Write(key)
+		binary.BigEndian.PutUint32(length[:], uint32(len(it.Value())))
+		stat.hash.Write(length[:])
+		stat.hash.Write(it.Value())
+	}
+	return stats, it.Error()
+}
+
+// verifyMigration compares the item counts and checksums of each data category
+// between the source and target database of a migration.
+func verifyMigration(src, dst ethdb.KeyValueStore) error {
+	log.Info("Verifying migrated database")
+	have, err := inspectMigration(dst)
+	if err != nil {
+		return fmt.Errorf("failed to inspect target database: %v", err)
+	}
+	want, err := inspectMigration(src)
+	if err != nil {
+		return fmt.Errorf("failed to inspect source database: %v", err)
+	}
+	var (
+		rows       [][]string
+		mismatches int
+	)
+	for _, category := range append(KeyValueCategories, CategoryUnaccounted) {
+		srcStat, dstStat := want[category], have[category]
+		if srcStat == nil && dstStat == nil {
+			continue
+		}
+		var (
+			srcCount, dstCount uint64
+			srcSum, dstSum     []byte
+		)
+		if srcStat != nil {
+			srcCount, srcSum = srcStat.count, srcStat.hash.Sum(nil)
+		}
+		if dstStat != nil {
+			dstCount, dstSum = dstStat.count, dstStat.hash.Sum(nil)
+		}
+		status := "ok"
+		if srcCount != dstCount || !bytes.Equal(srcSum, dstSum) {
+			status = "MISMATCH"
+			mismatches++
+		}
+		rows = append(rows, []string{category, fmt.Sprint(srcCount), fmt.Sprint(dstCount), fmt.Sprintf("%x", dstSum), status})
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Category", "Source items", "Target items", "Checksum", "Status"})
+	table.AppendBulk(rows)
+	table.Render()
+
+	if mismatches > 0 {
+		return fmt.Errorf("migrated database mismatches the source in %d categories", mismatches)
+	}
+	return nil
+}
+
+// swapDatabases replaces the database at path with the migrated one, keeping the
+// original at the backup path and moving the ancient chain segments over if they
+// are stored inside the database directory. Every step is a rename, so the swap
+// can be finished by a later run if it's interrupted.
+func swapDatabases(path, target, backup string) error {
+	if common.FileExist(path) {
+		if err := os.Rename(path, backup); err != nil {
+			return err
+		}
+	}
+	ancient := filepath.Join(backup, "ancient")
+	if common.FileExist(ancient) && !common.FileExist(filepath.Join(target, "ancient")) {
+		if err := os.Rename(ancient, filepath.Join(target, "ancient")); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(target, path); err != nil {
+		return err
+	}
+	log.Info("Database migrated", "path", path, "engine", PreexistingDatabase(path), "backup", backup)
+	log.Warn("Old database kept, delete it once the node runs fine", "path", backup)
+	return nil
+}
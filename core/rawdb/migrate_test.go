@@ -0,0 +1,183 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/crypto"
+)
+
+// Tests that an interrupted database migration is resumed, verified and swapped
+// in place of the original database, together with its ancient directory.
+func TestMigrateDatabase(t *testing.T) {
+	if !PebbleEnabled {
+		t.Skip("pebble not supported on this platform")
+	}
+	datadir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	path := filepath.Join(datadir, "chaindata")
+	db, err := Open(OpenOptions{Type: DBLeveldb, Directory: path})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	var keys [][]byte
+	for i := 0; i < 100; i++ {
+		blob := []byte(fmt.Sprintf("value %d", i))
+		WriteCode(db, crypto.Keccak256Hash(blob), blob)
+		WriteTxLookupEntries(db, uint64(i), []common.Hash{crypto.Keccak256Hash(blob, blob)})
+		db.Put(crypto.Keccak256(blob), blob)
+	}
+	WriteHeadBlockHash(db, common.Hash{0x01})
+	db.Put([]byte("unknown"), []byte{0x02})
+
+	it := db.NewIterator(nil, nil)
+	for it.Next() {
+		keys = append(keys, common.CopyBytes(it.Key()))
+	}
+	it.Release()
+	db.Close()
+
+	ancient := filepath.Join(path, "ancient")
+	if err := os.MkdirAll(ancient, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(ancient, "FLOCK"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate an interrupted run which copied the first half of the entries
+	src, err := Open(OpenOptions{Directory: path, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	dst, err := Open(OpenOptions{Type: DBPebble, Directory: path + ".migrate"})
+	if err != nil {
+		t.Fatalf("failed to create target database: %v", err)
+	}
+	for _, key := range keys[:len(keys)/2] {
+		value, _ := src.Get(key)
+		dst.Put(key, value)
+	}
+	dst.Put(migrationProgressKey, append([]byte{migrationRunning}, keys[len(keys)/2-1]...))
+	src.Close()
+	dst.Close()
+
+	if err := MigrateDatabase(path, DBPebble, 16, 16); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	if engine := PreexistingDatabase(path); engine != DBPebble {
+		t.Fatalf("engine mismatch: have %q, want %q", engine, DBPebble)
+	}
+	if engine := PreexistingDatabase(path + ".old"); engine != DBLeveldb {
+		t.Fatalf("backup engine mismatch: have %q, want %q", engine, DBLeveldb)
+	}
+	if !common.FileExist(filepath.Join(ancient, "FLOCK")) {
+		t.Fatalf("ancient directory not moved")
+	}
+	db, err = Open(OpenOptions{Directory: path})
+	if err != nil {
+		t.Fatalf("failed to open migrated database: %v", err)
+	}
+	defer db.Close()
+
+	var have [][]byte
+	it = db.NewIterator(nil, nil)
+	for it.Next() {
+		have = append(have, common.CopyBytes(it.Key()))
+	}
+	it.Release()
+	if len(have) != len(keys) {
+		t.Fatalf("key count mismatch: have %d, want %d", len(have), len(keys))
+	}
+	for i := range keys {
+		if !bytes.Equal(have[i], keys[i]) {
+			t.Fatalf("key %d mismatch: have %x, want %x", i, have[i], keys[i])
+		}
+	}
+	if hash := ReadHeadBlockHash(db); hash != (common.Hash{0x01}) {
+		t.Fatalf("head block hash mismatch: have %x", hash)
+	}
+	// A second migration must not clobber the kept backup
+	if err := MigrateDatabase(path, DBLeveldb, 16, 16); err == nil {
+		t.Fatalf("migration succeeded with an existing backup")
+	}
+}
+
+// Tests that a migration failing verification is not marked as copied, so the
+// next run copies the database again instead of failing forever.
+func TestMigrateDatabaseVerifyFailure(t *testing.T) {
+	if !PebbleEnabled {
+		t.Skip("pebble not supported on this platform")
+	}
+	datadir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	path := filepath.Join(datadir, "chaindata")
+	db, err := Open(OpenOptions{Type: DBLeveldb, Directory: path})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		blob := []byte(fmt.Sprintf("value %d", i))
+		WriteCode(db, crypto.Keccak256Hash(blob), blob)
+	}
+	db.Close()
+
+	// Simulate a previous run which copied everything, but corrupted an entry
+	// before being interrupted ahead of the verification
+	dst, err := Open(OpenOptions{Type: DBPebble, Directory: path + ".migrate"})
+	if err != nil {
+		t.Fatalf("failed to create target database: %v", err)
+	}
+	blob := []byte("value 0")
+	WriteCode(dst, crypto.Keccak256Hash(blob), []byte("corrupted"))
+	dst.Put(migrationProgressKey, []byte{migrationDone})
+	dst.Close()
+
+	if err := MigrateDatabase(path, DBPebble, 16, 16); err == nil {
+		t.Fatalf("corrupted migration succeeded")
+	}
+	if engine := PreexistingDatabase(path); engine != DBLeveldb {
+		t.Fatalf("engine mismatch after failed migration: have %q, want %q", engine, DBLeveldb)
+	}
+	// The retry must copy the database again, fixing the corrupted entry
+	if err := MigrateDatabase(path, DBPebble, 16, 16); err != nil {
+		t.Fatalf("migration retry failed: %v", err)
+	}
+	db, err = Open(OpenOptions{Directory: path, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("failed to open migrated database: %v", err)
+	}
+	defer db.Close()
+
+	if code := ReadCode(db, crypto.Keccak256Hash(blob)); !bytes.Equal(code, blob) {
+		t.Fatalf("code mismatch: have %q, want %q", code, blob)
+	}
+}
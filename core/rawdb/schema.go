@@ -69,6 +69,9 @@ var (
 	// fastTxLookupLimitKey tracks the transaction lookup limit during fast sync.
 	fastTxLookupLimitKey = []byte("FastTransactionLookupLimit")
 
+	// historyTailKey tracks the oldest block whose body and receipts are retained.
+	historyTailKey = []byte("HistoryTail")
+
 	// badBlockKey tracks the list of bad blocks seen by local
 	badBlockKey = []byte("InvalidBlock")
 
@@ -89,12 +92,16 @@ var (
 	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
+	rejectedReorgPrefix   = []byte("R") // rejectedReorgPrefix + num (uint64 big endian) + hash -> rejected side chain record
+	transferPrefix        = []byte("x") // transferPrefix + address + num (uint64 big endian) + index (uint32 big endian) -> value transfer
+	transferBlockPrefix   = []byte("X") // transferBlockPrefix + num (uint64 big endian) -> addresses with indexed transfers in the block
 
 	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("ethereum-config-") // config prefix for the db
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
+	TransferIndexPrefix  = []byte("iX") // TransferIndexPrefix is the data table of the transfer indexer to track its progress
 
 	preimageCounter    = metrics.NewRegisteredCounter("db/preimage/total", nil)
 	preimageHitCounter = metrics.NewRegisteredCounter("db/preimage/hits", nil)
@@ -118,7 +125,8 @@ const (
 )
 
 // FreezerNoSnappy configures whether compression is disabled for the ancient-tables.
-// Hashes and difficulties don't compress well.
+// Hashes and difficulties don't compress well. It only applies to tables without
+// metadata, the codec of existing tables is recorded in their metadata file.
 var FreezerNoSnappy = map[string]bool{
 	freezerHeaderTable:     false,
 	freezerHashTable:       true,
@@ -127,6 +135,10 @@ var FreezerNoSnappy = map[string]bool{
 	freezerDifficultyTable: true,
 }
 
+// freezerHistoryTables are the ancient-tables whose tail can be pruned by history
+// expiry.
+var freezerHistoryTables = []string{freezerBodiesTable, freezerReceiptTable}
+
 // LegacyTxLookupEntry is the legacy TxLookupEntry definition with some unnecessary
 // fields.
 type LegacyTxLookupEntry struct {
@@ -197,6 +209,11 @@ func storageSnapshotsKey(accountHash common.Hash) []byte {
 	return append(SnapshotStoragePrefix, accountHash.Bytes()...)
 }
 
+// rejectedReorgKey = rejectedReorgPrefix + num (uint64 big endian) + hash
+func rejectedReorgKey(number uint64, hash common.Hash) []byte {
+	return append(append(rejectedReorgPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
 // bloomBitsKey = bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash
 func bloomBitsKey(bit uint, section uint64, hash common.Hash) []byte {
 	key := append(append(bloomBitsPrefix, make([]byte, 10)...), hash.Bytes()...)
@@ -207,6 +224,21 @@ func bloomBitsKey(bit uint, section uint64, hash common.Hash) []byte {
 	return key
 }
 
+// transferKey = transferPrefix + address + num (uint64 big endian) + index (uint32 big endian)
+func transferKey(address common.Address, number uint64, index uint32) []byte {
+	key := append(append(transferPrefix, address.Bytes()...), make([]byte, 12)...)
+
+	binary.BigEndian.PutUint64(key[1+common.AddressLength:], number)
+	binary.BigEndian.PutUint32(key[1+common.AddressLength+8:], index)
+
+	return key
+}
+
+// transferBlockKey = transferBlockPrefix + num (uint64 big endian)
+func transferBlockKey(number uint64) []byte {
+	return append(transferBlockPrefix, encodeBlockNumber(number)...)
+}
+
 // preimageKey = preimagePrefix + hash
 func preimageKey(hash common.Hash) []byte {
 	return append(preimagePrefix, hash.Bytes()...)
@@ -0,0 +1,226 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core/rawdb"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/log"
+	"github.com/expanse-org/go-expanse/metrics"
+)
+
+const (
+	// maxRejectedReorgs is the number of rejected side chain records kept in the
+	// database, older ones are deleted as new ones arrive.
+	maxRejectedReorgs = 128
+
+	// maxReorgOverrides is the number of pending manual overrides kept at once,
+	// the oldest one is dropped if a new one is added over the limit.
+	maxReorgOverrides = 16
+)
+
+var reorgRejectMeter = metrics.NewRegisteredMeter("chain/reorg/rejects", nil)
+
+// reorgGuard enforces the maximum reorg depth policy of the local node. Blocks
+// deeper than the configured depth below the head are considered final and any
+// side chain forking off before them is refused, unless manually authorized.
+type reorgGuard struct {
+	maxDepth  uint64                    // Maximum depth a side chain may fork off below the head (0 = unlimited)
+	overrides map[common.Hash]time.Time // Side chain blocks authorized to reorg past the depth limit, with their creation time
+	lock      sync.RWMutex
+}
+
+// SetMaxReorgDepth sets the maximum number of blocks below the current head a
+// side chain may fork off from to be accepted. Zero disables the limit.
+func (bc *BlockChain) SetMaxReorgDepth(depth uint64) {
+	bc.reorgGuard.lock.Lock()
+	defer bc.reorgGuard.lock.Unlock()
+
+	bc.reorgGuard.maxDepth = depth
+}
+
+// MaxReorgDepth returns the maximum reorg depth enforced by the chain, zero if
+// the limit is disabled.
+func (bc *BlockChain) MaxReorgDepth() uint64 {
+	bc.reorgGuard.lock.RLock()
+	defer bc.reorgGuard.lock.RUnlock()
+
+	return bc.reorgGuard.maxDepth
+}
+
+// OverrideReorgGuard authorizes any side chain containing the block with the
+// given hash to reorg the local chain, regardless of its depth or penalty. It
+// is meant to be used by operators to accept a legitimate deep reorg (e.g. after
+// a network split), the side chain will be picked up on the next sync cycle.
+//
+// Overrides are kept in memory only, and expire once the authorized block made
+// it into the canonical chain.
+func (bc *BlockChain) OverrideReorgGuard(hash common.Hash) {
+	bc.reorgGuard.lock.Lock()
+	defer bc.reorgGuard.lock.Unlock()
+
+	if bc.reorgGuard.overrides == nil {
+		bc.reorgGuard.overrides = make(map[common.Hash]time.Time)
+	}
+	if _, ok := bc.reorgGuard.overrides[hash]; !ok && len(bc.reorgGuard.overrides) >= maxReorgOverrides {
+		var (
+			oldest common.Hash
+			added  time.Time
+		)
+		for hash, created := range bc.reorgGuard.overrides {
+			if added.IsZero() || created.Before(added) {
+				oldest, added = hash, created
+			}
+		}
+		delete(bc.reorgGuard.overrides, oldest)
+		log.Warn("Reorg guard override dropped", "hash", oldest)
+	}
+	bc.reorgGuard.overrides[hash] = time.Now()
+	log.Warn("Reorg guard overridden", "hash", hash)
+}
+
+// RejectedReorgs returns all the side chains refused by the reorg depth policy.
+func (bc *BlockChain) RejectedReorgs() []*rawdb.RejectedReorg {
+	return rawdb.ReadAllRejectedReorgs(bc.db)
+}
+
+// rejectReorg logs and stores the record of a side chain refused by the reorg
+// depth policy, deleting the oldest records beyond the retention limit. It must
+// only be called once the side chain headers were verified, so peers can't fill
+// the database with garbage forks.
+func (bc *BlockChain) rejectReorg(reorg *rawdb.RejectedReorg) {
+	reorgRejectMeter.Mark(1)
+	log.Error("Rejected side chain beyond maximum reorg depth", "number", reorg.Number, "hash", reorg.Hash,
+		"fork", reorg.ForkNumber, "depth", reorg.HeadNumber-reorg.ForkNumber, "limit", bc.MaxReorgDepth(), "origin", reorg.Origin)
+
+	rawdb.WriteRejectedReorg(bc.db, reorg)
+
+	reorgs := rawdb.ReadAllRejectedReorgs(bc.db)
+	if len(reorgs) <= maxRejectedReorgs {
+		return
+	}
+	sort.SliceStable(reorgs, func(i, j int) bool {
+		return reorgs[i].Time < reorgs[j].Time
+	})
+	for _, old := range reorgs[:len(reorgs)-maxRejectedReorgs] {
+		rawdb.DeleteRejectedReorg(bc.db, old.Hash, old.Number)
+	}
+}
+
+// checkSideChain runs the local reorg policies against the given chain if it
+// forks off the canonical one. Chains extending the current head, re-imports of
+// canonical blocks and chains with unknown ancestry are not checked. If the
+// chain is refused by the reorg depth policy, the record to store once its
+// headers are verified is also returned.
+func (bc *BlockChain) checkSideChain(chain types.Blocks) (*rawdb.RejectedReorg, error) {
+	first, fork, authorized := bc.sideChainFork(chain)
+	if fork == nil || authorized {
+		return nil, nil
+	}
+	if reorg, err := bc.checkReorgDepth(chain[first:], fork); err != nil {
+		return reorg, err
+	}
+	return nil, bc.checkChainForAttack(chain[first:], fork)
+}
+
+// sideChainFork returns the index of the first block in chain which is not part
+// of the canonical chain, along with the canonical header it forks off from. It
+// also reports whether any of the side chain blocks were authorized to override
+// the reorg policies, expiring the overrides already applied.
+func (bc *BlockChain) sideChainFork(chain types.Blocks) (int, *types.Header, bool) {
+	bc.reorgGuard.lock.Lock()
+	defer bc.reorgGuard.lock.Unlock()
+
+	// Expire the overrides whose blocks made it into the canonical chain
+	for hash := range bc.reorgGuard.overrides {
+		if number := bc.hc.GetBlockNumber(hash); number != nil && bc.GetCanonicalHash(*number) == hash {
+			delete(bc.reorgGuard.overrides, hash)
+			log.Info("Reorg guard override applied", "hash", hash, "number", *number)
+		}
+	}
+	// Skip any blocks that are already part of the canonical chain, they are
+	// re-imports and not a reorg
+	first := 0
+	for ; first < len(chain); first++ {
+		if bc.GetCanonicalHash(chain[first].NumberU64()) != chain[first].Hash() {
+			break
+		}
+	}
+	if first == len(chain) {
+		return first, nil, false
+	}
+	var authorized bool
+	for _, block := range chain[first:] {
+		if _, ok := bc.reorgGuard.overrides[block.Hash()]; ok {
+			authorized = true
+		}
+	}
+	// Walk the side chain back to the canonical chain to find the fork point. If
+	// an ancestor is missing, the chain is either a future chain or garbage and
+	// will be handled by the regular import logic.
+	fork := bc.GetHeader(chain[first].ParentHash(), chain[first].NumberU64()-1)
+	for fork != nil && bc.GetCanonicalHash(fork.Number.Uint64()) != fork.Hash() {
+		if _, ok := bc.reorgGuard.overrides[fork.Hash()]; ok {
+			authorized = true
+		}
+		fork = bc.GetHeader(fork.ParentHash, fork.Number.Uint64()-1)
+	}
+	return first, fork, authorized
+}
+
+// checkReorgDepth verifies that the side chain does not fork off deeper below
+// the current head than allowed, returning the record of the rejected side
+// chain otherwise.
+func (bc *BlockChain) checkReorgDepth(chain types.Blocks, fork *types.Header) (*rawdb.RejectedReorg, error) {
+	var (
+		maxDepth = bc.MaxReorgDepth()
+		head     = bc.CurrentBlock().NumberU64()
+		number   = fork.Number.Uint64()
+	)
+	if maxDepth == 0 || number >= head || head-number <= maxDepth {
+		return nil, nil
+	}
+	reorg := &rawdb.RejectedReorg{
+		Number:     chain[0].NumberU64(),
+		Hash:       chain[0].Hash(),
+		ForkNumber: number,
+		HeadNumber: head,
+		Origin:     blockOrigin(chain[0]),
+		Time:       uint64(time.Now().Unix()),
+	}
+	return reorg, fmt.Errorf("%w: fork at #%d is %d blocks below head, limit %d", ErrReorgTooDeep, number, head-number, maxDepth)
+}
+
+// blockOrigin returns the identifier of the peer a block was received from, or
+// an empty string if unknown (e.g. locally mined or imported from a file).
+func blockOrigin(block *types.Block) string {
+	switch origin := block.ReceivedFrom.(type) {
+	case string:
+		return origin
+	case interface{ ID() string }:
+		return origin.ID()
+	case fmt.Stringer:
+		return origin.String()
+	}
+	return ""
+}
@@ -0,0 +1,202 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/consensus/ethash"
+	"github.com/expanse-org/go-expanse/core/rawdb"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/core/vm"
+	"github.com/expanse-org/go-expanse/ethdb"
+	"github.com/expanse-org/go-expanse/params"
+)
+
+// newReorgTester creates a chain with the given reorg depth limit and imports a
+// canonical chain of the given length into it.
+func newReorgTester(t *testing.T, maxDepth uint64, n int) (ethdb.Database, *BlockChain, []*types.Block) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		genesis = (&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+		engine  = ethash.NewFaker()
+	)
+	canon, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, n, func(i int, b *BlockGen) {})
+
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	chain.SetMaxReorgDepth(maxDepth)
+	if _, err := chain.InsertChain(canon); err != nil {
+		t.Fatalf("failed to insert canonical chain: %v", err)
+	}
+	return db, chain, canon
+}
+
+// makeSideChain creates a side chain forking off depth blocks below the head of
+// canon, reaching extra blocks past it.
+func makeSideChain(db ethdb.Database, canon []*types.Block, depth, extra int) []*types.Block {
+	parent := canon[len(canon)-1-depth]
+	side, _ := GenerateChain(params.TestChainConfig, parent, ethash.NewFaker(), db, depth+extra, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{0x01})
+	})
+	return side
+}
+
+// Tests that side chains forking off deeper than the maximum reorg depth are
+// rejected and recorded, while shallower ones are imported.
+func TestReorgMaxDepth(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxDepth uint64
+		depth    int
+		rejected bool
+	}{
+		{"unlimited", 0, 20, false},
+		{"extension", 5, 0, false},
+		{"shallow reorg", 5, 3, false},
+		{"reorg at limit", 5, 5, false},
+		{"reorg past limit", 5, 6, true},
+		{"deep reorg", 5, 20, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, chain, canon := newReorgTester(t, tt.maxDepth, 32)
+			defer chain.Stop()
+
+			side := makeSideChain(db, canon, tt.depth, 2)
+			side[0].ReceivedFrom = "peer-1"
+
+			_, err := chain.InsertChain(side)
+			if !tt.rejected {
+				if err != nil {
+					t.Fatalf("failed to insert side chain: %v", err)
+				}
+				if head := chain.CurrentBlock().Hash(); head != side[len(side)-1].Hash() {
+					t.Fatalf("head mismatch: have %x, want %x", head, side[len(side)-1].Hash())
+				}
+				if reorgs := chain.RejectedReorgs(); len(reorgs) != 0 {
+					t.Fatalf("unexpected rejected reorgs: %v", reorgs)
+				}
+				return
+			}
+			if !errors.Is(err, ErrReorgTooDeep) {
+				t.Fatalf("side chain error mismatch: have %v, want %v", err, ErrReorgTooDeep)
+			}
+			if head := chain.CurrentBlock().Hash(); head != canon[len(canon)-1].Hash() {
+				t.Fatalf("head changed after rejected reorg")
+			}
+			reorgs := chain.RejectedReorgs()
+			if len(reorgs) != 1 {
+				t.Fatalf("rejected reorg count mismatch: have %d, want 1", len(reorgs))
+			}
+			want := rawdb.RejectedReorg{
+				Number:     side[0].NumberU64(),
+				Hash:       side[0].Hash(),
+				ForkNumber: side[0].NumberU64() - 1,
+				HeadNumber: canon[len(canon)-1].NumberU64(),
+				Origin:     "peer-1",
+				Time:       reorgs[0].Time,
+			}
+			if *reorgs[0] != want {
+				t.Fatalf("rejected reorg mismatch: have %+v, want %+v", reorgs[0], want)
+			}
+		})
+	}
+}
+
+// Tests that a deep reorg can be accepted after a manual override.
+func TestReorgGuardOverride(t *testing.T) {
+	db, chain, canon := newReorgTester(t, 5, 32)
+	defer chain.Stop()
+
+	side := makeSideChain(db, canon, 10, 2)
+	if _, err := chain.InsertChain(side); !errors.Is(err, ErrReorgTooDeep) {
+		t.Fatalf("side chain error mismatch: have %v, want %v", err, ErrReorgTooDeep)
+	}
+	chain.OverrideReorgGuard(side[0].Hash())
+
+	if _, err := chain.InsertChain(side); err != nil {
+		t.Fatalf("failed to insert authorized side chain: %v", err)
+	}
+	if head := chain.CurrentBlock().Hash(); head != side[len(side)-1].Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", head, side[len(side)-1].Hash())
+	}
+	// The override was applied, make sure it doesn't linger around
+	chain.sideChainFork(side)
+	if n := len(chain.reorgGuard.overrides); n != 0 {
+		t.Fatalf("applied override not expired: %d left", n)
+	}
+}
+
+// Tests that the number of pending overrides is capped, dropping the oldest.
+func TestReorgGuardOverrideLimit(t *testing.T) {
+	_, chain, _ := newReorgTester(t, 5, 1)
+	defer chain.Stop()
+
+	for i := 0; i <= maxReorgOverrides; i++ {
+		chain.OverrideReorgGuard(common.Hash{byte(i)})
+		time.Sleep(time.Millisecond) // Ensure distinct creation times
+	}
+	if n := len(chain.reorgGuard.overrides); n != maxReorgOverrides {
+		t.Fatalf("override count mismatch: have %d, want %d", n, maxReorgOverrides)
+	}
+	if _, ok := chain.reorgGuard.overrides[common.Hash{0}]; ok {
+		t.Fatalf("oldest override not dropped")
+	}
+}
+
+// Tests that deep side chains with invalid headers are refused without leaving a
+// record in the database.
+func TestReorgGuardUnverified(t *testing.T) {
+	db, chain, canon := newReorgTester(t, 5, 32)
+	defer chain.Stop()
+
+	side := makeSideChain(db, canon, 10, 2)
+	header := side[len(side)-1].Header()
+	header.Extra = make([]byte, params.MaximumExtraDataSize+1)
+	side[len(side)-1] = side[len(side)-1].WithSeal(header)
+
+	if _, err := chain.InsertChain(side); !errors.Is(err, ErrReorgTooDeep) {
+		t.Fatalf("side chain error mismatch: have %v, want %v", err, ErrReorgTooDeep)
+	}
+	if reorgs := chain.RejectedReorgs(); len(reorgs) != 0 {
+		t.Fatalf("unverified side chain recorded: %v", reorgs)
+	}
+}
+
+// Tests that only the most recent rejected side chains are kept.
+func TestRejectedReorgRotation(t *testing.T) {
+	_, chain, _ := newReorgTester(t, 5, 1)
+	defer chain.Stop()
+
+	for i := 0; i < maxRejectedReorgs+10; i++ {
+		chain.rejectReorg(&rawdb.RejectedReorg{Number: uint64(i), Hash: common.Hash{byte(i)}, Time: uint64(i)})
+	}
+	reorgs := chain.RejectedReorgs()
+	if len(reorgs) != maxRejectedReorgs {
+		t.Fatalf("rejected reorg count mismatch: have %d, want %d", len(reorgs), maxRejectedReorgs)
+	}
+	if reorgs[0].Number != 10 {
+		t.Fatalf("oldest kept record mismatch: have %d, want %d", reorgs[0].Number, 10)
+	}
+}
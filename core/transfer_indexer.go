@@ -0,0 +1,385 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core/rawdb"
+	"github.com/expanse-org/go-expanse/core/state"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/core/vm"
+	"github.com/expanse-org/go-expanse/ethdb"
+	"github.com/expanse-org/go-expanse/log"
+	"github.com/expanse-org/go-expanse/params"
+	"github.com/expanse-org/go-expanse/trie"
+)
+
+const (
+	// transferThrottling is the time to wait between processing two consecutive
+	// index sections. It's useful during chain upgrades to prevent disk overload.
+	transferThrottling = 100 * time.Millisecond
+
+	// transferReexec is the number of blocks the transfer indexer re-executes at
+	// most to regenerate the state of a section when it's missing.
+	transferReexec = 128
+)
+
+// TransferIndexer implements a core.ChainIndexer, re-executing the canonical
+// blocks to index the value transfers and contract creations of all the calls
+// made by their transactions, keyed by the accounts involved.
+type TransferIndexer struct {
+	db       ethdb.Database // database instance to write index data and metadata into
+	chain    *BlockChain    // blockchain to retrieve blocks and live state from
+	database state.Database // ephemeral state database isolating regenerated states from the live one
+	size     uint64         // section size to index transfers for
+	reexec   uint64         // number of blocks to re-execute when the required state is missing
+
+	section   uint64              // Section is the section number being processed currently
+	head      common.Hash         // Head is the hash of the last header processed
+	transfers [][]*types.Transfer // Transfers of the blocks processed in the current section
+
+	statedb   *state.StateDB // Regenerated state after the last processed block, nil if using the live state
+	stateHash common.Hash    // Hash of the block the regenerated state belongs to
+	stateRoot common.Hash    // Root of the regenerated state, referenced in the ephemeral database
+}
+
+// NewTransferIndexer returns a chain indexer that indexes the internal value
+// transfers of the canonical chain for fast address history lookups. If the state
+// needed to execute a section is missing, at most reexec blocks are re-executed
+// to regenerate it.
+func NewTransferIndexer(db ethdb.Database, chain *BlockChain, size, confirms, reexec uint64, throttling time.Duration) *ChainIndexer {
+	backend := &TransferIndexer{
+		db:       db,
+		chain:    chain,
+		database: state.NewDatabaseWithConfig(db, &trie.Config{Cache: 16}),
+		size:     size,
+		reexec:   reexec,
+	}
+	table := rawdb.NewTable(db, string(rawdb.TransferIndexPrefix))
+
+	return NewChainIndexer(db, table, backend, size, confirms, throttling, "transfers")
+}
+
+// NewDefaultTransferIndexer returns a transfer chain indexer with the default
+// section size, confirmations, state regeneration limit and throttling, meant
+// to run alongside block imports.
+func NewDefaultTransferIndexer(db ethdb.Database, chain *BlockChain) *ChainIndexer {
+	return NewTransferIndexer(db, chain, params.TransferIndexBlocks, params.TransferIndexConfirms, transferReexec, transferThrottling)
+}
+
+// Reset implements core.ChainIndexerBackend, starting a new transfer index
+// section and dropping any data left over for it by an earlier chain.
+func (b *TransferIndexer) Reset(ctx context.Context, section uint64, lastSectionHead common.Hash) error {
+	b.section, b.head, b.transfers = section, common.Hash{}, nil
+	for number := section * b.size; number < (section+1)*b.size; number++ {
+		rawdb.DeleteTransfers(b.db, number)
+	}
+	return nil
+}
+
+// Process implements core.ChainIndexerBackend, re-executing a block to collect
+// the value transfers of its transactions.
+func (b *TransferIndexer) Process(ctx context.Context, header *types.Header) error {
+	number, hash := header.Number.Uint64(), header.Hash()
+	if number == 0 {
+		b.transfers = append(b.transfers, nil)
+		b.head = hash
+		return nil
+	}
+	block := b.chain.GetBlock(hash, number)
+	if block == nil {
+		return fmt.Errorf("block #%d [%x] not found", number, hash)
+	}
+	statedb, err := b.stateAt(ctx, block.ParentHash(), number-1)
+	if err != nil {
+		return err
+	}
+	tracer := newTransferTracer(block)
+	if _, _, _, err := b.chain.Processor().Process(block, statedb, vm.Config{Debug: true, Tracer: tracer}); err != nil {
+		b.release()
+		return err
+	}
+	if statedb.Database() == b.database {
+		if err := b.commit(block, statedb); err != nil {
+			b.release()
+			return err
+		}
+	} else if root := statedb.IntermediateRoot(b.chain.Config().IsEIP158(block.Number())); root != block.Root() {
+		return fmt.Errorf("state root mismatch on block #%d [%x]: have %x, want %x", number, hash, root, block.Root())
+	}
+	for i, transfer := range tracer.transfers {
+		transfer.Index = uint(i)
+	}
+	b.transfers = append(b.transfers, tracer.transfers)
+	b.head = hash
+	return nil
+}
+
+// Commit implements core.ChainIndexerBackend, writing out the transfers of the
+// section into the database.
+func (b *TransferIndexer) Commit() error {
+	batch := b.db.NewBatch()
+	for i, transfers := range b.transfers {
+		rawdb.WriteTransfers(batch, b.section*b.size+uint64(i), transfers)
+	}
+	b.transfers = nil
+	return batch.Write()
+}
+
+// Prune returns an empty error since we don't support pruning here.
+func (b *TransferIndexer) Prune(threshold uint64) error {
+	return nil
+}
+
+// stateAt returns the state after the given block. The live state is used if
+// it's still available, otherwise the state regenerated for the last processed
+// block is continued, or a new one regenerated from the closest ancestor with
+// available state.
+func (b *TransferIndexer) stateAt(ctx context.Context, hash common.Hash, number uint64) (*state.StateDB, error) {
+	block := b.chain.GetBlock(hash, number)
+	if block == nil {
+		return nil, fmt.Errorf("block #%d [%x] not found", number, hash)
+	}
+	if statedb, err := b.chain.StateAt(block.Root()); err == nil {
+		b.release()
+		return statedb, nil
+	}
+	if b.statedb != nil && b.stateHash == hash {
+		return b.statedb, nil
+	}
+	b.release()
+
+	// The state is not available, find the closest ancestor having it
+	var (
+		current = block
+		statedb *state.StateDB
+		err     error
+	)
+	for i := uint64(0); ; i++ {
+		if statedb, err = state.New(current.Root(), b.database, nil); err == nil {
+			break
+		}
+		if i == b.reexec {
+			return nil, fmt.Errorf("required historical state unavailable (reexec=%d)", b.reexec)
+		}
+		if current.NumberU64() == 0 {
+			return nil, errors.New("genesis state is missing")
+		}
+		parent := b.chain.GetBlock(current.ParentHash(), current.NumberU64()-1)
+		if parent == nil {
+			return nil, fmt.Errorf("missing block %x #%d", current.ParentHash(), current.NumberU64()-1)
+		}
+		current = parent
+	}
+	// Regenerate the state by re-executing the blocks on top of the ancestor
+	var (
+		start  = time.Now()
+		logged time.Time
+	)
+	for current.NumberU64() < number {
+		if err := ctx.Err(); err != nil {
+			b.release()
+			return nil, err
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Regenerating historical state for transfer index", "block", current.NumberU64()+1, "target", number, "remaining", number-current.NumberU64(), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		next := current.NumberU64() + 1
+		if current = b.chain.GetBlockByNumber(next); current == nil {
+			b.release()
+			return nil, fmt.Errorf("block #%d not found", next)
+		}
+		if _, _, _, err := b.chain.Processor().Process(current, statedb, vm.Config{}); err != nil {
+			b.release()
+			return nil, fmt.Errorf("processing block %d failed: %v", current.NumberU64(), err)
+		}
+		if err := b.commit(current, statedb); err != nil {
+			b.release()
+			return nil, err
+		}
+		statedb = b.statedb
+	}
+	return statedb, nil
+}
+
+// commit finalises a state regenerated in the ephemeral database after a block,
+// replacing the previously regenerated one. Committing and reopening the state
+// for every block keeps the memory use bounded across long regenerations.
+func (b *TransferIndexer) commit(block *types.Block, statedb *state.StateDB) error {
+	root, err := statedb.Commit(b.chain.Config().IsEIP158(block.Number()))
+	if err != nil {
+		return err
+	}
+	if root != block.Root() {
+		return fmt.Errorf("state root mismatch on block #%d [%x]: have %x, want %x", block.NumberU64(), block.Hash(), root, block.Root())
+	}
+	triedb := b.database.TrieDB()
+	triedb.Reference(root, common.Hash{})
+	if b.stateRoot != (common.Hash{}) {
+		triedb.Dereference(b.stateRoot)
+	}
+	b.stateRoot = root
+
+	if b.statedb, err = state.New(root, b.database, nil); err != nil {
+		return fmt.Errorf("state reset after block %d failed: %v", block.NumberU64(), err)
+	}
+	b.stateHash = block.Hash()
+	return nil
+}
+
+// release drops the regenerated state, if any.
+func (b *TransferIndexer) release() {
+	if b.stateRoot != (common.Hash{}) {
+		b.database.TrieDB().Dereference(b.stateRoot)
+	}
+	b.statedb, b.stateHash, b.stateRoot = nil, common.Hash{}, common.Hash{}
+}
+
+// transferFrame is a call in flight, along with the transfers made by it and by
+// its descendants. The transfers are only kept if the call succeeds.
+type transferFrame struct {
+	depth     int               // Depth of the caller, the call runs at depth+1
+	transfer  *types.Transfer   // Transfer made by the call itself, nil if none
+	transfers []*types.Transfer // Transfers made by the descendants of the call
+}
+
+// transferTracer is a vm.Tracer collecting the successful value transfers and
+// contract creations executed by the transactions of a block.
+type transferTracer struct {
+	block     *types.Block
+	tx        *types.Transaction // Transaction currently being executed
+	txIndex   int                // Position of the current transaction in the block
+	frames    []*transferFrame   // Calls in flight, the transaction being the first
+	transfers []*types.Transfer  // Transfers of the successfully executed transactions
+}
+
+// newTransferTracer creates a new transfer collector for the given block.
+func newTransferTracer(block *types.Block) *transferTracer {
+	return &transferTracer{block: block}
+}
+
+// CaptureStart implements the vm.Tracer interface to initialize the tracing operation.
+func (t *transferTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.tx, t.txIndex = nil, 0
+	if statedb, ok := env.StateDB.(interface{ TxIndex() int }); ok {
+		if index := statedb.TxIndex(); index < len(t.block.Transactions()) {
+			t.tx, t.txIndex = t.block.Transactions()[index], index
+		}
+	}
+	frame := &transferFrame{}
+	switch {
+	case create:
+		frame.transfer = &types.Transfer{Type: types.TransferCreate, From: from, To: to, Value: new(big.Int).Set(value)}
+	case value.Sign() > 0:
+		frame.transfer = &types.Transfer{Type: types.TransferCall, From: from, To: to, Value: new(big.Int).Set(value)}
+	}
+	t.frames = []*transferFrame{frame}
+}
+
+// CaptureState implements the vm.Tracer interface to trace a single step of VM execution.
+func (t *transferTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if len(t.frames) == 0 {
+		return
+	}
+	stack := scope.Stack
+
+	// Settle the calls returned from since the last step. The topmost stack item
+	// is the success flag of the call (or the created address) after returning.
+	for len(t.frames) > 1 && t.frames[len(t.frames)-1].depth >= depth {
+		frame := t.frames[len(t.frames)-1]
+		t.frames = t.frames[:len(t.frames)-1]
+
+		if frame.depth > depth || len(stack.Data()) == 0 || stack.Back(0).IsZero() {
+			continue
+		}
+		parent := t.frames[len(t.frames)-1]
+		if frame.transfer != nil {
+			if frame.transfer.Type != types.TransferCall {
+				frame.transfer.To = common.Address(stack.Back(0).Bytes20())
+			}
+			parent.transfers = append(parent.transfers, frame.transfer)
+		}
+		parent.transfers = append(parent.transfers, frame.transfers...)
+	}
+	if err != nil {
+		return
+	}
+	var (
+		caller = scope.Contract.Address()
+		frame  = &transferFrame{depth: depth}
+	)
+	switch op {
+	case vm.CALL:
+		if value := stack.Back(2); !value.IsZero() {
+			frame.transfer = &types.Transfer{Type: types.TransferCall, From: caller, To: common.Address(stack.Back(1).Bytes20()), Value: value.ToBig(), Depth: uint(depth)}
+		}
+	case vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		// Value is either not transferred or stays with the caller, but the
+		// calls made by the callee need to be tracked.
+	case vm.CREATE:
+		frame.transfer = &types.Transfer{Type: types.TransferCreate, From: caller, Value: stack.Back(0).ToBig(), Depth: uint(depth)}
+	case vm.CREATE2:
+		frame.transfer = &types.Transfer{Type: types.TransferCreate2, From: caller, Value: stack.Back(0).ToBig(), Depth: uint(depth)}
+	case vm.SELFDESTRUCT:
+		current := t.frames[len(t.frames)-1]
+		current.transfers = append(current.transfers, &types.Transfer{
+			Type:  types.TransferSelfDestruct,
+			From:  caller,
+			To:    common.Address(stack.Back(0).Bytes20()),
+			Value: env.StateDB.GetBalance(caller),
+			Depth: uint(depth),
+		})
+		return
+	default:
+		return
+	}
+	t.frames = append(t.frames, frame)
+}
+
+// CaptureFault implements the vm.Tracer interface to trace an execution fault.
+func (t *transferTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *transferTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	if len(t.frames) == 0 {
+		return
+	}
+	root := t.frames[0]
+	t.frames = nil
+
+	if err != nil || t.tx == nil {
+		return
+	}
+	var transfers []*types.Transfer
+	if root.transfer != nil {
+		transfers = append(transfers, root.transfer)
+	}
+	for _, transfer := range append(transfers, root.transfers...) {
+		transfer.BlockNumber = t.block.NumberU64()
+		transfer.TxHash = t.tx.Hash()
+		transfer.TxIndex = uint(t.txIndex)
+		t.transfers = append(t.transfers, transfer)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/consensus/ethash"
+	"github.com/expanse-org/go-expanse/core/rawdb"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/core/vm"
+	"github.com/expanse-org/go-expanse/crypto"
+	"github.com/expanse-org/go-expanse/params"
+)
+
+// Tests that the transfer indexer collects the successful value transfers of
+// both transactions and internal calls.
+func TestTransferIndexer(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender = crypto.PubkeyToAddress(key.PublicKey)
+
+		forwarder = common.HexToAddress("0xaa") // forwards the received value to sink
+		sink      = common.HexToAddress("0xbb")
+		failing   = common.HexToAddress("0xcc") // forwards the received value to reverter
+		reverter  = common.HexToAddress("0xdd")
+		creator   = common.HexToAddress("0xee") // creates an empty contract endowed with 1 wei
+		created   = crypto.CreateAddress(creator, 0)
+
+		forward = func(to common.Address) []byte {
+			return common.FromHex("600060006000600034" + "73" + common.Bytes2Hex(to.Bytes()) + "5af100")
+		}
+		db    = rawdb.NewMemoryDatabase()
+		gspec = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				sender:    {Balance: big.NewInt(params.Ether)},
+				forwarder: {Code: forward(sink), Balance: new(big.Int)},
+				failing:   {Code: forward(reverter), Balance: new(big.Int)},
+				reverter:  {Code: common.FromHex("60006000fd"), Balance: new(big.Int)},
+				creator:   {Code: common.FromHex("600060006001f000"), Balance: new(big.Int)},
+			},
+		}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	txs := []struct {
+		to    common.Address
+		value int64
+	}{{forwarder, 100}, {failing, 50}, {creator, 5}, {forwarder, 0}}
+
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 5, func(i int, b *BlockGen) {
+		if i < len(txs) {
+			tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(sender), txs[i].to, big.NewInt(txs[i].value), 100000, b.header.BaseFee, nil), signer, key)
+			b.AddTx(tx)
+		}
+	})
+	gspec.MustCommit(db)
+	chain, err := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Reopen the chain to drop the intermediate states from memory, forcing the
+	// indexer to regenerate them
+	chain.Stop()
+	if chain, err = NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil); err != nil {
+		t.Fatalf("failed to reopen chain: %v", err)
+	}
+	defer chain.Stop()
+	if _, err := chain.StateAt(blocks[1].Root()); err == nil {
+		t.Fatalf("intermediate state still available")
+	}
+	indexer := NewTransferIndexer(db, chain, 2, 0, 128, 0)
+	defer indexer.Close()
+	indexer.Start(chain)
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if sections, _, _ := indexer.Sections(); sections == 3 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("indexer did not finish in time")
+		}
+	}
+	tests := []struct {
+		address common.Address
+		want    []types.Transfer
+	}{
+		{sink, []types.Transfer{
+			{BlockNumber: 1, Index: 1, TxHash: blocks[0].Transactions()[0].Hash(), Type: types.TransferCall, From: forwarder, To: sink, Value: big.NewInt(100), Depth: 1},
+		}},
+		{failing, []types.Transfer{
+			{BlockNumber: 2, TxHash: blocks[1].Transactions()[0].Hash(), Type: types.TransferCall, From: sender, To: failing, Value: big.NewInt(50)},
+		}},
+		{reverter, nil},
+		{creator, []types.Transfer{
+			{BlockNumber: 3, TxHash: blocks[2].Transactions()[0].Hash(), Type: types.TransferCall, From: sender, To: creator, Value: big.NewInt(5)},
+			{BlockNumber: 3, Index: 1, TxHash: blocks[2].Transactions()[0].Hash(), Type: types.TransferCreate, From: creator, To: created, Value: big.NewInt(1), Depth: 1},
+		}},
+	}
+	for i, test := range tests {
+		have := rawdb.ReadTransfers(db, test.address, 0, 0, 10)
+		if len(have) != len(test.want) {
+			t.Errorf("test %d: transfer count mismatch: have %d, want %d", i, len(have), len(test.want))
+			continue
+		}
+		for j := range have {
+			if have[j].Value.Cmp(test.want[j].Value) != 0 {
+				t.Errorf("test %d, transfer %d: value mismatch: have %v, want %v", i, j, have[j].Value, test.want[j].Value)
+			}
+			have[j].Value = test.want[j].Value
+			if *have[j] != test.want[j] {
+				t.Errorf("test %d, transfer %d: mismatch:\nhave %+v\nwant %+v", i, j, *have[j], test.want[j])
+			}
+		}
+	}
+	// The sender's history should be paginated in chain order
+	first := rawdb.ReadTransfers(db, sender, 0, 0, 2)
+	if len(first) != 2 || first[0].To != forwarder || first[1].To != failing {
+		t.Fatalf("first page mismatch: %+v", first)
+	}
+	last := first[len(first)-1]
+	second := rawdb.ReadTransfers(db, sender, last.BlockNumber, uint32(last.Index)+1, 2)
+	if len(second) != 1 || second[0].To != creator {
+		t.Fatalf("second page mismatch: %+v", second)
+	}
+	// Deleting a block should drop its transfers for all the addresses involved
+	rawdb.DeleteTransfers(db, 3)
+	if transfers := rawdb.ReadTransfers(db, creator, 0, 0, 10); len(transfers) != 0 {
+		t.Errorf("deleted transfers still present: %+v", transfers)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/crypto"
+	"github.com/expanse-org/go-expanse/log"
+)
+
+const (
+	// maxTxBundles is the maximum number of bundles the pool keeps at once.
+	maxTxBundles = 1024
+
+	// maxBundleFutureBlocks is how far ahead of the chain head a bundle may
+	// target a block.
+	maxBundleFutureBlocks = 64
+)
+
+var (
+	// ErrBundleEmpty is returned if a bundle without transactions is added.
+	ErrBundleEmpty = errors.New("empty bundle")
+
+	// ErrBundleBlockNumber is returned if a bundle targets no block or a block
+	// number out of range.
+	ErrBundleBlockNumber = errors.New("invalid bundle block number")
+
+	// ErrBundleStale is returned if a bundle targets a block that is already
+	// part of the chain.
+	ErrBundleStale = errors.New("bundle targets past block")
+
+	// ErrBundleFuture is returned if a bundle targets a block too far ahead of
+	// the chain head.
+	ErrBundleFuture = errors.New("bundle targets future block")
+
+	// ErrBundleTimestamp is returned if a bundle can never be included because
+	// of its timestamp bounds.
+	ErrBundleTimestamp = errors.New("invalid bundle timestamp range")
+
+	// ErrBundleUnderpriced is returned if the bundle pool is full and the bundle
+	// doesn't pay more than the cheapest one kept.
+	ErrBundleUnderpriced = errors.New("bundle underpriced")
+)
+
+// TxBundle is an ordered list of transactions to be included atomically at the
+// top of a block. A bundle is only included if none of its transactions fail,
+// except for the ones explicitly allowed to revert.
+type TxBundle struct {
+	Txs               types.Transactions
+	BlockNumber       *big.Int      // Number of the block the bundle is targeted at
+	MinTimestamp      uint64        // Earliest block timestamp to include the bundle at (0 = unbounded)
+	MaxTimestamp      uint64        // Latest block timestamp to include the bundle at (0 = unbounded)
+	RevertingTxHashes []common.Hash // Transactions allowed to revert without voiding the bundle
+}
+
+// Hash returns the hash identifying the bundle, the hash of the concatenated
+// transaction hashes.
+func (b *TxBundle) Hash() common.Hash {
+	hashes := make([]byte, 0, len(b.Txs)*common.HashLength)
+	for _, tx := range b.Txs {
+		hashes = append(hashes, tx.Hash().Bytes()...)
+	}
+	return crypto.Keccak256Hash(hashes)
+}
+
+// CanRevert returns whether the transaction with the given hash may revert
+// without voiding the bundle.
+func (b *TxBundle) CanRevert(hash common.Hash) bool {
+	for _, allowed := range b.RevertingTxHashes {
+		if allowed == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// Price returns the gas weighted average tip the bundle pays the miner on top
+// of the given base fee. It ranks the bundles when they can't all be kept or
+// simulated, payments made by the transactions themselves are not accounted.
+func (b *TxBundle) Price(baseFee *big.Int) *big.Int {
+	var (
+		gas   = new(big.Int)
+		total = new(big.Int)
+	)
+	for _, tx := range b.Txs {
+		tip := tx.EffectiveGasTipValue(baseFee)
+		if tip.Sign() < 0 {
+			tip = new(big.Int)
+		}
+		limit := new(big.Int).SetUint64(tx.Gas())
+		gas.Add(gas, limit)
+		total.Add(total, limit.Mul(limit, tip))
+	}
+	if gas.Sign() == 0 {
+		return gas
+	}
+	return total.Div(total, gas)
+}
+
+// includable returns whether the bundle may be included in a block with the
+// given number and timestamp.
+func (b *TxBundle) includable(number *big.Int, timestamp uint64) bool {
+	if b.BlockNumber.Cmp(number) != 0 {
+		return false
+	}
+	if b.MinTimestamp != 0 && timestamp < b.MinTimestamp {
+		return false
+	}
+	if b.MaxTimestamp != 0 && timestamp > b.MaxTimestamp {
+		return false
+	}
+	return true
+}
+
+// AddBundle adds a transaction bundle to be included by the local miner at the
+// top of the targeted block. The transactions are only checked for a valid
+// signature, the miner simulates the bundle before including it. Bundles are
+// never broadcast to the network. If the pool is full, the cheapest bundle is
+// evicted, provided the new one pays more.
+func (pool *TxPool) AddBundle(bundle *TxBundle) error {
+	if len(bundle.Txs) == 0 {
+		return ErrBundleEmpty
+	}
+	if bundle.MaxTimestamp != 0 && bundle.MinTimestamp > bundle.MaxTimestamp {
+		return ErrBundleTimestamp
+	}
+	for _, tx := range bundle.Txs {
+		if _, err := types.Sender(pool.signer, tx); err != nil {
+			return ErrInvalidSender
+		}
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if bundle.BlockNumber == nil || !bundle.BlockNumber.IsUint64() {
+		return ErrBundleBlockNumber
+	}
+	if bundle.BlockNumber.Uint64() <= pool.currentNumber {
+		return ErrBundleStale
+	}
+	if bundle.BlockNumber.Uint64() > pool.currentNumber+maxBundleFutureBlocks {
+		return ErrBundleFuture
+	}
+	if len(pool.bundles) >= maxTxBundles {
+		var (
+			baseFee  = pool.priced.urgent.baseFee
+			cheapest = 0
+			price    = pool.bundles[0].Price(baseFee)
+		)
+		for i, old := range pool.bundles[1:] {
+			if p := old.Price(baseFee); p.Cmp(price) < 0 {
+				cheapest, price = i+1, p
+			}
+		}
+		if bundle.Price(baseFee).Cmp(price) <= 0 {
+			return ErrBundleUnderpriced
+		}
+		log.Debug("Evicting transaction bundle", "hash", pool.bundles[cheapest].Hash(), "block", pool.bundles[cheapest].BlockNumber, "price", price)
+		pool.bundles[cheapest] = bundle
+	} else {
+		pool.bundles = append(pool.bundles, bundle)
+	}
+
+	log.Debug("Added transaction bundle", "hash", bundle.Hash(), "txs", len(bundle.Txs), "block", bundle.BlockNumber)
+	return nil
+}
+
+// Bundles retrieves the transaction bundles which may be included in a block
+// with the given number and timestamp.
+func (pool *TxPool) Bundles(number *big.Int, timestamp uint64) []*TxBundle {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	var bundles []*TxBundle
+	for _, bundle := range pool.bundles {
+		if bundle.includable(number, timestamp) {
+			bundles = append(bundles, bundle)
+		}
+	}
+	return bundles
+}
+
+// pruneBundles drops the bundles targeting blocks which are already part of
+// the chain. The pool lock must be held.
+func (pool *TxPool) pruneBundles() {
+	bundles := pool.bundles[:0]
+	for _, bundle := range pool.bundles {
+		if bundle.BlockNumber.Uint64() > pool.currentNumber {
+			bundles = append(bundles, bundle)
+		}
+	}
+	for i := len(bundles); i < len(pool.bundles); i++ {
+		pool.bundles[i] = nil
+	}
+	pool.bundles = bundles
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/expanse-org/go-expanse/core/types"
+)
+
+// Tests that bundles are validated when added, only returned for the targeted
+// block and timestamp range, and dropped once their block is in the chain.
+func TestTxPoolBundles(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	txs := types.Transactions{transaction(0, 100000, key), transaction(1, 100000, key)}
+
+	if err := pool.AddBundle(&TxBundle{BlockNumber: big.NewInt(1)}); err != ErrBundleEmpty {
+		t.Fatalf("empty bundle: have %v, want %v", err, ErrBundleEmpty)
+	}
+	if err := pool.AddBundle(&TxBundle{Txs: txs}); err != ErrBundleBlockNumber {
+		t.Fatalf("untargeted bundle: have %v, want %v", err, ErrBundleBlockNumber)
+	}
+	if err := pool.AddBundle(&TxBundle{Txs: txs, BlockNumber: big.NewInt(-1)}); err != ErrBundleBlockNumber {
+		t.Fatalf("negative bundle target: have %v, want %v", err, ErrBundleBlockNumber)
+	}
+	if err := pool.AddBundle(&TxBundle{Txs: txs, BlockNumber: new(big.Int).Lsh(big.NewInt(1), 64)}); err != ErrBundleBlockNumber {
+		t.Fatalf("overflowing bundle target: have %v, want %v", err, ErrBundleBlockNumber)
+	}
+	if err := pool.AddBundle(&TxBundle{Txs: txs, BlockNumber: big.NewInt(0)}); err != ErrBundleStale {
+		t.Fatalf("stale bundle: have %v, want %v", err, ErrBundleStale)
+	}
+	if err := pool.AddBundle(&TxBundle{Txs: txs, BlockNumber: big.NewInt(maxBundleFutureBlocks + 1)}); err != ErrBundleFuture {
+		t.Fatalf("future bundle: have %v, want %v", err, ErrBundleFuture)
+	}
+	if err := pool.AddBundle(&TxBundle{Txs: txs, BlockNumber: big.NewInt(1), MinTimestamp: 20, MaxTimestamp: 10}); err != ErrBundleTimestamp {
+		t.Fatalf("bundle timestamps: have %v, want %v", err, ErrBundleTimestamp)
+	}
+	var (
+		first  = &TxBundle{Txs: txs, BlockNumber: big.NewInt(1)}
+		bound  = &TxBundle{Txs: txs[:1], BlockNumber: big.NewInt(1), MinTimestamp: 10, MaxTimestamp: 20}
+		second = &TxBundle{Txs: txs[1:], BlockNumber: big.NewInt(2)}
+	)
+	for _, bundle := range []*TxBundle{first, bound, second} {
+		if err := pool.AddBundle(bundle); err != nil {
+			t.Fatalf("failed to add bundle: %v", err)
+		}
+	}
+	if first.Hash() == bound.Hash() {
+		t.Fatalf("bundle hash collision")
+	}
+	tests := []struct {
+		number    int64
+		timestamp uint64
+		want      []*TxBundle
+	}{
+		{1, 5, []*TxBundle{first}},
+		{1, 10, []*TxBundle{first, bound}},
+		{1, 20, []*TxBundle{first, bound}},
+		{1, 21, []*TxBundle{first}},
+		{2, 15, []*TxBundle{second}},
+		{3, 15, nil},
+	}
+	for i, tt := range tests {
+		have := pool.Bundles(big.NewInt(tt.number), tt.timestamp)
+		if len(have) != len(tt.want) {
+			t.Fatalf("test %d: bundle count mismatch: have %d, want %d", i, len(have), len(tt.want))
+		}
+		for j := range have {
+			if have[j] != tt.want[j] {
+				t.Errorf("test %d: bundle %d mismatch", i, j)
+			}
+		}
+	}
+	// Advance the chain past the first target block
+	<-pool.requestReset(nil, &types.Header{Number: big.NewInt(1), GasLimit: 10000000, BaseFee: big.NewInt(1)})
+
+	if bundles := pool.Bundles(big.NewInt(1), 15); len(bundles) != 0 {
+		t.Fatalf("stale bundles retained: %d", len(bundles))
+	}
+	if bundles := pool.Bundles(big.NewInt(2), 15); len(bundles) != 1 {
+		t.Fatalf("pending bundles dropped: have %d, want %d", len(bundles), 1)
+	}
+}
+
+// Tests that the cheapest bundles are evicted to make room for better paying
+// ones once the pool is full, and that underpriced bundles are rejected.
+func TestTxPoolBundleEviction(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	bundles := make([]*TxBundle, maxTxBundles)
+	for i := range bundles {
+		tx := pricedTransaction(uint64(i), 100000, big.NewInt(int64(10+i%2)), key)
+		bundles[i] = &TxBundle{Txs: types.Transactions{tx}, BlockNumber: big.NewInt(1)}
+		if err := pool.AddBundle(bundles[i]); err != nil {
+			t.Fatalf("bundle %d: failed to add: %v", i, err)
+		}
+	}
+	cheap := &TxBundle{Txs: types.Transactions{pricedTransaction(maxTxBundles, 100000, big.NewInt(10), key)}, BlockNumber: big.NewInt(1)}
+	if err := pool.AddBundle(cheap); err != ErrBundleUnderpriced {
+		t.Fatalf("underpriced bundle: have %v, want %v", err, ErrBundleUnderpriced)
+	}
+	rich := &TxBundle{Txs: types.Transactions{pricedTransaction(maxTxBundles, 100000, big.NewInt(12), key)}, BlockNumber: big.NewInt(1)}
+	if err := pool.AddBundle(rich); err != nil {
+		t.Fatalf("failed to add better paying bundle: %v", err)
+	}
+	have := pool.Bundles(big.NewInt(1), 0)
+	if len(have) != maxTxBundles {
+		t.Fatalf("bundle count mismatch: have %d, want %d", len(have), maxTxBundles)
+	}
+	if have[0] != rich {
+		t.Fatalf("cheapest bundle not evicted")
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/event"
+)
+
+// txLifecycleQueueSize is the number of transaction state change batches queued
+// for the subscribers before new ones are dropped.
+const txLifecycleQueueSize = 256
+
+// TxLifecycleStatus is the state a transaction moved to in the pool.
+type TxLifecycleStatus string
+
+const (
+	TxLifecycleQueued   TxLifecycleStatus = "queued"   // Entered the future queue, or was demoted into it
+	TxLifecyclePromoted TxLifecycleStatus = "promoted" // Became executable
+	TxLifecycleReplaced TxLifecycleStatus = "replaced" // Replaced by another transaction with the same nonce
+	TxLifecycleDropped  TxLifecycleStatus = "dropped"  // Removed from the pool without being included
+	TxLifecycleIncluded TxLifecycleStatus = "included" // Included in the canonical chain
+)
+
+// Reasons reported for dropped transactions.
+const (
+	TxDropUnderpriced        = "underpriced"         // Below the pool's price limit, or cheapest in a full pool
+	TxDropReplaceUnderpriced = "replace-underpriced" // Same nonce as an executable transaction paying more
+	TxDropNonceTooLow        = "nonce-too-low"       // Nonce used by a transaction included in the chain
+	TxDropInsufficientFunds  = "insufficient-funds"  // Sender can't pay for the transaction anymore
+	TxDropGasLimit           = "gas-limit"           // Needs more gas than the current block gas limit
+	TxDropEvicted            = "evicted"             // Over the per account or global pool limits
+	TxDropExpired            = "expired"             // Queued for longer than the pool lifetime
+)
+
+// TxLifecycle is a state change of a transaction in the pool.
+type TxLifecycle struct {
+	Tx         *types.Transaction
+	Status     TxLifecycleStatus
+	Reason     string        // Reason a transaction was dropped
+	ReplacedBy common.Hash   // Hash of the transaction replacing a replaced one
+	Block      *types.Header // Block a transaction was included in
+
+	private bool // Whether the transaction was private, hidden from public subscribers
+}
+
+// SubscribeTxLifecycleEvent registers a subscription of TxLifecycleEvent and
+// starts sending event to the given channel.
+func (pool *TxPool) SubscribeTxLifecycleEvent(ch chan<- TxLifecycleEvent) event.Subscription {
+	return pool.scope.Track(pool.lifecycleFeed.Subscribe(ch))
+}
+
+// txQueued records that a transaction entered the future queue. The pool lock
+// must be held.
+func (pool *TxPool) txQueued(tx *types.Transaction) {
+	pool.lifecycle = append(pool.lifecycle, &TxLifecycle{Tx: tx, Status: TxLifecycleQueued})
+}
+
+// txPromoted records that a transaction became executable. The pool lock must
+// be held.
+func (pool *TxPool) txPromoted(tx *types.Transaction) {
+	pool.lifecycle = append(pool.lifecycle, &TxLifecycle{Tx: tx, Status: TxLifecyclePromoted})
+}
+
+// txReplaced records that a transaction was superseded by another one with the
+// same nonce. The pool lock must be held.
+func (pool *TxPool) txReplaced(old *types.Transaction, tx *types.Transaction) {
+	pool.lifecycle = append(pool.lifecycle, &TxLifecycle{Tx: old, Status: TxLifecycleReplaced, ReplacedBy: tx.Hash()})
+}
+
+// txDropped records that a transaction was removed for the given reason. The
+// pool lock must be held.
+func (pool *TxPool) txDropped(tx *types.Transaction, reason string) {
+	pool.lifecycle = append(pool.lifecycle, &TxLifecycle{Tx: tx, Status: TxLifecycleDropped, Reason: reason})
+}
+
+// txStale records that a transaction was removed because its nonce was used,
+// reporting whether it was included in the new chain head. The pool lock must
+// be held.
+func (pool *TxPool) txStale(tx *types.Transaction) {
+	header, ok := pool.inclusions[tx.Hash()]
+	if !ok && pool.deepReset {
+		header = pool.lookupInclusion(tx.Hash())
+		ok = header != nil
+	}
+	if ok {
+		pool.lifecycle = append(pool.lifecycle, &TxLifecycle{Tx: tx, Status: TxLifecycleIncluded, Block: header})
+		return
+	}
+	pool.txDropped(tx, TxDropNonceTooLow)
+}
+
+// lookupInclusion retrieves the header of the canonical block including the
+// given transaction, or nil if it's not indexed. It's used when a reset was too
+// deep to track the inclusions block by block.
+func (pool *TxPool) lookupInclusion(hash common.Hash) *types.Header {
+	lookup := pool.chain.GetTransactionLookup(hash)
+	if lookup == nil {
+		return nil
+	}
+	block := pool.chain.GetBlock(lookup.BlockHash, lookup.BlockIndex)
+	if block == nil {
+		return nil
+	}
+	return block.Header()
+}
+
+// txUnpayable records that a transaction was removed because it can't be
+// executed with the current balance or block gas limit. The pool lock must be
+// held.
+func (pool *TxPool) txUnpayable(tx *types.Transaction) {
+	if tx.Gas() > pool.currentMaxGas {
+		pool.txDropped(tx, TxDropGasLimit)
+	} else {
+		pool.txDropped(tx, TxDropInsufficientFunds)
+	}
+}
+
+// trackInclusions records the transactions of a newly canonical block, so that
+// their removal from the pool is reported as an inclusion. The pool lock must
+// be held.
+func (pool *TxPool) trackInclusions(block *types.Block) {
+	if pool.inclusions == nil {
+		pool.inclusions = make(map[common.Hash]*types.Header)
+	}
+	header := block.Header()
+	for _, tx := range block.Transactions() {
+		pool.inclusions[tx.Hash()] = header
+	}
+}
+
+// takeLifecycle returns the recorded transaction state changes and resets the
+// record. The pool lock must be held.
+func (pool *TxPool) takeLifecycle() []*TxLifecycle {
+	changes := pool.lifecycle
+	pool.lifecycle = nil
+
+	// Mark the private transactions while they're still tracked, the ones that
+	// left the pool are forgotten on the next reset
+	for _, change := range changes {
+		_, change.private = pool.private[change.Tx.Hash()]
+	}
+	return changes
+}
+
+// sendLifecycle queues transaction state changes for the subscribers. If they
+// fall behind, the changes are dropped instead of stalling the pool. It must be
+// called without holding the pool lock.
+func (pool *TxPool) sendLifecycle(changes []*TxLifecycle) {
+	if len(changes) == 0 {
+		return
+	}
+	select {
+	case pool.lifecycleCh <- changes:
+	default:
+		lifecycleDropMeter.Mark(int64(len(changes)))
+	}
+}
+
+// lifecycleLoop delivers the queued transaction state changes to the
+// subscribers, so that a slow one never blocks the pool itself.
+func (pool *TxPool) lifecycleLoop() {
+	defer pool.wg.Done()
+
+	for {
+		select {
+		case changes := <-pool.lifecycleCh:
+			pool.lifecycleFeed.Send(TxLifecycleEvent{changes})
+
+			public := make([]*TxLifecycle, 0, len(changes))
+			for _, change := range changes {
+				if !change.private {
+					public = append(public, change)
+				}
+			}
+			if len(public) > 0 {
+				pool.publicLifecycleFeed.Send(TxLifecycleEvent{public})
+			}
+		case <-pool.reorgShutdownCh:
+			return
+		}
+	}
+}
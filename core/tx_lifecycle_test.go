@@ -0,0 +1,257 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core/rawdb"
+	"github.com/expanse-org/go-expanse/core/state"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/crypto"
+	"github.com/expanse-org/go-expanse/event"
+	"github.com/expanse-org/go-expanse/params"
+	"github.com/expanse-org/go-expanse/trie"
+)
+
+// inclusionBlockChain is a test chain whose blocks contain a fixed set of
+// transactions.
+type inclusionBlockChain struct {
+	*testBlockChain
+	block   *types.Block
+	lookups map[common.Hash]*rawdb.LegacyTxLookupEntry
+}
+
+func (bc *inclusionBlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	return bc.block
+}
+
+func (bc *inclusionBlockChain) GetTransactionLookup(hash common.Hash) *rawdb.LegacyTxLookupEntry {
+	return bc.lookups[hash]
+}
+
+// validateLifecycle checks that the given lifecycle changes are received, in
+// order, and no others.
+func validateLifecycle(events chan TxLifecycleEvent, want []*TxLifecycle) error {
+	var have []*TxLifecycle
+	for len(have) < len(want) {
+		select {
+		case ev := <-events:
+			have = append(have, ev.Changes...)
+		case <-time.After(time.Second):
+			return fmt.Errorf("event #%d not fired", len(have))
+		}
+	}
+	select {
+	case ev := <-events:
+		return fmt.Errorf("more than %d events fired: %v", len(want), ev.Changes)
+	case <-time.After(50 * time.Millisecond):
+	}
+	for i := range want {
+		if have[i].Tx.Hash() != want[i].Tx.Hash() || have[i].Status != want[i].Status || have[i].Reason != want[i].Reason || have[i].ReplacedBy != want[i].ReplacedBy {
+			return fmt.Errorf("change %d mismatch: have %s %s (%s), want %s %s (%s)", i,
+				have[i].Tx.Hash().TerminalString(), have[i].Status, have[i].Reason,
+				want[i].Tx.Hash().TerminalString(), want[i].Status, want[i].Reason)
+		}
+		if (have[i].Block == nil) != (want[i].Block == nil) || (want[i].Block != nil && have[i].Block.Hash() != want[i].Block.Hash()) {
+			return fmt.Errorf("change %d block mismatch: have %v, want %v", i, have[i].Block, want[i].Block)
+		}
+	}
+	return nil
+}
+
+// Tests that transaction state changes in the pool are reported to lifecycle
+// subscribers.
+func TestTxPoolLifecycle(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	chain := &inclusionBlockChain{testBlockChain: &testBlockChain{statedb, 10000000, new(event.Feed)}}
+
+	key, _ := crypto.GenerateKey()
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, chain)
+	defer pool.Stop()
+
+	events := make(chan TxLifecycleEvent, 32)
+	sub := pool.SubscribeTxLifecycleEvent(events)
+	defer sub.Unsubscribe()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	testAddBalance(pool, from, big.NewInt(1000000000))
+
+	// A gapped transaction is queued, filling the gap promotes both
+	var (
+		tx0 = pricedTransaction(0, 100000, big.NewInt(1), key)
+		tx1 = pricedTransaction(1, 100000, big.NewInt(1), key)
+		tx2 = pricedTransaction(1, 100000, big.NewInt(2), key)
+		tx3 = pricedTransaction(2, 100000, big.NewInt(1), key)
+	)
+	if err := pool.addRemoteSync(tx1); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := validateLifecycle(events, []*TxLifecycle{{Tx: tx1, Status: TxLifecycleQueued}}); err != nil {
+		t.Fatalf("gapped transaction: %v", err)
+	}
+	if err := pool.addRemoteSync(tx0); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := validateLifecycle(events, []*TxLifecycle{
+		{Tx: tx0, Status: TxLifecycleQueued},
+		{Tx: tx0, Status: TxLifecyclePromoted},
+		{Tx: tx1, Status: TxLifecyclePromoted},
+	}); err != nil {
+		t.Fatalf("gap filling transaction: %v", err)
+	}
+	// Replacing an executable transaction reports both sides
+	if err := pool.addRemoteSync(tx2); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := validateLifecycle(events, []*TxLifecycle{
+		{Tx: tx1, Status: TxLifecycleReplaced, ReplacedBy: tx2.Hash()},
+		{Tx: tx2, Status: TxLifecyclePromoted},
+	}); err != nil {
+		t.Fatalf("replacement: %v", err)
+	}
+	if err := pool.addRemoteSync(tx3); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := validateLifecycle(events, []*TxLifecycle{
+		{Tx: tx3, Status: TxLifecycleQueued},
+		{Tx: tx3, Status: TxLifecyclePromoted},
+	}); err != nil {
+		t.Fatalf("executable transaction: %v", err)
+	}
+	// Include the first transaction in a new head block
+	oldHead := chain.CurrentBlock().Header()
+	chain.block = types.NewBlock(&types.Header{
+		ParentHash: oldHead.Hash(),
+		Number:     big.NewInt(1),
+		GasLimit:   chain.gasLimit,
+		BaseFee:    big.NewInt(1),
+	}, []*types.Transaction{tx0}, nil, nil, trie.NewStackTrie(nil))
+	statedb.SetNonce(from, 1)
+
+	<-pool.requestReset(oldHead, chain.block.Header())
+	if err := validateLifecycle(events, []*TxLifecycle{{Tx: tx0, Status: TxLifecycleIncluded, Block: chain.block.Header()}}); err != nil {
+		t.Fatalf("inclusion: %v", err)
+	}
+	// Raising the price limit drops the cheap remote transactions
+	pool.SetGasPrice(big.NewInt(2))
+	if err := validateLifecycle(events, []*TxLifecycle{
+		{Tx: tx3, Status: TxLifecycleDropped, Reason: TxDropUnderpriced},
+	}); err != nil {
+		t.Fatalf("price limit: %v", err)
+	}
+}
+
+// Tests that transactions included during a reorg too deep to walk are still
+// reported as included instead of dropped.
+func TestTxPoolLifecycleDeepReorg(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	chain := &inclusionBlockChain{testBlockChain: &testBlockChain{statedb, 10000000, new(event.Feed)}}
+
+	key, _ := crypto.GenerateKey()
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, chain)
+	defer pool.Stop()
+
+	events := make(chan TxLifecycleEvent, 32)
+	sub := pool.SubscribeTxLifecycleEvent(events)
+	defer sub.Unsubscribe()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	testAddBalance(pool, from, big.NewInt(1000000000))
+
+	var (
+		tx0 = pricedTransaction(0, 100000, big.NewInt(1), key)
+		tx1 = pricedTransaction(1, 100000, big.NewInt(1), key)
+	)
+	if err := pool.AddRemotesSync([]*types.Transaction{tx0, tx1})[0]; err != nil {
+		t.Fatalf("failed to add transactions: %v", err)
+	}
+	if err := validateLifecycle(events, []*TxLifecycle{
+		{Tx: tx0, Status: TxLifecycleQueued},
+		{Tx: tx1, Status: TxLifecycleQueued},
+		{Tx: tx0, Status: TxLifecyclePromoted},
+		{Tx: tx1, Status: TxLifecyclePromoted},
+	}); err != nil {
+		t.Fatalf("executable transactions: %v", err)
+	}
+
+	// Jump to a head on an unrelated chain, more than 64 blocks away, which
+	// included the first transaction only
+	oldHead := chain.CurrentBlock().Header()
+	chain.block = types.NewBlock(&types.Header{
+		ParentHash: common.Hash{0x01},
+		Number:     big.NewInt(100),
+		GasLimit:   chain.gasLimit,
+		BaseFee:    big.NewInt(1),
+	}, []*types.Transaction{tx0}, nil, nil, trie.NewStackTrie(nil))
+	chain.lookups = map[common.Hash]*rawdb.LegacyTxLookupEntry{
+		tx0.Hash(): {BlockHash: chain.block.Hash(), BlockIndex: 100},
+	}
+	statedb.SetNonce(from, 2)
+
+	<-pool.requestReset(oldHead, chain.block.Header())
+	if err := validateLifecycle(events, []*TxLifecycle{
+		{Tx: tx0, Status: TxLifecycleIncluded, Block: chain.block.Header()},
+		{Tx: tx1, Status: TxLifecycleDropped, Reason: TxDropNonceTooLow},
+	}); err != nil {
+		t.Fatalf("deep reorg: %v", err)
+	}
+}
+
+// Tests that a subscriber not draining its lifecycle events doesn't block the
+// pool from accepting transactions.
+func TestTxPoolLifecycleSlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	chain := &testBlockChain{statedb, 10000000, new(event.Feed)}
+
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, chain)
+	defer pool.Stop()
+
+	sub := pool.SubscribeTxLifecycleEvent(make(chan TxLifecycleEvent))
+	defer sub.Unsubscribe()
+
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 2*txLifecycleQueueSize; i++ {
+			key, _ := crypto.GenerateKey()
+			testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+			if err := pool.addRemoteSync(transaction(0, 100000, key)); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("pool blocked by slow lifecycle subscriber")
+	}
+}
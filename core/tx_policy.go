@@ -0,0 +1,446 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/common/math"
+	"github.com/expanse-org/go-expanse/core/state"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/log"
+)
+
+const (
+	// txPolicyRejectsLimit is the number of recent policy rejections retained
+	// for reporting.
+	txPolicyRejectsLimit = 256
+
+	// txPolicyReloadInterval is the time between two checks whether a policy
+	// file changed.
+	txPolicyReloadInterval = 2 * time.Second
+)
+
+// TxPoolPolicy is an admission rule consulted by the transaction pool for every
+// transaction that passed the built-in validity checks. Policies apply to local
+// transactions too, it's up to them to exempt those if needed.
+type TxPoolPolicy interface {
+	// Name returns the identifier of the policy, used to report rejections.
+	Name() string
+
+	// Validate checks whether the transaction from the given sender may enter
+	// the pool, returning the reason of the rejection otherwise. The state is
+	// the one of the current pool head and must not be modified.
+	Validate(tx *types.Transaction, from common.Address, state *state.StateDB, local bool) error
+}
+
+// TxPolicyRejection is a transaction refused by one of the pool policies.
+type TxPolicyRejection struct {
+	Hash   common.Hash    `json:"hash"`
+	From   common.Address `json:"from"`
+	Local  bool           `json:"local"`
+	Policy string         `json:"policy"`
+	Reason string         `json:"reason"`
+	Time   time.Time      `json:"time"`
+}
+
+// TxPolicyStatus reports the active admission policies and the transactions
+// they rejected.
+type TxPolicyStatus struct {
+	Policies []string             `json:"policies"` // Names of the active policies
+	Rejected map[string]uint64    `json:"rejected"` // Number of rejections per policy since startup
+	Recent   []*TxPolicyRejection `json:"recent"`   // Most recent rejections, oldest first
+}
+
+// txPolicyLog records the transactions rejected by the pool policies.
+type txPolicyLog struct {
+	counts map[string]uint64
+	recent []*TxPolicyRejection
+	lock   sync.Mutex
+}
+
+func newTxPolicyLog() *txPolicyLog {
+	return &txPolicyLog{counts: make(map[string]uint64)}
+}
+
+// add records a rejection, dropping the oldest one if the log is full.
+func (l *txPolicyLog) add(reject *TxPolicyRejection) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.counts[reject.Policy]++
+	if len(l.recent) >= txPolicyRejectsLimit {
+		copy(l.recent, l.recent[1:])
+		l.recent = l.recent[:len(l.recent)-1]
+	}
+	l.recent = append(l.recent, reject)
+}
+
+// AddPolicy registers an additional admission policy. It only affects the
+// transactions added afterwards.
+func (pool *TxPool) AddPolicy(policy TxPoolPolicy) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.policies = append(pool.policies, policy)
+}
+
+// PolicyStatus returns the active admission policies and the transactions they
+// recently rejected.
+func (pool *TxPool) PolicyStatus() *TxPolicyStatus {
+	pool.mu.RLock()
+	names := make([]string, 0, len(pool.policies))
+	for _, policy := range pool.policies {
+		names = append(names, policy.Name())
+	}
+	pool.mu.RUnlock()
+
+	pool.rejects.lock.Lock()
+	defer pool.rejects.lock.Unlock()
+
+	status := &TxPolicyStatus{
+		Policies: names,
+		Rejected: make(map[string]uint64, len(pool.rejects.counts)),
+		Recent:   make([]*TxPolicyRejection, len(pool.rejects.recent)),
+	}
+	for name, count := range pool.rejects.counts {
+		status.Rejected[name] = count
+	}
+	copy(status.Recent, pool.rejects.recent)
+	return status
+}
+
+// validatePolicies runs the transaction through all the admission policies,
+// recording it if any of them refuses it. The pool lock must be held.
+func (pool *TxPool) validatePolicies(tx *types.Transaction, from common.Address, local bool) error {
+	for _, policy := range pool.policies {
+		if err := policy.Validate(tx, from, pool.currentState, local); err != nil {
+			policyRejectMeter.Mark(1)
+			pool.rejects.add(&TxPolicyRejection{
+				Hash:   tx.Hash(),
+				From:   from,
+				Local:  local,
+				Policy: policy.Name(),
+				Reason: err.Error(),
+				Time:   time.Now(),
+			})
+			return fmt.Errorf("%w: %s: %v", ErrTxPolicyRejected, policy.Name(), err)
+		}
+	}
+	return nil
+}
+
+// AccountListPolicy rejects the transactions of denied senders and, if an allow
+// list is set, of all senders not on it.
+type AccountListPolicy struct {
+	deny  map[common.Address]struct{}
+	allow map[common.Address]struct{}
+}
+
+// NewAccountListPolicy creates a sender filtering policy. An empty allow list
+// accepts every sender not explicitly denied.
+func NewAccountListPolicy(deny []common.Address, allow []common.Address) *AccountListPolicy {
+	p := &AccountListPolicy{
+		deny:  make(map[common.Address]struct{}),
+		allow: make(map[common.Address]struct{}),
+	}
+	for _, addr := range deny {
+		p.deny[addr] = struct{}{}
+	}
+	for _, addr := range allow {
+		p.allow[addr] = struct{}{}
+	}
+	return p
+}
+
+// Name implements TxPoolPolicy.
+func (p *AccountListPolicy) Name() string { return "accounts" }
+
+// Validate implements TxPoolPolicy.
+func (p *AccountListPolicy) Validate(tx *types.Transaction, from common.Address, state *state.StateDB, local bool) error {
+	if _, ok := p.deny[from]; ok {
+		return fmt.Errorf("sender %x is denied", from)
+	}
+	if len(p.allow) > 0 {
+		if _, ok := p.allow[from]; !ok {
+			return fmt.Errorf("sender %x is not allowed", from)
+		}
+	}
+	return nil
+}
+
+// MinTipPolicy rejects transactions paying less than the minimum tip of the
+// account class of their sender.
+type MinTipPolicy struct {
+	fallback *big.Int                    // Minimum tip of senders without a class
+	tips     map[common.Address]*big.Int // Minimum tip of senders with a class
+}
+
+// NewMinTipPolicy creates a minimum tip policy. The fallback applies to the
+// senders not listed in tips and may be nil to accept them regardless.
+func NewMinTipPolicy(fallback *big.Int, tips map[common.Address]*big.Int) *MinTipPolicy {
+	return &MinTipPolicy{fallback: fallback, tips: tips}
+}
+
+// Name implements TxPoolPolicy.
+func (p *MinTipPolicy) Name() string { return "mintip" }
+
+// Validate implements TxPoolPolicy.
+func (p *MinTipPolicy) Validate(tx *types.Transaction, from common.Address, state *state.StateDB, local bool) error {
+	limit, ok := p.tips[from]
+	if !ok {
+		limit = p.fallback
+	}
+	if limit != nil && tx.GasTipCapIntCmp(limit) < 0 {
+		return fmt.Errorf("tip %v below minimum %v", tx.GasTipCap(), limit)
+	}
+	return nil
+}
+
+// MaxGasPolicy rejects transactions requesting more gas than a set cap.
+type MaxGasPolicy struct {
+	limit uint64
+}
+
+// NewMaxGasPolicy creates a policy capping the gas of a single transaction.
+func NewMaxGasPolicy(limit uint64) *MaxGasPolicy {
+	return &MaxGasPolicy{limit: limit}
+}
+
+// Name implements TxPoolPolicy.
+func (p *MaxGasPolicy) Name() string { return "maxgas" }
+
+// Validate implements TxPoolPolicy.
+func (p *MaxGasPolicy) Validate(tx *types.Transaction, from common.Address, state *state.StateDB, local bool) error {
+	if tx.Gas() > p.limit {
+		return fmt.Errorf("gas %d above cap %d", tx.Gas(), p.limit)
+	}
+	return nil
+}
+
+// CreationPolicy rejects contract creations from unknown senders, which are
+// the accounts that never sent a transaction and are not explicitly trusted.
+type CreationPolicy struct {
+	trusted map[common.Address]struct{}
+}
+
+// NewCreationPolicy creates a policy restricting contract creations to known
+// senders and the given trusted accounts.
+func NewCreationPolicy(trusted []common.Address) *CreationPolicy {
+	p := &CreationPolicy{trusted: make(map[common.Address]struct{})}
+	for _, addr := range trusted {
+		p.trusted[addr] = struct{}{}
+	}
+	return p
+}
+
+// Name implements TxPoolPolicy.
+func (p *CreationPolicy) Name() string { return "creation" }
+
+// Validate implements TxPoolPolicy.
+func (p *CreationPolicy) Validate(tx *types.Transaction, from common.Address, state *state.StateDB, local bool) error {
+	if tx.To() != nil {
+		return nil
+	}
+	if _, ok := p.trusted[from]; ok {
+		return nil
+	}
+	if state.GetNonce(from) == 0 {
+		return fmt.Errorf("contract creation from unknown sender %x", from)
+	}
+	return nil
+}
+
+// TxPolicyConfig is the format of a transaction pool policy file.
+type TxPolicyConfig struct {
+	Deny                   []common.Address          `json:"deny,omitempty"`                   // Senders whose transactions are always rejected
+	Allow                  []common.Address          `json:"allow,omitempty"`                  // If set, only these senders are accepted
+	MaxGas                 uint64                    `json:"maxGas,omitempty"`                 // Maximum gas of a single transaction (0 = unlimited)
+	MinTip                 *math.HexOrDecimal256     `json:"minTip,omitempty"`                 // Minimum tip of the senders without a class
+	Classes                map[string]*TxPolicyClass `json:"classes,omitempty"`                // Account classes with their own minimum tip
+	RejectUnknownCreations bool                      `json:"rejectUnknownCreations,omitempty"` // Whether to refuse contract creations from unknown senders
+}
+
+// TxPolicyClass is a group of accounts sharing the same minimum tip.
+type TxPolicyClass struct {
+	Accounts []common.Address      `json:"accounts"`
+	MinTip   *math.HexOrDecimal256 `json:"minTip,omitempty"`
+}
+
+// Policies converts the configuration into the built-in policies enforcing it.
+// Accounts on the allow list or in a class are trusted to create contracts.
+func (c *TxPolicyConfig) Policies() ([]TxPoolPolicy, error) {
+	var policies []TxPoolPolicy
+	if len(c.Deny) > 0 || len(c.Allow) > 0 {
+		policies = append(policies, NewAccountListPolicy(c.Deny, c.Allow))
+	}
+	if c.MaxGas > 0 {
+		policies = append(policies, NewMaxGasPolicy(c.MaxGas))
+	}
+	var (
+		trusted = append([]common.Address{}, c.Allow...)
+		tips    = make(map[common.Address]*big.Int)
+	)
+	for name, class := range c.Classes {
+		for _, addr := range class.Accounts {
+			if _, ok := tips[addr]; ok {
+				return nil, fmt.Errorf("account %x is in multiple classes", addr)
+			}
+			tips[addr] = (*big.Int)(class.MinTip)
+			trusted = append(trusted, addr)
+		}
+		if class.MinTip != nil && (*big.Int)(class.MinTip).Sign() < 0 {
+			return nil, fmt.Errorf("class %q has a negative minimum tip", name)
+		}
+	}
+	if c.MinTip != nil || len(tips) > 0 {
+		policies = append(policies, NewMinTipPolicy((*big.Int)(c.MinTip), tips))
+	}
+	if c.RejectUnknownCreations {
+		policies = append(policies, NewCreationPolicy(trusted))
+	}
+	return policies, nil
+}
+
+// FileTxPoolPolicy enforces the built-in policies configured in a JSON file,
+// which is reloaded in the background whenever it changes. If an updated file
+// is invalid, the previous rules remain in effect.
+type FileTxPoolPolicy struct {
+	path     string
+	policies atomic.Value // Active rules ([]TxPoolPolicy), swapped on reload
+	modTime  time.Time    // Modification time of the loaded file
+	lock     sync.Mutex   // Serializes the reloads
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewFileTxPoolPolicy creates a policy from the rules in the given file and
+// starts watching it for changes. Close must be called to stop the watcher.
+func NewFileTxPoolPolicy(path string) (*FileTxPoolPolicy, error) {
+	p := &FileTxPoolPolicy{
+		path: path,
+		quit: make(chan struct{}),
+	}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	p.wg.Add(1)
+	go p.loop()
+
+	return p, nil
+}
+
+// Close stops watching the policy file for changes.
+func (p *FileTxPoolPolicy) Close() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+// loop periodically checks whether the policy file changed, reloading it off
+// the transaction validation path.
+func (p *FileTxPoolPolicy) loop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(txPolicyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.refresh()
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// refresh reloads the policy file if it was modified since the last load.
+func (p *FileTxPoolPolicy) refresh() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	stat, err := os.Stat(p.path)
+	if err != nil {
+		log.Warn("Failed to check transaction policy file", "path", p.path, "err", err)
+		return
+	}
+	if stat.ModTime().Equal(p.modTime) {
+		return
+	}
+	if err := p.reload(); err != nil {
+		// Don't retry until the file is modified again
+		p.modTime = stat.ModTime()
+		log.Warn("Failed to reload transaction policy file", "path", p.path, "err", err)
+	}
+}
+
+// Name implements TxPoolPolicy.
+func (p *FileTxPoolPolicy) Name() string { return "file" }
+
+// Validate implements TxPoolPolicy, reporting the rule rejecting a transaction
+// along with the reason.
+func (p *FileTxPoolPolicy) Validate(tx *types.Transaction, from common.Address, state *state.StateDB, local bool) error {
+	for _, policy := range p.policies.Load().([]TxPoolPolicy) {
+		if err := policy.Validate(tx, from, state, local); err != nil {
+			return fmt.Errorf("%s: %v", policy.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Reload loads the rules from the policy file, regardless of whether it changed.
+func (p *FileTxPoolPolicy) Reload() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.reload()
+}
+
+// reload replaces the active rules with the ones in the policy file. The lock
+// must be held.
+func (p *FileTxPoolPolicy) reload() error {
+	stat, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+	blob, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	var config TxPolicyConfig
+	if err := json.Unmarshal(blob, &config); err != nil {
+		return fmt.Errorf("invalid transaction policy file: %v", err)
+	}
+	policies, err := config.Policies()
+	if err != nil {
+		return fmt.Errorf("invalid transaction policy file: %v", err)
+	}
+	p.policies.Store(policies)
+	p.modTime = stat.ModTime()
+
+	log.Info("Loaded transaction policy file", "path", p.path, "rules", len(policies))
+	return nil
+}
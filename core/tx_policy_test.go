@@ -0,0 +1,167 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core/rawdb"
+	"github.com/expanse-org/go-expanse/core/state"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/crypto"
+)
+
+// Tests that the transaction pool consults its admission policies and records
+// the transactions they reject.
+func TestTxPoolPolicies(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	denied, _ := crypto.GenerateKey()
+	pool.AddPolicy(NewMaxGasPolicy(50000))
+	pool.AddPolicy(NewAccountListPolicy([]common.Address{crypto.PubkeyToAddress(denied.PublicKey)}, nil))
+
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	testAddBalance(pool, crypto.PubkeyToAddress(denied.PublicKey), big.NewInt(1000000000))
+
+	if err := pool.AddRemote(transaction(0, 30000, key)); err != nil {
+		t.Fatalf("failed to add admitted transaction: %v", err)
+	}
+	expensive := transaction(1, 100000, key)
+	if err := pool.AddRemote(expensive); !errors.Is(err, ErrTxPolicyRejected) {
+		t.Fatalf("gas cap not enforced: have %v, want %v", err, ErrTxPolicyRejected)
+	}
+	if err := pool.AddLocal(transaction(0, 30000, denied)); !errors.Is(err, ErrTxPolicyRejected) {
+		t.Fatalf("denied sender admitted: have %v, want %v", err, ErrTxPolicyRejected)
+	}
+	status := pool.PolicyStatus()
+	if len(status.Policies) != 2 || status.Policies[0] != "maxgas" || status.Policies[1] != "accounts" {
+		t.Fatalf("policies mismatch: have %v", status.Policies)
+	}
+	if status.Rejected["maxgas"] != 1 || status.Rejected["accounts"] != 1 {
+		t.Fatalf("rejection counts mismatch: have %v", status.Rejected)
+	}
+	if len(status.Recent) != 2 {
+		t.Fatalf("recent rejections mismatch: have %d, want %d", len(status.Recent), 2)
+	}
+	if status.Recent[0].Hash != expensive.Hash() || status.Recent[0].Policy != "maxgas" || status.Recent[0].Local {
+		t.Fatalf("rejection mismatch: have %+v", status.Recent[0])
+	}
+	if !status.Recent[1].Local || status.Recent[1].From != crypto.PubkeyToAddress(denied.PublicKey) {
+		t.Fatalf("rejection mismatch: have %+v", status.Recent[1])
+	}
+}
+
+// Tests the built-in policies configured through a file, and that the file is
+// reloaded when it changes.
+func TestFileTxPoolPolicy(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "txpolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		keys  = make([]*ecdsa.PrivateKey, 4)
+		addrs = make([]common.Address, 4)
+	)
+	for i := range keys {
+		key, _ := crypto.GenerateKey()
+		keys[i], addrs[i] = key, crypto.PubkeyToAddress(key.PublicKey)
+	}
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.SetNonce(addrs[1], 1)
+
+	path := filepath.Join(dir, "policy.json")
+	config := fmt.Sprintf(`{
+		"deny": ["%s"],
+		"maxGas": 100000,
+		"minTip": "10",
+		"classes": {"partners": {"accounts": ["%s"], "minTip": "1"}},
+		"rejectUnknownCreations": true
+	}`, addrs[2].Hex(), addrs[0].Hex())
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewFileTxPoolPolicy(path)
+	if err != nil {
+		t.Fatalf("failed to load policy: %v", err)
+	}
+	defer policy.Close()
+	sign := func(key *ecdsa.PrivateKey, tx types.TxData) *types.Transaction {
+		return types.MustSignNewTx(key, types.HomesteadSigner{}, tx)
+	}
+	to := common.Address{0x01}
+	tests := []struct {
+		tx   *types.Transaction
+		from common.Address
+		ok   bool
+	}{
+		{sign(keys[0], &types.LegacyTx{Gas: 21000, GasPrice: big.NewInt(1), To: &to}), addrs[0], true},    // class tip
+		{sign(keys[1], &types.LegacyTx{Gas: 21000, GasPrice: big.NewInt(1), To: &to}), addrs[1], false},   // default tip
+		{sign(keys[1], &types.LegacyTx{Gas: 21000, GasPrice: big.NewInt(10), To: &to}), addrs[1], true},   // default tip
+		{sign(keys[1], &types.LegacyTx{Gas: 200000, GasPrice: big.NewInt(10), To: &to}), addrs[1], false}, // gas cap
+		{sign(keys[2], &types.LegacyTx{Gas: 21000, GasPrice: big.NewInt(10), To: &to}), addrs[2], false},  // denied
+		{sign(keys[0], &types.LegacyTx{Gas: 60000, GasPrice: big.NewInt(1)}), addrs[0], true},             // trusted creator
+		{sign(keys[1], &types.LegacyTx{Gas: 60000, GasPrice: big.NewInt(10)}), addrs[1], true},            // known creator
+		{sign(keys[3], &types.LegacyTx{Gas: 60000, GasPrice: big.NewInt(10)}), addrs[3], false},           // unknown creator
+	}
+	for i, tt := range tests {
+		if err := policy.Validate(tt.tx, tt.from, statedb, false); (err == nil) != tt.ok {
+			t.Errorf("test %d: admission mismatch: have %v, want ok=%v", i, err, tt.ok)
+		}
+	}
+	// Lift the default tip and ensure the change is picked up
+	config = `{"minTip": "0"}`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+	policy.refresh()
+
+	if err := policy.Validate(tests[1].tx, tests[1].from, statedb, false); err != nil {
+		t.Fatalf("updated policy not reloaded: %v", err)
+	}
+	// Invalid updates must leave the active rules in place
+	if err := ioutil.WriteFile(path, []byte(`{"maxGas": "lots"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future = future.Add(time.Minute)
+	os.Chtimes(path, future, future)
+	policy.refresh()
+
+	if err := policy.Validate(tests[1].tx, tests[1].from, statedb, false); err != nil {
+		t.Fatalf("invalid policy file replaced the active rules: %v", err)
+	}
+	if err := policy.Reload(); err == nil {
+		t.Fatalf("invalid policy file loaded")
+	}
+}
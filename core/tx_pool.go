@@ -27,6 +27,7 @@ import (
 	"github.com/expanse-org/go-expanse/common"
 	"github.com/expanse-org/go-expanse/common/prque"
 	"github.com/expanse-org/go-expanse/consensus/misc"
+	"github.com/expanse-org/go-expanse/core/rawdb"
 	"github.com/expanse-org/go-expanse/core/state"
 	"github.com/expanse-org/go-expanse/core/types"
 	"github.com/expanse-org/go-expanse/event"
@@ -84,6 +85,10 @@ var (
 	// than some meaningful limit a user might use. This is not a consensus error
 	// making the transaction invalid, rather a DOS protection.
 	ErrOversizedData = errors.New("oversized data")
+
+	// ErrTxPolicyRejected is returned if a transaction is refused by one of the
+	// admission policies of the transaction pool.
+	ErrTxPolicyRejected = errors.New("rejected by transaction pool policy")
 )
 
 var (
@@ -111,6 +116,8 @@ var (
 	invalidTxMeter     = metrics.NewRegisteredMeter("txpool/invalid", nil)
 	underpricedTxMeter = metrics.NewRegisteredMeter("txpool/underpriced", nil)
 	overflowedTxMeter  = metrics.NewRegisteredMeter("txpool/overflowed", nil)
+	policyRejectMeter  = metrics.NewRegisteredMeter("txpool/policy/rejected", nil)
+	lifecycleDropMeter = metrics.NewRegisteredMeter("txpool/lifecycle/dropped", nil) // State changes skipped due to slow subscribers
 
 	pendingGauge = metrics.NewRegisteredGauge("txpool/pending", nil)
 	queuedGauge  = metrics.NewRegisteredGauge("txpool/queued", nil)
@@ -135,6 +142,7 @@ const (
 type blockChain interface {
 	CurrentBlock() *types.Block
 	GetBlock(hash common.Hash, number uint64) *types.Block
+	GetTransactionLookup(hash common.Hash) *rawdb.LegacyTxLookupEntry
 	StateAt(root common.Hash) (*state.StateDB, error)
 
 	SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) event.Subscription
@@ -156,6 +164,11 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	PrivateDeadline uint64 // Blocks after which unmined private transactions are broadcast (0 = never)
+
+	PolicyFile string         // JSON file with the admission policies, reloaded on change
+	Policies   []TxPoolPolicy `toml:"-"` // Admission policies consulted for every transaction
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -173,6 +186,8 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	GlobalQueue:  1024,
 
 	Lifetime: 3 * time.Hour,
+
+	PrivateDeadline: 25,
 }
 
 // sanitize checks the provided user configurations and changes anything that's
@@ -222,14 +237,16 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 // current state) and future transactions. Transactions move between those
 // two states over time as they are received and processed.
 type TxPool struct {
-	config      TxPoolConfig
-	chainconfig *params.ChainConfig
-	chain       blockChain
-	gasPrice    *big.Int
-	txFeed      event.Feed
-	scope       event.SubscriptionScope
-	signer      types.Signer
-	mu          sync.RWMutex
+	config        TxPoolConfig
+	chainconfig   *params.ChainConfig
+	chain         blockChain
+	gasPrice      *big.Int
+	txFeed        event.Feed
+	lifecycleFeed event.Feed
+	releaseFeed   event.Feed
+	scope         event.SubscriptionScope
+	signer        types.Signer
+	mu            sync.RWMutex
 
 	istanbul bool // Fork indicator whether we are in the istanbul stage.
 	eip2718  bool // Fork indicator whether we are using EIP-2718 type transactions.
@@ -238,10 +255,25 @@ type TxPool struct {
 	currentState  *state.StateDB // Current state in the blockchain head
 	pendingNonces *txNoncer      // Pending state tracking virtual nonces
 	currentMaxGas uint64         // Current gas limit for transaction caps
+	currentNumber uint64         // Current block number for private deadlines
 
 	locals  *accountSet // Set of local transaction to exempt from eviction rules
 	journal *txJournal  // Journal of local transaction to back up to disk
 
+	policies []TxPoolPolicy // Admission policies consulted for every transaction
+	rejects  *txPolicyLog   // Transactions recently rejected by the policies
+
+	lifecycle   []*TxLifecycle                // Transaction state changes not yet sent to subscribers
+	lifecycleCh chan []*TxLifecycle           // Transaction state changes queued for the subscribers
+	inclusions  map[common.Hash]*types.Header // Transactions included by the chain head of the running reset
+	deepReset   bool                          // Whether the running reset skipped tracking the inclusions
+
+	private map[common.Hash]uint64 // Transactions kept from the network, mapped to their release block
+	bundles []*TxBundle            // Transaction bundles for the local miner, kept from the network
+
+	publicTxFeed        event.Feed // New transactions, without the private ones
+	publicLifecycleFeed event.Feed // Transaction state changes, without the private ones
+
 	pending map[common.Address]*txList   // All currently processable transactions
 	queue   map[common.Address]*txList   // Queued but non-processable transactions
 	beats   map[common.Address]time.Time // Last heartbeat from each known account
@@ -254,8 +286,8 @@ type TxPool struct {
 	reqPromoteCh    chan *accountSet
 	queueTxEventCh  chan *types.Transaction
 	reorgDoneCh     chan chan struct{}
-	reorgShutdownCh chan struct{}  // requests shutdown of scheduleReorgLoop
-	wg              sync.WaitGroup // tracks loop, scheduleReorgLoop
+	reorgShutdownCh chan struct{}  // requests shutdown of scheduleReorgLoop and lifecycleLoop
+	wg              sync.WaitGroup // tracks loop, scheduleReorgLoop, lifecycleLoop
 }
 
 type txpoolResetRequest struct {
@@ -285,6 +317,10 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		reorgDoneCh:     make(chan chan struct{}),
 		reorgShutdownCh: make(chan struct{}),
 		gasPrice:        new(big.Int).SetUint64(config.PriceLimit),
+		policies:        append([]TxPoolPolicy{}, config.Policies...),
+		rejects:         newTxPolicyLog(),
+		private:         make(map[common.Hash]uint64),
+		lifecycleCh:     make(chan []*TxLifecycle, txLifecycleQueueSize),
 	}
 	pool.locals = newAccountSet(pool.signer)
 	for _, addr := range config.Locals {
@@ -295,8 +331,9 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 	pool.reset(nil, chain.CurrentBlock().Header())
 
 	// Start the reorg loop early so it can handle requests generated during journal loading.
-	pool.wg.Add(1)
+	pool.wg.Add(2)
 	go pool.scheduleReorgLoop()
+	go pool.lifecycleLoop()
 
 	// If local transactions and journaling is enabled, load from disk
 	if !config.NoLocals && config.Journal != "" {
@@ -375,12 +412,15 @@ func (pool *TxPool) loop() {
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
 					list := pool.queue[addr].Flatten()
 					for _, tx := range list {
+						pool.txDropped(tx, TxDropExpired)
 						pool.removeTx(tx.Hash(), true)
 					}
 					queuedEvictionMeter.Mark(int64(len(list)))
 				}
 			}
+			changes := pool.takeLifecycle()
 			pool.mu.Unlock()
+			pool.sendLifecycle(changes)
 
 		// Handle local transaction journal rotation
 		case <-journal.C:
@@ -428,7 +468,11 @@ func (pool *TxPool) GasPrice() *big.Int {
 // new transaction, and drops all transactions below this threshold.
 func (pool *TxPool) SetGasPrice(price *big.Int) {
 	pool.mu.Lock()
-	defer pool.mu.Unlock()
+	defer func() {
+		changes := pool.takeLifecycle()
+		pool.mu.Unlock()
+		pool.sendLifecycle(changes)
+	}()
 
 	old := pool.gasPrice
 	pool.gasPrice = price
@@ -437,6 +481,7 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 		// pool.priced is sorted by GasFeeCap, so we have to iterate through pool.all instead
 		drop := pool.all.RemotesBelowTip(price)
 		for _, tx := range drop {
+			pool.txDropped(tx, TxDropUnderpriced)
 			pool.removeTx(tx.Hash(), false)
 		}
 		pool.priced.Removed(len(drop))
@@ -550,17 +595,17 @@ func (pool *TxPool) Locals() []common.Address {
 	return pool.locals.flatten()
 }
 
-// local retrieves all currently known local transactions, grouped by origin
-// account and sorted by nonce. The returned transaction set is a copy and can be
-// freely modified by calling code.
+// local retrieves all currently known public local transactions, grouped by
+// origin account and sorted by nonce. The returned transaction set is a copy and
+// can be freely modified by calling code.
 func (pool *TxPool) local() map[common.Address]types.Transactions {
 	txs := make(map[common.Address]types.Transactions)
 	for addr := range pool.locals.accounts {
 		if pending := pool.pending[addr]; pending != nil {
-			txs[addr] = append(txs[addr], pending.Flatten()...)
+			txs[addr] = append(txs[addr], pool.public(pending.Flatten())...)
 		}
 		if queued := pool.queue[addr]; queued != nil {
-			txs[addr] = append(txs[addr], queued.Flatten()...)
+			txs[addr] = append(txs[addr], pool.public(queued.Flatten())...)
 		}
 	}
 	return txs
@@ -627,7 +672,8 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if tx.Gas() < intrGas {
 		return ErrIntrinsicGas
 	}
-	return nil
+	// Ensure the transaction passes the locally configured admission policies
+	return pool.validatePolicies(tx, from, local)
 }
 
 // add validates a transaction and inserts it into the non-executable queue for later
@@ -678,6 +724,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		for _, tx := range drop {
 			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "gasTipCap", tx.GasTipCap(), "gasFeeCap", tx.GasFeeCap())
 			underpricedTxMeter.Mark(1)
+			pool.txDropped(tx, TxDropUnderpriced)
 			pool.removeTx(tx.Hash(), false)
 		}
 	}
@@ -695,8 +742,10 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed(1)
 			pendingReplaceMeter.Mark(1)
+			pool.txReplaced(old, tx)
 		}
 		pool.all.Add(tx, isLocal)
+		pool.txPromoted(tx)
 		pool.priced.Put(tx, isLocal)
 		pool.journalTx(from, tx)
 		pool.queueTxEvent(tx)
@@ -746,6 +795,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		queuedReplaceMeter.Mark(1)
+		pool.txReplaced(old, tx)
 	} else {
 		// Nothing was replaced, bump the queued counter
 		queuedGauge.Inc(1)
@@ -759,6 +809,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 		pool.all.Add(tx, local)
 		pool.priced.Put(tx, local)
 	}
+	pool.txQueued(tx)
 	// If we never record the heartbeat, do it right now.
 	if _, exist := pool.beats[from]; !exist {
 		pool.beats[from] = time.Now()
@@ -773,6 +824,10 @@ func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
 	if pool.journal == nil || !pool.locals.contains(from) {
 		return
 	}
+	// Private transactions are not journaled, lest they are broadcast after a restart
+	if _, ok := pool.private[tx.Hash()]; ok {
+		return
+	}
 	if err := pool.journal.insert(tx); err != nil {
 		log.Warn("Failed to journal local transaction", "err", err)
 	}
@@ -795,6 +850,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.all.Remove(hash)
 		pool.priced.Removed(1)
 		pendingDiscardMeter.Mark(1)
+		pool.txDropped(tx, TxDropReplaceUnderpriced)
 		return false
 	}
 	// Otherwise discard any previous transaction and mark this
@@ -802,12 +858,14 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		pendingReplaceMeter.Mark(1)
+		pool.txReplaced(old, tx)
 	} else {
 		// Nothing was replaced, bump the pending counter
 		pendingGauge.Inc(1)
 	}
 	// Set the potentially new pending nonce and notify any subsystems of the new tx
 	pool.pendingNonces.set(addr, tx.Nonce()+1)
+	pool.txPromoted(tx)
 
 	// Successful promotion, bump the heartbeat
 	pool.beats[addr] = time.Now()
@@ -892,7 +950,9 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 	// Process all the new transaction and merge any errors into the original slice
 	pool.mu.Lock()
 	newErrs, dirtyAddrs := pool.addTxsLocked(news, local)
+	changes := pool.takeLifecycle()
 	pool.mu.Unlock()
+	pool.sendLifecycle(changes)
 
 	var nilSlot = 0
 	for _, err := range newErrs {
@@ -1163,7 +1223,21 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 		highestPending := list.LastElement()
 		pool.pendingNonces.set(addr, highestPending.Nonce()+1)
 	}
+	pool.inclusions, pool.deepReset = nil, false
+	changes := pool.takeLifecycle()
+
+	var released []*types.Transaction
+	if reset != nil {
+		released = pool.releasePrivate()
+		pool.pruneBundles()
+	}
 	pool.mu.Unlock()
+	pool.sendLifecycle(changes)
+
+	if len(released) > 0 {
+		pool.releaseFeed.Send(PrivateTxsReleasedEvent{released})
+		pool.publicTxFeed.Send(NewTxsEvent{released})
+	}
 
 	// Notify subsystems for newly added transactions
 	for _, tx := range promoted {
@@ -1179,6 +1253,9 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 			txs = append(txs, set.Flatten()...)
 		}
 		pool.txFeed.Send(NewTxsEvent{txs})
+		if public := pool.publicTxs(txs); len(public) > 0 {
+			pool.publicTxFeed.Send(NewTxsEvent{public})
+		}
 	}
 }
 
@@ -1195,6 +1272,9 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 
 		if depth := uint64(math.Abs(float64(oldNum) - float64(newNum))); depth > 64 {
 			log.Debug("Skipping deep transaction reorg", "depth", depth)
+
+			// Too many blocks to track, look up the stale transactions instead
+			pool.deepReset = true
 		} else {
 			// Reorg seems shallow enough to pull in all transactions into memory
 			var discarded, included types.Transactions
@@ -1227,6 +1307,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 				}
 				for add.NumberU64() > rem.NumberU64() {
 					included = append(included, add.Transactions()...)
+					pool.trackInclusions(add)
 					if add = pool.chain.GetBlock(add.ParentHash(), add.NumberU64()-1); add == nil {
 						log.Error("Unrooted new chain seen by tx pool", "block", newHead.Number, "hash", newHead.Hash())
 						return
@@ -1239,6 +1320,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 						return
 					}
 					included = append(included, add.Transactions()...)
+					pool.trackInclusions(add)
 					if add = pool.chain.GetBlock(add.ParentHash(), add.NumberU64()-1); add == nil {
 						log.Error("Unrooted new chain seen by tx pool", "block", newHead.Number, "hash", newHead.Hash())
 						return
@@ -1247,6 +1329,11 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 				reinject = types.TxDifference(discarded, included)
 			}
 		}
+	} else if oldHead != nil && newHead != nil {
+		// Plain chain extension, the new head holds all the included transactions
+		if block := pool.chain.GetBlock(newHead.Hash(), newHead.Number.Uint64()); block != nil {
+			pool.trackInclusions(block)
+		}
 	}
 	// Initialize the internal state to the current head
 	if newHead == nil {
@@ -1260,6 +1347,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	pool.currentState = statedb
 	pool.pendingNonces = newTxNoncer(statedb)
 	pool.currentMaxGas = newHead.GasLimit
+	pool.currentNumber = newHead.Number.Uint64()
 
 	// Inject any transactions discarded due to reorgs
 	log.Debug("Reinjecting stale transactions", "count", len(reinject))
@@ -1291,6 +1379,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		for _, tx := range forwards {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.txStale(tx)
 		}
 		log.Trace("Removed old queued transactions", "count", len(forwards))
 		// Drop all transactions that are too costly (low balance or out of gas)
@@ -1298,6 +1387,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		for _, tx := range drops {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.txUnpayable(tx)
 		}
 		log.Trace("Removed unpayable queued transactions", "count", len(drops))
 		queuedNofundsMeter.Mark(int64(len(drops)))
@@ -1320,6 +1410,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 			for _, tx := range caps {
 				hash := tx.Hash()
 				pool.all.Remove(hash)
+				pool.txDropped(tx, TxDropEvicted)
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
 			}
 			queuedRateLimitMeter.Mark(int64(len(caps)))
@@ -1382,6 +1473,7 @@ func (pool *TxPool) truncatePending() {
 						// Drop the transaction from the global pools too
 						hash := tx.Hash()
 						pool.all.Remove(hash)
+						pool.txDropped(tx, TxDropEvicted)
 
 						// Update the account nonce to the dropped transaction
 						pool.pendingNonces.setIfLower(offenders[i], tx.Nonce())
@@ -1409,6 +1501,7 @@ func (pool *TxPool) truncatePending() {
 					// Drop the transaction from the global pools too
 					hash := tx.Hash()
 					pool.all.Remove(hash)
+					pool.txDropped(tx, TxDropEvicted)
 
 					// Update the account nonce to the dropped transaction
 					pool.pendingNonces.setIfLower(addr, tx.Nonce())
@@ -1455,6 +1548,7 @@ func (pool *TxPool) truncateQueue() {
 		// Drop all transactions if they are less than the overflow
 		if size := uint64(list.Len()); size <= drop {
 			for _, tx := range list.Flatten() {
+				pool.txDropped(tx, TxDropEvicted)
 				pool.removeTx(tx.Hash(), true)
 			}
 			drop -= size
@@ -1464,6 +1558,7 @@ func (pool *TxPool) truncateQueue() {
 		// Otherwise drop only last few transactions
 		txs := list.Flatten()
 		for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
+			pool.txDropped(txs[i], TxDropEvicted)
 			pool.removeTx(txs[i].Hash(), true)
 			drop--
 			queuedRateLimitMeter.Mark(1)
@@ -1488,6 +1583,7 @@ func (pool *TxPool) demoteUnexecutables() {
 		for _, tx := range olds {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.txStale(tx)
 			log.Trace("Removed old pending transaction", "hash", hash)
 		}
 		// Drop all transactions that are too costly (low balance or out of gas), and queue any invalids back for later
@@ -1496,6 +1592,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			hash := tx.Hash()
 			log.Trace("Removed unpayable pending transaction", "hash", hash)
 			pool.all.Remove(hash)
+			pool.txUnpayable(tx)
 		}
 		pendingNofundsMeter.Mark(int64(len(drops)))
 
@@ -0,0 +1,166 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/event"
+	"github.com/expanse-org/go-expanse/log"
+)
+
+// AddPrivate enqueues a single local transaction into the pool, keeping it from
+// being broadcast to the network. The transaction is available to the local
+// miner as usual. If it isn't mined within the configured private deadline, it
+// is released and broadcast like any other transaction.
+//
+// Private transactions are not journaled, so they are lost on restart.
+func (pool *TxPool) AddPrivate(tx *types.Transaction) error {
+	hash := tx.Hash()
+
+	// Mark the transaction before adding it, so it's never announced. Known ones
+	// might have been broadcast already, leave them alone.
+	pool.mu.Lock()
+	if pool.all.Get(hash) != nil {
+		pool.mu.Unlock()
+		return ErrAlreadyKnown
+	}
+	var deadline uint64
+	if pool.config.PrivateDeadline > 0 {
+		deadline = pool.currentNumber + pool.config.PrivateDeadline
+	}
+	pool.private[hash] = deadline
+	pool.mu.Unlock()
+
+	if err := pool.AddLocal(tx); err != nil {
+		pool.mu.Lock()
+		delete(pool.private, hash)
+		pool.mu.Unlock()
+		return err
+	}
+	log.Debug("Added private transaction", "hash", hash, "deadline", deadline)
+	return nil
+}
+
+// IsPrivate returns whether a transaction is kept from being broadcast to the
+// network.
+func (pool *TxPool) IsPrivate(hash common.Hash) bool {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	_, ok := pool.private[hash]
+	return ok
+}
+
+// SubscribePrivateTxsReleasedEvent registers a subscription of
+// PrivateTxsReleasedEvent and starts sending event to the given channel.
+func (pool *TxPool) SubscribePrivateTxsReleasedEvent(ch chan<- PrivateTxsReleasedEvent) event.Subscription {
+	return pool.scope.Track(pool.releaseFeed.Subscribe(ch))
+}
+
+// SubscribePublicTxsEvent registers a subscription of NewTxsEvent for clients
+// which mustn't see private transactions. Those are only sent once released.
+func (pool *TxPool) SubscribePublicTxsEvent(ch chan<- NewTxsEvent) event.Subscription {
+	return pool.scope.Track(pool.publicTxFeed.Subscribe(ch))
+}
+
+// SubscribePublicTxLifecycleEvent registers a subscription of TxLifecycleEvent
+// for clients which mustn't see private transactions. The state changes of a
+// private transaction are left out, up to its release.
+func (pool *TxPool) SubscribePublicTxLifecycleEvent(ch chan<- TxLifecycleEvent) event.Subscription {
+	return pool.scope.Track(pool.publicLifecycleFeed.Subscribe(ch))
+}
+
+// PublicContent is like Content, but leaves out the private transactions.
+func (pool *TxPool) PublicContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	pending := make(map[common.Address]types.Transactions)
+	for addr, list := range pool.pending {
+		if txs := pool.public(list.Flatten()); len(txs) > 0 {
+			pending[addr] = txs
+		}
+	}
+	queued := make(map[common.Address]types.Transactions)
+	for addr, list := range pool.queue {
+		if txs := pool.public(list.Flatten()); len(txs) > 0 {
+			queued[addr] = txs
+		}
+	}
+	return pending, queued
+}
+
+// PublicContentFrom is like ContentFrom, but leaves out the private transactions.
+func (pool *TxPool) PublicContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	var pending types.Transactions
+	if list, ok := pool.pending[addr]; ok {
+		pending = pool.public(list.Flatten())
+	}
+	var queued types.Transactions
+	if list, ok := pool.queue[addr]; ok {
+		queued = pool.public(list.Flatten())
+	}
+	return pending, queued
+}
+
+// publicTxs returns a copy of the given list without the private transactions.
+func (pool *TxPool) publicTxs(txs types.Transactions) types.Transactions {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.public(append(types.Transactions{}, txs...))
+}
+
+// public filters the private transactions out of the given list in place. The
+// pool lock must be held.
+func (pool *TxPool) public(txs types.Transactions) types.Transactions {
+	if len(pool.private) == 0 {
+		return txs
+	}
+	public := txs[:0]
+	for _, tx := range txs {
+		if _, ok := pool.private[tx.Hash()]; !ok {
+			public = append(public, tx)
+		}
+	}
+	return public
+}
+
+// releasePrivate forgets the private transactions which left the pool, and
+// releases the ones that passed their deadline, returning them for broadcast.
+// The pool lock must be held.
+func (pool *TxPool) releasePrivate() []*types.Transaction {
+	var released []*types.Transaction
+	for hash, deadline := range pool.private {
+		tx := pool.all.Get(hash)
+		switch {
+		case tx == nil:
+			delete(pool.private, hash)
+		case deadline != 0 && pool.currentNumber >= deadline:
+			delete(pool.private, hash)
+			released = append(released, tx)
+		}
+	}
+	if len(released) > 0 {
+		log.Debug("Released private transactions", "count", len(released))
+	}
+	return released
+}
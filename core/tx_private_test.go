@@ -0,0 +1,174 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/crypto"
+)
+
+// Tests that private transactions are kept from the network until they pass
+// their deadline.
+func TestTxPoolPrivate(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+	pool.config.PrivateDeadline = 2
+
+	released := make(chan PrivateTxsReleasedEvent, 1)
+	sub := pool.SubscribePrivateTxsReleasedEvent(released)
+	defer sub.Unsubscribe()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	testAddBalance(pool, from, big.NewInt(1000000000))
+
+	var (
+		private = transaction(0, 100000, key)
+		public  = transaction(1, 100000, key)
+	)
+	if err := pool.AddPrivate(private); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if err := pool.AddLocal(public); err != nil {
+		t.Fatalf("failed to add public transaction: %v", err)
+	}
+	if err := pool.AddPrivate(public); err != ErrAlreadyKnown {
+		t.Fatalf("known transaction made private: have %v, want %v", err, ErrAlreadyKnown)
+	}
+	if !pool.IsPrivate(private.Hash()) || pool.IsPrivate(public.Hash()) {
+		t.Fatalf("privacy mismatch: private %v, public %v", pool.IsPrivate(private.Hash()), pool.IsPrivate(public.Hash()))
+	}
+	// The miner must see the private transaction, but the journal mustn't
+	pending, _ := pool.Pending(false)
+	if len(pending[from]) != 2 {
+		t.Fatalf("pending transactions mismatch: have %d, want %d", len(pending[from]), 2)
+	}
+	pool.mu.RLock()
+	local := pool.local()
+	pool.mu.RUnlock()
+	if len(local[from]) != 1 || local[from][0].Hash() != public.Hash() {
+		t.Fatalf("journaled transactions mismatch: have %v", local[from])
+	}
+	// Advance the chain, releasing the transaction at the deadline
+	advance := func(number int64) {
+		head := &types.Header{Number: big.NewInt(number), GasLimit: 10000000, BaseFee: big.NewInt(1)}
+		<-pool.requestReset(nil, head)
+	}
+	advance(1)
+	select {
+	case ev := <-released:
+		t.Fatalf("transactions released before deadline: %v", ev.Txs)
+	case <-time.After(50 * time.Millisecond):
+	}
+	advance(2)
+	select {
+	case ev := <-released:
+		if len(ev.Txs) != 1 || ev.Txs[0].Hash() != private.Hash() {
+			t.Fatalf("released transactions mismatch: have %v", ev.Txs)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("private transaction not released")
+	}
+	if pool.IsPrivate(private.Hash()) {
+		t.Fatalf("released transaction still private")
+	}
+}
+
+// Tests that private transactions never reach the public views of the pool,
+// which back the pending transaction subscriptions and the txpool namespace.
+func TestTxPoolPrivatePublicView(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+	pool.config.PrivateDeadline = 2
+
+	txs := make(chan NewTxsEvent, 10)
+	sub := pool.SubscribePublicTxsEvent(txs)
+	defer sub.Unsubscribe()
+
+	changes := make(chan TxLifecycleEvent, 10)
+	lcsub := pool.SubscribePublicTxLifecycleEvent(changes)
+	defer lcsub.Unsubscribe()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	testAddBalance(pool, from, big.NewInt(1000000000))
+
+	var (
+		private = transaction(0, 100000, key)
+		public  = transaction(1, 100000, key)
+	)
+	if err := pool.AddPrivate(private); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if err := pool.AddLocal(public); err != nil {
+		t.Fatalf("failed to add public transaction: %v", err)
+	}
+	<-pool.requestPromoteExecutables(newAccountSet(pool.signer, from))
+
+	// Only the public transaction may be announced to the subscribers
+	var (
+		announced bool
+		timeout   = time.After(100 * time.Millisecond)
+	)
+	for done := false; !done; {
+		select {
+		case ev := <-txs:
+			for _, tx := range ev.Txs {
+				if tx.Hash() == private.Hash() {
+					t.Fatalf("private transaction announced")
+				}
+				announced = announced || tx.Hash() == public.Hash()
+			}
+		case ev := <-changes:
+			for _, change := range ev.Changes {
+				if change.Tx.Hash() == private.Hash() {
+					t.Fatalf("private transaction state change announced: %s", change.Status)
+				}
+			}
+		case <-timeout:
+			done = true
+		}
+	}
+	if !announced {
+		t.Fatalf("public transaction not announced")
+	}
+	pending, queued := pool.PublicContent()
+	if len(pending[from]) != 1 || pending[from][0].Hash() != public.Hash() || len(queued) != 0 {
+		t.Fatalf("public content mismatch: pending %v, queued %v", pending[from], queued)
+	}
+	if pending, _ := pool.PublicContentFrom(from); len(pending) != 1 || pending[0].Hash() != public.Hash() {
+		t.Fatalf("public content mismatch: pending %v", pending)
+	}
+	// Once released at the deadline, the transaction becomes public
+	head := &types.Header{Number: big.NewInt(2), GasLimit: 10000000, BaseFee: big.NewInt(1)}
+	<-pool.requestReset(nil, head)
+
+	select {
+	case ev := <-txs:
+		if len(ev.Txs) != 1 || ev.Txs[0].Hash() != private.Hash() {
+			t.Fatalf("released transactions mismatch: have %v", ev.Txs)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("released transaction not announced")
+	}
+}
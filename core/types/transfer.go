@@ -0,0 +1,47 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"math/big"
+
+	"github.com/expanse-org/go-expanse/common"
+)
+
+// Kinds of value transfers recorded by the transfer index.
+const (
+	TransferCall         = "call"
+	TransferCreate       = "create"
+	TransferCreate2      = "create2"
+	TransferSelfDestruct = "selfdestruct"
+)
+
+// Transfer is a value transfer or contract creation executed by a transaction,
+// either by the transaction itself or by one of the internal calls it made.
+// Transfers are derived by re-executing blocks and are not part of consensus.
+type Transfer struct {
+	BlockNumber uint64      // Block in which the transfer was executed
+	Index       uint        // Position of the transfer within the block
+	TxHash      common.Hash // Transaction executing the transfer
+	TxIndex     uint        // Position of the transaction within the block
+
+	Type  string         // Kind of the transfer (call, create, create2 or selfdestruct)
+	From  common.Address // Account sending the value or creating the contract
+	To    common.Address // Account receiving the value or the created contract
+	Value *big.Int       // Amount of wei transferred
+	Depth uint           // Call depth of the transfer, 0 for the transaction itself
+}
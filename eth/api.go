@@ -19,6 +19,7 @@ package eth
 import (
 	"compress/gzip"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -35,6 +36,7 @@ import (
 	"github.com/expanse-org/go-expanse/core/state"
 	"github.com/expanse-org/go-expanse/core/types"
 	"github.com/expanse-org/go-expanse/internal/ethapi"
+	"github.com/expanse-org/go-expanse/params"
 	"github.com/expanse-org/go-expanse/rlp"
 	"github.com/expanse-org/go-expanse/rpc"
 	"github.com/expanse-org/go-expanse/trie"
@@ -66,6 +68,120 @@ func (api *PublicEthereumAPI) Hashrate() hexutil.Uint64 {
 	return hexutil.Uint64(api.e.Miner().Hashrate())
 }
 
+const (
+	// defaultAddressHistoryLimit is the number of transfers returned by
+	// GetAddressHistory if no limit is requested.
+	defaultAddressHistoryLimit = 100
+
+	// maxAddressHistoryLimit is the maximum number of transfers returned by a
+	// single GetAddressHistory call.
+	maxAddressHistoryLimit = 1000
+)
+
+// AddressHistoryArgs represents the arguments to retrieve a page of the address
+// history. Cursor, if set, is the value returned as next by the previous page and
+// takes precedence over FromBlock.
+type AddressHistoryArgs struct {
+	FromBlock *hexutil.Uint64 `json:"fromBlock"`
+	ToBlock   *hexutil.Uint64 `json:"toBlock"`
+	Cursor    *hexutil.Bytes  `json:"cursor"`
+	Limit     *hexutil.Uint64 `json:"limit"`
+}
+
+// AddressHistory is a page of the value transfers touching an address.
+type AddressHistory struct {
+	Transfers    []*RPCTransfer  `json:"transfers"`
+	Next         *hexutil.Bytes  `json:"next"`         // Cursor of the next page, nil if there is none
+	IndexedBlock *hexutil.Uint64 `json:"indexedBlock"` // Last block covered by the index, nil if none is
+}
+
+// RPCTransfer is a value transfer or contract creation in RPC representation.
+type RPCTransfer struct {
+	BlockHash        common.Hash    `json:"blockHash"`
+	BlockNumber      hexutil.Uint64 `json:"blockNumber"`
+	TransactionHash  common.Hash    `json:"transactionHash"`
+	TransactionIndex hexutil.Uint   `json:"transactionIndex"`
+	TransferIndex    hexutil.Uint   `json:"transferIndex"`
+	Type             string         `json:"type"`
+	From             common.Address `json:"from"`
+	To               common.Address `json:"to"`
+	Value            *hexutil.Big   `json:"value"`
+	Depth            hexutil.Uint   `json:"depth"`
+}
+
+// GetAddressHistory returns a page of the value transfers and contract creations
+// touching an address, including the ones made by internal calls, in chain order.
+// It requires the transfer index to be enabled.
+func (api *PublicEthereumAPI) GetAddressHistory(address common.Address, args *AddressHistoryArgs) (*AddressHistory, error) {
+	indexer := api.e.TransferIndexer()
+	if indexer == nil {
+		return nil, errors.New("transfer index is not enabled")
+	}
+	if args == nil {
+		args = new(AddressHistoryArgs)
+	}
+	var (
+		number uint64
+		index  uint32
+		limit  = defaultAddressHistoryLimit
+	)
+	if args.FromBlock != nil {
+		number = uint64(*args.FromBlock)
+	}
+	if args.Cursor != nil {
+		if len(*args.Cursor) != 12 {
+			return nil, errors.New("invalid cursor")
+		}
+		number, index = binary.BigEndian.Uint64(*args.Cursor), binary.BigEndian.Uint32((*args.Cursor)[8:])
+	}
+	if args.Limit != nil {
+		if *args.Limit == 0 || *args.Limit > maxAddressHistoryLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxAddressHistoryLimit)
+		}
+		limit = int(*args.Limit)
+	}
+	history := &AddressHistory{Transfers: []*RPCTransfer{}}
+
+	sections, _, _ := indexer.Sections()
+	if sections == 0 {
+		return history, nil
+	}
+	last := hexutil.Uint64(sections*params.TransferIndexBlocks - 1)
+	history.IndexedBlock = &last
+
+	end := uint64(last)
+	if args.ToBlock != nil && uint64(*args.ToBlock) < end {
+		end = uint64(*args.ToBlock)
+	}
+	// Retrieve an extra transfer to know whether there is a next page
+	db := api.e.ChainDb()
+	for _, transfer := range rawdb.ReadTransfers(db, address, number, index, limit+1) {
+		if transfer.BlockNumber > end {
+			break
+		}
+		if len(history.Transfers) == limit {
+			cursor := make(hexutil.Bytes, 12)
+			binary.BigEndian.PutUint64(cursor, transfer.BlockNumber)
+			binary.BigEndian.PutUint32(cursor[8:], uint32(transfer.Index))
+			history.Next = &cursor
+			break
+		}
+		history.Transfers = append(history.Transfers, &RPCTransfer{
+			BlockHash:        rawdb.ReadCanonicalHash(db, transfer.BlockNumber),
+			BlockNumber:      hexutil.Uint64(transfer.BlockNumber),
+			TransactionHash:  transfer.TxHash,
+			TransactionIndex: hexutil.Uint(transfer.TxIndex),
+			TransferIndex:    hexutil.Uint(transfer.Index),
+			Type:             transfer.Type,
+			From:             transfer.From,
+			To:               transfer.To,
+			Value:            (*hexutil.Big)(transfer.Value),
+			Depth:            hexutil.Uint(transfer.Depth),
+		})
+	}
+	return history, nil
+}
+
 // PublicMinerAPI provides an API to control the miner.
 // It offers only methods that operate on data that pose no security risk when it is publicly accessible.
 type PublicMinerAPI struct {
@@ -146,6 +262,25 @@ func (api *PrivateMinerAPI) SetRecommitInterval(interval int) {
 	api.e.Miner().SetRecommitInterval(time.Duration(interval) * time.Millisecond)
 }
 
+// PrivateTxPoolPolicyAPI offers an API to inspect the admission policies of the
+// transaction pool. The rejections reveal the senders and rules of the node, so
+// it is only exposed over the private endpoints.
+type PrivateTxPoolPolicyAPI struct {
+	e *Ethereum
+}
+
+// NewPrivateTxPoolPolicyAPI creates a new RPC service reporting the transaction
+// pool admission policies.
+func NewPrivateTxPoolPolicyAPI(e *Ethereum) *PrivateTxPoolPolicyAPI {
+	return &PrivateTxPoolPolicyAPI{e}
+}
+
+// Policy returns the active admission policies along with the transactions they
+// rejected and why.
+func (api *PrivateTxPoolPolicyAPI) Policy() *core.TxPolicyStatus {
+	return api.e.TxPool().PolicyStatus()
+}
+
 // PrivateAdminAPI is the collection of Ethereum full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
@@ -256,6 +391,27 @@ func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// OverrideReorgGuard authorizes the side chain containing the given block to
+// reorg the local chain beyond the maximum reorg depth and the Pirl Guard.
+func (api *PrivateAdminAPI) OverrideReorgGuard(hash common.Hash) bool {
+	api.eth.BlockChain().OverrideReorgGuard(hash)
+	return true
+}
+
+// RejectedReorgs retrieves the side chains refused by the maximum reorg depth
+// policy, along with the peers they were received from.
+func (api *PrivateAdminAPI) RejectedReorgs() []*rawdb.RejectedReorg {
+	return api.eth.BlockChain().RejectedReorgs()
+}
+
+// ForkSchedule retrieves the activation block, fork identifier and enabled EIPs
+// of every fork of the chain configuration, along with whether it is active at
+// the chain head.
+func (api *PrivateAdminAPI) ForkSchedule() *ethapi.ForkSchedule {
+	chain := api.eth.BlockChain()
+	return ethapi.NewForkSchedule(chain.Config(), chain.Genesis().Hash(), chain.CurrentHeader().Number.Uint64())
+}
+
 // PublicDebugAPI is the collection of Ethereum full node APIs exposed
 // over the public debugging endpoint.
 type PublicDebugAPI struct {
@@ -297,6 +453,12 @@ func (api *PublicDebugAPI) DumpBlock(blockNr rpc.BlockNumber) (state.Dump, error
 	return stateDb.RawDump(opts), nil
 }
 
+// PirlGuardStatus retrieves the configuration and runtime statistics of the
+// Pirl Guard side chain penalty checks.
+func (api *PublicDebugAPI) PirlGuardStatus() core.PirlGuardStatus {
+	return api.eth.blockchain.PirlGuardStatus()
+}
+
 // PrivateDebugAPI is the collection of Ethereum full node APIs exposed over
 // the private debugging endpoint.
 type PrivateDebugAPI struct {
@@ -1716,9 +1716,15 @@ func (d *Downloader) importBlockResults(results []*fetchResult) error {
 		"firstnum", first.Number, "firsthash", first.Hash(),
 		"lastnum", last.Number, "lasthash", last.Hash(),
 	)
+	// Tag the blocks with the master peer, which the chain was chosen from
+	d.cancelLock.RLock()
+	origin := d.cancelPeer
+	d.cancelLock.RUnlock()
+
 	blocks := make([]*types.Block, len(results))
 	for i, result := range results {
 		blocks[i] = types.NewBlockWithHeader(result.Header).WithBody(result.Transactions, result.Uncles)
+		blocks[i].ReceivedFrom = origin
 	}
 	if index, err := d.blockchain.InsertChain(blocks); err != nil {
 		if index < len(results) {
@@ -137,6 +137,9 @@ type Config struct {
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
+	ReorgMaxDepth uint64 `toml:",omitempty"` // The maximum number of blocks below head a reorg may reach (0 = unlimited).
+	TransferIndex bool   `toml:",omitempty"` // Whether to index the internal value transfers of the canonical chain.
+	HistoryRetain uint64 `toml:",omitempty"` // The number of blocks from head whose bodies and receipts are kept (0 = entire chain).
 
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
@@ -208,7 +211,7 @@ type Config struct {
 }
 
 // CreateConsensusEngine creates a consensus engine for the given chain configuration.
-func CreateConsensusEngine(stack *node.Node, chainConfig *params.ChainConfig, config *ethash.Config, notify []string, noverify bool, db ethdb.Database) consensus.Engine {
+func CreateConsensusEngine(stack *node.Node, chainConfig *params.ChainConfig, config *ethash.Config, notify []string, noverify bool, stratum frkhash.StratumConfig, db ethdb.Database) consensus.Engine {
 	// If proof-of-authority is requested, set it up
 	if chainConfig.Clique != nil {
 		return clique.New(chainConfig.Clique, db)
@@ -252,6 +255,8 @@ func CreateConsensusEngine(stack *node.Node, chainConfig *params.ChainConfig, co
 	engine := frkhash.New(frkhash.Config{
 		PowMode:    config.PowMode,
 		NotifyFull: config.NotifyFull,
+		Schedule:   chainConfig.Frkhash,
+		Stratum:    stratum,
 	}, notify, noverify)
 	engine.SetThreads(-1) // Disable CPU mining
 
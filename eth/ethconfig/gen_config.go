@@ -26,6 +26,9 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		NoPruning               bool
 		NoPrefetch              bool
 		TxLookupLimit           uint64                 `toml:",omitempty"`
+		ReorgMaxDepth           uint64                 `toml:",omitempty"`
+		TransferIndex           bool                   `toml:",omitempty"`
+		HistoryRetain           uint64                 `toml:",omitempty"`
 		Whitelist               map[uint64]common.Hash `toml:"-"`
 		LightServ               int                    `toml:",omitempty"`
 		LightIngress            int                    `toml:",omitempty"`
@@ -69,6 +72,9 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.NoPruning = c.NoPruning
 	enc.NoPrefetch = c.NoPrefetch
 	enc.TxLookupLimit = c.TxLookupLimit
+	enc.ReorgMaxDepth = c.ReorgMaxDepth
+	enc.TransferIndex = c.TransferIndex
+	enc.HistoryRetain = c.HistoryRetain
 	enc.Whitelist = c.Whitelist
 	enc.LightServ = c.LightServ
 	enc.LightIngress = c.LightIngress
@@ -116,6 +122,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		NoPruning               *bool
 		NoPrefetch              *bool
 		TxLookupLimit           *uint64                `toml:",omitempty"`
+		ReorgMaxDepth           *uint64                `toml:",omitempty"`
+		TransferIndex           *bool                  `toml:",omitempty"`
+		HistoryRetain           *uint64                `toml:",omitempty"`
 		Whitelist               map[uint64]common.Hash `toml:"-"`
 		LightServ               *int                   `toml:",omitempty"`
 		LightIngress            *int                   `toml:",omitempty"`
@@ -178,6 +187,15 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.TxLookupLimit != nil {
 		c.TxLookupLimit = *dec.TxLookupLimit
 	}
+	if dec.ReorgMaxDepth != nil {
+		c.ReorgMaxDepth = *dec.ReorgMaxDepth
+	}
+	if dec.TransferIndex != nil {
+		c.TransferIndex = *dec.TransferIndex
+	}
+	if dec.HistoryRetain != nil {
+		c.HistoryRetain = *dec.HistoryRetain
+	}
 	if dec.Whitelist != nil {
 		c.Whitelist = dec.Whitelist
 	}
@@ -71,6 +71,13 @@ type txPool interface {
 	// SubscribeNewTxsEvent should return an event subscription of
 	// NewTxsEvent and send events to the given channel.
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
+
+	// IsPrivate returns whether a transaction should be kept from the network.
+	IsPrivate(hash common.Hash) bool
+
+	// SubscribePrivateTxsReleasedEvent should return an event subscription of
+	// PrivateTxsReleasedEvent and send events to the given channel.
+	SubscribePrivateTxsReleasedEvent(chan<- core.PrivateTxsReleasedEvent) event.Subscription
 }
 
 // handlerConfig is the collection of initialization parameters to create a full
@@ -112,6 +119,8 @@ type handler struct {
 	eventMux      *event.TypeMux
 	txsCh         chan core.NewTxsEvent
 	txsSub        event.Subscription
+	releaseCh     chan core.PrivateTxsReleasedEvent
+	releaseSub    event.Subscription
 	minedBlockSub *event.TypeMuxSubscription
 
 	whitelist map[uint64]common.Hash
@@ -400,6 +409,8 @@ func (h *handler) Start(maxPeers int) {
 	h.wg.Add(1)
 	h.txsCh = make(chan core.NewTxsEvent, txChanSize)
 	h.txsSub = h.txpool.SubscribeNewTxsEvent(h.txsCh)
+	h.releaseCh = make(chan core.PrivateTxsReleasedEvent, txChanSize)
+	h.releaseSub = h.txpool.SubscribePrivateTxsReleasedEvent(h.releaseCh)
 	go h.txBroadcastLoop()
 
 	// broadcast mined blocks
@@ -414,6 +425,7 @@ func (h *handler) Start(maxPeers int) {
 }
 
 func (h *handler) Stop() {
+	h.releaseSub.Unsubscribe()
 	h.txsSub.Unsubscribe()        // quits txBroadcastLoop
 	h.minedBlockSub.Unsubscribe() // quits blockBroadcastLoop
 
@@ -482,6 +494,10 @@ func (h *handler) BroadcastTransactions(txs types.Transactions) {
 	)
 	// Broadcast transactions to a batch of peers not knowing about it
 	for _, tx := range txs {
+		// Private transactions are only for the local miner, don't leak them
+		if h.txpool.IsPrivate(tx.Hash()) {
+			continue
+		}
 		peers := h.peers.peersWithoutTransaction(tx.Hash())
 		// Send the tx unconditionally to a subset of our peers
 		numDirect := int(math.Sqrt(float64(len(peers))))
@@ -527,6 +543,8 @@ func (h *handler) txBroadcastLoop() {
 		select {
 		case event := <-h.txsCh:
 			h.BroadcastTransactions(event.Txs)
+		case event := <-h.releaseCh:
+			h.BroadcastTransactions(event.Txs)
 		case <-h.txsSub.Err():
 			return
 		}
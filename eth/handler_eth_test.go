@@ -450,6 +450,89 @@ func testTransactionPropagation(t *testing.T, protocol uint) {
 	}
 }
 
+// Tests that private transactions are not propagated to peers until they are
+// released by the pool.
+func TestPrivateTxPropagation65(t *testing.T) { testPrivateTxPropagation(t, eth.ETH65) }
+func TestPrivateTxPropagation66(t *testing.T) { testPrivateTxPropagation(t, eth.ETH66) }
+
+func testPrivateTxPropagation(t *testing.T, protocol uint) {
+	t.Parallel()
+
+	// Create a source handler to send transactions from and a number of sinks
+	// to receive them, both via broadcasts and announcements
+	source := newTestHandler()
+	defer source.close()
+
+	sinks := make([]*testHandler, 4)
+	for i := 0; i < len(sinks); i++ {
+		sinks[i] = newTestHandler()
+		defer sinks[i].close()
+
+		sinks[i].handler.acceptTxs = 1 // mark synced to accept transactions
+	}
+	for i, sink := range sinks {
+		sink := sink // Closure for gorotuine below
+
+		sourcePipe, sinkPipe := p2p.MsgPipe()
+		defer sourcePipe.Close()
+		defer sinkPipe.Close()
+
+		sourcePeer := eth.NewPeer(protocol, p2p.NewPeerPipe(enode.ID{byte(i)}, "", nil, sourcePipe), sourcePipe, source.txpool)
+		sinkPeer := eth.NewPeer(protocol, p2p.NewPeerPipe(enode.ID{0}, "", nil, sinkPipe), sinkPipe, sink.txpool)
+		defer sourcePeer.Close()
+		defer sinkPeer.Close()
+
+		go source.handler.runEthPeer(sourcePeer, func(peer *eth.Peer) error {
+			return eth.Handle((*ethHandler)(source.handler), peer)
+		})
+		go sink.handler.runEthPeer(sinkPeer, func(peer *eth.Peer) error {
+			return eth.Handle((*ethHandler)(sink.handler), peer)
+		})
+	}
+	txChs := make([]chan core.NewTxsEvent, len(sinks))
+	for i := 0; i < len(sinks); i++ {
+		txChs[i] = make(chan core.NewTxsEvent, 1024)
+
+		sub := sinks[i].txpool.SubscribeNewTxsEvent(txChs[i])
+		defer sub.Unsubscribe()
+	}
+	// Add a batch of private transactions, followed by public ones
+	txs := make([]*types.Transaction, 16)
+	for nonce := range txs {
+		tx := types.NewTransaction(uint64(nonce), common.Address{}, big.NewInt(0), 100000, big.NewInt(0), nil)
+		tx, _ = types.SignTx(tx, types.HomesteadSigner{}, testKey)
+
+		txs[nonce] = tx
+	}
+	source.txpool.AddPrivate(txs[:8])
+	source.txpool.AddRemotes(txs[8:])
+
+	// Only the public transactions should arrive at the sinks, then the private
+	// ones after their release
+	waitTxs := func(i int, want []*types.Transaction) {
+		for arrived := 0; arrived < len(want); {
+			select {
+			case event := <-txChs[i]:
+				for _, tx := range event.Txs {
+					if source.txpool.IsPrivate(tx.Hash()) {
+						t.Errorf("sink %d: private transaction %x leaked", i, tx.Hash())
+					}
+				}
+				arrived += len(event.Txs)
+			case <-time.NewTimer(time.Second).C:
+				t.Fatalf("sink %d: transaction propagation timed out: have %d, want %d", i, arrived, len(want))
+			}
+		}
+	}
+	for i := range sinks {
+		waitTxs(i, txs[8:])
+	}
+	source.txpool.Release()
+	for i := range sinks {
+		waitTxs(i, txs[:8])
+	}
+}
+
 // Tests that post eth protocol handshake, clients perform a mutual checkpoint
 // challenge to validate each other's chains. Hash mismatches, or missing ones
 // during a fast sync should lead to the peer getting dropped.
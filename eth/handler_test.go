@@ -46,16 +46,19 @@ var (
 // Its goal is to get around setting up a valid statedb for the balance and nonce
 // checks.
 type testTxPool struct {
-	pool map[common.Hash]*types.Transaction // Hash map of collected transactions
+	pool    map[common.Hash]*types.Transaction // Hash map of collected transactions
+	private map[common.Hash]bool               // Hashes of the private transactions
 
-	txFeed event.Feed   // Notification feed to allow waiting for inclusion
-	lock   sync.RWMutex // Protects the transaction pool
+	txFeed      event.Feed   // Notification feed to allow waiting for inclusion
+	releaseFeed event.Feed   // Notification feed of released private transactions
+	lock        sync.RWMutex // Protects the transaction pool
 }
 
 // newTestTxPool creates a mock transaction pool.
 func newTestTxPool() *testTxPool {
 	return &testTxPool{
-		pool: make(map[common.Hash]*types.Transaction),
+		pool:    make(map[common.Hash]*types.Transaction),
+		private: make(map[common.Hash]bool),
 	}
 }
 
@@ -90,6 +93,40 @@ func (p *testTxPool) AddRemotes(txs []*types.Transaction) []error {
 	return make([]error, len(txs))
 }
 
+// AddPrivate appends a batch of private transactions to the pool, and notifies
+// any listeners if the addition channel is non nil.
+func (p *testTxPool) AddPrivate(txs []*types.Transaction) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, tx := range txs {
+		p.pool[tx.Hash()] = tx
+		p.private[tx.Hash()] = true
+	}
+	p.txFeed.Send(core.NewTxsEvent{Txs: txs})
+}
+
+// Release makes all private transactions public and notifies any listeners.
+func (p *testTxPool) Release() {
+	p.lock.Lock()
+	var txs []*types.Transaction
+	for hash := range p.private {
+		txs = append(txs, p.pool[hash])
+	}
+	p.private = make(map[common.Hash]bool)
+	p.lock.Unlock()
+
+	p.releaseFeed.Send(core.PrivateTxsReleasedEvent{Txs: txs})
+}
+
+// IsPrivate returns whether a transaction is kept from the network.
+func (p *testTxPool) IsPrivate(hash common.Hash) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.private[hash]
+}
+
 // Pending returns all the transactions known to the pool
 func (p *testTxPool) Pending(enforceTips bool) (map[common.Address]types.Transactions, error) {
 	p.lock.RLock()
@@ -112,6 +149,12 @@ func (p *testTxPool) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subs
 	return p.txFeed.Subscribe(ch)
 }
 
+// SubscribePrivateTxsReleasedEvent should return an event subscription of
+// PrivateTxsReleasedEvent and send events to the given channel.
+func (p *testTxPool) SubscribePrivateTxsReleasedEvent(ch chan<- core.PrivateTxsReleasedEvent) event.Subscription {
+	return p.releaseFeed.Subscribe(ch)
+}
+
 // testHandler is a live implementation of the Ethereum protocol handler, just
 // preinitialized with some sane testing defaults and the transaction pool mocked
 // out.
@@ -17,6 +17,7 @@
 package eth
 
 import (
+	"bytes"
 	"math"
 	"math/big"
 	"math/rand"
@@ -389,6 +390,35 @@ func testGetBlockBodies(t *testing.T, protocol uint) {
 	}
 }
 
+// Tests that block bodies and receipts are only served up to the first block
+// below the history tail, so the response stays a prefix of the request.
+func TestGetPrunedHistory(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(16)
+	defer backend.close()
+
+	rawdb.WriteHistoryTail(backend.db, 8)
+
+	var (
+		fresh  = backend.chain.GetBlockByNumber(10)
+		pruned = backend.chain.GetBlockByNumber(4)
+		later  = backend.chain.GetBlockByNumber(12)
+		query  = []common.Hash{fresh.Hash(), pruned.Hash(), later.Hash()}
+	)
+	bodies := answerGetBlockBodiesQuery(backend, query, nil)
+	if len(bodies) != 1 {
+		t.Fatalf("bodies count mismatch: have %d, want %d", len(bodies), 1)
+	}
+	if want := backend.chain.GetBodyRLP(fresh.Hash()); !bytes.Equal(bodies[0], want) {
+		t.Errorf("body mismatch: have %x, want %x", bodies[0], want)
+	}
+	receipts := answerGetReceiptsQuery(backend, query, nil)
+	if len(receipts) != 1 {
+		t.Fatalf("receipts count mismatch: have %d, want %d", len(receipts), 1)
+	}
+}
+
 // Tests that the state trie nodes can be retrieved based on hashes.
 func TestGetNodeData65(t *testing.T) { testGetNodeData(t, ETH65) }
 func TestGetNodeData66(t *testing.T) { testGetNodeData(t, ETH66) }
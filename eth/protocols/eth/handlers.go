@@ -21,6 +21,7 @@ import (
 	"fmt"
 
 	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core"
 	"github.com/expanse-org/go-expanse/core/types"
 	"github.com/expanse-org/go-expanse/log"
 	"github.com/expanse-org/go-expanse/rlp"
@@ -160,12 +161,18 @@ func answerGetBlockBodiesQuery(backend Backend, query GetBlockBodiesPacket, peer
 	var (
 		bytes  int
 		bodies []rlp.RawValue
+		tail   = backend.Chain().HistoryTail()
 	)
 	for lookups, hash := range query {
 		if bytes >= softResponseLimit || len(bodies) >= maxBodiesServe ||
 			lookups >= 2*maxBodiesServe {
 			break
 		}
+		// Stop at the first pruned block, the response must stay a prefix
+		// of the request for the remote side to match it up
+		if isHistoryPruned(backend.Chain(), tail, hash) {
+			break
+		}
 		if data := backend.Chain().GetBodyRLP(hash); len(data) != 0 {
 			bodies = append(bodies, data)
 			bytes += len(data)
@@ -174,6 +181,17 @@ func answerGetBlockBodiesQuery(backend Backend, query GetBlockBodiesPacket, peer
 	return bodies
 }
 
+// isHistoryPruned reports whether the body and receipts of the block with the
+// given hash are below the history tail. Remnants of pruned history may still
+// be on disk, but they are not served to keep responses consistent.
+func isHistoryPruned(chain *core.BlockChain, tail uint64, hash common.Hash) bool {
+	if tail == 0 {
+		return false
+	}
+	header := chain.GetHeaderByHash(hash)
+	return header != nil && header.Number.Uint64() < tail
+}
+
 func handleGetNodeData(backend Backend, msg Decoder, peer *Peer) error {
 	// Decode the trie node data retrieval message
 	var query GetNodeDataPacket
@@ -248,12 +266,18 @@ func answerGetReceiptsQuery(backend Backend, query GetReceiptsPacket, peer *Peer
 	var (
 		bytes    int
 		receipts []rlp.RawValue
+		tail     = backend.Chain().HistoryTail()
 	)
 	for lookups, hash := range query {
 		if bytes >= softResponseLimit || len(receipts) >= maxReceiptsServe ||
 			lookups >= 2*maxReceiptsServe {
 			break
 		}
+		// Stop at the first pruned block, the response must stay a prefix
+		// of the request for the remote side to match it up
+		if isHistoryPruned(backend.Chain(), tail, hash) {
+			break
+		}
 		// Retrieve the requested block's receipts
 		results := backend.Chain().GetReceiptsByHash(hash)
 		if results == nil {
@@ -440,9 +464,9 @@ func answerGetPooledTransactions(backend Backend, query GetPooledTransactionsPac
 		if bytes >= softResponseLimit {
 			break
 		}
-		// Retrieve the requested transaction, skipping if unknown to us
+		// Retrieve the requested transaction, skipping if unknown to us or private
 		tx := backend.TxPool().Get(hash)
-		if tx == nil {
+		if tx == nil || backend.TxPool().IsPrivate(hash) {
 			continue
 		}
 		// If known, encode and queue for response packet
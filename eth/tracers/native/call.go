@@ -0,0 +1,276 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/common/hexutil"
+	"github.com/expanse-org/go-expanse/core/vm"
+)
+
+func init() {
+	register("callTracer", newCallTracer)
+}
+
+// callFrame is a single call of the call tree. Its fields are ordered and
+// encoded the same way as the ones of the JavaScript call tracer.
+type callFrame struct {
+	Type    string       `json:"type"`
+	From    string       `json:"from"`
+	To      string       `json:"to,omitempty"`
+	Value   string       `json:"value,omitempty"`
+	Gas     string       `json:"gas,omitempty"`
+	GasUsed string       `json:"gasUsed,omitempty"`
+	Input   string       `json:"input,omitempty"`
+	Output  string       `json:"output,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Time    string       `json:"time,omitempty"`
+	Calls   []*callFrame `json:"calls,omitempty"`
+
+	gasIn   uint64 // Gas available before the call opcode
+	gasCost uint64 // Cost of the call opcode, including the gas passed along
+	gasLeft uint64 // Gas available in the callee on entry
+	hasGas  bool   // Whether the callee executed any code (i.e. gasLeft is known)
+	outOff  int64  // Memory offset of the call output
+	outLen  int64  // Memory size of the call output
+}
+
+// callTracer is the native counterpart of the JavaScript call tracer, reporting
+// the tree of calls made during the execution of a transaction.
+type callTracer struct {
+	precompiles []common.Address
+	callstack   []*callFrame // Calls currently in flight, the first being the transaction itself
+	descended   bool         // Whether the last opcode entered a new call frame
+
+	typ     string
+	from    common.Address
+	to      common.Address
+	input   []byte
+	gas     uint64
+	value   *big.Int
+	output  []byte
+	gasUsed uint64
+	time    time.Duration
+	err     error
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newCallTracer creates a native call tracer. It takes no configuration.
+func newCallTracer(config json.RawMessage) (Tracer, error) {
+	return &callTracer{callstack: []*callFrame{{}}}, nil
+}
+
+// CaptureStart implements the vm.Tracer interface to initialize the tracing operation.
+func (t *callTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.typ = "CALL"
+	if create {
+		t.typ = "CREATE"
+	}
+	t.from, t.to = from, to
+	t.input = common.CopyBytes(input)
+	t.gas = gas
+	t.value = value
+	t.precompiles = activePrecompiles(env)
+}
+
+// CaptureState implements the vm.Tracer interface to trace a single step of VM execution.
+func (t *callTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return
+	}
+	if err != nil {
+		t.fault(err)
+		return
+	}
+	var (
+		stack  = scope.Stack
+		memory = scope.Memory
+		caller = scope.Contract.Address()
+	)
+	switch op {
+	case vm.CREATE, vm.CREATE2:
+		t.callstack = append(t.callstack, &callFrame{
+			Type:    op.String(),
+			From:    addressToHex(caller),
+			Input:   hexutil.Encode(memorySlice(memory, peekInt(stack, 1), peekInt(stack, 2))),
+			Value:   bigToHex(stack.Back(0).ToBig()),
+			gasIn:   gas,
+			gasCost: cost,
+		})
+		t.descended = true
+		return
+
+	case vm.SELFDESTRUCT:
+		top := t.callstack[len(t.callstack)-1]
+		top.Calls = append(top.Calls, &callFrame{
+			Type:  op.String(),
+			From:  addressToHex(caller),
+			To:    addressToHex(peekAddress(stack, 0)),
+			Value: bigToHex(env.StateDB.GetBalance(caller)),
+		})
+		return
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		to := peekAddress(stack, 1)
+		if isPrecompiled(t.precompiles, to) {
+			return
+		}
+		off := 1
+		if op == vm.DELEGATECALL || op == vm.STATICCALL {
+			off = 0
+		}
+		call := &callFrame{
+			Type:    op.String(),
+			From:    addressToHex(caller),
+			To:      addressToHex(to),
+			Input:   hexutil.Encode(memorySlice(memory, peekInt(stack, 2+off), peekInt(stack, 3+off))),
+			gasIn:   gas,
+			gasCost: cost,
+			outOff:  peekInt(stack, 4+off),
+			outLen:  peekInt(stack, 5+off),
+		}
+		if off == 1 {
+			call.Value = bigToHex(stack.Back(2).ToBig())
+		}
+		t.callstack = append(t.callstack, call)
+		t.descended = true
+		return
+	}
+	// If we've just descended into an inner call, retrieve its true allowance
+	if t.descended {
+		if depth >= len(t.callstack) {
+			top := t.callstack[len(t.callstack)-1]
+			top.gasLeft, top.hasGas = gas, true
+		}
+		t.descended = false
+	}
+	// If an existing call is returning, pop off the call stack
+	if op == vm.REVERT {
+		t.callstack[len(t.callstack)-1].Error = "execution reverted"
+		return
+	}
+	if depth != len(t.callstack)-1 {
+		return
+	}
+	call := t.callstack[len(t.callstack)-1]
+	t.callstack = t.callstack[:len(t.callstack)-1]
+
+	ret := stack.Back(0)
+	if call.Type == "CREATE" || call.Type == "CREATE2" {
+		call.GasUsed = bigToHex(big.NewInt(int64(call.gasIn) - int64(call.gasCost) - int64(gas)))
+		if !ret.IsZero() {
+			addr := common.Address(ret.Bytes20())
+			call.To = addressToHex(addr)
+			call.Output = hexutil.Encode(env.StateDB.GetCode(addr))
+		} else if call.Error == "" {
+			call.Error = "internal failure"
+		}
+	} else {
+		if call.hasGas {
+			call.GasUsed = bigToHex(big.NewInt(int64(call.gasIn) - int64(call.gasCost) + int64(call.gasLeft) - int64(gas)))
+		}
+		if !ret.IsZero() {
+			call.Output = hexutil.Encode(memorySlice(memory, call.outOff, call.outLen))
+		} else if call.Error == "" {
+			call.Error = "internal failure"
+		}
+	}
+	if call.hasGas {
+		call.Gas = bigToHex(new(big.Int).SetUint64(call.gasLeft))
+	}
+	top := t.callstack[len(t.callstack)-1]
+	top.Calls = append(top.Calls, call)
+}
+
+// CaptureFault implements the vm.Tracer interface to trace an execution fault.
+func (t *callTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return
+	}
+	t.fault(err)
+}
+
+// fault closes the innermost call with the given error, unless it already
+// failed with a revert.
+func (t *callTracer) fault(err error) {
+	if t.callstack[len(t.callstack)-1].Error != "" {
+		return
+	}
+	call := t.callstack[len(t.callstack)-1]
+	t.callstack = t.callstack[:len(t.callstack)-1]
+
+	call.Error = err.Error()
+	if call.hasGas {
+		call.Gas = bigToHex(new(big.Int).SetUint64(call.gasLeft))
+		call.GasUsed = call.Gas
+	}
+	if len(t.callstack) > 0 {
+		top := t.callstack[len(t.callstack)-1]
+		top.Calls = append(top.Calls, call)
+		return
+	}
+	t.callstack = append(t.callstack, call)
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *callTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	t.output = common.CopyBytes(output)
+	t.gasUsed = gasUsed
+	t.time = d
+	t.err = err
+}
+
+// GetResult returns the call tree of the traced transaction.
+func (t *callTracer) GetResult() (json.RawMessage, error) {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return nil, t.reason
+	}
+	result := &callFrame{
+		Type:    t.typ,
+		From:    addressToHex(t.from),
+		To:      addressToHex(t.to),
+		Value:   bigToHex(t.value),
+		Gas:     bigToHex(new(big.Int).SetUint64(t.gas)),
+		GasUsed: bigToHex(new(big.Int).SetUint64(t.gasUsed)),
+		Input:   hexutil.Encode(t.input),
+		Output:  hexutil.Encode(t.output),
+		Time:    t.time.String(),
+		Calls:   t.callstack[0].Calls,
+	}
+	if t.callstack[0].Error != "" {
+		result.Error = t.callstack[0].Error
+	} else if t.err != nil {
+		result.Error = t.err.Error()
+	}
+	if result.Error != "" && (result.Error != "execution reverted" || result.Output == "0x") {
+		result.Output = ""
+	}
+	return json.Marshal(result)
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *callTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
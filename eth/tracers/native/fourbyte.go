@@ -0,0 +1,118 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import (
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/common/hexutil"
+	"github.com/expanse-org/go-expanse/core/vm"
+)
+
+func init() {
+	register("4byteTracer", newFourByteTracer)
+}
+
+// fourByteTracer is the native counterpart of the JavaScript 4byte tracer,
+// collecting the 4 byte method identifiers of all the calls made during the
+// execution of a transaction, along with the size of the supplied call data.
+//
+// The result is a map from "<id>-<size>" keys to the number of occurrences:
+//
+//	{
+//	  "0x27dc297e-128": 1,
+//	  "0x38cc4831-0": 2,
+//	}
+type fourByteTracer struct {
+	precompiles []common.Address
+	ids         map[string]int
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newFourByteTracer creates a native 4byte tracer. It takes no configuration.
+func newFourByteTracer(config json.RawMessage) (Tracer, error) {
+	return &fourByteTracer{ids: make(map[string]int)}, nil
+}
+
+// store records an occurrence of a method identifier with the given call data size.
+func (t *fourByteTracer) store(id []byte, size int64) {
+	t.ids[hexutil.Encode(id)+"-"+strconv.FormatInt(size, 10)]++
+}
+
+// CaptureStart implements the vm.Tracer interface to initialize the tracing operation.
+func (t *fourByteTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.precompiles = activePrecompiles(env)
+
+	if len(input) >= 4 {
+		t.store(input[:4], int64(len(input)-4))
+	}
+}
+
+// CaptureState implements the vm.Tracer interface to trace a single step of VM execution.
+func (t *fourByteTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return
+	}
+	// Skip anything that's not a call into a contract
+	var pos int
+	switch op {
+	case vm.CALL, vm.CALLCODE:
+		pos = 3
+	case vm.DELEGATECALL, vm.STATICCALL:
+		pos = 2
+	default:
+		return
+	}
+	stack := scope.Stack
+	if isPrecompiled(t.precompiles, peekAddress(stack, 1)) {
+		return
+	}
+	if size := peekInt(stack, pos+1); size >= 4 {
+		if id := memorySlice(scope.Memory, peekInt(stack, pos), 4); id != nil {
+			t.store(id, size-4)
+		}
+	}
+}
+
+// CaptureFault implements the vm.Tracer interface to trace an execution fault.
+func (t *fourByteTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *fourByteTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+}
+
+// GetResult returns the collected method identifiers.
+func (t *fourByteTracer) GetResult() (json.RawMessage, error) {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return nil, t.reason
+	}
+	return json.Marshal(t.ids)
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *fourByteTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
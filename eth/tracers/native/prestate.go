@@ -0,0 +1,305 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/common/hexutil"
+	"github.com/expanse-org/go-expanse/core"
+	"github.com/expanse-org/go-expanse/core/vm"
+	"github.com/expanse-org/go-expanse/crypto"
+)
+
+func init() {
+	register("prestateTracer", newPrestateTracer)
+}
+
+// prestateConfig is the configuration of the prestate tracer.
+type prestateConfig struct {
+	DiffMode bool `json:"diffMode"` // Report the modified state before and after the transaction
+}
+
+// account is the state of an account as seen by the prestate tracer.
+type account struct {
+	balance *big.Int
+	nonce   uint64
+	code    []byte
+	storage map[common.Hash]common.Hash
+}
+
+// empty returns whether the account did not exist before the transaction.
+func (a *account) empty() bool {
+	if a.balance.Sign() != 0 || a.nonce != 0 || len(a.code) != 0 {
+		return false
+	}
+	for _, val := range a.storage {
+		if val != (common.Hash{}) {
+			return false
+		}
+	}
+	return true
+}
+
+// prestateAccount is the encoding of an account in the default mode, matching
+// the output of the JavaScript prestate tracer.
+type prestateAccount struct {
+	Balance string                      `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// diffAccount is the encoding of an account in diff mode, where only the
+// modified fields are reported.
+type diffAccount struct {
+	Balance *hexutil.Big                `json:"balance,omitempty"`
+	Nonce   uint64                      `json:"nonce,omitempty"`
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// prestateDiff is the result of the prestate tracer in diff mode.
+type prestateDiff struct {
+	Pre  map[common.Address]*diffAccount `json:"pre"`
+	Post map[common.Address]*diffAccount `json:"post"`
+}
+
+// prestateTracer is the native counterpart of the JavaScript prestate tracer,
+// reporting the state of all the accounts touched by a transaction prior to its
+// execution. In diff mode, it reports the modified state before and after the
+// execution instead.
+type prestateTracer struct {
+	config   prestateConfig
+	env      *vm.EVM
+	prestate map[common.Address]*account
+	create   bool
+	to       common.Address
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newPrestateTracer creates a native prestate tracer, optionally configured
+// to run in diff mode.
+func newPrestateTracer(config json.RawMessage) (Tracer, error) {
+	t := &prestateTracer{prestate: make(map[common.Address]*account)}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &t.config); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// CaptureStart implements the vm.Tracer interface to initialize the tracing operation.
+func (t *prestateTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.env = env
+	t.create = create
+	t.to = to
+
+	// The sender already paid for the gas and the value, while the recipient
+	// already received the value, revert these to get the state before the
+	// transaction.
+	t.lookupAccount(from)
+	t.lookupAccount(to)
+	if t.config.DiffMode {
+		t.lookupAccount(env.Context.Coinbase)
+	}
+	intrinsicGas, err := core.IntrinsicGas(input, nil, create, env.ChainConfig().IsHomestead(env.Context.BlockNumber), env.ChainConfig().IsIstanbul(env.Context.BlockNumber))
+	if err != nil {
+		return
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(gas+intrinsicGas), env.TxContext.GasPrice)
+
+	t.prestate[to].balance = new(big.Int).Sub(t.prestate[to].balance, value)
+	t.prestate[from].balance = new(big.Int).Add(t.prestate[from].balance, new(big.Int).Add(value, fee))
+	t.prestate[from].nonce--
+
+	// A freshly deployed contract had no state prior to the transaction
+	if create {
+		t.prestate[to].nonce = 0
+		t.prestate[to].code = nil
+	}
+}
+
+// CaptureState implements the vm.Tracer interface to trace a single step of VM execution.
+func (t *prestateTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return
+	}
+	var (
+		stack  = scope.Stack
+		caller = scope.Contract.Address()
+	)
+	t.lookupAccount(caller)
+
+	switch op {
+	case vm.EXTCODECOPY, vm.EXTCODESIZE, vm.EXTCODEHASH, vm.BALANCE, vm.SELFDESTRUCT:
+		t.lookupAccount(peekAddress(stack, 0))
+
+	case vm.CREATE:
+		t.lookupAccount(crypto.CreateAddress(caller, env.StateDB.GetNonce(caller)))
+
+	case vm.CREATE2:
+		init := memorySlice(scope.Memory, peekInt(stack, 1), peekInt(stack, 2))
+		salt := stack.Back(3).Bytes32()
+		t.lookupAccount(crypto.CreateAddress2(caller, salt, crypto.Keccak256(init)))
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		t.lookupAccount(peekAddress(stack, 1))
+
+	case vm.SSTORE, vm.SLOAD:
+		t.lookupStorage(caller, common.Hash(stack.Back(0).Bytes32()))
+	}
+}
+
+// CaptureFault implements the vm.Tracer interface to trace an execution fault.
+func (t *prestateTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *prestateTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+}
+
+// lookupAccount fetches the current state of an account, unless it was already
+// accessed earlier in the transaction.
+func (t *prestateTracer) lookupAccount(addr common.Address) {
+	if _, ok := t.prestate[addr]; ok {
+		return
+	}
+	t.prestate[addr] = &account{
+		balance: new(big.Int).Set(t.env.StateDB.GetBalance(addr)),
+		nonce:   t.env.StateDB.GetNonce(addr),
+		code:    t.env.StateDB.GetCode(addr),
+		storage: make(map[common.Hash]common.Hash),
+	}
+}
+
+// lookupStorage fetches the current value of a storage slot, unless it was
+// already accessed earlier in the transaction.
+func (t *prestateTracer) lookupStorage(addr common.Address, key common.Hash) {
+	if _, ok := t.prestate[addr].storage[key]; ok {
+		return
+	}
+	t.prestate[addr].storage[key] = t.env.StateDB.GetState(addr, key)
+}
+
+// GetResult returns the state of the touched accounts prior to the execution
+// of the transaction, or the modified state in diff mode.
+func (t *prestateTracer) GetResult() (json.RawMessage, error) {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return nil, t.reason
+	}
+	if t.config.DiffMode {
+		return json.Marshal(t.diff())
+	}
+	result := make(map[common.Address]*prestateAccount, len(t.prestate))
+	for addr, acc := range t.prestate {
+		if t.create && addr == t.to {
+			continue
+		}
+		result[addr] = &prestateAccount{
+			Balance: bigToHex(acc.balance),
+			Nonce:   acc.nonce,
+			Code:    acc.code,
+			Storage: acc.storage,
+		}
+	}
+	return json.Marshal(result)
+}
+
+// diff compares the state of the touched accounts before and after the
+// transaction, reporting only the modified ones. It relies on the state
+// database being left in its post-transaction state by the caller.
+func (t *prestateTracer) diff() *prestateDiff {
+	result := &prestateDiff{
+		Pre:  make(map[common.Address]*diffAccount),
+		Post: make(map[common.Address]*diffAccount),
+	}
+	if t.env == nil {
+		return result
+	}
+	db := t.env.StateDB
+	for addr, acc := range t.prestate {
+		var (
+			pre      = &diffAccount{Nonce: acc.nonce, Code: acc.code, Storage: make(map[common.Hash]common.Hash)}
+			post     = &diffAccount{Storage: make(map[common.Hash]common.Hash)}
+			modified bool
+		)
+		if acc.balance.Sign() != 0 {
+			pre.Balance = (*hexutil.Big)(acc.balance)
+		}
+		// Destructed accounts are only reported in the pre state
+		if db.HasSuicided(addr) {
+			for key, val := range acc.storage {
+				if val != (common.Hash{}) {
+					pre.Storage[key] = val
+				}
+			}
+			if !acc.empty() {
+				result.Pre[addr] = pre
+			}
+			continue
+		}
+		for key, val := range acc.storage {
+			if current := db.GetState(addr, key); current != val {
+				modified = true
+				if val != (common.Hash{}) {
+					pre.Storage[key] = val
+				}
+				if current != (common.Hash{}) {
+					post.Storage[key] = current
+				}
+			}
+		}
+		if balance := db.GetBalance(addr); balance.Cmp(acc.balance) != 0 {
+			modified = true
+			post.Balance = (*hexutil.Big)(balance)
+		}
+		if nonce := db.GetNonce(addr); nonce != acc.nonce {
+			modified = true
+			post.Nonce = nonce
+		}
+		if code := db.GetCode(addr); !bytes.Equal(code, acc.code) {
+			modified = true
+			post.Code = code
+		}
+		if !modified {
+			continue
+		}
+		if !acc.empty() {
+			result.Pre[addr] = pre
+		}
+		result.Post[addr] = post
+	}
+	return result
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *prestateTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package native is a collection of transaction tracers written in Go, mirroring
+// the output of the built in JavaScript tracers without the cost of running a
+// JavaScript VM for every executed opcode.
+package native
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/common/hexutil"
+	"github.com/expanse-org/go-expanse/core/vm"
+)
+
+// Tracer is a vm.Tracer that collects a JSON result of the traced execution.
+// Its method set matches the one of the JavaScript tracer, so callers can treat
+// both kinds of tracers alike.
+type Tracer interface {
+	vm.Tracer
+
+	// GetResult returns the JSON encoded result of the trace, or any error that
+	// was encountered while tracing.
+	GetResult() (json.RawMessage, error)
+
+	// Stop terminates the tracing at the first opportune moment.
+	Stop(err error)
+}
+
+// Constructor creates a new native tracer with the given, tracer specific
+// configuration. The config may be empty if none was supplied by the user.
+type Constructor func(config json.RawMessage) (Tracer, error)
+
+// tracers contains all the native tracers by name.
+var tracers = make(map[string]Constructor)
+
+// register makes a native tracer available under the given name. It is meant
+// to be called from the init functions of the individual tracers.
+func register(name string, ctor Constructor) {
+	if _, ok := tracers[name]; ok {
+		panic("native tracer " + name + " registered twice")
+	}
+	tracers[name] = ctor
+}
+
+// Lookup retrieves the constructor of a native tracer by name.
+func Lookup(name string) (Constructor, bool) {
+	ctor, ok := tracers[name]
+	return ctor, ok
+}
+
+// Names returns the sorted names of all the registered native tracers.
+func Names() []string {
+	names := make([]string, 0, len(tracers))
+	for name := range tracers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isPrecompiled checks whether the given address is one of the precompiled
+// contracts active in the given execution environment.
+func isPrecompiled(precompiles []common.Address, addr common.Address) bool {
+	for _, p := range precompiles {
+		if p == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// activePrecompiles returns the precompiled contracts active in the block of
+// the given execution environment.
+func activePrecompiles(env *vm.EVM) []common.Address {
+	return vm.ActivePrecompiles(env.ChainConfig().Rules(env.Context.BlockNumber))
+}
+
+// memorySlice returns a copy of the memory in the [offset, offset+size) range,
+// or nil if the range is outside of the allocated memory.
+func memorySlice(mem *vm.Memory, offset, size int64) []byte {
+	if size == 0 {
+		return []byte{}
+	}
+	if offset < 0 || size < 0 || offset+size < offset || int64(mem.Len()) < offset+size {
+		return nil
+	}
+	return mem.GetCopy(offset, size)
+}
+
+// peekInt returns the n-th item from the top of the stack as an integer, or -1
+// if it doesn't fit into one.
+func peekInt(stack *vm.Stack, n int) int64 {
+	v := stack.Back(n)
+	if !v.IsUint64() || v.Uint64() > math.MaxInt64 {
+		return -1
+	}
+	return int64(v.Uint64())
+}
+
+// peekAddress returns the n-th item from the top of the stack as an address.
+func peekAddress(stack *vm.Stack, n int) common.Address {
+	return common.Address(stack.Back(n).Bytes20())
+}
+
+// addressToHex formats an address in the lowercase hex encoding used by the
+// JavaScript tracers.
+func addressToHex(addr common.Address) string {
+	return hexutil.Encode(addr[:])
+}
+
+// bigToHex formats a big integer in the quantity encoding used by the
+// JavaScript tracers.
+func bigToHex(n *big.Int) string {
+	if n == nil {
+		return "0x0"
+	}
+	return "0x" + n.Text(16)
+}
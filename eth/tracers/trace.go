@@ -0,0 +1,696 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/common/hexutil"
+	"github.com/expanse-org/go-expanse/consensus/frkhash"
+	"github.com/expanse-org/go-expanse/core"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/core/vm"
+	"github.com/expanse-org/go-expanse/eth/tracers/native"
+	"github.com/expanse-org/go-expanse/rpc"
+)
+
+const (
+	// maxTraceFilterBlocks is the maximum number of blocks a single trace_filter
+	// request is allowed to scan.
+	maxTraceFilterBlocks = 10000
+
+	// traceTypeTrace, traceTypeStateDiff and traceTypeVMTrace are the types of
+	// traces that can be requested when replaying transactions.
+	traceTypeTrace     = "trace"
+	traceTypeStateDiff = "stateDiff"
+	traceTypeVMTrace   = "vmTrace"
+)
+
+// TraceAPI is the collection of OpenEthereum compatible tracing APIs, reporting
+// the calls made by transactions as flat lists of traces.
+type TraceAPI struct {
+	api *API
+}
+
+// NewTraceAPI creates a new API definition for the trace namespace.
+func NewTraceAPI(backend Backend) *TraceAPI {
+	return &TraceAPI{api: NewAPI(backend)}
+}
+
+// CallAction is the action of a call trace.
+type CallAction struct {
+	CallType string         `json:"callType"`
+	From     common.Address `json:"from"`
+	Gas      hexutil.Uint64 `json:"gas"`
+	Input    hexutil.Bytes  `json:"input"`
+	To       common.Address `json:"to"`
+	Value    *hexutil.Big   `json:"value"`
+}
+
+// CallResult is the result of a successful call trace.
+type CallResult struct {
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Output  hexutil.Bytes  `json:"output"`
+}
+
+// CreateAction is the action of a contract creation trace.
+type CreateAction struct {
+	CreationMethod string         `json:"creationMethod"`
+	From           common.Address `json:"from"`
+	Gas            hexutil.Uint64 `json:"gas"`
+	Init           hexutil.Bytes  `json:"init"`
+	Value          *hexutil.Big   `json:"value"`
+}
+
+// CreateResult is the result of a successful contract creation trace.
+type CreateResult struct {
+	Address common.Address `json:"address"`
+	Code    hexutil.Bytes  `json:"code"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+}
+
+// SuicideAction is the action of a self-destruct trace.
+type SuicideAction struct {
+	Address       common.Address `json:"address"`
+	Balance       *hexutil.Big   `json:"balance"`
+	RefundAddress common.Address `json:"refundAddress"`
+}
+
+// RewardAction is the action of a block reward trace.
+type RewardAction struct {
+	Author     common.Address `json:"author"`
+	RewardType string         `json:"rewardType"`
+	Value      *hexutil.Big   `json:"value"`
+}
+
+// FlatTrace is a single call of a transaction, positioned in the call tree by
+// its trace address.
+type FlatTrace struct {
+	Action       interface{} `json:"action"`
+	Error        string      `json:"error,omitempty"`
+	Result       interface{} `json:"result,omitempty"`
+	Subtraces    int         `json:"subtraces"`
+	TraceAddress []int       `json:"traceAddress"`
+	Type         string      `json:"type"`
+
+	from common.Address // Originator of the action, used for filtering
+	to   common.Address // Recipient of the action, used for filtering
+}
+
+// LocalizedTrace is a flat trace along with its position in the chain.
+type LocalizedTrace struct {
+	*FlatTrace
+	BlockHash           common.Hash  `json:"blockHash"`
+	BlockNumber         uint64       `json:"blockNumber"`
+	TransactionHash     *common.Hash `json:"transactionHash"`
+	TransactionPosition *uint64      `json:"transactionPosition"`
+}
+
+// TraceResults is the outcome of replaying a transaction with the requested
+// types of traces.
+type TraceResults struct {
+	Output          hexutil.Bytes                   `json:"output"`
+	StateDiff       map[common.Address]*AccountDiff `json:"stateDiff"`
+	Trace           []*FlatTrace                    `json:"trace"`
+	VMTrace         *VMTrace                        `json:"vmTrace"`
+	TransactionHash *common.Hash                    `json:"transactionHash,omitempty"`
+}
+
+// AccountDiff is the change of an account caused by a transaction. Each field
+// is either "=" if unchanged, or an object keyed by "+" (created), "-" (deleted)
+// or "*" (modified) describing the change.
+type AccountDiff struct {
+	Balance interface{}                 `json:"balance"`
+	Code    interface{}                 `json:"code"`
+	Nonce   interface{}                 `json:"nonce"`
+	Storage map[common.Hash]interface{} `json:"storage"`
+}
+
+// valueChange is the description of a modified value in a state diff.
+type valueChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// TraceFilterArgs are the criteria of the traces to retrieve with trace_filter.
+type TraceFilterArgs struct {
+	FromBlock   *rpc.BlockNumber `json:"fromBlock"`
+	ToBlock     *rpc.BlockNumber `json:"toBlock"`
+	FromAddress []common.Address `json:"fromAddress"`
+	ToAddress   []common.Address `json:"toAddress"`
+	After       *uint64          `json:"after"`
+	Count       *uint64          `json:"count"`
+}
+
+// callFrame is a call reported by the call tracer.
+type callFrame struct {
+	Type    string         `json:"type"`
+	From    common.Address `json:"from"`
+	To      common.Address `json:"to"`
+	Value   *hexutil.Big   `json:"value"`
+	Gas     string         `json:"gas"`
+	GasUsed string         `json:"gasUsed"`
+	Input   hexutil.Bytes  `json:"input"`
+	Output  hexutil.Bytes  `json:"output"`
+	Error   string         `json:"error"`
+	Calls   []*callFrame   `json:"calls"`
+}
+
+// callTraceConfig returns the trace configuration running the call tracer.
+func callTraceConfig() *TraceConfig {
+	tracer := "callTracer"
+	return &TraceConfig{Tracer: &tracer}
+}
+
+// Block returns the traces of all the transactions in the given block, followed
+// by the block rewards.
+func (api *TraceAPI) Block(ctx context.Context, number rpc.BlockNumber) ([]*LocalizedTrace, error) {
+	block, err := api.api.blockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return api.traceBlock(ctx, block)
+}
+
+// Transaction returns the traces of the transaction with the given hash.
+func (api *TraceAPI) Transaction(ctx context.Context, hash common.Hash) ([]*LocalizedTrace, error) {
+	_, blockHash, blockNumber, index, err := api.api.backend.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	res, err := api.api.TraceTransaction(ctx, hash, callTraceConfig())
+	if err != nil {
+		return nil, err
+	}
+	traces, err := flattenCallTrace(res)
+	if err != nil {
+		return nil, err
+	}
+	return localizeTraces(traces, blockHash, blockNumber, &hash, &index), nil
+}
+
+// Filter returns the traces of the given block range matching the given sender
+// and recipient addresses. The blocks are traced on the fly, so the range is
+// limited to maxTraceFilterBlocks.
+func (api *TraceAPI) Filter(ctx context.Context, args TraceFilterArgs) ([]*LocalizedTrace, error) {
+	from, err := api.resolveBlockNumber(ctx, args.FromBlock)
+	if err != nil {
+		return nil, err
+	}
+	to, err := api.resolveBlockNumber(ctx, args.ToBlock)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, fmt.Errorf("invalid block range %d-%d", from, to)
+	}
+	if to-from >= maxTraceFilterBlocks {
+		return nil, fmt.Errorf("block range %d-%d exceeds the limit of %d blocks", from, to, maxTraceFilterBlocks)
+	}
+	// A zero count asks for no traces at all, don't bother tracing the range
+	if args.Count != nil && *args.Count == 0 {
+		return []*LocalizedTrace{}, nil
+	}
+	var (
+		fromAddrs = make(map[common.Address]bool)
+		toAddrs   = make(map[common.Address]bool)
+		skip      uint64
+		results   = []*LocalizedTrace{}
+	)
+	for _, addr := range args.FromAddress {
+		fromAddrs[addr] = true
+	}
+	for _, addr := range args.ToAddress {
+		toAddrs[addr] = true
+	}
+	if args.After != nil {
+		skip = *args.After
+	}
+	for number := from; number <= to; number++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		block, err := api.api.blockByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil {
+			return nil, err
+		}
+		traces, err := api.traceBlock(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		for _, trace := range traces {
+			if len(fromAddrs) > 0 && !fromAddrs[trace.from] {
+				continue
+			}
+			if len(toAddrs) > 0 && !toAddrs[trace.to] {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			results = append(results, trace)
+			if args.Count != nil && uint64(len(results)) >= *args.Count {
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
+
+// ReplayBlockTransactions replays all the transactions of the given block,
+// returning the requested types of traces of each of them.
+func (api *TraceAPI) ReplayBlockTransactions(ctx context.Context, number rpc.BlockNumber, traceTypes []string) ([]*TraceResults, error) {
+	block, err := api.api.blockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return api.replayBlock(ctx, block, traceTypes, -1)
+}
+
+// ReplayTransaction replays the transaction with the given hash, returning the
+// requested types of traces.
+func (api *TraceAPI) ReplayTransaction(ctx context.Context, hash common.Hash, traceTypes []string) (*TraceResults, error) {
+	_, blockHash, blockNumber, index, err := api.api.backend.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	block, err := api.api.blockByNumberAndHash(ctx, rpc.BlockNumber(blockNumber), blockHash)
+	if err != nil {
+		return nil, err
+	}
+	results, err := api.replayBlock(ctx, block, traceTypes, int(index))
+	if err != nil {
+		return nil, err
+	}
+	result := results[index]
+	result.TransactionHash = nil
+	return result, nil
+}
+
+// resolveBlockNumber converts a block number of a filter into an absolute one,
+// defaulting to the chain head.
+func (api *TraceAPI) resolveBlockNumber(ctx context.Context, number *rpc.BlockNumber) (uint64, error) {
+	if number != nil && *number >= 0 {
+		return uint64(*number), nil
+	}
+	header, err := api.api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return 0, err
+	}
+	if header == nil {
+		return 0, errors.New("chain head not found")
+	}
+	return header.Number.Uint64(), nil
+}
+
+// traceBlock traces all the transactions of the block with the call tracer,
+// and appends the block rewards.
+func (api *TraceAPI) traceBlock(ctx context.Context, block *types.Block) ([]*LocalizedTrace, error) {
+	var traces []*LocalizedTrace
+	if block.NumberU64() > 0 && len(block.Transactions()) > 0 {
+		results, err := api.api.traceBlock(ctx, block, callTraceConfig())
+		if err != nil {
+			return nil, err
+		}
+		for i, res := range results {
+			if res.Error != "" {
+				return nil, fmt.Errorf("transaction %#x: %s", block.Transactions()[i].Hash(), res.Error)
+			}
+			flat, err := flattenCallTrace(res.Result)
+			if err != nil {
+				return nil, err
+			}
+			var (
+				hash  = block.Transactions()[i].Hash()
+				index = uint64(i)
+			)
+			traces = append(traces, localizeTraces(flat, block.Hash(), block.NumberU64(), &hash, &index)...)
+		}
+	}
+	return append(traces, localizeTraces(api.rewardTraces(block), block.Hash(), block.NumberU64(), nil, nil)...), nil
+}
+
+// rewardTraces returns the traces of the rewards paid out for mining a block.
+// Rewards are only reported for chains running frkhash.
+func (api *TraceAPI) rewardTraces(block *types.Block) []*FlatTrace {
+	if _, ok := api.api.backend.Engine().(*frkhash.Frkhash); !ok || block.NumberU64() == 0 {
+		return nil
+	}
+	var (
+		rewards = frkhash.CalcRewards(api.api.backend.ChainConfig(), block.Header(), block.Uncles())
+		traces  []*FlatTrace
+	)
+	reward := func(author common.Address, kind string, value *big.Int) {
+		traces = append(traces, &FlatTrace{
+			Action:       &RewardAction{Author: author, RewardType: kind, Value: (*hexutil.Big)(value)},
+			TraceAddress: []int{},
+			Type:         "reward",
+			to:           author,
+		})
+	}
+	reward(block.Coinbase(), "block", rewards.Miner)
+	for i, uncle := range block.Uncles() {
+		reward(uncle.Coinbase, "uncle", rewards.Uncles[i])
+	}
+	if rewards.Fund != nil && rewards.Treasury.Sign() > 0 {
+		reward(*rewards.Fund, "treasury", rewards.Treasury)
+	}
+	return traces
+}
+
+// localizeTraces positions the flat traces of a transaction in the chain.
+func localizeTraces(traces []*FlatTrace, blockHash common.Hash, blockNumber uint64, txHash *common.Hash, txIndex *uint64) []*LocalizedTrace {
+	localized := make([]*LocalizedTrace, len(traces))
+	for i, trace := range traces {
+		localized[i] = &LocalizedTrace{
+			FlatTrace:           trace,
+			BlockHash:           blockHash,
+			BlockNumber:         blockNumber,
+			TransactionHash:     txHash,
+			TransactionPosition: txIndex,
+		}
+	}
+	return localized
+}
+
+// flattenCallTrace converts the result of the call tracer into a list of flat
+// traces, ordered depth first.
+func flattenCallTrace(result interface{}) ([]*FlatTrace, error) {
+	blob, ok := result.(json.RawMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected call trace result %T", result)
+	}
+	call := new(callFrame)
+	if err := json.Unmarshal(blob, call); err != nil {
+		return nil, err
+	}
+	var traces []*FlatTrace
+	flattenCallFrame(call, []int{}, &traces)
+	return traces, nil
+}
+
+// flattenCallFrame appends the flat trace of a call and all its inner calls.
+func flattenCallFrame(call *callFrame, address []int, traces *[]*FlatTrace) {
+	trace := &FlatTrace{
+		Error:        parityError(call.Error),
+		Subtraces:    len(call.Calls),
+		TraceAddress: address,
+		from:         call.From,
+		to:           call.To,
+	}
+	value := call.Value
+	if value == nil {
+		value = new(hexutil.Big)
+	}
+	gas, _ := hexutil.DecodeUint64(call.Gas)
+	gasUsed, _ := hexutil.DecodeUint64(call.GasUsed)
+
+	switch call.Type {
+	case "CREATE", "CREATE2":
+		trace.Type = "create"
+		trace.Action = &CreateAction{
+			CreationMethod: strings.ToLower(call.Type),
+			From:           call.From,
+			Gas:            hexutil.Uint64(gas),
+			Init:           call.Input,
+			Value:          value,
+		}
+		if call.Error == "" {
+			trace.Result = &CreateResult{Address: call.To, Code: call.Output, GasUsed: hexutil.Uint64(gasUsed)}
+		}
+	case "SELFDESTRUCT":
+		trace.Type = "suicide"
+		trace.Action = &SuicideAction{Address: call.From, Balance: value, RefundAddress: call.To}
+	default:
+		trace.Type = "call"
+		trace.Action = &CallAction{
+			CallType: strings.ToLower(call.Type),
+			From:     call.From,
+			Gas:      hexutil.Uint64(gas),
+			Input:    call.Input,
+			To:       call.To,
+			Value:    value,
+		}
+		if call.Error == "" {
+			output := call.Output
+			if output == nil {
+				output = hexutil.Bytes{}
+			}
+			trace.Result = &CallResult{GasUsed: hexutil.Uint64(gasUsed), Output: output}
+		}
+	}
+	*traces = append(*traces, trace)
+
+	for i, inner := range call.Calls {
+		addr := make([]int, len(address)+1)
+		copy(addr, address)
+		addr[len(address)] = i
+		flattenCallFrame(inner, addr, traces)
+	}
+}
+
+// parityError converts an EVM error message into the one reported by
+// OpenEthereum, keeping the original message for errors without a counterpart.
+func parityError(err string) string {
+	switch {
+	case err == "":
+		return ""
+	case err == vm.ErrExecutionReverted.Error():
+		return "Reverted"
+	case err == vm.ErrOutOfGas.Error(), err == vm.ErrCodeStoreOutOfGas.Error():
+		return "Out of gas"
+	case err == vm.ErrInvalidJump.Error():
+		return "Bad jump destination"
+	case err == vm.ErrDepth.Error():
+		return "Out of stack"
+	case strings.HasPrefix(err, "stack underflow"):
+		return "Stack underflow"
+	case strings.HasPrefix(err, "stack limit reached"):
+		return "Out of stack"
+	case strings.HasPrefix(err, "invalid opcode"):
+		return "Bad instruction"
+	}
+	return err
+}
+
+// replayBlock re-executes the transactions of a block up to and including the
+// given index, or all of them if negative, collecting the requested traces.
+func (api *TraceAPI) replayBlock(ctx context.Context, block *types.Block, traceTypes []string, index int) ([]*TraceResults, error) {
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis is not traceable")
+	}
+	var trace, stateDiff, vmTrace bool
+	for _, typ := range traceTypes {
+		switch typ {
+		case traceTypeTrace:
+			trace = true
+		case traceTypeStateDiff:
+			stateDiff = true
+		case traceTypeVMTrace:
+			vmTrace = true
+		default:
+			return nil, fmt.Errorf("unknown trace type %q", typ)
+		}
+	}
+	parent, err := api.api.blockByNumberAndHash(ctx, rpc.BlockNumber(block.NumberU64()-1), block.ParentHash())
+	if err != nil {
+		return nil, err
+	}
+	statedb, err := api.api.backend.StateAtBlock(ctx, parent, defaultTraceReexec, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		config   = api.api.backend.ChainConfig()
+		signer   = types.MakeSigner(config, block.Number())
+		blockCtx = core.NewEVMBlockContext(block.Header(), api.api.chainContext(ctx), nil)
+		results  []*TraceResults
+	)
+	for i, tx := range block.Transactions() {
+		if index >= 0 && i > index {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		msg, err := tx.AsMessage(signer, block.BaseFee())
+		if err != nil {
+			return nil, err
+		}
+		var (
+			callTracer, prestateTracer native.Tracer
+			vmTracer                   *vmTraceTracer
+			tracers                    multiTracer
+		)
+		if trace {
+			if callTracer, err = newTracer("callTracer", new(Context), nil); err != nil {
+				return nil, err
+			}
+			tracers = append(tracers, callTracer)
+		}
+		if stateDiff {
+			if prestateTracer, err = newTracer("prestateTracer", new(Context), json.RawMessage(`{"diffMode":true}`)); err != nil {
+				return nil, err
+			}
+			tracers = append(tracers, prestateTracer)
+		}
+		if vmTrace {
+			vmTracer = newVMTraceTracer()
+			tracers = append(tracers, vmTracer)
+		}
+		statedb.Prepare(tx.Hash(), i)
+		vmenv := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), statedb, config, vm.Config{Debug: len(tracers) > 0, Tracer: tracers})
+		result, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas()))
+		if err != nil {
+			return nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+		}
+		hash := tx.Hash()
+		res := &TraceResults{
+			Output:          result.ReturnData,
+			Trace:           []*FlatTrace{},
+			TransactionHash: &hash,
+		}
+		if res.Output == nil {
+			res.Output = hexutil.Bytes{}
+		}
+		if callTracer != nil {
+			blob, err := callTracer.GetResult()
+			if err != nil {
+				return nil, err
+			}
+			if res.Trace, err = flattenCallTrace(blob); err != nil {
+				return nil, err
+			}
+		}
+		if prestateTracer != nil {
+			blob, err := prestateTracer.GetResult()
+			if err != nil {
+				return nil, err
+			}
+			if res.StateDiff, err = parityStateDiff(blob); err != nil {
+				return nil, err
+			}
+		}
+		if vmTracer != nil {
+			res.VMTrace = vmTracer.result()
+		}
+		results = append(results, res)
+
+		// Finalize the state so any modifications are written to the trie
+		statedb.Finalise(config.IsEIP158(block.Number()))
+	}
+	if index >= len(results) {
+		return nil, fmt.Errorf("transaction index %d out of range", index)
+	}
+	return results, nil
+}
+
+// prestateDiffAccount is an account reported by the prestate tracer in diff mode.
+type prestateDiffAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// parityStateDiff converts the result of the prestate tracer in diff mode into
+// the state diff format of OpenEthereum.
+func parityStateDiff(blob json.RawMessage) (map[common.Address]*AccountDiff, error) {
+	var diff struct {
+		Pre  map[common.Address]*prestateDiffAccount `json:"pre"`
+		Post map[common.Address]*prestateDiffAccount `json:"post"`
+	}
+	if err := json.Unmarshal(blob, &diff); err != nil {
+		return nil, err
+	}
+	result := make(map[common.Address]*AccountDiff)
+	for addr, pre := range diff.Pre {
+		post, ok := diff.Post[addr]
+		if !ok {
+			// Account destructed by the transaction
+			account := &AccountDiff{
+				Balance: map[string]interface{}{"-": bigOrZero(pre.Balance)},
+				Code:    map[string]interface{}{"-": bytesOrEmpty(pre.Code)},
+				Nonce:   map[string]interface{}{"-": hexutil.Uint64(pre.Nonce)},
+				Storage: make(map[common.Hash]interface{}),
+			}
+			for key, val := range pre.Storage {
+				account.Storage[key] = map[string]interface{}{"-": val}
+			}
+			result[addr] = account
+			continue
+		}
+		// Account modified by the transaction
+		account := &AccountDiff{Balance: "=", Code: "=", Nonce: "=", Storage: make(map[common.Hash]interface{})}
+		if post.Balance != nil {
+			account.Balance = map[string]interface{}{"*": &valueChange{From: bigOrZero(pre.Balance), To: post.Balance}}
+		}
+		if post.Code != nil {
+			account.Code = map[string]interface{}{"*": &valueChange{From: bytesOrEmpty(pre.Code), To: post.Code}}
+		}
+		if post.Nonce != 0 {
+			account.Nonce = map[string]interface{}{"*": &valueChange{From: hexutil.Uint64(pre.Nonce), To: hexutil.Uint64(post.Nonce)}}
+		}
+		for key := range pre.Storage {
+			account.Storage[key] = map[string]interface{}{"*": &valueChange{From: pre.Storage[key], To: post.Storage[key]}}
+		}
+		for key := range post.Storage {
+			account.Storage[key] = map[string]interface{}{"*": &valueChange{From: pre.Storage[key], To: post.Storage[key]}}
+		}
+		result[addr] = account
+	}
+	for addr, post := range diff.Post {
+		if _, ok := diff.Pre[addr]; ok {
+			continue
+		}
+		// Account created by the transaction
+		account := &AccountDiff{
+			Balance: map[string]interface{}{"+": bigOrZero(post.Balance)},
+			Code:    map[string]interface{}{"+": bytesOrEmpty(post.Code)},
+			Nonce:   map[string]interface{}{"+": hexutil.Uint64(post.Nonce)},
+			Storage: make(map[common.Hash]interface{}),
+		}
+		for key, val := range post.Storage {
+			account.Storage[key] = map[string]interface{}{"+": val}
+		}
+		result[addr] = account
+	}
+	return result, nil
+}
+
+// bigOrZero returns the given number, or zero if it is nil.
+func bigOrZero(n *hexutil.Big) *hexutil.Big {
+	if n == nil {
+		return new(hexutil.Big)
+	}
+	return n
+}
+
+// bytesOrEmpty returns the given bytes, or an empty slice if they are nil.
+func bytesOrEmpty(b hexutil.Bytes) hexutil.Bytes {
+	if b == nil {
+		return hexutil.Bytes{}
+	}
+	return b
+}
@@ -0,0 +1,220 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/params"
+	"github.com/expanse-org/go-expanse/rpc"
+)
+
+var (
+	// traceCallee stores 0x2a in slot 0.
+	traceCallee     = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	traceCalleeCode = common.FromHex("602a60005500")
+
+	// traceCaller calls traceCallee without any value or data.
+	traceCaller     = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	traceCallerCode = common.FromHex("60006000600060006000" + "73" + "00000000000000000000000000000000000000bb" + "5af100")
+)
+
+// newTraceTestAPI creates a trace API over a chain with a single block, which
+// contains a transaction calling traceCaller.
+func newTraceTestAPI(t *testing.T) (*TraceAPI, common.Address, *types.Transaction) {
+	accounts := newAccounts(1)
+	genesis := &core.Genesis{Alloc: core.GenesisAlloc{
+		accounts[0].addr: {Balance: big.NewInt(params.Ether)},
+		traceCaller:      {Code: traceCallerCode, Balance: new(big.Int)},
+		traceCallee:      {Code: traceCalleeCode, Balance: new(big.Int)},
+	}}
+	var tx *types.Transaction
+	backend := newTestBackend(t, 1, genesis, func(i int, b *core.BlockGen) {
+		tx, _ = types.SignTx(types.NewTransaction(uint64(i), traceCaller, big.NewInt(0), 100000, b.BaseFee(), nil), types.HomesteadSigner{}, accounts[0].key)
+		b.AddTx(tx)
+	})
+	return NewTraceAPI(backend), accounts[0].addr, tx
+}
+
+func TestTraceBlockAndTransaction(t *testing.T) {
+	t.Parallel()
+
+	api, sender, tx := newTraceTestAPI(t)
+
+	block, err := api.Block(context.Background(), rpc.BlockNumber(1))
+	if err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	if len(block) != 2 {
+		t.Fatalf("trace count mismatch: have %d, want 2", len(block))
+	}
+	outer, inner := block[0], block[1]
+	if action, ok := outer.Action.(*CallAction); !ok || action.CallType != "call" || action.From != sender || action.To != traceCaller {
+		t.Errorf("outer action mismatch: %+v", outer.Action)
+	}
+	if outer.Subtraces != 1 || len(outer.TraceAddress) != 0 {
+		t.Errorf("outer position mismatch: subtraces %d, address %v", outer.Subtraces, outer.TraceAddress)
+	}
+	if action, ok := inner.Action.(*CallAction); !ok || action.From != traceCaller || action.To != traceCallee || action.Gas == 0 {
+		t.Errorf("inner action mismatch: %+v", inner.Action)
+	}
+	if inner.Subtraces != 0 || !reflect.DeepEqual(inner.TraceAddress, []int{0}) {
+		t.Errorf("inner position mismatch: subtraces %d, address %v", inner.Subtraces, inner.TraceAddress)
+	}
+	if result, ok := inner.Result.(*CallResult); !ok || result.GasUsed == 0 {
+		t.Errorf("inner result mismatch: %+v", inner.Result)
+	}
+	if inner.BlockNumber != 1 || *inner.TransactionHash != tx.Hash() || *inner.TransactionPosition != 0 {
+		t.Errorf("inner location mismatch: block %d, tx %x, index %d", inner.BlockNumber, *inner.TransactionHash, *inner.TransactionPosition)
+	}
+	// The transaction traces should match the ones of the block
+	traces, err := api.Transaction(context.Background(), tx.Hash())
+	if err != nil {
+		t.Fatalf("failed to trace transaction: %v", err)
+	}
+	have, _ := json.Marshal(traces)
+	want, _ := json.Marshal(block)
+	if string(have) != string(want) {
+		t.Errorf("transaction traces mismatch:\nhave %s\nwant %s", have, want)
+	}
+}
+
+func TestTraceFilter(t *testing.T) {
+	t.Parallel()
+
+	api, sender, _ := newTraceTestAPI(t)
+
+	var (
+		from, to = rpc.BlockNumber(1), rpc.BlockNumber(1)
+		zero     = uint64(0)
+		one      = uint64(1)
+	)
+	tests := []struct {
+		args TraceFilterArgs
+		want []common.Address // Recipients of the expected traces
+	}{
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to}, []common.Address{traceCaller, traceCallee}},
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, FromAddress: []common.Address{traceCaller}}, []common.Address{traceCallee}},
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, ToAddress: []common.Address{traceCaller}}, []common.Address{traceCaller}},
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, FromAddress: []common.Address{sender}, ToAddress: []common.Address{traceCallee}}, []common.Address{}},
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, After: &one}, []common.Address{traceCallee}},
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, Count: &one}, []common.Address{traceCaller}},
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, Count: &zero}, []common.Address{}},
+		{TraceFilterArgs{ToAddress: []common.Address{traceCallee}}, []common.Address{traceCallee}},
+	}
+	for i, test := range tests {
+		traces, err := api.Filter(context.Background(), test.args)
+		if err != nil {
+			t.Fatalf("test %d: failed to filter traces: %v", i, err)
+		}
+		have := []common.Address{}
+		for _, trace := range traces {
+			have = append(have, trace.Action.(*CallAction).To)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("test %d: recipients mismatch: have %x, want %x", i, have, test.want)
+		}
+	}
+	// Too wide ranges should be rejected
+	from, to = 0, maxTraceFilterBlocks
+	if _, err := api.Filter(context.Background(), TraceFilterArgs{FromBlock: &from, ToBlock: &to}); err == nil {
+		t.Errorf("expected error for oversized block range")
+	}
+}
+
+func TestTraceReplayBlockTransactions(t *testing.T) {
+	t.Parallel()
+
+	api, sender, tx := newTraceTestAPI(t)
+
+	results, err := api.ReplayBlockTransactions(context.Background(), rpc.BlockNumber(1), []string{"trace", "stateDiff", "vmTrace"})
+	if err != nil {
+		t.Fatalf("failed to replay block: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("result count mismatch: have %d, want 1", len(results))
+	}
+	res := results[0]
+	if *res.TransactionHash != tx.Hash() {
+		t.Errorf("transaction hash mismatch: have %x, want %x", *res.TransactionHash, tx.Hash())
+	}
+	if len(res.Trace) != 2 {
+		t.Errorf("trace count mismatch: have %d, want 2", len(res.Trace))
+	}
+	// The callee storage and the sender balance and nonce should be modified
+	blob, _ := json.Marshal(res.StateDiff)
+	var diff map[common.Address]map[string]interface{}
+	if err := json.Unmarshal(blob, &diff); err != nil {
+		t.Fatalf("failed to decode state diff: %v", err)
+	}
+	slot := diff[traceCallee]["storage"].(map[string]interface{})[common.Hash{}.Hex()]
+	want := map[string]interface{}{"*": map[string]interface{}{"from": common.Hash{}.Hex(), "to": common.BigToHash(big.NewInt(0x2a)).Hex()}}
+	if !reflect.DeepEqual(slot, want) {
+		t.Errorf("storage diff mismatch: have %v, want %v", slot, want)
+	}
+	if diff[traceCallee]["balance"] != "=" || diff[traceCallee]["code"] != "=" {
+		t.Errorf("callee diff mismatch: %v", diff[traceCallee])
+	}
+	nonce := map[string]interface{}{"*": map[string]interface{}{"from": "0x0", "to": "0x1"}}
+	if !reflect.DeepEqual(diff[sender]["nonce"], nonce) {
+		t.Errorf("sender nonce diff mismatch: have %v, want %v", diff[sender]["nonce"], nonce)
+	}
+	// The VM trace should contain the inner call storing into the callee
+	if !reflect.DeepEqual([]byte(res.VMTrace.Code), traceCallerCode) {
+		t.Fatalf("caller code mismatch: have %x", res.VMTrace.Code)
+	}
+	var call *VMOperation
+	for _, op := range res.VMTrace.Ops {
+		if op.Sub != nil {
+			call = op
+		}
+	}
+	if call == nil {
+		t.Fatalf("no inner call in VM trace")
+	}
+	if call.Ex == nil || len(call.Ex.Push) != 1 || call.Ex.Push[0].ToInt().Uint64() != 1 {
+		t.Errorf("call effects mismatch: %+v", call.Ex)
+	}
+	if len(call.Sub.Ops) != 4 {
+		t.Fatalf("inner op count mismatch: have %d, want 4", len(call.Sub.Ops))
+	}
+	store := call.Sub.Ops[2].Ex.Store
+	if store == nil || store.Key.ToInt().Sign() != 0 || store.Val.ToInt().Uint64() != 0x2a {
+		t.Errorf("store effects mismatch: %+v", store)
+	}
+	if push := call.Sub.Ops[0].Ex.Push; len(push) != 1 || (*big.Int)(push[0]).Uint64() != 0x2a {
+		t.Errorf("push effects mismatch: %v", push)
+	}
+	// Replaying the single transaction should yield the same, without the hash
+	single, err := api.ReplayTransaction(context.Background(), tx.Hash(), []string{"trace"})
+	if err != nil {
+		t.Fatalf("failed to replay transaction: %v", err)
+	}
+	if single.TransactionHash != nil || single.StateDiff != nil || single.VMTrace != nil || len(single.Trace) != 2 {
+		t.Errorf("single replay mismatch: %+v", single)
+	}
+	if _, err := api.ReplayTransaction(context.Background(), tx.Hash(), []string{"bogus"}); err == nil {
+		t.Errorf("expected error for unknown trace type")
+	}
+}
@@ -14,14 +14,16 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
-// Package tracers is a collection of JavaScript transaction tracers.
+// Package tracers is a collection of JavaScript and native transaction tracers.
 package tracers
 
 import (
+	"encoding/json"
 	"strings"
 	"unicode"
 
 	"github.com/expanse-org/go-expanse/eth/tracers/internal/tracers"
+	"github.com/expanse-org/go-expanse/eth/tracers/native"
 )
 
 // all contains all the built in JavaScript tracers by name.
@@ -51,3 +53,13 @@ func tracer(name string) (string, bool) {
 	}
 	return "", false
 }
+
+// newTracer creates the tracer with the given name or JavaScript code. Native
+// tracers take precedence over the built in JavaScript tracers of the same name.
+// The config is only used by the native tracers.
+func newTracer(code string, ctx *Context, config json.RawMessage) (native.Tracer, error) {
+	if ctor, ok := native.Lookup(code); ok {
+		return ctor(config)
+	}
+	return New(code, ctx)
+}
@@ -17,6 +17,7 @@
 package tracers
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/json"
@@ -32,9 +33,11 @@ import (
 	"github.com/expanse-org/go-expanse/common/math"
 	"github.com/expanse-org/go-expanse/core"
 	"github.com/expanse-org/go-expanse/core/rawdb"
+	"github.com/expanse-org/go-expanse/core/state"
 	"github.com/expanse-org/go-expanse/core/types"
 	"github.com/expanse-org/go-expanse/core/vm"
 	"github.com/expanse-org/go-expanse/crypto"
+	"github.com/expanse-org/go-expanse/eth/tracers/native"
 	"github.com/expanse-org/go-expanse/params"
 	"github.com/expanse-org/go-expanse/rlp"
 	"github.com/expanse-org/go-expanse/tests"
@@ -201,83 +204,242 @@ func TestPrestateTracerCreate2(t *testing.T) {
 	}
 }
 
-// Iterates over all the input-output datasets in the tracer test harness and
-// runs the JavaScript tracers against them.
-func TestCallTracer(t *testing.T) {
+// callTracerFixtures returns the names of the call tracer test cases.
+func callTracerFixtures(t *testing.T) []string {
 	files, err := ioutil.ReadDir("testdata")
 	if err != nil {
 		t.Fatalf("failed to retrieve tracer test suite: %v", err)
 	}
+	var names []string
 	for _, file := range files {
-		if !strings.HasPrefix(file.Name(), "call_tracer_") {
-			continue
+		if strings.HasPrefix(file.Name(), "call_tracer_") {
+			names = append(names, file.Name())
 		}
+	}
+	return names
+}
+
+// runCallTracerFixture executes the transaction of a call tracer test case with
+// the given tracer, returning the test case, the post-transaction state and the
+// result of the tracer.
+func runCallTracerFixture(t *testing.T, file string, tracer native.Tracer) (*callTracerTest, *state.StateDB, json.RawMessage) {
+	// Call tracer test found, read if from disk
+	blob, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatalf("failed to read testcase: %v", err)
+	}
+	test := new(callTracerTest)
+	if err := json.Unmarshal(blob, test); err != nil {
+		t.Fatalf("failed to parse testcase: %v", err)
+	}
+	// Configure a blockchain with the given prestate
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+		t.Fatalf("failed to parse testcase input: %v", err)
+	}
+	signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+	origin, _ := signer.Sender(tx)
+	txContext := vm.TxContext{
+		Origin:   origin,
+		GasPrice: tx.GasPrice(),
+	}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Coinbase:    test.Context.Miner,
+		BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
+		Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
+		Difficulty:  (*big.Int)(test.Context.Difficulty),
+		GasLimit:    uint64(test.Context.GasLimit),
+	}
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), test.Genesis.Alloc, false)
+
+	// Create the EVM environment and run the tracer
+	evm := vm.NewEVM(context, txContext, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+
+	msg, err := tx.AsMessage(signer, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, err = st.TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	return test, statedb, res
+}
+
+// Iterates over all the input-output datasets in the tracer test harness and
+// runs the JavaScript tracers against them.
+func TestCallTracer(t *testing.T) {
+	testCallTracer(t, func() (native.Tracer, error) { return New("callTracer", new(Context)) })
+}
+
+// Iterates over all the input-output datasets in the tracer test harness and
+// runs the native call tracer against them.
+func TestCallTracerNative(t *testing.T) {
+	testCallTracer(t, func() (native.Tracer, error) { return newTracer("callTracer", new(Context), nil) })
+}
+
+func testCallTracer(t *testing.T, newCallTracer func() (native.Tracer, error)) {
+	for _, file := range callTracerFixtures(t) {
 		file := file // capture range variable
-		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json")), func(t *testing.T) {
+		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file, "call_tracer_"), ".json")), func(t *testing.T) {
 			t.Parallel()
 
-			// Call tracer test found, read if from disk
-			blob, err := ioutil.ReadFile(filepath.Join("testdata", file.Name()))
+			tracer, err := newCallTracer()
 			if err != nil {
-				t.Fatalf("failed to read testcase: %v", err)
+				t.Fatalf("failed to create call tracer: %v", err)
+			}
+			test, _, res := runCallTracerFixture(t, file, tracer)
+
+			// Compare the trace result against the etalon
+			ret := new(callTrace)
+			if err := json.Unmarshal(res, ret); err != nil {
+				t.Fatalf("failed to unmarshal trace result: %v", err)
+			}
+			if !jsonEqual(ret, test.Result) {
+				// uncomment this for easier debugging
+				//have, _ := json.MarshalIndent(ret, "", " ")
+				//want, _ := json.MarshalIndent(test.Result, "", " ")
+				//t.Fatalf("trace mismatch: \nhave %+v\nwant %+v", string(have), string(want))
+				t.Fatalf("trace mismatch: \nhave %+v\nwant %+v", ret, test.Result)
 			}
-			test := new(callTracerTest)
-			if err := json.Unmarshal(blob, test); err != nil {
-				t.Fatalf("failed to parse testcase: %v", err)
+		})
+	}
+}
+
+// prestateAccount is the result of a prestateTracer run for a single account.
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// Tests that the native prestate tracer reports the state of the accounts
+// prior to the transaction, as specified by the genesis of the test cases.
+func TestPrestateTracerNative(t *testing.T) {
+	for _, file := range callTracerFixtures(t) {
+		file := file // capture range variable
+		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file, "call_tracer_"), ".json")), func(t *testing.T) {
+			t.Parallel()
+
+			tracer, err := newTracer("prestateTracer", new(Context), nil)
+			if err != nil {
+				t.Fatalf("failed to create prestate tracer: %v", err)
 			}
-			// Configure a blockchain with the given prestate
-			tx := new(types.Transaction)
-			if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
-				t.Fatalf("failed to parse testcase input: %v", err)
+			test, _, res := runCallTracerFixture(t, file, tracer)
+
+			prestate := make(map[common.Address]*prestateAccount)
+			if err := json.Unmarshal(res, &prestate); err != nil {
+				t.Fatalf("failed to unmarshal trace result: %v", err)
 			}
-			signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
-			origin, _ := signer.Sender(tx)
-			txContext := vm.TxContext{
-				Origin:   origin,
-				GasPrice: tx.GasPrice(),
+			if len(prestate) == 0 {
+				t.Fatalf("no accounts reported")
 			}
-			context := vm.BlockContext{
-				CanTransfer: core.CanTransfer,
-				Transfer:    core.Transfer,
-				Coinbase:    test.Context.Miner,
-				BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
-				Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
-				Difficulty:  (*big.Int)(test.Context.Difficulty),
-				GasLimit:    uint64(test.Context.GasLimit),
+			for addr, have := range prestate {
+				want := test.Genesis.Alloc[addr]
+				if want.Balance == nil {
+					want.Balance = new(big.Int)
+				}
+				if have.Balance.ToInt().Cmp(want.Balance) != 0 {
+					t.Errorf("account %x: balance mismatch: have %v, want %v", addr, have.Balance, want.Balance)
+				}
+				if have.Nonce != want.Nonce {
+					t.Errorf("account %x: nonce mismatch: have %d, want %d", addr, have.Nonce, want.Nonce)
+				}
+				if !bytes.Equal(have.Code, want.Code) {
+					t.Errorf("account %x: code mismatch: have %x, want %x", addr, have.Code, want.Code)
+				}
+				for key, val := range have.Storage {
+					if val != want.Storage[key] {
+						t.Errorf("account %x: slot %x mismatch: have %x, want %x", addr, key, val, want.Storage[key])
+					}
+				}
 			}
-			_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), test.Genesis.Alloc, false)
+		})
+	}
+}
+
+// Tests that the diff mode of the native prestate tracer reports the modified
+// accounts before and after the transaction.
+func TestPrestateTracerNativeDiff(t *testing.T) {
+	for _, file := range callTracerFixtures(t) {
+		file := file // capture range variable
+		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file, "call_tracer_"), ".json")), func(t *testing.T) {
+			t.Parallel()
 
-			// Create the tracer, the EVM environment and run it
-			tracer, err := New("callTracer", new(Context))
+			tracer, err := newTracer("prestateTracer", new(Context), json.RawMessage(`{"diffMode": true}`))
 			if err != nil {
-				t.Fatalf("failed to create call tracer: %v", err)
+				t.Fatalf("failed to create prestate tracer: %v", err)
 			}
-			evm := vm.NewEVM(context, txContext, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+			test, statedb, res := runCallTracerFixture(t, file, tracer)
 
-			msg, err := tx.AsMessage(signer, nil)
-			if err != nil {
-				t.Fatalf("failed to prepare transaction for tracing: %v", err)
+			var diff struct {
+				Pre  map[common.Address]*prestateAccount `json:"pre"`
+				Post map[common.Address]*prestateAccount `json:"post"`
+			}
+			if err := json.Unmarshal(res, &diff); err != nil {
+				t.Fatalf("failed to unmarshal trace result: %v", err)
+			}
+			// The sender pays for the gas, so it's always modified
+			origin := common.HexToAddress(test.Result.From.Hex())
+			if diff.Pre[origin] == nil || diff.Post[origin] == nil {
+				t.Fatalf("sender %x missing from diff", origin)
 			}
-			st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
-			if _, err = st.TransitionDb(); err != nil {
-				t.Fatalf("failed to execute transaction: %v", err)
+			for addr, have := range diff.Pre {
+				if want := test.Genesis.Alloc[addr]; have.Balance != nil && have.Balance.ToInt().Cmp(want.Balance) != 0 {
+					t.Errorf("account %x: pre balance mismatch: have %v, want %v", addr, have.Balance, want.Balance)
+				}
 			}
-			// Retrieve the trace result and compare against the etalon
-			res, err := tracer.GetResult()
+			for addr, have := range diff.Post {
+				if want := statedb.GetBalance(addr); have.Balance != nil && have.Balance.ToInt().Cmp(want) != 0 {
+					t.Errorf("account %x: post balance mismatch: have %v, want %v", addr, have.Balance, want)
+				}
+				if want := statedb.GetNonce(addr); have.Nonce != 0 && have.Nonce != want {
+					t.Errorf("account %x: post nonce mismatch: have %d, want %d", addr, have.Nonce, want)
+				}
+				if _, ok := diff.Pre[addr]; !ok && len(test.Genesis.Alloc[addr].Code) > 0 {
+					t.Errorf("account %x: pre-existing account missing from pre state", addr)
+				}
+			}
+		})
+	}
+}
+
+// Tests that the native 4byte tracer produces the same output as the JavaScript
+// one.
+func TestFourByteTracerNative(t *testing.T) {
+	for _, file := range callTracerFixtures(t) {
+		file := file // capture range variable
+		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file, "call_tracer_"), ".json")), func(t *testing.T) {
+			t.Parallel()
+
+			jsTracer, err := New("4byteTracer", new(Context))
 			if err != nil {
-				t.Fatalf("failed to retrieve trace result: %v", err)
+				t.Fatalf("failed to create JavaScript tracer: %v", err)
 			}
-			ret := new(callTrace)
-			if err := json.Unmarshal(res, ret); err != nil {
-				t.Fatalf("failed to unmarshal trace result: %v", err)
+			_, _, want := runCallTracerFixture(t, file, jsTracer)
+
+			nativeTracer, err := newTracer("4byteTracer", new(Context), nil)
+			if err != nil {
+				t.Fatalf("failed to create native tracer: %v", err)
 			}
+			_, _, have := runCallTracerFixture(t, file, nativeTracer)
 
-			if !jsonEqual(ret, test.Result) {
-				// uncomment this for easier debugging
-				//have, _ := json.MarshalIndent(ret, "", " ")
-				//want, _ := json.MarshalIndent(test.Result, "", " ")
-				//t.Fatalf("trace mismatch: \nhave %+v\nwant %+v", string(have), string(want))
-				t.Fatalf("trace mismatch: \nhave %+v\nwant %+v", ret, test.Result)
+			var haveIDs, wantIDs map[string]int
+			if err := json.Unmarshal(have, &haveIDs); err != nil {
+				t.Fatalf("failed to unmarshal native result: %v", err)
+			}
+			if err := json.Unmarshal(want, &wantIDs); err != nil {
+				t.Fatalf("failed to unmarshal JavaScript result: %v", err)
+			}
+			if !reflect.DeepEqual(haveIDs, wantIDs) {
+				t.Fatalf("result mismatch: have %v, want %v", haveIDs, wantIDs)
 			}
 		})
 	}
@@ -0,0 +1,270 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/common/hexutil"
+	"github.com/expanse-org/go-expanse/core/vm"
+)
+
+// VMTrace is the OpenEthereum style trace of the opcodes executed by a single
+// call frame.
+type VMTrace struct {
+	Code hexutil.Bytes  `json:"code"`
+	Ops  []*VMOperation `json:"ops"`
+}
+
+// VMOperation is a single executed opcode, along with the trace of the call
+// frame it entered, if any.
+type VMOperation struct {
+	Cost uint64               `json:"cost"`
+	Ex   *VMExecutedOperation `json:"ex"` // Effects of the opcode, nil if it failed
+	PC   uint64               `json:"pc"`
+	Sub  *VMTrace             `json:"sub"`
+}
+
+// VMExecutedOperation is the effect of an executed opcode.
+type VMExecutedOperation struct {
+	Mem   *VMMemoryDiff  `json:"mem"`
+	Push  []*hexutil.Big `json:"push"`
+	Store *VMStorageDiff `json:"store"`
+	Used  uint64         `json:"used"` // Gas remaining after the opcode
+}
+
+// VMMemoryDiff is a region of memory written by an opcode.
+type VMMemoryDiff struct {
+	Off  uint64        `json:"off"`
+	Data hexutil.Bytes `json:"data"`
+}
+
+// VMStorageDiff is a storage slot written by an opcode.
+type VMStorageDiff struct {
+	Key *hexutil.Big `json:"key"`
+	Val *hexutil.Big `json:"val"`
+}
+
+// vmTraceFrame is a call frame in flight. The effects of an opcode are only
+// known once the next opcode of the frame is about to run, so the last opcode
+// is kept pending until then.
+type vmTraceFrame struct {
+	trace *VMTrace
+
+	pending *VMOperation   // Last opcode executed in the frame, if its effects are unknown yet
+	op      vm.OpCode      // Opcode of the pending operation
+	gas     uint64         // Gas available before the pending operation
+	memOff  int64          // Offset of the memory written by the pending operation
+	memSize int64          // Size of the memory written by the pending operation
+	store   *VMStorageDiff // Storage slot written by the pending operation
+}
+
+// vmTraceTracer is a vm.Tracer collecting an OpenEthereum style VM trace.
+type vmTraceTracer struct {
+	root   *VMTrace
+	frames []*vmTraceFrame // Call frames in flight, indexed by depth-1
+}
+
+// newVMTraceTracer creates a new VM trace collector.
+func newVMTraceTracer() *vmTraceTracer {
+	return new(vmTraceTracer)
+}
+
+// result returns the collected VM trace.
+func (t *vmTraceTracer) result() *VMTrace {
+	return t.root
+}
+
+// CaptureStart implements the vm.Tracer interface to initialize the tracing operation.
+func (t *vmTraceTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	code := input
+	if !create {
+		code = env.StateDB.GetCode(to)
+	}
+	t.root = &VMTrace{Code: common.CopyBytes(code), Ops: []*VMOperation{}}
+	t.frames = []*vmTraceFrame{{trace: t.root}}
+}
+
+// CaptureState implements the vm.Tracer interface to trace a single step of VM execution.
+func (t *vmTraceTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if len(t.frames) == 0 {
+		return
+	}
+	// Close all the frames returned from since the last step
+	for len(t.frames) > depth {
+		t.frames[len(t.frames)-1].settleExit()
+		t.frames = t.frames[:len(t.frames)-1]
+	}
+	frame := t.frames[len(t.frames)-1]
+	if len(t.frames) < depth {
+		// Descended into a new call frame, attach it to the calling opcode
+		sub := &VMTrace{Code: common.CopyBytes(scope.Contract.Code), Ops: []*VMOperation{}}
+		if frame.pending != nil {
+			frame.pending.Sub = sub
+		}
+		frame = &vmTraceFrame{trace: sub}
+		t.frames = append(t.frames, frame)
+	} else {
+		frame.settle(gas, scope)
+	}
+	operation := &VMOperation{Cost: cost, PC: pc}
+	frame.trace.Ops = append(frame.trace.Ops, operation)
+
+	// Failed opcodes have no effects to wait for
+	if err != nil {
+		return
+	}
+	frame.pending, frame.op, frame.gas = operation, op, gas
+	frame.memOff, frame.memSize, frame.store = 0, 0, nil
+
+	stack := scope.Stack
+	switch op {
+	case vm.MSTORE:
+		frame.memOff, frame.memSize = stackInt(stack, 0), 32
+	case vm.MSTORE8:
+		frame.memOff, frame.memSize = stackInt(stack, 0), 1
+	case vm.CALLDATACOPY, vm.CODECOPY, vm.RETURNDATACOPY:
+		frame.memOff, frame.memSize = stackInt(stack, 0), stackInt(stack, 2)
+	case vm.EXTCODECOPY:
+		frame.memOff, frame.memSize = stackInt(stack, 1), stackInt(stack, 3)
+	case vm.CALL, vm.CALLCODE:
+		frame.memOff, frame.memSize = stackInt(stack, 5), stackInt(stack, 6)
+	case vm.DELEGATECALL, vm.STATICCALL:
+		frame.memOff, frame.memSize = stackInt(stack, 4), stackInt(stack, 5)
+	case vm.SSTORE:
+		frame.store = &VMStorageDiff{
+			Key: (*hexutil.Big)(stack.Back(0).ToBig()),
+			Val: (*hexutil.Big)(stack.Back(1).ToBig()),
+		}
+	}
+}
+
+// CaptureFault implements the vm.Tracer interface to trace an execution fault.
+func (t *vmTraceTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	// A reverting opcode still has effects, anything else failed outright
+	if op == vm.REVERT || depth > len(t.frames) {
+		return
+	}
+	t.frames[depth-1].pending = nil
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *vmTraceTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	for len(t.frames) > 0 {
+		t.frames[len(t.frames)-1].settleExit()
+		t.frames = t.frames[:len(t.frames)-1]
+	}
+}
+
+// settle records the effects of the pending opcode, given the gas and the
+// stack after its execution.
+func (f *vmTraceFrame) settle(gas uint64, scope *vm.ScopeContext) {
+	if f.pending == nil {
+		return
+	}
+	ex := &VMExecutedOperation{Push: []*hexutil.Big{}, Store: f.store, Used: gas}
+
+	data := scope.Stack.Data()
+	if n := stackPushes(f.op); n > 0 && n <= len(data) {
+		for _, item := range data[len(data)-n:] {
+			ex.Push = append(ex.Push, (*hexutil.Big)(item.ToBig()))
+		}
+	}
+	if f.memSize > 0 && f.memOff >= 0 && int64(scope.Memory.Len()) >= f.memOff+f.memSize {
+		ex.Mem = &VMMemoryDiff{Off: uint64(f.memOff), Data: scope.Memory.GetCopy(f.memOff, f.memSize)}
+	}
+	f.pending.Ex = ex
+	f.pending = nil
+}
+
+// settleExit records the effects of the last opcode of a frame that returned,
+// which can't have pushed anything or written to memory.
+func (f *vmTraceFrame) settleExit() {
+	if f.pending == nil {
+		return
+	}
+	used := uint64(0)
+	if f.gas > f.pending.Cost {
+		used = f.gas - f.pending.Cost
+	}
+	f.pending.Ex = &VMExecutedOperation{Push: []*hexutil.Big{}, Store: f.store, Used: used}
+	f.pending = nil
+}
+
+// stackInt returns the n-th item from the top of the stack as an integer, or
+// -1 if it doesn't fit into one.
+func stackInt(stack *vm.Stack, n int) int64 {
+	v := stack.Back(n)
+	if !v.IsUint64() || v.Uint64() > 1<<62 {
+		return -1
+	}
+	return int64(v.Uint64())
+}
+
+// stackPushes returns the number of stack items reported as pushed by an
+// opcode. Following OpenEthereum, DUPn and SWAPn report all the items they
+// touched.
+func stackPushes(op vm.OpCode) int {
+	switch {
+	case op >= vm.PUSH1 && op <= vm.PUSH32:
+		return 1
+	case op >= vm.DUP1 && op <= vm.DUP16:
+		return int(op-vm.DUP1) + 2
+	case op >= vm.SWAP1 && op <= vm.SWAP16:
+		return int(op-vm.SWAP1) + 2
+	}
+	switch op {
+	case vm.STOP, vm.POP, vm.MSTORE, vm.MSTORE8, vm.SSTORE, vm.JUMP, vm.JUMPI, vm.JUMPDEST,
+		vm.LOG0, vm.LOG1, vm.LOG2, vm.LOG3, vm.LOG4, vm.CALLDATACOPY, vm.CODECOPY,
+		vm.EXTCODECOPY, vm.RETURNDATACOPY, vm.RETURN, vm.REVERT, vm.SELFDESTRUCT:
+		return 0
+	}
+	return 1
+}
+
+// multiTracer is a vm.Tracer forwarding all the events to multiple tracers.
+type multiTracer []vm.Tracer
+
+// CaptureStart implements the vm.Tracer interface to initialize the tracing operation.
+func (t multiTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	for _, tracer := range t {
+		tracer.CaptureStart(env, from, to, create, input, gas, value)
+	}
+}
+
+// CaptureState implements the vm.Tracer interface to trace a single step of VM execution.
+func (t multiTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	for _, tracer := range t {
+		tracer.CaptureState(env, pc, op, gas, cost, scope, rData, depth, err)
+	}
+}
+
+// CaptureFault implements the vm.Tracer interface to trace an execution fault.
+func (t multiTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	for _, tracer := range t {
+		tracer.CaptureFault(env, pc, op, gas, cost, scope, depth, err)
+	}
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t multiTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	for _, tracer := range t {
+		tracer.CaptureEnd(output, gasUsed, d, err)
+	}
+}
@@ -99,6 +99,11 @@ type AncientWriter interface {
 	// TruncateAncients discards all but the first n ancient data from the ancient store.
 	TruncateAncients(n uint64) error
 
+	// TruncateTail discards the prunable history (block bodies and receipts) of
+	// the ancient data below n. Data may be retained beyond n as it's deleted in
+	// whole files.
+	TruncateTail(n uint64) error
+
 	// Sync flushes all in-memory ancient store data to disk.
 	Sync() error
 }
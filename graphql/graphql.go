@@ -19,10 +19,12 @@ package graphql
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/expanse-org/go-expanse"
@@ -32,7 +34,10 @@ import (
 	"github.com/expanse-org/go-expanse/core/state"
 	"github.com/expanse-org/go-expanse/core/types"
 	"github.com/expanse-org/go-expanse/eth/filters"
+	"github.com/expanse-org/go-expanse/eth/tracers"
+	"github.com/expanse-org/go-expanse/eth/tracers/native"
 	"github.com/expanse-org/go-expanse/internal/ethapi"
+	"github.com/expanse-org/go-expanse/log"
 	"github.com/expanse-org/go-expanse/rpc"
 )
 
@@ -40,6 +45,19 @@ var (
 	errBlockInvariant = errors.New("block objects must be instantiated with at least one of num or hash")
 )
 
+const (
+	// subscriptionBuffer is the number of notifications buffered for a subscriber
+	// before further ones are dropped.
+	subscriptionBuffer = 256
+
+	// maxTraceTimeout is the longest a transaction trace may run, the default
+	// trace timeout of the debug namespace.
+	maxTraceTimeout = 5 * time.Second
+
+	// maxTraceSize is the maximum size of a JSON encoded transaction trace.
+	maxTraceSize = 4 * 1024 * 1024
+)
+
 type Long int64
 
 // ImplementsGraphQLType returns true if Long implements the provided GraphQL type.
@@ -71,6 +89,30 @@ func (b *Long) UnmarshalGraphQL(input interface{}) error {
 	return err
 }
 
+// JSON is an arbitrary JSON value.
+type JSON json.RawMessage
+
+// ImplementsGraphQLType returns true if JSON implements the provided GraphQL type.
+func (j JSON) ImplementsGraphQLType(name string) bool { return name == "JSON" }
+
+// UnmarshalGraphQL unmarshals the provided GraphQL query data.
+func (j *JSON) UnmarshalGraphQL(input interface{}) error {
+	blob, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	*j = blob
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, returning the raw JSON value.
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
 // Account represents an Ethereum account at a particular block.
 type Account struct {
 	backend       ethapi.Backend
@@ -200,6 +242,53 @@ func (t *Transaction) resolve(ctx context.Context) (*types.Transaction, error) {
 	return t.tx, nil
 }
 
+// Trace replays the transaction with the given native tracer, returning its
+// result. The GraphQL endpoint is not access controlled like the debug namespace,
+// so neither JavaScript tracers nor the opcode logger are available, and traces
+// are bounded in execution time and size.
+func (t *Transaction) Trace(ctx context.Context, args struct {
+	Tracer  string
+	Timeout *string
+}) (*JSON, error) {
+	backend, ok := t.backend.(tracers.Backend)
+	if !ok {
+		return nil, errors.New("tracing not supported")
+	}
+	if _, ok := native.Lookup(args.Tracer); !ok {
+		return nil, fmt.Errorf("unknown tracer %q, available: %s", args.Tracer, strings.Join(native.Names(), ", "))
+	}
+	timeout := maxTraceTimeout
+	if args.Timeout != nil {
+		requested, err := time.ParseDuration(*args.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		if requested < timeout {
+			timeout = requested
+		}
+	}
+	if _, err := t.resolve(ctx); err != nil || t.block == nil {
+		return nil, err
+	}
+	timeoutStr := timeout.String()
+	result, err := tracers.NewAPI(backend).TraceTransaction(ctx, t.hash, &tracers.TraceConfig{
+		Tracer:  &args.Tracer,
+		Timeout: &timeoutStr,
+	})
+	if err != nil {
+		return nil, err
+	}
+	blob, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) > maxTraceSize {
+		return nil, fmt.Errorf("trace too large: %d bytes, limit %d", len(blob), maxTraceSize)
+	}
+	trace := JSON(blob)
+	return &trace, nil
+}
+
 func (t *Transaction) Hash(ctx context.Context) common.Hash {
 	return t.hash
 }
@@ -926,6 +1015,59 @@ type CallData struct {
 	Data                 *hexutil.Bytes  // Any data sent with the call.
 }
 
+// AccountOverride encapsulates the state of an account replaced during an
+// invocation of the `call` accessor.
+type AccountOverride struct {
+	Address   common.Address  // The address of the overridden account.
+	Nonce     *hexutil.Uint64 // The nonce replacing the account's one.
+	Code      *hexutil.Bytes  // The code replacing the account's one.
+	Balance   *hexutil.Big    // The balance replacing the account's one.
+	State     *[]StorageSlot  // The slots replacing the entire storage of the account.
+	StateDiff *[]StorageSlot  // The slots replaced in the storage of the account.
+}
+
+// StorageSlot is the value of a single storage slot of an account override.
+type StorageSlot struct {
+	Key   common.Hash
+	Value common.Hash
+}
+
+// stateOverride converts the account overrides of a `call` accessor into the
+// state override applied to the call.
+func stateOverride(overrides *[]AccountOverride) (*ethapi.StateOverride, error) {
+	if overrides == nil {
+		return nil, nil
+	}
+	// storage converts a list of storage slots into a storage map
+	storage := func(slots *[]StorageSlot) *map[common.Hash]common.Hash {
+		if slots == nil {
+			return nil
+		}
+		m := make(map[common.Hash]common.Hash, len(*slots))
+		for _, slot := range *slots {
+			m[slot.Key] = slot.Value
+		}
+		return &m
+	}
+	diff := make(ethapi.StateOverride, len(*overrides))
+	for _, override := range *overrides {
+		if _, ok := diff[override.Address]; ok {
+			return nil, fmt.Errorf("account %s overridden multiple times", override.Address.Hex())
+		}
+		account := ethapi.OverrideAccount{
+			Nonce:     override.Nonce,
+			Code:      override.Code,
+			State:     storage(override.State),
+			StateDiff: storage(override.StateDiff),
+		}
+		if override.Balance != nil {
+			account.Balance = &override.Balance
+		}
+		diff[override.Address] = account
+	}
+	return &diff, nil
+}
+
 // CallResult encapsulates the result of an invocation of the `call` accessor.
 type CallResult struct {
 	data    hexutil.Bytes // The return data from the call
@@ -946,7 +1088,8 @@ func (c *CallResult) Status() Long {
 }
 
 func (b *Block) Call(ctx context.Context, args struct {
-	Data ethapi.TransactionArgs
+	Data      ethapi.TransactionArgs
+	Overrides *[]AccountOverride
 }) (*CallResult, error) {
 	if b.numberOrHash == nil {
 		_, err := b.resolve(ctx)
@@ -954,7 +1097,11 @@ func (b *Block) Call(ctx context.Context, args struct {
 			return nil, err
 		}
 	}
-	result, err := ethapi.DoCall(ctx, b.backend, args.Data, *b.numberOrHash, nil, 5*time.Second, b.backend.RPCGasCap())
+	overrides, err := stateOverride(args.Overrides)
+	if err != nil {
+		return nil, err
+	}
+	result, err := ethapi.DoCall(ctx, b.backend, args.Data, *b.numberOrHash, overrides, 5*time.Second, b.backend.RPCGasCap())
 	if err != nil {
 		return nil, err
 	}
@@ -1021,10 +1168,15 @@ func (p *Pending) Account(ctx context.Context, args struct {
 }
 
 func (p *Pending) Call(ctx context.Context, args struct {
-	Data ethapi.TransactionArgs
+	Data      ethapi.TransactionArgs
+	Overrides *[]AccountOverride
 }) (*CallResult, error) {
+	overrides, err := stateOverride(args.Overrides)
+	if err != nil {
+		return nil, err
+	}
 	pendingBlockNr := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
-	result, err := ethapi.DoCall(ctx, p.backend, args.Data, pendingBlockNr, nil, 5*time.Second, p.backend.RPCGasCap())
+	result, err := ethapi.DoCall(ctx, p.backend, args.Data, pendingBlockNr, overrides, 5*time.Second, p.backend.RPCGasCap())
 	if err != nil {
 		return nil, err
 	}
@@ -1051,6 +1203,7 @@ func (p *Pending) EstimateGas(ctx context.Context, args struct {
 // Resolver is the top-level object in the GraphQL hierarchy.
 type Resolver struct {
 	backend ethapi.Backend
+	events  *filters.EventSystem
 }
 
 func (r *Resolver) Block(ctx context.Context, args struct {
@@ -1147,6 +1300,122 @@ func (r *Resolver) SendRawTransaction(ctx context.Context, args struct{ Data hex
 	return hash, err
 }
 
+// Subscription returns the resolver for the subscription root type. It is kept
+// apart from the query resolver as both roots expose a field named logs.
+func (r *Resolver) Subscription() *SubscriptionResolver {
+	return &SubscriptionResolver{backend: r.backend, events: r.events}
+}
+
+// SubscriptionResolver is the top-level object of the GraphQL subscriptions.
+type SubscriptionResolver struct {
+	backend ethapi.Backend
+	events  *filters.EventSystem
+}
+
+// NewBlocks subscribes to the blocks added to the canonical chain.
+func (r *SubscriptionResolver) NewBlocks(ctx context.Context) <-chan *Block {
+	var (
+		headers = make(chan *types.Header)
+		blocks  = make(chan *Block, subscriptionBuffer)
+		sub     = r.events.SubscribeNewHeads(headers)
+	)
+	go func() {
+		defer close(blocks)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case header := <-headers:
+				numberOrHash := rpc.BlockNumberOrHashWithHash(header.Hash(), false)
+				block := &Block{
+					backend:      r.backend,
+					numberOrHash: &numberOrHash,
+					hash:         header.Hash(),
+					header:       header,
+				}
+				select {
+				case blocks <- block:
+				default:
+					log.Debug("Dropped GraphQL block notification", "number", header.Number)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return blocks
+}
+
+// Logs subscribes to the logs matching the filter criteria as they are
+// included in the canonical chain.
+func (r *SubscriptionResolver) Logs(ctx context.Context, args struct{ Filter BlockFilterCriteria }) (<-chan *Log, error) {
+	var crit ethereum.FilterQuery
+	if args.Filter.Addresses != nil {
+		crit.Addresses = *args.Filter.Addresses
+	}
+	if args.Filter.Topics != nil {
+		crit.Topics = *args.Filter.Topics
+	}
+	matches := make(chan []*types.Log)
+	sub, err := r.events.SubscribeLogs(crit, matches)
+	if err != nil {
+		return nil, err
+	}
+	logs := make(chan *Log, subscriptionBuffer)
+	go func() {
+		defer close(logs)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case matched := <-matches:
+				for _, l := range matched {
+					if l.Removed {
+						continue
+					}
+					select {
+					case logs <- &Log{backend: r.backend, transaction: &Transaction{backend: r.backend, hash: l.TxHash}, log: l}:
+					default:
+						log.Debug("Dropped GraphQL log notification", "tx", l.TxHash, "index", l.Index)
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return logs, nil
+}
+
+// PendingTransactions subscribes to the transactions entering the transaction pool.
+func (r *SubscriptionResolver) PendingTransactions(ctx context.Context) <-chan *Transaction {
+	var (
+		hashes = make(chan []common.Hash)
+		txs    = make(chan *Transaction, subscriptionBuffer)
+		sub    = r.events.SubscribePendingTxs(hashes)
+	)
+	go func() {
+		defer close(txs)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case pending := <-hashes:
+				for _, hash := range pending {
+					select {
+					case txs <- &Transaction{backend: r.backend, hash: hash}:
+					default:
+						log.Debug("Dropped GraphQL transaction notification", "hash", hash)
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return txs
+}
+
 // FilterCriteria encapsulates the arguments to `logs` on the root resolver object.
 type FilterCriteria struct {
 	FromBlock *hexutil.Uint64   // beginning of the queried range, nil means genesis block
@@ -1209,10 +1478,151 @@ func (r *Resolver) MaxPriorityFeePerGas(ctx context.Context) (hexutil.Big, error
 	return (hexutil.Big)(*tipcap), nil
 }
 
+func (r *Resolver) FeeHistory(ctx context.Context, args struct {
+	BlockCount        Long
+	LastBlock         *Long
+	RewardPercentiles *[]float64
+}) (*FeeHistory, error) {
+	lastBlock := rpc.LatestBlockNumber
+	if args.LastBlock != nil {
+		lastBlock = rpc.BlockNumber(*args.LastBlock)
+	}
+	var percentiles []float64
+	if args.RewardPercentiles != nil {
+		percentiles = *args.RewardPercentiles
+	}
+	oldest, reward, baseFee, gasUsed, err := r.backend.FeeHistory(ctx, int(args.BlockCount), lastBlock, percentiles)
+	if err != nil {
+		return nil, err
+	}
+	return &FeeHistory{oldest: oldest, reward: reward, baseFee: baseFee, gasUsed: gasUsed}, nil
+}
+
 func (r *Resolver) ChainID(ctx context.Context) (hexutil.Big, error) {
 	return hexutil.Big(*r.backend.ChainConfig().ChainID), nil
 }
 
+func (r *Resolver) ForkSchedule(ctx context.Context) (*ForkSchedule, error) {
+	genesis, err := r.backend.HeaderByNumber(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	config := r.backend.ChainConfig()
+	return &ForkSchedule{ethapi.NewForkSchedule(config, genesis.Hash(), r.backend.CurrentHeader().Number.Uint64())}, nil
+}
+
+// ForkSchedule represents the fork activation status returned from the
+// `forkSchedule` accessor.
+type ForkSchedule struct {
+	schedule *ethapi.ForkSchedule
+}
+
+func (s *ForkSchedule) Genesis() common.Hash {
+	return s.schedule.Genesis
+}
+
+func (s *ForkSchedule) Head() Long {
+	return Long(s.schedule.Head)
+}
+
+func (s *ForkSchedule) ForkID() *ForkID {
+	return &ForkID{s.schedule.ForkID}
+}
+
+func (s *ForkSchedule) Forks() []*Fork {
+	forks := make([]*Fork, len(s.schedule.Forks))
+	for i, status := range s.schedule.Forks {
+		forks[i] = &Fork{status}
+	}
+	return forks
+}
+
+// Fork represents the activation status of a single fork.
+type Fork struct {
+	status *ethapi.ForkStatus
+}
+
+func (f *Fork) Name() string {
+	return f.status.Name
+}
+
+func (f *Fork) Block() *Long {
+	if f.status.Block == nil {
+		return nil
+	}
+	block := Long(f.status.Block.ToInt().Uint64())
+	return &block
+}
+
+func (f *Fork) ForkID() *ForkID {
+	if f.status.ForkID == nil {
+		return nil
+	}
+	return &ForkID{f.status.ForkID}
+}
+
+func (f *Fork) Active() bool {
+	return f.status.Active
+}
+
+func (f *Fork) Eips() []string {
+	return f.status.EIPs
+}
+
+// ForkID represents an EIP-2124 fork identifier.
+type ForkID struct {
+	id *ethapi.ForkID
+}
+
+func (id *ForkID) Hash() hexutil.Bytes {
+	return id.id.Hash
+}
+
+func (id *ForkID) Next() Long {
+	return Long(id.id.Next)
+}
+
+// FeeHistory represents the fee history returned from the `feeHistory` accessor.
+type FeeHistory struct {
+	oldest  *big.Int
+	reward  [][]*big.Int
+	baseFee []*big.Int
+	gasUsed []float64
+}
+
+func (h *FeeHistory) OldestBlock() Long {
+	return Long(h.oldest.Int64())
+}
+
+func (h *FeeHistory) Reward() *[][]hexutil.Big {
+	if h.reward == nil {
+		return nil
+	}
+	reward := make([][]hexutil.Big, len(h.reward))
+	for i, fees := range h.reward {
+		reward[i] = make([]hexutil.Big, len(fees))
+		for j, fee := range fees {
+			reward[i][j] = hexutil.Big(*fee)
+		}
+	}
+	return &reward
+}
+
+func (h *FeeHistory) BaseFeePerGas() []hexutil.Big {
+	baseFee := make([]hexutil.Big, len(h.baseFee))
+	for i, fee := range h.baseFee {
+		baseFee[i] = hexutil.Big(*fee)
+	}
+	return baseFee
+}
+
+func (h *FeeHistory) GasUsedRatio() []float64 {
+	if h.gasUsed == nil {
+		return []float64{}
+	}
+	return h.gasUsed
+}
+
 // SyncState represents the synchronisation status returned from the `syncing` accessor.
 type SyncState struct {
 	progress ethereum.SyncProgress
@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 	"math/big"
 	"net/http"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -33,9 +34,11 @@ import (
 	"github.com/expanse-org/go-expanse/crypto"
 	"github.com/expanse-org/go-expanse/eth"
 	"github.com/expanse-org/go-expanse/eth/ethconfig"
+	"github.com/expanse-org/go-expanse/eth/filters"
 	"github.com/expanse-org/go-expanse/node"
 	"github.com/expanse-org/go-expanse/params"
 
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -52,7 +55,7 @@ func TestBuildSchema(t *testing.T) {
 		t.Fatalf("could not create new node: %v", err)
 	}
 	// Make sure the schema can be parsed and matched up to the object model.
-	if err := newHandler(stack, nil, []string{}, []string{}); err != nil {
+	if err := newHandler(stack, nil, nil, []string{}, []string{}); err != nil {
 		t.Errorf("Could not construct GraphQL handler: %v", err)
 	}
 }
@@ -143,6 +146,12 @@ func TestGraphQLBlockSerialization(t *testing.T) {
 			want: `{"data":{"block":{"number":10,"call":{"data":"0x","status":1}}}}`,
 			code: 200,
 		},
+		// should report the fork activation status at the chain head
+		{
+			body: `{"query": "{forkSchedule{head forkID{next} forks{name block active}}}"}`,
+			want: `{"data":{"forkSchedule":{"head":10,"forkID":{"next":0},"forks":[{"name":"homestead","block":0,"active":true},{"name":"daoFork","block":null,"active":false},{"name":"eip150","block":0,"active":true},{"name":"eip155","block":0,"active":true},{"name":"eip158","block":0,"active":true},{"name":"byzantium","block":0,"active":true},{"name":"constantinople","block":0,"active":true},{"name":"petersburg","block":0,"active":true},{"name":"istanbul","block":0,"active":true},{"name":"muirGlacier","block":null,"active":false},{"name":"berlin","block":0,"active":true},{"name":"phoenix","block":0,"active":true},{"name":"london","block":0,"active":true},{"name":"catalyst","block":null,"active":false}]}}}`,
+			code: 200,
+		},
 	} {
 		resp, err := http.Post(fmt.Sprintf("%s/graphql", stack.HTTPEndpoint()), "application/json", strings.NewReader(tt.body))
 		if err != nil {
@@ -179,6 +188,30 @@ func TestGraphQLBlockSerializationEIP2718(t *testing.T) {
 			want: `{"data":{"block":{"number":1,"transactions":[{"from":{"address":"0x71562b71999873db5b286df957af199ec94617f7"},"to":{"address":"0x0000000000000000000000000000000000000dad"},"value":"0x64","hash":"0xd864c9d7d37fade6b70164740540c06dd58bb9c3f6b46101908d6339db6a6a7b","type":0,"accessList":[],"index":0},{"from":{"address":"0x71562b71999873db5b286df957af199ec94617f7"},"to":{"address":"0x0000000000000000000000000000000000000dad"},"value":"0x32","hash":"0x19b35f8187b4e15fb59a9af469dca5dfa3cd363c11d372058c12f6482477b474","type":1,"accessList":[{"address":"0x0000000000000000000000000000000000000dad","storageKeys":["0x0000000000000000000000000000000000000000000000000000000000000000"]}],"index":1}]}}}`,
 			code: 200,
 		},
+		// should report the fee history of the chain
+		{
+			body: `{"query": "{feeHistory(blockCount: 2, rewardPercentiles: [50]){oldestBlock reward baseFeePerGas gasUsedRatio}}"}`,
+			want: `{"data":{"feeHistory":{"oldestBlock":0,"reward":[["0x0"],["0x7735940"]],"baseFeePerGas":["0x3b9aca00","0x342770c0","0x2db1cf0e"],"gasUsedRatio":[0,0.004583304347826087]}}}`,
+			code: 200,
+		},
+		// should trace the transactions with a native tracer
+		{
+			body: `{"query": "{block {transactions { trace(tracer: \"4byteTracer\", timeout: \"1m\") }}}"}`,
+			want: `{"data":{"block":{"transactions":[{"trace":{}},{"trace":{}}]}}}`,
+			code: 200,
+		},
+		// should refuse JavaScript tracers
+		{
+			body: `{"query": "{block {transactionAt(index: 0) { trace(tracer: \"{result: function() { return 1 }}\") }}}"}`,
+			want: `{"errors":[{"message":"unknown tracer \"{result: function() { return 1 }}\", available: 4byteTracer, callTracer, prestateTracer","path":["block","transactionAt","trace"]}],"data":{"block":{"transactionAt":{"trace":null}}}}`,
+			code: 400,
+		},
+		// should apply code and storage overrides to calls
+		{
+			body: `{"query": "{block {call(data: {to: \"0x0000000000000000000000000000000000000dad\"}, overrides: [{address: \"0x0000000000000000000000000000000000000dad\", code: \"0x60005460005260206000f3\", stateDiff: [{key: \"0x0000000000000000000000000000000000000000000000000000000000000000\", value: \"0x000000000000000000000000000000000000000000000000000000000000002a\"}]}]){data status}}}"}`,
+			want: `{"data":{"block":{"call":{"data":"0x000000000000000000000000000000000000000000000000000000000000002a","status":1}}}}`,
+			code: 200,
+		},
 	} {
 		resp, err := http.Post(fmt.Sprintf("%s/graphql", stack.HTTPEndpoint()), "application/json", strings.NewReader(tt.body))
 		if err != nil {
@@ -213,6 +246,114 @@ func TestGraphQLHTTPOnSamePort_GQLRequest_Unsuccessful(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
 
+// Tests that subscriptions and plain operations are served over websocket
+// connections using the graphql-ws protocol.
+func TestGraphQLSubscriptions(t *testing.T) {
+	stack, err := node.New(&node.Config{HTTPHost: "127.0.0.1", HTTPPort: 0})
+	if err != nil {
+		t.Fatalf("could not create node: %v", err)
+	}
+	defer stack.Close()
+	ethBackend := createGQLService(t, stack)
+	if err := stack.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	conn, read := dialGQLWebsocket(t, stack)
+	defer conn.Close()
+
+	// Subscribe to new blocks and run a plain query meanwhile
+	conn.WriteJSON(&wsMessage{ID: "1", Type: gqlStart, Payload: []byte(`{"query":"subscription { newBlocks { number } }"}`)})
+	conn.WriteJSON(&wsMessage{ID: "2", Type: gqlStart, Payload: []byte(`{"query":"{ block { number } }"}`)})
+
+	if msg := read(); msg.ID != "2" || msg.Type != gqlData || string(msg.Payload) != `{"data":{"block":{"number":10}}}` {
+		t.Fatalf("invalid query result: %+v, payload %s", msg, msg.Payload)
+	}
+	if msg := read(); msg.ID != "2" || msg.Type != gqlComplete {
+		t.Fatalf("query not completed: %+v", msg)
+	}
+	// Import a new block and wait for its notification
+	chain, _ := core.GenerateChain(params.AllEthashProtocolChanges, ethBackend.BlockChain().CurrentBlock(),
+		ethash.NewFaker(), ethBackend.ChainDb(), 1, func(i int, gen *core.BlockGen) {})
+	if _, err := ethBackend.BlockChain().InsertChain(chain); err != nil {
+		t.Fatalf("could not import block: %v", err)
+	}
+	if msg := read(); msg.ID != "1" || msg.Type != gqlData || string(msg.Payload) != `{"data":{"newBlocks":{"number":11}}}` {
+		t.Fatalf("invalid block notification: %+v, payload %s", msg, msg.Payload)
+	}
+	// Stop the subscription
+	conn.WriteJSON(&wsMessage{ID: "1", Type: gqlStop})
+	if msg := read(); msg.ID != "1" || msg.Type != gqlComplete {
+		t.Fatalf("subscription not completed: %+v", msg)
+	}
+	// Subscribe to logs, which shares its name with the logs query
+	conn.WriteJSON(&wsMessage{ID: "3", Type: gqlStart, Payload: []byte(`{"query":"subscription { logs(filter: {}) { index } }"}`)})
+	conn.WriteJSON(&wsMessage{ID: "3", Type: gqlStop})
+	if msg := read(); msg.ID != "3" || msg.Type != gqlComplete {
+		t.Fatalf("log subscription not completed: %+v, payload %s", msg, msg.Payload)
+	}
+}
+
+// Tests that a websocket connection cannot run more than the allowed number of
+// operations concurrently.
+func TestGraphQLSubscriptionLimit(t *testing.T) {
+	stack, err := node.New(&node.Config{HTTPHost: "127.0.0.1", HTTPPort: 0})
+	if err != nil {
+		t.Fatalf("could not create node: %v", err)
+	}
+	defer stack.Close()
+	createGQLService(t, stack)
+	if err := stack.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	conn, read := dialGQLWebsocket(t, stack)
+	defer conn.Close()
+
+	for i := 0; i < wsMaxOperations; i++ {
+		conn.WriteJSON(&wsMessage{ID: strconv.Itoa(i), Type: gqlStart, Payload: []byte(`{"query":"subscription { newBlocks { number } }"}`)})
+	}
+	conn.WriteJSON(&wsMessage{ID: "overflow", Type: gqlStart, Payload: []byte(`{"query":"subscription { newBlocks { number } }"}`)})
+	if msg := read(); msg.ID != "overflow" || msg.Type != gqlError {
+		t.Fatalf("excess operation not rejected: %+v, payload %s", msg, msg.Payload)
+	}
+	// Stopping an operation should make room for a new one
+	conn.WriteJSON(&wsMessage{ID: "0", Type: gqlStop})
+	if msg := read(); msg.ID != "0" || msg.Type != gqlComplete {
+		t.Fatalf("subscription not completed: %+v", msg)
+	}
+	conn.WriteJSON(&wsMessage{ID: "next", Type: gqlStart, Payload: []byte(`{"query":"subscription { newBlocks { number } }"}`)})
+	conn.WriteJSON(&wsMessage{ID: "next", Type: gqlStop})
+	if msg := read(); msg.ID != "next" || msg.Type != gqlComplete {
+		t.Fatalf("subscription not accepted after stop: %+v, payload %s", msg, msg.Payload)
+	}
+}
+
+// dialGQLWebsocket opens an initialized graphql-ws connection to the node and
+// returns it along with a function reading the next non keep alive message.
+func dialGQLWebsocket(t *testing.T, stack *node.Node) (*websocket.Conn, func() *wsMessage) {
+	dialer := websocket.Dialer{Subprotocols: []string{wsProtocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(stack.HTTPEndpoint(), "http")+"/graphql", nil)
+	if err != nil {
+		t.Fatalf("could not dial graphql websocket: %v", err)
+	}
+	read := func() *wsMessage {
+		for {
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			msg := new(wsMessage)
+			if err := conn.ReadJSON(msg); err != nil {
+				t.Fatalf("could not read message: %v", err)
+			}
+			if msg.Type != gqlConnectionKeepAlive {
+				return msg
+			}
+		}
+	}
+	conn.WriteJSON(&wsMessage{Type: gqlConnectionInit})
+	if msg := read(); msg.Type != gqlConnectionAck {
+		t.Fatalf("connection not acknowledged: %+v", msg)
+	}
+	return conn, read
+}
+
 func createNode(t *testing.T, gqlEnabled bool, txEnabled bool) *node.Node {
 	stack, err := node.New(&node.Config{
 		HTTPHost: "127.0.0.1",
@@ -234,7 +375,7 @@ func createNode(t *testing.T, gqlEnabled bool, txEnabled bool) *node.Node {
 	return stack
 }
 
-func createGQLService(t *testing.T, stack *node.Node) {
+func createGQLService(t *testing.T, stack *node.Node) *eth.Ethereum {
 	// create backend
 	ethConf := &ethconfig.Config{
 		Genesis: &core.Genesis{
@@ -265,10 +406,11 @@ func createGQLService(t *testing.T, stack *node.Node) {
 		t.Fatalf("could not create import blocks: %v", err)
 	}
 	// create gql service
-	err = New(stack, ethBackend.APIBackend, []string{}, []string{})
+	err = New(stack, ethBackend.APIBackend, filters.NewEventSystem(ethBackend.APIBackend, false), []string{}, []string{})
 	if err != nil {
 		t.Fatalf("could not create graphql service: %v", err)
 	}
+	return ethBackend
 }
 
 func createGQLServiceWithTransactions(t *testing.T, stack *node.Node) {
@@ -302,6 +444,7 @@ func createGQLServiceWithTransactions(t *testing.T, stack *node.Node) {
 		Ethash: ethash.Config{
 			PowMode: ethash.ModeFake,
 		},
+		GPO:                     ethconfig.Defaults.GPO,
 		NetworkId:               1337,
 		TrieCleanCache:          5,
 		TrieCleanCacheJournal:   "triecache",
@@ -350,7 +493,7 @@ func createGQLServiceWithTransactions(t *testing.T, stack *node.Node) {
 		t.Fatalf("could not create import blocks: %v", err)
 	}
 	// create gql service
-	err = New(stack, ethBackend.APIBackend, []string{}, []string{})
+	err = New(stack, ethBackend.APIBackend, filters.NewEventSystem(ethBackend.APIBackend, false), []string{}, []string{})
 	if err != nil {
 		t.Fatalf("could not create graphql service: %v", err)
 	}
@@ -30,10 +30,13 @@ const schema string = `
     scalar BigInt
     # Long is a 64 bit unsigned integer.
     scalar Long
+    # JSON is an arbitrary JSON value.
+    scalar JSON
 
     schema {
         query: Query
         mutation: Mutation
+        subscription: Subscription
     }
 
     # Account is an Ethereum account at a particular block.
@@ -138,6 +141,11 @@ const schema string = `
         #Envelope transaction support
         type: Int
         accessList: [AccessTuple!]
+        # Trace replays the transaction and returns the result of the given
+        # native tracer (callTracer, prestateTracer or 4byteTracer). The timeout
+        # limits the execution time of the trace, up to 5s. This field will be
+        # null if the transaction has not yet been mined.
+        trace(tracer: String!, timeout: String): JSON
     }
 
     # BlockFilterCriteria encapsulates log filter criteria for a filter applied
@@ -226,8 +234,9 @@ const schema string = `
         logs(filter: BlockFilterCriteria!): [Log!]!
         # Account fetches an Ethereum account at the current block's state.
         account(address: Address!): Account!
-        # Call executes a local call operation at the current block's state.
-        call(data: CallData!): CallResult
+        # Call executes a local call operation at the current block's state,
+        # with the given account overrides applied to it.
+        call(data: CallData!, overrides: [AccountOverride!]): CallResult
         # EstimateGas estimates the amount of gas that will be required for
         # successful execution of a transaction at the current block's state.
         estimateGas(data: CallData!): Long!
@@ -254,6 +263,31 @@ const schema string = `
         data: Bytes
     }
 
+    # AccountOverride replaces the state of an account during a local call
+    # operation. All fields but the address are optional.
+    input AccountOverride {
+        # Address is the address of the overridden account.
+        address: Address!
+        # Nonce replaces the nonce of the account.
+        nonce: Long
+        # Code replaces the code of the account.
+        code: Bytes
+        # Balance replaces the balance of the account.
+        balance: BigInt
+        # State replaces the entire storage of the account with the given slots.
+        state: [StorageSlot!]
+        # StateDiff replaces the given slots, keeping the rest of the storage.
+        stateDiff: [StorageSlot!]
+    }
+
+    # StorageSlot is the value of a single storage slot.
+    input StorageSlot {
+        # Key is the key of the storage slot.
+        key: Bytes32!
+        # Value is the value of the storage slot.
+        value: Bytes32!
+    }
+
     # CallResult is the result of a local call operation.
     type CallResult {
         # Data is the return data of the called contract.
@@ -313,13 +347,67 @@ const schema string = `
       transactions: [Transaction!]
       # Account fetches an Ethereum account for the pending state.
       account(address: Address!): Account!
-      # Call executes a local call operation for the pending state.
-      call(data: CallData!): CallResult
+      # Call executes a local call operation for the pending state, with the
+      # given account overrides applied to it.
+      call(data: CallData!, overrides: [AccountOverride!]): CallResult
       # EstimateGas estimates the amount of gas that will be required for
       # successful execution of a transaction for the pending state.
       estimateGas(data: CallData!): Long!
     }
 
+    # FeeHistory is the history of the base fees, gas usage and priority fees
+    # of a range of blocks.
+    type FeeHistory {
+        # OldestBlock is the number of the first block of the range.
+        oldestBlock: Long!
+        # Reward is the list of the effective priority fees per gas at the
+        # requested percentiles for every block of the range. This will be null
+        # if no percentiles were requested.
+        reward: [[BigInt!]!]
+        # BaseFeePerGas is the list of the base fees per gas of every block of
+        # the range, followed by the one of the next block. This will be empty
+        # before EIP-1559.
+        baseFeePerGas: [BigInt!]!
+        # GasUsedRatio is the list of the gas used to gas limit ratios of every
+        # block of the range.
+        gasUsedRatio: [Float!]!
+    }
+
+    # ForkID is an EIP-2124 fork identifier.
+    type ForkID {
+        # Hash is the CRC32 checksum of the genesis block and passed fork block numbers.
+        hash: Bytes!
+        # Next is the block number of the next upcoming fork, or 0 if no forks are known.
+        next: Long!
+    }
+
+    # Fork is a protocol upgrade of the chain configuration.
+    type Fork {
+        # Name is the name of the fork in the chain configuration.
+        name: String!
+        # Block is the activation block of the fork, or null if not scheduled.
+        block: Long
+        # ForkID is the fork identifier from the activation block on, or null
+        # if the fork is not scheduled.
+        forkID: ForkID
+        # Active is true if the fork is active at the chain head.
+        active: Boolean!
+        # EIPs is the list of protocol changes enabled by the fork.
+        eips: [String!]!
+    }
+
+    # ForkSchedule is the activation status of all the forks of the chain.
+    type ForkSchedule {
+        # Genesis is the hash of the genesis block.
+        genesis: Bytes32!
+        # Head is the number of the chain head the status is reported at.
+        head: Long!
+        # ForkID is the fork identifier at the chain head.
+        forkID: ForkID!
+        # Forks is the list of all the forks in activation order.
+        forks: [Fork!]!
+    }
+
     type Query {
         # Block fetches an Ethereum block by number or by hash. If neither is
         # supplied, the most recent known block is returned.
@@ -341,12 +429,30 @@ const schema string = `
         maxPriorityFeePerGas: BigInt!
         # Syncing returns information on the current synchronisation state.
         syncing: SyncState
+        # FeeHistory returns the fee history of the blockCount blocks up to and
+        # including lastBlock, which defaults to the most recent known block.
+        # The priority fees at the given percentiles are reported per block.
+        feeHistory(blockCount: Long!, lastBlock: Long, rewardPercentiles: [Float!]): FeeHistory!
         # ChainID returns the current chain ID for transaction replay protection.
         chainID: BigInt!
+        # ForkSchedule returns the activation status of all the forks of the
+        # chain configuration at the chain head.
+        forkSchedule: ForkSchedule!
     }
 
     type Mutation {
         # SendRawTransaction sends an RLP-encoded transaction to the network.
         sendRawTransaction(data: Bytes!): Bytes32!
     }
+
+    type Subscription {
+        # NewBlocks emits every block added to the canonical chain.
+        newBlocks: Block!
+        # Logs emits the log entries matching the provided filter as they are
+        # included in the canonical chain. Logs reverted by a chain reorganisation
+        # are not emitted again.
+        logs(filter: BlockFilterCriteria!): Log!
+        # PendingTransactions emits every transaction entering the transaction pool.
+        pendingTransactions: Transaction!
+    }
 `
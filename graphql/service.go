@@ -20,16 +20,23 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/expanse-org/go-expanse/eth/filters"
 	"github.com/expanse-org/go-expanse/internal/ethapi"
 	"github.com/expanse-org/go-expanse/node"
+	"github.com/gorilla/websocket"
 	"github.com/graph-gophers/graphql-go"
 )
 
 type handler struct {
 	Schema *graphql.Schema
+	ws     *wsHandler // Handler of the subscriptions over websocket connections
 }
 
 func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		h.ws.ServeHTTP(w, r)
+		return
+	}
 	var params struct {
 		Query         string                 `json:"query"`
 		OperationName string                 `json:"operationName"`
@@ -55,26 +62,31 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// New constructs a new GraphQL service instance.
-func New(stack *node.Node, backend ethapi.Backend, cors, vhosts []string) error {
+// New constructs a new GraphQL service instance. Subscriptions are served from
+// the events of the given event system.
+func New(stack *node.Node, backend ethapi.Backend, events *filters.EventSystem, cors, vhosts []string) error {
 	if backend == nil {
 		panic("missing backend")
 	}
+	if events == nil {
+		panic("missing event system")
+	}
 	// check if http server with given endpoint exists and enable graphQL on it
-	return newHandler(stack, backend, cors, vhosts)
+	return newHandler(stack, backend, events, cors, vhosts)
 }
 
 // newHandler returns a new `http.Handler` that will answer GraphQL queries.
-// It additionally exports an interactive query browser on the / endpoint.
-func newHandler(stack *node.Node, backend ethapi.Backend, cors, vhosts []string) error {
-	q := Resolver{backend}
+// It additionally exports an interactive query browser on the / endpoint and
+// serves subscriptions over websocket connections using the graphql-ws protocol.
+func newHandler(stack *node.Node, backend ethapi.Backend, events *filters.EventSystem, cors, vhosts []string) error {
+	q := Resolver{backend: backend, events: events}
 
 	s, err := graphql.ParseSchema(schema, &q)
 	if err != nil {
 		return err
 	}
-	h := handler{Schema: s}
-	handler := node.NewHTTPHandlerStack(h, cors, vhosts)
+	h := handler{Schema: s, ws: newWSHandler(s, cors)}
+	handler := node.NewHTTPHandlerStack(h, cors, vhosts, nil)
 
 	stack.RegisterHandler("GraphQL UI", "/graphql/ui", GraphiQL{})
 	stack.RegisterHandler("GraphQL", "/graphql", handler)
@@ -0,0 +1,292 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/expanse-org/go-expanse/log"
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+)
+
+const (
+	wsProtocol          = "graphql-ws" // Apollo subscriptions-transport-ws protocol
+	wsReadBuffer        = 1024
+	wsWriteBuffer       = 1024
+	wsWriteTimeout      = 10 * time.Second
+	wsKeepAliveInterval = 30 * time.Second
+	wsMessageSizeLimit  = 1024 * 1024
+	wsMaxOperations     = 32 // Maximum number of concurrently running operations per connection
+)
+
+// Message types of the graphql-ws protocol.
+const (
+	gqlConnectionInit      = "connection_init"      // Client -> Server
+	gqlConnectionAck       = "connection_ack"       // Server -> Client
+	gqlConnectionError     = "connection_error"     // Server -> Client
+	gqlConnectionKeepAlive = "ka"                   // Server -> Client
+	gqlConnectionTerminate = "connection_terminate" // Client -> Server
+	gqlStart               = "start"                // Client -> Server
+	gqlData                = "data"                 // Server -> Client
+	gqlError               = "error"                // Server -> Client
+	gqlComplete            = "complete"             // Server -> Client
+	gqlStop                = "stop"                 // Client -> Server
+)
+
+// wsMessage is a message of the graphql-ws protocol.
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsOperation is the payload of a start message.
+type wsOperation struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// wsHandler serves GraphQL operations, most notably subscriptions, over
+// websocket connections using the graphql-ws protocol.
+type wsHandler struct {
+	schema   *graphql.Schema
+	upgrader websocket.Upgrader
+}
+
+// newWSHandler creates a graphql-ws handler accepting connections from the given
+// origins. Without any origins configured, only same-origin browser connections
+// are accepted.
+func newWSHandler(schema *graphql.Schema, origins []string) *wsHandler {
+	return &wsHandler{
+		schema: schema,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  wsReadBuffer,
+			WriteBufferSize: wsWriteBuffer,
+			Subprotocols:    []string{wsProtocol},
+			CheckOrigin:     wsOriginValidator(origins),
+		},
+	}
+}
+
+// wsOriginValidator returns a function that verifies the origin of a websocket
+// handshake against the allowed origins.
+func wsOriginValidator(origins []string) func(r *http.Request) bool {
+	allowed := make(map[string]bool)
+	for _, origin := range origins {
+		allowed[strings.ToLower(origin)] = true
+	}
+	return func(r *http.Request) bool {
+		// Non-browser clients don't set the origin, nothing to protect against
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if allowed["*"] || allowed[strings.ToLower(origin)] {
+			return true
+		}
+		if u, err := url.Parse(origin); err == nil && len(allowed) == 0 && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		log.Warn("Rejected GraphQL websocket connection", "origin", origin)
+		return false
+	}
+}
+
+func (h *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Debug("GraphQL websocket upgrade failed", "err", err)
+		return
+	}
+	if conn.Subprotocol() != wsProtocol {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseProtocolError, "unsupported subprotocol"), time.Now().Add(wsWriteTimeout))
+		conn.Close()
+		return
+	}
+	newWSConn(h.schema, conn).serve()
+}
+
+// wsConn is a single graphql-ws connection running any number of operations.
+type wsConn struct {
+	schema *graphql.Schema
+	conn   *websocket.Conn
+
+	ops    map[string]context.CancelFunc // Cancel functions of the running operations
+	opLock sync.Mutex                    // Lock protecting the running operations
+	opWG   sync.WaitGroup                // Wait group for the running operations to finish
+
+	writeLock sync.Mutex // Lock serializing the writes to the connection
+}
+
+func newWSConn(schema *graphql.Schema, conn *websocket.Conn) *wsConn {
+	return &wsConn{
+		schema: schema,
+		conn:   conn,
+		ops:    make(map[string]context.CancelFunc),
+	}
+}
+
+// serve reads and handles the client messages until the connection is closed
+// or terminated, tearing down all the running operations afterwards.
+func (c *wsConn) serve() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		c.conn.Close()
+		c.opWG.Wait()
+	}()
+	c.conn.SetReadLimit(wsMessageSizeLimit)
+
+	initialized := false
+	for {
+		var msg wsMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			log.Trace("GraphQL websocket connection closed", "err", err)
+			return
+		}
+		switch msg.Type {
+		case gqlConnectionInit:
+			if initialized {
+				continue
+			}
+			initialized = true
+			if err := c.write(&wsMessage{Type: gqlConnectionAck}); err != nil {
+				return
+			}
+			c.opWG.Add(1)
+			go c.keepAlive(ctx)
+
+		case gqlStart:
+			if !initialized {
+				c.write(&wsMessage{Type: gqlConnectionError, Payload: errorPayload("connection not initialized")})
+				return
+			}
+			c.start(ctx, &msg)
+
+		case gqlStop:
+			c.opLock.Lock()
+			if stop, ok := c.ops[msg.ID]; ok {
+				stop()
+			}
+			c.opLock.Unlock()
+
+		case gqlConnectionTerminate:
+			return
+
+		default:
+			c.write(&wsMessage{ID: msg.ID, Type: gqlError, Payload: errorPayload("unknown message type " + msg.Type)})
+		}
+	}
+}
+
+// start begins executing an operation, streaming its results to the client.
+func (c *wsConn) start(ctx context.Context, msg *wsMessage) {
+	var op wsOperation
+	if err := json.Unmarshal(msg.Payload, &op); err != nil {
+		c.write(&wsMessage{ID: msg.ID, Type: gqlError, Payload: errorPayload("invalid operation: " + err.Error())})
+		return
+	}
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+
+	if _, ok := c.ops[msg.ID]; ok || msg.ID == "" {
+		c.write(&wsMessage{ID: msg.ID, Type: gqlError, Payload: errorPayload("invalid or duplicate operation id")})
+		return
+	}
+	if len(c.ops) >= wsMaxOperations {
+		c.write(&wsMessage{ID: msg.ID, Type: gqlError, Payload: errorPayload("too many concurrent operations")})
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	results, err := c.schema.Subscribe(ctx, op.Query, op.OperationName, op.Variables)
+	if err != nil {
+		cancel()
+		c.write(&wsMessage{ID: msg.ID, Type: gqlError, Payload: errorPayload(err.Error())})
+		return
+	}
+	c.ops[msg.ID] = cancel
+
+	c.opWG.Add(1)
+	go c.run(msg.ID, results, cancel)
+}
+
+// run forwards the results of an operation to the client until the operation
+// completes or is stopped.
+func (c *wsConn) run(id string, results <-chan interface{}, cancel context.CancelFunc) {
+	defer c.opWG.Done()
+
+	for result := range results {
+		payload, err := json.Marshal(result)
+		if err != nil {
+			log.Warn("Failed to encode GraphQL result", "err", err)
+			continue
+		}
+		if err := c.write(&wsMessage{ID: id, Type: gqlData, Payload: payload}); err != nil {
+			// Connection broken, drain the results until the operation is torn down
+			cancel()
+		}
+	}
+	c.opLock.Lock()
+	delete(c.ops, id)
+	c.opLock.Unlock()
+	cancel()
+
+	c.write(&wsMessage{ID: id, Type: gqlComplete})
+}
+
+// keepAlive periodically sends keep alive messages to the client until the
+// connection is closed.
+func (c *wsConn) keepAlive(ctx context.Context) {
+	defer c.opWG.Done()
+
+	ticker := time.NewTicker(wsKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.write(&wsMessage{Type: gqlConnectionKeepAlive}); err != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// write sends a message to the client.
+func (c *wsConn) write(msg *wsMessage) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.conn.WriteJSON(msg)
+}
+
+// errorPayload creates the payload of an error message.
+func errorPayload(message string) json.RawMessage {
+	payload, _ := json.Marshal(map[string]string{"message": message})
+	return payload
+}
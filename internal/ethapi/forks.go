@@ -0,0 +1,74 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/common/hexutil"
+	"github.com/expanse-org/go-expanse/core/forkid"
+	"github.com/expanse-org/go-expanse/params"
+)
+
+// ForkID is the JSON representation of an EIP-2124 fork identifier.
+type ForkID struct {
+	Hash hexutil.Bytes  `json:"hash"` // CRC32 checksum of the genesis block and passed fork block numbers
+	Next hexutil.Uint64 `json:"next"` // Block number of the next upcoming fork, or 0 if no forks are known
+}
+
+func newForkID(id forkid.ID) *ForkID {
+	return &ForkID{Hash: id.Hash[:], Next: hexutil.Uint64(id.Next)}
+}
+
+// ForkStatus is the activation status of a single fork at the chain head.
+type ForkStatus struct {
+	Name   string       `json:"name"`
+	Block  *hexutil.Big `json:"block"`  // Activation block, nil if the fork is not scheduled
+	ForkID *ForkID      `json:"forkId"` // Fork identifier from the activation block on, nil if not scheduled
+	Active bool         `json:"active"`
+	EIPs   []string     `json:"eips"`
+}
+
+// ForkSchedule is the activation status of all the forks of the chain.
+type ForkSchedule struct {
+	Genesis common.Hash    `json:"genesis"`
+	Head    hexutil.Uint64 `json:"head"`
+	ForkID  *ForkID        `json:"forkId"` // Fork identifier at the chain head
+	Forks   []*ForkStatus  `json:"forks"`
+}
+
+// NewForkSchedule assembles the activation status of the forks of the chain
+// configuration at the given head.
+func NewForkSchedule(config *params.ChainConfig, genesis common.Hash, head uint64) *ForkSchedule {
+	schedule := &ForkSchedule{
+		Genesis: genesis,
+		Head:    hexutil.Uint64(head),
+		ForkID:  newForkID(forkid.NewID(config, genesis, head)),
+	}
+	for _, fork := range config.Forks() {
+		status := &ForkStatus{Name: fork.Name, EIPs: fork.EIPs}
+		if status.EIPs == nil {
+			status.EIPs = []string{}
+		}
+		if fork.Block != nil {
+			status.Block = (*hexutil.Big)(fork.Block)
+			status.ForkID = newForkID(forkid.NewID(config, genesis, fork.Block.Uint64()))
+			status.Active = fork.Block.Uint64() <= head
+		}
+		schedule.Forks = append(schedule.Forks, status)
+	}
+	return schedule
+}
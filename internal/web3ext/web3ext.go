@@ -21,12 +21,14 @@ var Modules = map[string]string{
 	"admin":    AdminJs,
 	"clique":   CliqueJs,
 	"ethash":   EthashJs,
+	"frkhash":  FrkhashJs,
 	"debug":    DebugJs,
 	"eth":      EthJs,
 	"miner":    MinerJs,
 	"net":      NetJs,
 	"personal": PersonalJs,
 	"rpc":      RpcJs,
+	"trace":    TraceJs,
 	"txpool":   TxpoolJs,
 	"les":      LESJs,
 	"vflux":    VfluxJs,
@@ -117,6 +119,60 @@ web3._extend({
 });
 `
 
+const FrkhashJs = `
+web3._extend({
+	property: 'frkhash',
+	methods: [
+		new web3._extend.Method({
+			name: 'getWork',
+			call: 'frkhash_getWork',
+			params: 0
+		}),
+		new web3._extend.Method({
+			name: 'getHashrate',
+			call: 'frkhash_getHashrate',
+			params: 0
+		}),
+		new web3._extend.Method({
+			name: 'submitWork',
+			call: 'frkhash_submitWork',
+			params: 3,
+		}),
+		new web3._extend.Method({
+			name: 'submitHashrate',
+			call: 'frkhash_submitHashrate',
+			params: 2,
+		}),
+		new web3._extend.Method({
+			name: 'getBlockReward',
+			call: 'frkhash_getBlockReward',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getStratumSessions',
+			call: 'frkhash_getStratumSessions',
+			params: 0
+		}),
+		new web3._extend.Method({
+			name: 'getShareWork',
+			call: 'frkhash_getShareWork',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'submitShare',
+			call: 'frkhash_submitShare',
+			params: 3
+		}),
+		new web3._extend.Method({
+			name: 'getWorkers',
+			call: 'frkhash_getWorkers',
+			params: 0
+		}),
+	]
+});
+`
+
 const AdminJs = `
 web3._extend({
 	property: 'admin',
@@ -152,6 +208,19 @@ web3._extend({
 			call: 'admin_importChain',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'overrideReorgGuard',
+			call: 'admin_overrideReorgGuard',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'rejectedReorgs',
+			call: 'admin_rejectedReorgs',
+		}),
+		new web3._extend.Method({
+			name: 'forkSchedule',
+			call: 'admin_forkSchedule',
+		}),
 		new web3._extend.Method({
 			name: 'sleepBlocks',
 			call: 'admin_sleepBlocks',
@@ -250,6 +319,10 @@ web3._extend({
 			params: 1,
 			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'pirlGuardStatus',
+			call: 'debug_pirlGuardStatus',
+		}),
 		new web3._extend.Method({
 			name: 'chaindbProperty',
 			call: 'debug_chaindbProperty',
@@ -467,6 +540,11 @@ web3._extend({
 			call: 'eth_chainId',
 			params: 0
 		}),
+		new web3._extend.Method({
+			name: 'chainConfig',
+			call: 'eth_chainConfig',
+			params: 0
+		}),
 		new web3._extend.Method({
 			name: 'sign',
 			call: 'eth_sign',
@@ -504,6 +582,17 @@ web3._extend({
 			params: 1,
 			inputFormatter: [web3._extend.formatters.inputTransactionFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'sendPrivateTransaction',
+			call: 'eth_sendPrivateTransaction',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getAddressHistory',
+			call: 'eth_getAddressHistory',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null]
+		}),
 		new web3._extend.Method({
 			name: 'getHeaderByNumber',
 			call: 'eth_getHeaderByNumber',
@@ -623,10 +712,21 @@ web3._extend({
 			call: 'miner_setRecommitInterval',
 			params: 1,
 		}),
+		new web3._extend.Method({
+			name: 'setWorkerDifficulty',
+			call: 'miner_setWorkerDifficulty',
+			params: 2,
+			inputFormatter: [null, web3._extend.utils.fromDecimal]
+		}),
 		new web3._extend.Method({
 			name: 'getHashrate',
 			call: 'miner_getHashrate'
 		}),
+		new web3._extend.Method({
+			name: 'sendBundle',
+			call: 'miner_sendBundle',
+			params: 1
+		}),
 	],
 	properties: []
 });
@@ -714,6 +814,41 @@ web3._extend({
 });
 `
 
+const TraceJs = `
+web3._extend({
+	property: 'trace',
+	methods: [
+		new web3._extend.Method({
+			name: 'block',
+			call: 'trace_block',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'transaction',
+			call: 'trace_transaction',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'filter',
+			call: 'trace_filter',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'replayBlockTransactions',
+			call: 'trace_replayBlockTransactions',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, null]
+		}),
+		new web3._extend.Method({
+			name: 'replayTransaction',
+			call: 'trace_replayTransaction',
+			params: 2
+		}),
+	]
+});
+`
+
 const TxpoolJs = `
 web3._extend({
 	property: 'txpool',
@@ -737,6 +872,10 @@ web3._extend({
 				return status;
 			}
 		}),
+		new web3._extend.Property({
+			name: 'policy',
+			getter: 'txpool_policy'
+		}),
 		new web3._extend.Method({
 			name: 'contentFrom',
 			call: 'txpool_contentFrom',
@@ -0,0 +1,180 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"sync/atomic"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core"
+	"github.com/expanse-org/go-expanse/core/state"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/log"
+)
+
+// maxBundleSims is the maximum number of bundles simulated for a block, the
+// cheapest of the rest of the bundles targeting it are ignored.
+const maxBundleSims = 32
+
+// bundleState is the mining state a bundle is executed on top of. Bundles are
+// applied atomically, so every execution works on a copy of the state.
+type bundleState struct {
+	state    *state.StateDB
+	gasPool  core.GasPool
+	gasUsed  uint64
+	txs      []*types.Transaction
+	receipts []*types.Receipt
+}
+
+// simulatedBundle is a bundle successfully executed on top of a mining state.
+type simulatedBundle struct {
+	bundle  *core.TxBundle
+	result  *bundleState // State after executing the bundle
+	payment *big.Int     // Increase of the coinbase balance caused by the bundle
+}
+
+// simulateBundle executes a bundle on a copy of the given state. It fails if
+// any transaction is invalid, or reverts without being allowed to.
+func (w *worker) simulateBundle(bundle *core.TxBundle, base *bundleState, coinbase common.Address) (*simulatedBundle, error) {
+	env := &bundleState{
+		state:    base.state.Copy(),
+		gasPool:  base.gasPool,
+		gasUsed:  base.gasUsed,
+		txs:      append([]*types.Transaction{}, base.txs...),
+		receipts: append([]*types.Receipt{}, base.receipts...),
+	}
+	balance := env.state.GetBalance(coinbase)
+
+	for _, tx := range bundle.Txs {
+		env.state.Prepare(tx.Hash(), len(env.txs))
+
+		receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &coinbase, &env.gasPool, env.state, w.current.header, tx, &env.gasUsed, *w.chain.GetVMConfig())
+		if err != nil {
+			return nil, fmt.Errorf("transaction %x: %w", tx.Hash(), err)
+		}
+		if receipt.Status == types.ReceiptStatusFailed && !bundle.CanRevert(tx.Hash()) {
+			return nil, fmt.Errorf("transaction %x reverted", tx.Hash())
+		}
+		env.txs = append(env.txs, tx)
+		env.receipts = append(env.receipts, receipt)
+	}
+	return &simulatedBundle{
+		bundle:  bundle,
+		result:  env,
+		payment: new(big.Int).Sub(env.state.GetBalance(coinbase), balance),
+	}, nil
+}
+
+// commitBundles places the most profitable set of bundles at the top of the
+// block being mined. Every bundle is simulated on its own, then they are merged
+// by decreasing coinbase payment. A bundle only makes it into the set if it
+// still succeeds and pays as much on top of the previously merged ones.
+//
+// Like commitTransactions, it returns whether the work was interrupted by a new
+// head and must be discarded. Other interrupts keep the bundles merged so far.
+func (w *worker) commitBundles(bundles []*core.TxBundle, coinbase common.Address, interrupt *int32) bool {
+	if len(bundles) > maxBundleSims {
+		// Only simulate the best paying bundles, by the tip of their transactions
+		prices := make(map[*core.TxBundle]*big.Int, len(bundles))
+		for _, bundle := range bundles {
+			prices[bundle] = bundle.Price(w.current.header.BaseFee)
+		}
+		sort.SliceStable(bundles, func(i, j int) bool {
+			return prices[bundles[i]].Cmp(prices[bundles[j]]) > 0
+		})
+		log.Debug("Ignoring excess bundles", "bundles", len(bundles), "limit", maxBundleSims)
+		bundles = bundles[:maxBundleSims]
+	}
+	interrupted := func() bool {
+		return interrupt != nil && atomic.LoadInt32(interrupt) != commitInterruptNone
+	}
+	env := w.current
+	if env.gasPool == nil {
+		env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit)
+	}
+	base := &bundleState{
+		state:    env.state,
+		gasPool:  *env.gasPool,
+		gasUsed:  env.header.GasUsed,
+		txs:      env.txs,
+		receipts: env.receipts,
+	}
+	var sims []*simulatedBundle
+	for _, bundle := range bundles {
+		if interrupted() {
+			return atomic.LoadInt32(interrupt) == commitInterruptNewHead
+		}
+		sim, err := w.simulateBundle(bundle, base, coinbase)
+		if err != nil {
+			log.Debug("Discarding failed bundle", "hash", bundle.Hash(), "err", err)
+			continue
+		}
+		sims = append(sims, sim)
+	}
+	sort.SliceStable(sims, func(i, j int) bool {
+		return sims[i].payment.Cmp(sims[j].payment) > 0
+	})
+	var (
+		merged  = base
+		count   int
+		payment = new(big.Int)
+	)
+	for _, sim := range sims {
+		// The first bundle is merged on the base state, reuse its simulation
+		if merged == base {
+			merged = sim.result
+			payment.Add(payment, sim.payment)
+			count++
+			continue
+		}
+		if interrupted() {
+			if atomic.LoadInt32(interrupt) == commitInterruptNewHead {
+				return true
+			}
+			break
+		}
+		next, err := w.simulateBundle(sim.bundle, merged, coinbase)
+		if err != nil {
+			log.Debug("Skipping conflicting bundle", "hash", sim.bundle.Hash(), "err", err)
+			continue
+		}
+		if next.payment.Cmp(sim.payment) < 0 {
+			log.Debug("Skipping devalued bundle", "hash", sim.bundle.Hash(), "payment", next.payment, "alone", sim.payment)
+			continue
+		}
+		merged = next.result
+		payment.Add(payment, next.payment)
+		count++
+	}
+	if count == 0 {
+		return false
+	}
+	// Swap the merged state in, the original one is not needed anymore
+	env.state.StopPrefetcher()
+	env.state = merged.state
+	*env.gasPool = merged.gasPool
+	env.header.GasUsed = merged.gasUsed
+	env.tcount += len(merged.txs) - len(env.txs)
+	env.txs = merged.txs
+	env.receipts = merged.receipts
+
+	log.Debug("Committed transaction bundles", "bundles", count, "txs", env.tcount, "payment", payment)
+	return false
+}
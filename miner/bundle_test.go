@@ -0,0 +1,206 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/consensus/ethash"
+	"github.com/expanse-org/go-expanse/core"
+	"github.com/expanse-org/go-expanse/core/rawdb"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/event"
+	"github.com/expanse-org/go-expanse/params"
+)
+
+// Tests that the worker places the most profitable set of bundles at the top of
+// the block, voiding the ones with disallowed reverts.
+func TestCommitBundles(t *testing.T) {
+	var (
+		coinbase = common.Address{0xc0}
+		gasPrice = big.NewInt(2 * params.InitialBaseFee)
+	)
+	pay := func(nonce uint64, amount int64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, coinbase, big.NewInt(amount), params.TxGas, gasPrice, nil), types.HomesteadSigner{}, testBankKey)
+		return tx
+	}
+	revert := func(nonce uint64) *types.Transaction {
+		code := []byte{0x60, 0x00, 0x60, 0x00, 0xfd} // PUSH1 0 PUSH1 0 REVERT
+		tx, _ := types.SignTx(types.NewContractCreation(nonce, big.NewInt(0), 100000, gasPrice, code), types.HomesteadSigner{}, testBankKey)
+		return tx
+	}
+	var (
+		low      = &core.TxBundle{Txs: types.Transactions{pay(0, 1000)}}
+		high     = &core.TxBundle{Txs: types.Transactions{pay(0, 5000)}}
+		failing  = &core.TxBundle{Txs: types.Transactions{pay(0, 9000), revert(1)}}
+		reverter = &core.TxBundle{Txs: failing.Txs, RevertingTxHashes: []common.Hash{failing.Txs[1].Hash()}}
+		future   = &core.TxBundle{Txs: types.Transactions{pay(0, 9000)}, MinTimestamp: uint64(time.Now().Add(time.Hour).Unix())}
+	)
+	tests := []struct {
+		bundles []*core.TxBundle
+		want    types.Transactions
+	}{
+		{[]*core.TxBundle{low}, low.Txs},
+		{[]*core.TxBundle{low, high}, high.Txs},
+		{[]*core.TxBundle{high, low}, high.Txs},
+		{[]*core.TxBundle{low, failing}, low.Txs},
+		{[]*core.TxBundle{low, reverter}, reverter.Txs},
+		{[]*core.TxBundle{low, future}, low.Txs},
+	}
+	for i, tt := range tests {
+		engine := ethash.NewFaker()
+		b := newTestWorkerBackend(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+		for _, bundle := range tt.bundles {
+			bundle.BlockNumber = big.NewInt(1)
+			if err := b.txPool.AddBundle(bundle); err != nil {
+				t.Fatalf("test %d: failed to add bundle: %v", i, err)
+			}
+		}
+		w, err := newWorker(testConfig, ethashChainConfig, engine, b, new(event.TypeMux), nil, false)
+		if err != nil {
+			t.Fatalf("test %d: failed to create worker: %v", i, err)
+		}
+		w.setEtherbase(coinbase)
+
+		taskCh := make(chan *task, 1)
+		w.newTaskHook = func(task *task) {
+			if task.block.NumberU64() == 1 && len(task.block.Transactions()) > 0 {
+				select {
+				case taskCh <- task:
+				default:
+				}
+			}
+		}
+		w.skipSealHook = func(task *task) bool { return true }
+		w.start()
+
+		select {
+		case task := <-taskCh:
+			txs := task.block.Transactions()
+			if len(txs) != len(tt.want) {
+				t.Errorf("test %d: transaction count mismatch: have %d, want %d", i, len(txs), len(tt.want))
+				break
+			}
+			for j, tx := range txs {
+				if tx.Hash() != tt.want[j].Hash() {
+					t.Errorf("test %d: transaction %d mismatch: have %x, want %x", i, j, tx.Hash(), tt.want[j].Hash())
+				}
+				if task.receipts[j].TransactionIndex != uint(j) {
+					t.Errorf("test %d: receipt %d index mismatch: have %d", i, j, task.receipts[j].TransactionIndex)
+				}
+			}
+		case <-time.After(time.Second):
+			t.Errorf("test %d: new task timeout", i)
+		}
+		w.close()
+		engine.Close()
+	}
+}
+
+// Tests that bundle simulation stops when the work is interrupted, discarding
+// it on a new head and keeping the state untouched on a resubmit.
+func TestCommitBundlesInterrupt(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	b := newTestWorkerBackend(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	w, err := newWorker(testConfig, ethashChainConfig, engine, b, new(event.TypeMux), nil, false)
+	if err != nil {
+		t.Fatalf("failed to create worker: %v", err)
+	}
+	defer w.close()
+
+	var (
+		coinbase = common.Address{0xc0}
+		parent   = b.chain.CurrentBlock()
+		header   = &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     big.NewInt(1),
+			GasLimit:   parent.GasLimit(),
+			Time:       parent.Time() + 1,
+			BaseFee:    big.NewInt(params.InitialBaseFee),
+			Coinbase:   coinbase,
+		}
+	)
+	tx, _ := types.SignTx(types.NewTransaction(0, coinbase, big.NewInt(1000), params.TxGas, big.NewInt(2*params.InitialBaseFee), nil), types.HomesteadSigner{}, testBankKey)
+	bundles := []*core.TxBundle{{Txs: types.Transactions{tx}, BlockNumber: big.NewInt(1)}}
+
+	for _, signal := range []int32{commitInterruptNewHead, commitInterruptResubmit} {
+		if err := w.makeCurrent(parent, header); err != nil {
+			t.Fatalf("failed to prepare work: %v", err)
+		}
+		interrupt := new(int32)
+		atomic.StoreInt32(interrupt, signal)
+
+		if discard := w.commitBundles(bundles, coinbase, interrupt); discard != (signal == commitInterruptNewHead) {
+			t.Errorf("signal %d: discard mismatch: have %v", signal, discard)
+		}
+		if len(w.current.txs) != 0 {
+			t.Errorf("signal %d: bundle committed despite interrupt", signal)
+		}
+	}
+}
+
+// Tests that the best paying bundles are simulated when there are too many of
+// them, regardless of the order they were submitted in.
+func TestCommitBundlesPriority(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	b := newTestWorkerBackend(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	w, err := newWorker(testConfig, ethashChainConfig, engine, b, new(event.TypeMux), nil, false)
+	if err != nil {
+		t.Fatalf("failed to create worker: %v", err)
+	}
+	defer w.close()
+
+	var (
+		coinbase = common.Address{0xc0}
+		parent   = b.chain.CurrentBlock()
+		header   = &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     big.NewInt(1),
+			GasLimit:   parent.GasLimit(),
+			Time:       parent.Time() + 1,
+			Difficulty: big.NewInt(1),
+			BaseFee:    big.NewInt(params.InitialBaseFee),
+			Coinbase:   coinbase,
+		}
+	)
+	bundle := func(gasPrice int64) *core.TxBundle {
+		tx, _ := types.SignTx(types.NewTransaction(0, coinbase, big.NewInt(0), params.TxGas, big.NewInt(gasPrice), nil), types.HomesteadSigner{}, testBankKey)
+		return &core.TxBundle{Txs: types.Transactions{tx}, BlockNumber: big.NewInt(1)}
+	}
+	var bundles []*core.TxBundle
+	for i := 0; i < maxBundleSims; i++ {
+		bundles = append(bundles, bundle(2*params.InitialBaseFee+int64(i)))
+	}
+	best := bundle(4 * params.InitialBaseFee)
+	bundles = append(bundles, best)
+
+	if err := w.makeCurrent(parent, header); err != nil {
+		t.Fatalf("failed to prepare work: %v", err)
+	}
+	w.commitBundles(bundles, coinbase, nil)
+	if len(w.current.txs) != 1 || w.current.txs[0].Hash() != best.Txs[0].Hash() {
+		t.Fatalf("best paying bundle not included: have %v", w.current.txs)
+	}
+}
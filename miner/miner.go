@@ -51,6 +51,16 @@ type Config struct {
 	GasPrice   *big.Int       // Minimum gas price for mining a transaction
 	Recommit   time.Duration  // The time interval for miner to re-create mining work.
 	Noverify   bool           // Disable remote mining solution verification(only useful in ethash & frkhash).
+
+	Strategy       string        `toml:",omitempty"` // Block building strategy: price (default), fairshare or ageboost
+	FairShareCap   int           `toml:",omitempty"` // Maximum transactions of a remote sender in a block (fairshare strategy)
+	AgeBoostPeriod time.Duration `toml:",omitempty"` // Pending time doubling the priority of a transaction (ageboost strategy)
+
+	Stratum              string        `toml:",omitempty"` // TCP listening address of the stratum server (only useful in frkhash).
+	StratumDifficulty    uint64        `toml:",omitempty"` // Initial share difficulty of stratum workers
+	StratumShareTime     time.Duration `toml:",omitempty"` // Target interval between shares of a stratum worker
+	StratumPassword      string        `toml:",omitempty"` // Password stratum workers have to authorize with
+	StratumMaxConnsPerIP int           `toml:",omitempty"` // Maximum number of stratum connections from a single IP address
 }
 
 // Miner creates blocks and searches for proof-of-work values.
@@ -65,7 +75,11 @@ type Miner struct {
 	stopCh   chan struct{}
 }
 
-func New(eth Backend, config *Config, chainConfig *params.ChainConfig, mux *event.TypeMux, engine consensus.Engine, isLocalBlock func(block *types.Block) bool) *Miner {
+func New(eth Backend, config *Config, chainConfig *params.ChainConfig, mux *event.TypeMux, engine consensus.Engine, isLocalBlock func(block *types.Block) bool) (*Miner, error) {
+	worker, err := newWorker(config, chainConfig, engine, eth, mux, isLocalBlock, true)
+	if err != nil {
+		return nil, err
+	}
 	miner := &Miner{
 		eth:     eth,
 		mux:     mux,
@@ -73,11 +87,11 @@ func New(eth Backend, config *Config, chainConfig *params.ChainConfig, mux *even
 		exitCh:  make(chan struct{}),
 		startCh: make(chan common.Address),
 		stopCh:  make(chan struct{}),
-		worker:  newWorker(config, chainConfig, engine, eth, mux, isLocalBlock, true),
+		worker:  worker,
 	}
 	go miner.update()
 
-	return miner
+	return miner, nil
 }
 
 // update keeps track of the downloader events. Please be aware that this is a one shot type of update loop.
@@ -0,0 +1,318 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"container/heap"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core/state"
+	"github.com/expanse-org/go-expanse/core/types"
+)
+
+const (
+	// defaultFairShareCap is the number of transactions a sender may have in a
+	// block with the fair share strategy, if not configured.
+	defaultFairShareCap = 16
+
+	// defaultAgeBoostPeriod is the time a transaction has to wait to have its
+	// priority doubled with the age boost strategy, if not configured.
+	defaultAgeBoostPeriod = time.Minute
+
+	// maxAgeBoost is the maximum priority multiplier of old transactions with the
+	// age boost strategy.
+	maxAgeBoost = 4
+)
+
+// PendingTxs is the set of executable transactions block building strategies
+// choose from.
+type PendingTxs struct {
+	Signer types.Signer                          // Signer to recover the transaction senders
+	Txs    map[common.Address]types.Transactions // Executable transactions by sender, in nonce order
+	Locals []common.Address                      // Senders considered local by the transaction pool
+}
+
+// splitLocals separates the pending transactions of local senders from the
+// remote ones.
+func (p *PendingTxs) splitLocals() (locals, remotes map[common.Address]types.Transactions) {
+	locals, remotes = make(map[common.Address]types.Transactions), make(map[common.Address]types.Transactions)
+	for addr, txs := range p.Txs {
+		remotes[addr] = txs
+	}
+	for _, addr := range p.Locals {
+		if txs := remotes[addr]; len(txs) > 0 {
+			delete(remotes, addr)
+			locals[addr] = txs
+		}
+	}
+	return locals, remotes
+}
+
+// Strategy decides which pending transactions the worker tries to include in a
+// block, and in which order.
+type Strategy interface {
+	// Order returns the pending transactions to try to include in the block with
+	// the given header, on top of the given state, in order of preference. The
+	// transactions of every sender must stay in nonce order. The state must not
+	// be modified.
+	Order(pending *PendingTxs, header *types.Header, state *state.StateDB) types.Transactions
+}
+
+// NewStrategy creates the block building strategy selected in the config.
+func NewStrategy(config *Config) (Strategy, error) {
+	switch config.Strategy {
+	case "", "price":
+		return PriceStrategy{}, nil
+	case "fairshare":
+		limit := config.FairShareCap
+		if limit < 0 {
+			return nil, fmt.Errorf("invalid fair share cap %d", limit)
+		}
+		if limit == 0 {
+			limit = defaultFairShareCap
+		}
+		return &FairShareStrategy{Cap: limit}, nil
+	case "ageboost":
+		period := config.AgeBoostPeriod
+		if period < 0 {
+			return nil, fmt.Errorf("invalid age boost period %v", period)
+		}
+		if period == 0 {
+			period = defaultAgeBoostPeriod
+		}
+		return NewAgeBoostStrategy(period), nil
+	default:
+		return nil, fmt.Errorf("unknown mining strategy %q", config.Strategy)
+	}
+}
+
+// flatten drains a price and nonce sorted transaction set into a list.
+func flatten(txs *types.TransactionsByPriceAndNonce) types.Transactions {
+	var list types.Transactions
+	for tx := txs.Peek(); tx != nil; tx = txs.Peek() {
+		list = append(list, tx)
+		txs.Shift()
+	}
+	return list
+}
+
+// PriceStrategy is the default block building strategy. It orders the local
+// transactions first, followed by the remote ones, each by effective tip while
+// honouring the nonces.
+type PriceStrategy struct{}
+
+// Order implements Strategy, ordering transactions by price.
+func (PriceStrategy) Order(pending *PendingTxs, header *types.Header, state *state.StateDB) types.Transactions {
+	locals, remotes := pending.splitLocals()
+
+	txs := flatten(types.NewTransactionsByPriceAndNonce(pending.Signer, locals, header.BaseFee))
+	return append(txs, flatten(types.NewTransactionsByPriceAndNonce(pending.Signer, remotes, header.BaseFee))...)
+}
+
+// FairShareStrategy orders transactions like the price strategy, but caps the
+// number of transactions of every remote sender ahead of the others, so a few
+// busy accounts can't crowd everyone else out. The transactions over the cap
+// follow, by price, to fill any space left in the block.
+type FairShareStrategy struct {
+	Cap int // Maximum number of transactions of a remote sender before the others
+}
+
+// Order implements Strategy, ordering transactions by price with a per sender
+// limit.
+func (s *FairShareStrategy) Order(pending *PendingTxs, header *types.Header, state *state.StateDB) types.Transactions {
+	locals, remotes := pending.splitLocals()
+
+	excess := make(map[common.Address]types.Transactions)
+	for addr, txs := range remotes {
+		if len(txs) > s.Cap {
+			remotes[addr], excess[addr] = txs[:s.Cap], txs[s.Cap:]
+		}
+	}
+	txs := flatten(types.NewTransactionsByPriceAndNonce(pending.Signer, locals, header.BaseFee))
+	txs = append(txs, flatten(types.NewTransactionsByPriceAndNonce(pending.Signer, remotes, header.BaseFee))...)
+	return append(txs, flatten(types.NewTransactionsByPriceAndNonce(pending.Signer, excess, header.BaseFee))...)
+}
+
+// AgeBoostStrategy orders remote transactions by effective tip, boosted by the
+// time they have been pending, so cheap transactions are not starved forever.
+// The priority of a transaction grows linearly, by its tip for every period it
+// has been pending, up to a maximum of four times its tip. Local transactions
+// still come first.
+//
+// The age of a transaction is measured from the time the node first saw it.
+type AgeBoostStrategy struct {
+	period time.Duration
+	now    func() time.Time                      // Clock to measure the ages with, replaceable in tests
+	seen   func(tx *types.Transaction) time.Time // First seen time of a transaction, replaceable in tests
+}
+
+// NewAgeBoostStrategy creates an age boost strategy doubling the priority of
+// transactions pending for the given period.
+func NewAgeBoostStrategy(period time.Duration) *AgeBoostStrategy {
+	return &AgeBoostStrategy{
+		period: period,
+		now:    time.Now,
+		seen:   (*types.Transaction).Time,
+	}
+}
+
+// Order implements Strategy, ordering transactions by age boosted price.
+func (s *AgeBoostStrategy) Order(pending *PendingTxs, header *types.Header, state *state.StateDB) types.Transactions {
+	now := s.now()
+	locals, remotes := pending.splitLocals()
+	txs := flatten(types.NewTransactionsByPriceAndNonce(pending.Signer, locals, header.BaseFee))
+
+	// Order the remotes by their boosted tips, always taking the next
+	// transaction of the sender with the best head
+	var heads boostedHeads
+	for addr, list := range remotes {
+		if head := s.boost(list[0], header.BaseFee, now); head != nil {
+			heads = append(heads, head)
+			remotes[addr] = list[1:]
+		}
+	}
+	heap.Init(&heads)
+	for len(heads) > 0 {
+		tx := heads[0].tx
+		txs = append(txs, tx)
+
+		from, _ := types.Sender(pending.Signer, tx)
+		if list := remotes[from]; len(list) > 0 {
+			if next := s.boost(list[0], header.BaseFee, now); next != nil {
+				heads[0], remotes[from] = next, list[1:]
+				heap.Fix(&heads, 0)
+				continue
+			}
+		}
+		heap.Pop(&heads)
+	}
+	return txs
+}
+
+// boost computes the age boosted priority of a transaction, or nil if it can't
+// pay the base fee.
+func (s *AgeBoostStrategy) boost(tx *types.Transaction, baseFee *big.Int, now time.Time) *boostedTx {
+	tip, err := tx.EffectiveGasTip(baseFee)
+	if err != nil {
+		return nil
+	}
+	// Scale the tip by 1 + age/period, in thousandths to keep the precision
+	var (
+		seen     = s.seen(tx)
+		permille = int64(1000)
+	)
+	if age := now.Sub(seen); age > 0 {
+		permille += int64(1000 * age / s.period)
+	}
+	if permille > 1000*maxAgeBoost {
+		permille = 1000 * maxAgeBoost
+	}
+	priority := new(big.Int).Mul(tip, big.NewInt(permille))
+	return &boostedTx{tx: tx, priority: priority, seen: seen}
+}
+
+// boostedTx is a transaction with its age boosted priority.
+type boostedTx struct {
+	tx       *types.Transaction
+	priority *big.Int
+	seen     time.Time
+}
+
+// boostedHeads is a heap of the next transactions of every sender, ordered by
+// priority, older ones first on ties.
+type boostedHeads []*boostedTx
+
+func (h boostedHeads) Len() int { return len(h) }
+func (h boostedHeads) Less(i, j int) bool {
+	if cmp := h[i].priority.Cmp(h[j].priority); cmp != 0 {
+		return cmp > 0
+	}
+	return h[i].seen.Before(h[j].seen)
+}
+func (h boostedHeads) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *boostedHeads) Push(x interface{}) {
+	*h = append(*h, x.(*boostedTx))
+}
+
+func (h *boostedHeads) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+// txIterator is a sequence of transactions the worker tries to commit.
+type txIterator interface {
+	// Peek returns the next transaction, nil if there are none left.
+	Peek() *types.Transaction
+
+	// Shift moves on to the next transaction.
+	Shift()
+
+	// Pop moves on to the next transaction, skipping the ones of the same sender.
+	Pop()
+}
+
+// orderedTxs walks a strategy's transaction list for the worker, skipping the
+// remaining transactions of a sender once it's dropped.
+type orderedTxs struct {
+	signer  types.Signer
+	txs     types.Transactions
+	dropped map[common.Address]bool
+}
+
+// newOrderedTxs creates a worker iterator over an ordered transaction list.
+func newOrderedTxs(signer types.Signer, txs types.Transactions) *orderedTxs {
+	return &orderedTxs{
+		signer:  signer,
+		txs:     txs,
+		dropped: make(map[common.Address]bool),
+	}
+}
+
+// Peek returns the next transaction of a sender not dropped yet.
+func (o *orderedTxs) Peek() *types.Transaction {
+	for len(o.txs) > 0 {
+		from, _ := types.Sender(o.signer, o.txs[0])
+		if !o.dropped[from] {
+			return o.txs[0]
+		}
+		o.txs = o.txs[1:]
+	}
+	return nil
+}
+
+// Shift moves on to the next transaction.
+func (o *orderedTxs) Shift() {
+	if len(o.txs) > 0 {
+		o.txs = o.txs[1:]
+	}
+}
+
+// Pop drops the current transaction and all the later ones of the same sender.
+func (o *orderedTxs) Pop() {
+	if len(o.txs) > 0 {
+		from, _ := types.Sender(o.signer, o.txs[0])
+		o.dropped[from] = true
+		o.txs = o.txs[1:]
+	}
+}
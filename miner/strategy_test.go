@@ -0,0 +1,337 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/expanse-org/go-expanse/common"
+	"github.com/expanse-org/go-expanse/core/rawdb"
+	"github.com/expanse-org/go-expanse/core/state"
+	"github.com/expanse-org/go-expanse/core/types"
+	"github.com/expanse-org/go-expanse/crypto"
+	"github.com/expanse-org/go-expanse/params"
+)
+
+// simSender is an account sending transactions in a strategy simulation.
+type simSender struct {
+	key   *ecdsa.PrivateKey
+	addr  common.Address
+	nonce uint64 // Nonce of the next transaction to send
+}
+
+func newSimSender() *simSender {
+	key, _ := crypto.GenerateKey()
+	return &simSender{key: key, addr: crypto.PubkeyToAddress(key.PublicKey)}
+}
+
+// send creates the sender's next transaction with the given tip in gwei.
+func (s *simSender) send(signer types.Signer, tip int64) *types.Transaction {
+	tx := types.MustSignNewTx(s.key, signer, &types.DynamicFeeTx{
+		ChainID:   params.TestChainConfig.ChainID,
+		Nonce:     s.nonce,
+		GasTipCap: big.NewInt(tip * params.GWei),
+		GasFeeCap: big.NewInt((tip + 10) * params.GWei),
+		Gas:       params.TxGas,
+		To:        &common.Address{},
+	})
+	s.nonce++
+	return tx
+}
+
+// simResult is the outcome of building a series of blocks with a strategy.
+type simResult struct {
+	revenue   *big.Int       // Sum of the tips paid to the coinbase
+	included  int            // Number of included transactions
+	remaining int            // Number of transactions left in the pool
+	maxWait   map[string]int // Longest wait for inclusion of every sender class, in blocks
+}
+
+// simulateStrategy builds a block for every round of arrivals with the given
+// strategy. Before every block, the arrivals of that round join the pool, then
+// the block is filled with the transactions in the order given by the strategy,
+// honouring the nonces and the gas limit, like the worker does. Transactions are
+// simple transfers, so a block holds a fixed number of them.
+func simulateStrategy(strategy Strategy, arrivals [][]*types.Transaction, classes map[common.Address]string, slots int, clock *int) *simResult {
+	var (
+		signer   = types.LatestSigner(params.TestChainConfig)
+		baseFee  = big.NewInt(params.GWei)
+		statedb  = newSimState()
+		pool     = make(map[common.Address]types.Transactions)
+		arrived  = make(map[common.Hash]int)
+		nonces   = make(map[common.Address]uint64)
+		result   = &simResult{revenue: new(big.Int), maxWait: make(map[string]int)}
+		gasLimit = uint64(slots) * params.TxGas
+	)
+	for round, txs := range arrivals {
+		*clock = round
+		for _, tx := range txs {
+			from, _ := types.Sender(signer, tx)
+			pool[from] = append(pool[from], tx)
+			arrived[tx.Hash()] = round
+		}
+		// Hand the strategy a copy of the pool, it may reorganise it
+		pending := make(map[common.Address]types.Transactions)
+		for addr, txs := range pool {
+			if len(txs) > 0 {
+				pending[addr] = append(types.Transactions{}, txs...)
+			}
+		}
+		header := &types.Header{Number: big.NewInt(int64(round + 1)), GasLimit: gasLimit, BaseFee: baseFee}
+		ordered := strategy.Order(&PendingTxs{Signer: signer, Txs: pending}, header, statedb)
+
+		var (
+			gas  uint64
+			iter = newOrderedTxs(signer, ordered)
+		)
+		for tx := iter.Peek(); tx != nil && gas+tx.Gas() <= gasLimit; tx = iter.Peek() {
+			from, _ := types.Sender(signer, tx)
+			if tx.Nonce() != nonces[from] {
+				iter.Pop()
+				continue
+			}
+			nonces[from]++
+			gas += tx.Gas()
+
+			tip, _ := tx.EffectiveGasTip(baseFee)
+			result.revenue.Add(result.revenue, new(big.Int).Mul(tip, new(big.Int).SetUint64(tx.Gas())))
+			result.included++
+
+			if wait := round - arrived[tx.Hash()]; wait > result.maxWait[classes[from]] {
+				result.maxWait[classes[from]] = wait
+			}
+			pool[from] = pool[from][1:]
+			iter.Shift()
+		}
+	}
+	for _, txs := range pool {
+		result.remaining += len(txs)
+	}
+	return result
+}
+
+func newSimState() *state.StateDB {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	return statedb
+}
+
+// compareStrategies runs the simulation with every strategy and checks that
+// the blocks are always full, and that none of them out-earns the greedy price
+// ordering.
+func compareStrategies(t *testing.T, arrivals [][]*types.Transaction, classes map[common.Address]string, slots int) map[string]*simResult {
+	var (
+		clock   int
+		start   = time.Unix(1600000000, 0)
+		arrived = make(map[common.Hash]time.Time)
+	)
+	for round, txs := range arrivals {
+		for _, tx := range txs {
+			arrived[tx.Hash()] = start.Add(time.Duration(round) * 15 * time.Second)
+		}
+	}
+	ageBoost := NewAgeBoostStrategy(15 * time.Second)
+	ageBoost.now = func() time.Time { return start.Add(time.Duration(clock) * 15 * time.Second) }
+	ageBoost.seen = func(tx *types.Transaction) time.Time { return arrived[tx.Hash()] }
+
+	strategies := []struct {
+		name     string
+		strategy Strategy
+	}{
+		{"price", PriceStrategy{}},
+		{"fairshare", &FairShareStrategy{Cap: 4}},
+		{"ageboost", ageBoost},
+	}
+	results := make(map[string]*simResult)
+	for _, s := range strategies {
+		res := simulateStrategy(s.strategy, arrivals, classes, slots, &clock)
+		results[s.name] = res
+
+		t.Logf("%-9s revenue %v, included %d, remaining %d, max wait %v", s.name, res.revenue, res.included, res.remaining, res.maxWait)
+	}
+	for name, res := range results {
+		if res.included != len(arrivals)*slots {
+			t.Errorf("%s: included transactions mismatch: have %d, want %d", name, res.included, len(arrivals)*slots)
+		}
+		if res.revenue.Cmp(results["price"].revenue) > 0 {
+			t.Errorf("%s out-earned the price strategy: %v > %v", name, res.revenue, results["price"].revenue)
+		}
+	}
+	return results
+}
+
+// Tests the strategies on a congested pool, where a whale floods the pool with
+// well paying transactions while a crowd of users trickles in cheaper ones.
+func TestStrategySimulationCongestion(t *testing.T) {
+	var (
+		signer  = types.LatestSigner(params.TestChainConfig)
+		whale   = newSimSender()
+		crowd   = make([]*simSender, 8)
+		classes = map[common.Address]string{whale.addr: "whale"}
+	)
+	for i := range crowd {
+		crowd[i] = newSimSender()
+		classes[crowd[i].addr] = "crowd"
+	}
+	arrivals := make([][]*types.Transaction, 30)
+	for i := 0; i < 200; i++ {
+		arrivals[0] = append(arrivals[0], whale.send(signer, 3))
+	}
+	for round := range arrivals {
+		for i, sender := range crowd {
+			if (round+i)%2 == 0 {
+				arrivals[round] = append(arrivals[round], sender.send(signer, 2))
+			}
+		}
+	}
+	results := compareStrategies(t, arrivals, classes, 10)
+
+	// Capping the whale lets the crowd in faster
+	if results["fairshare"].maxWait["crowd"] >= results["price"].maxWait["crowd"] {
+		t.Errorf("fairshare: crowd waited as long as with price: %d >= %d", results["fairshare"].maxWait["crowd"], results["price"].maxWait["crowd"])
+	}
+}
+
+// Tests the strategies on a saturated pool, where a cheap transaction is always
+// outbid by a steady stream of better paying ones.
+func TestStrategySimulationStarvation(t *testing.T) {
+	var (
+		signer  = types.LatestSigner(params.TestChainConfig)
+		whale   = newSimSender()
+		crowd   = make([]*simSender, 4)
+		miser   = newSimSender()
+		classes = map[common.Address]string{whale.addr: "whale", miser.addr: "miser"}
+	)
+	for i := range crowd {
+		crowd[i] = newSimSender()
+		classes[crowd[i].addr] = "crowd"
+	}
+	arrivals := make([][]*types.Transaction, 30)
+	arrivals[0] = append(arrivals[0], miser.send(signer, 1))
+	for round := range arrivals {
+		for i := 0; i < 6; i++ {
+			arrivals[round] = append(arrivals[round], whale.send(signer, 3))
+		}
+		for _, sender := range crowd {
+			arrivals[round] = append(arrivals[round], sender.send(signer, 2))
+		}
+	}
+	results := compareStrategies(t, arrivals, classes, 10)
+
+	// Only the age boost eventually includes the cheap transaction
+	for _, name := range []string{"price", "fairshare"} {
+		if _, ok := results[name].maxWait["miser"]; ok {
+			t.Errorf("%s: cheap transaction included in a saturated pool", name)
+		}
+	}
+	if _, ok := results["ageboost"].maxWait["miser"]; !ok {
+		t.Errorf("ageboost: cheap transaction starved")
+	}
+}
+
+// Tests that the worker's iterator over a strategy's ordering skips the later
+// transactions of dropped senders.
+func TestOrderedTxs(t *testing.T) {
+	var (
+		signer = types.LatestSigner(params.TestChainConfig)
+		a, b   = newSimSender(), newSimSender()
+	)
+	txs := types.Transactions{a.send(signer, 1), b.send(signer, 1), a.send(signer, 1), b.send(signer, 1)}
+	iter := newOrderedTxs(signer, txs)
+
+	iter.Shift() // include a's first
+	iter.Pop()   // drop b entirely
+	if tx := iter.Peek(); tx != txs[2] {
+		t.Fatalf("next transaction mismatch: have %v, want %x", tx, txs[2].Hash())
+	}
+	iter.Shift()
+	if tx := iter.Peek(); tx != nil {
+		t.Fatalf("dropped sender's transaction returned: %x", tx.Hash())
+	}
+}
+
+// Tests that strategies are selected by name through the config.
+func TestNewStrategy(t *testing.T) {
+	tests := []struct {
+		name string
+		want Strategy
+	}{
+		{"", PriceStrategy{}},
+		{"price", PriceStrategy{}},
+		{"fairshare", &FairShareStrategy{}},
+		{"ageboost", &AgeBoostStrategy{}},
+	}
+	for _, tt := range tests {
+		strategy, err := NewStrategy(&Config{Strategy: tt.name})
+		if err != nil {
+			t.Fatalf("%q: failed to create strategy: %v", tt.name, err)
+		}
+		switch tt.want.(type) {
+		case PriceStrategy:
+			_, ok := strategy.(PriceStrategy)
+			if !ok {
+				t.Errorf("%q: strategy mismatch: have %T", tt.name, strategy)
+			}
+		case *FairShareStrategy:
+			if s, ok := strategy.(*FairShareStrategy); !ok || s.Cap != defaultFairShareCap {
+				t.Errorf("%q: strategy mismatch: have %T %+v", tt.name, strategy, strategy)
+			}
+		case *AgeBoostStrategy:
+			if s, ok := strategy.(*AgeBoostStrategy); !ok || s.period != defaultAgeBoostPeriod {
+				t.Errorf("%q: strategy mismatch: have %T", tt.name, strategy)
+			}
+		}
+	}
+	if _, err := NewStrategy(&Config{Strategy: "random"}); err == nil {
+		t.Fatalf("unknown strategy accepted")
+	}
+	if _, err := NewStrategy(&Config{Strategy: "fairshare", FairShareCap: -1}); err == nil {
+		t.Fatalf("negative fair share cap accepted")
+	}
+	if _, err := NewStrategy(&Config{Strategy: "ageboost", AgeBoostPeriod: -time.Second}); err == nil {
+		t.Fatalf("negative age boost period accepted")
+	}
+}
+
+// Tests that the age boost strategy measures the ages from the time the node
+// first saw the transactions, growing the priority linearly.
+func TestAgeBoostFirstSeen(t *testing.T) {
+	var (
+		signer   = types.LatestSigner(params.TestChainConfig)
+		tx       = newSimSender().send(signer, 1)
+		baseFee  = big.NewInt(params.GWei)
+		strategy = NewAgeBoostStrategy(time.Minute)
+	)
+	tests := []struct {
+		age   time.Duration
+		boost int64
+	}{
+		{0, 1000},
+		{30 * time.Second, 1500},
+		{time.Minute, 2000},
+		{2 * time.Minute, 3000},
+		{time.Hour, 1000 * maxAgeBoost},
+	}
+	for i, tt := range tests {
+		boosted := strategy.boost(tx, baseFee, tx.Time().Add(tt.age))
+		if want := new(big.Int).Mul(big.NewInt(params.GWei), big.NewInt(tt.boost)); boosted.priority.Cmp(want) != 0 {
+			t.Errorf("test %d: priority mismatch: have %v, want %v", i, boosted.priority, want)
+		}
+	}
+}
@@ -195,11 +195,28 @@ func (b *testWorkerBackend) newRandomTx(creation bool) *types.Transaction {
 func newTestWorker(t *testing.T, chainConfig *params.ChainConfig, engine consensus.Engine, db ethdb.Database, blocks int) (*worker, *testWorkerBackend) {
 	backend := newTestWorkerBackend(t, chainConfig, engine, db, blocks)
 	backend.txPool.AddLocals(pendingTxs)
-	w := newWorker(testConfig, chainConfig, engine, backend, new(event.TypeMux), nil, false)
+	w, err := newWorker(testConfig, chainConfig, engine, backend, new(event.TypeMux), nil, false)
+	if err != nil {
+		t.Fatalf("failed to create worker: %v", err)
+	}
 	w.setEtherbase(testBankAddress)
 	return w, backend
 }
 
+// Tests that a worker configured with an unknown strategy fails to start.
+func TestNewWorkerUnknownStrategy(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	config := *testConfig
+	config.Strategy = "random"
+
+	backend := newTestWorkerBackend(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	if _, err := newWorker(&config, ethashChainConfig, engine, backend, new(event.TypeMux), nil, false); err == nil {
+		t.Fatalf("unknown strategy accepted")
+	}
+}
+
 func TestGenerateBlockAndImportEthash(t *testing.T) {
 	testGenerateBlockAndImport(t, false)
 }
@@ -70,6 +70,11 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// DBEngine is the key-value database backend ("leveldb" or "pebble") used for
+	// newly created databases. Existing databases are always opened with the
+	// engine they were created with. If empty, LevelDB is used for new ones.
+	DBEngine string `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
@@ -139,6 +144,10 @@ type Config struct {
 	// interface.
 	HTTPTimeouts rpc.HTTPTimeouts
 
+	// RPCLimits configures the resource limits enforced on the clients of the
+	// HTTP and WebSocket RPC interfaces. The authenticated interface is exempt.
+	RPCLimits rpc.Limits
+
 	// HTTPPathPrefix specifies a path prefix on which http-rpc is to be served.
 	HTTPPathPrefix string `toml:",omitempty"`
 
@@ -185,6 +194,29 @@ type Config struct {
 	// Requests using ip address directly are not affected
 	GraphQLVirtualHosts []string `toml:",omitempty"`
 
+	// JWTSecret is the path to the file holding the hex encoded secret used to
+	// authenticate the requests to the authenticated RPC server. If this field is
+	// empty, no authenticated endpoint will be started. If the file doesn't exist,
+	// a new random secret is generated and written into it.
+	JWTSecret string `toml:",omitempty"`
+
+	// AuthAddr is the host interface on which to start the authenticated HTTP and
+	// websocket RPC server.
+	AuthAddr string `toml:",omitempty"`
+
+	// AuthPort is the TCP port number on which to start the authenticated HTTP and
+	// websocket RPC server.
+	AuthPort int `toml:",omitempty"`
+
+	// AuthVirtualHosts is the list of virtual hostnames which are allowed on incoming
+	// requests to the authenticated RPC server.
+	AuthVirtualHosts []string `toml:",omitempty"`
+
+	// AuthModules is a list of API modules to expose via the authenticated RPC
+	// server. If the module list is empty, all RPC API endpoints are exposed,
+	// including the ones not designated public.
+	AuthModules []string `toml:",omitempty"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
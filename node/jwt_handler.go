@@ -0,0 +1,163 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// jwtExpiryTimeout is the maximum allowed drift between the issued-at time of
+// a token and the local clock, in either direction.
+const jwtExpiryTimeout = 60 * time.Second
+
+var (
+	errMissingToken  = errors.New("missing token")
+	errInvalidToken  = errors.New("invalid token")
+	errInvalidAlg    = errors.New("unsupported signing algorithm")
+	errInvalidSig    = errors.New("signature is invalid")
+	errMissingIat    = errors.New("missing issued-at")
+	errStaleToken    = errors.New("stale token")
+	errFutureToken   = errors.New("future token")
+	errExpiredToken  = errors.New("token is expired")
+	jwtEncoding      = base64.RawURLEncoding
+	jwtDefaultHeader = jwtEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+)
+
+// jwtClaims are the registered claims of a token checked by the handler.
+type jwtClaims struct {
+	IssuedAt  *json.Number `json:"iat"`
+	ExpiresAt *json.Number `json:"exp"`
+}
+
+// jwtHandler is a http.Handler rejecting the requests which don't carry a valid,
+// fresh HS256 JSON Web Token signed with the configured secret.
+type jwtHandler struct {
+	secret []byte
+	next   http.Handler
+}
+
+// newJWTHandler wraps a http.Handler with JWT authentication.
+func newJWTHandler(secret []byte, next http.Handler) http.Handler {
+	return &jwtHandler{
+		secret: secret,
+		next:   next,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *jwtHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var token string
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if err := verifyJWT(h.secret, token, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// verifyJWT checks that token is a HS256 JSON Web Token signed with the given
+// secret, issued within jwtExpiryTimeout of now and not expired.
+func verifyJWT(secret []byte, token string, now time.Time) error {
+	if token == "" {
+		return errMissingToken
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errInvalidToken
+	}
+	// Only accept HS256, anything else (notably "none") is rejected
+	blob, err := jwtEncoding.DecodeString(parts[0])
+	if err != nil {
+		return errInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(blob, &header); err != nil {
+		return errInvalidToken
+	}
+	if header.Alg != "HS256" {
+		return errInvalidAlg
+	}
+	signature, err := jwtEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errInvalidToken
+	}
+	if !hmac.Equal(signature, jwtSign(secret, parts[0]+"."+parts[1])) {
+		return errInvalidSig
+	}
+	// Signature valid, check the freshness of the token
+	if blob, err = jwtEncoding.DecodeString(parts[1]); err != nil {
+		return errInvalidToken
+	}
+	var claims jwtClaims
+	dec := json.NewDecoder(bytes.NewReader(blob))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		return errInvalidToken
+	}
+	if claims.IssuedAt == nil {
+		return errMissingIat
+	}
+	iat, err := claims.IssuedAt.Int64()
+	if err != nil {
+		return errInvalidToken
+	}
+	issued := time.Unix(iat, 0)
+	switch {
+	case now.Sub(issued) > jwtExpiryTimeout:
+		return errStaleToken
+	case issued.Sub(now) > jwtExpiryTimeout:
+		return errFutureToken
+	}
+	if claims.ExpiresAt != nil {
+		exp, err := claims.ExpiresAt.Int64()
+		if err != nil {
+			return errInvalidToken
+		}
+		if !now.Before(time.Unix(exp, 0)) {
+			return errExpiredToken
+		}
+	}
+	return nil
+}
+
+// jwtSign computes the HS256 signature of the given token header and payload.
+func jwtSign(secret []byte, content string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(content))
+	return mac.Sum(nil)
+}
+
+// NewJWTToken creates a HS256 JSON Web Token issued now, signed with the given
+// secret, to authenticate against the authenticated RPC endpoints.
+func NewJWTToken(secret []byte) string {
+	payload := jwtEncoding.EncodeToString([]byte(fmt.Sprintf(`{"iat":%d}`, time.Now().Unix())))
+	content := jwtDefaultHeader + "." + payload
+	return content + "." + jwtEncoding.EncodeToString(jwtSign(secret, content))
+}
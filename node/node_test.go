@@ -17,6 +17,8 @@
 package node
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -24,10 +26,12 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/expanse-org/go-expanse/common"
 	"github.com/expanse-org/go-expanse/crypto"
 	"github.com/expanse-org/go-expanse/ethdb"
 	"github.com/expanse-org/go-expanse/p2p"
@@ -485,6 +489,54 @@ func TestWebsocketHTTPOnSeparatePort_WSRequest(t *testing.T) {
 	}
 }
 
+// Tests that the authenticated server exposes the private APIs to the requests
+// carrying a token signed with the generated secret, and only to them.
+func TestNodeAuthRPC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := testNodeConfig()
+	conf.JWTSecret = filepath.Join(dir, "jwtsecret")
+	conf.AuthAddr = "127.0.0.1"
+	node, err := New(conf)
+	if err != nil {
+		t.Fatalf("could not create a new node: %v", err)
+	}
+	defer node.Close()
+	if err := node.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	// The secret should have been generated and be reused by later nodes
+	blob, err := ioutil.ReadFile(conf.JWTSecret)
+	if err != nil {
+		t.Fatalf("failed to read generated secret: %v", err)
+	}
+	secret := common.FromHex(string(blob))
+	if reloaded, err := obtainJWTSecret(conf.JWTSecret); err != nil || !bytes.Equal(reloaded, secret) {
+		t.Fatalf("secret mismatch: have %x, want %x (err %v)", reloaded, secret, err)
+	}
+	client, err := rpc.DialHTTP(node.AuthEndpoint())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	var datadir string
+	if err := client.Call(&datadir, "admin_datadir"); err == nil {
+		t.Errorf("unauthenticated request accepted")
+	}
+	client.SetHeader("Authorization", "Bearer "+NewJWTToken(secret))
+	if err := client.Call(&datadir, "admin_datadir"); err != nil {
+		t.Errorf("authenticated request failed: %v", err)
+	}
+	if _, err := rpc.DialWebsocket(context.Background(), strings.Replace(node.AuthEndpoint(), "http://", "ws://", 1), ""); err == nil {
+		t.Errorf("unauthenticated websocket connection accepted")
+	}
+}
+
 type rpcPrefixTest struct {
 	httpPrefix, wsPrefix string
 	// These lists paths on which JSON-RPC should be served / not served.
@@ -24,6 +24,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/expanse-org/go-expanse/internal/testlog"
 	"github.com/expanse-org/go-expanse/log"
@@ -58,6 +59,59 @@ func TestVhosts(t *testing.T) {
 	assert.Equal(t, resp2.StatusCode, http.StatusForbidden)
 }
 
+// TestJWT makes sure JWT authentication is enforced on the http and ws servers.
+func TestJWT(t *testing.T) {
+	var (
+		secret = []byte("secretsecretsecretsecretsecret32")
+		now    = time.Now().Unix()
+		header = `{"alg":"HS256","typ":"JWT"}`
+	)
+	token := func(secret []byte, header, claims string) string {
+		content := jwtEncoding.EncodeToString([]byte(header)) + "." + jwtEncoding.EncodeToString([]byte(claims))
+		return "Bearer " + content + "." + jwtEncoding.EncodeToString(jwtSign(secret, content))
+	}
+	srv := createAndStartServer(t, &httpConfig{jwtSecret: secret}, true, &wsConfig{jwtSecret: secret})
+	defer srv.stop()
+	httpURL, wsURL := "http://"+srv.listenAddr(), "ws://"+srv.listenAddr()
+
+	valid := []string{
+		"Bearer " + NewJWTToken(secret),
+		token(secret, header, fmt.Sprintf(`{"iat":%d}`, now)),
+		token(secret, header, fmt.Sprintf(`{"iat":%d}`, now-50)),
+		token(secret, header, fmt.Sprintf(`{"iat":%d}`, now+50)),
+		token(secret, header, fmt.Sprintf(`{"iat":%d,"exp":%d}`, now, now+10)),
+	}
+	for i, auth := range valid {
+		if resp := rpcRequest(t, httpURL, "Authorization", auth); resp.StatusCode != http.StatusOK {
+			t.Errorf("token %d: http request rejected: %v", i, resp.Status)
+		}
+		if err := wsRequest(t, wsURL, "", "Authorization", auth); err != nil {
+			t.Errorf("token %d: ws connection rejected: %v", i, err)
+		}
+	}
+	invalid := []string{
+		"",
+		"Bearer ",
+		"Bearer bogus",
+		strings.TrimPrefix(token(secret, header, fmt.Sprintf(`{"iat":%d}`, now)), "Bearer "),
+		token([]byte("wrongsecret"), header, fmt.Sprintf(`{"iat":%d}`, now)),
+		token(secret, `{"alg":"none","typ":"JWT"}`, fmt.Sprintf(`{"iat":%d}`, now)),
+		token(secret, `{"alg":"HS512","typ":"JWT"}`, fmt.Sprintf(`{"iat":%d}`, now)),
+		token(secret, header, `{}`),
+		token(secret, header, fmt.Sprintf(`{"iat":%d}`, now-70)),
+		token(secret, header, fmt.Sprintf(`{"iat":%d}`, now+70)),
+		token(secret, header, fmt.Sprintf(`{"iat":%d,"exp":%d}`, now, now-1)),
+	}
+	for i, auth := range invalid {
+		if resp := rpcRequest(t, httpURL, "Authorization", auth); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("token %d: http request not rejected: %v", i, resp.Status)
+		}
+		if err := wsRequest(t, wsURL, "", "Authorization", auth); err == nil {
+			t.Errorf("token %d: ws connection not rejected", i)
+		}
+	}
+}
+
 type originTest struct {
 	spec    string
 	expOk   []string
@@ -243,7 +297,7 @@ func createAndStartServer(t *testing.T, conf *httpConfig, ws bool, wsConf *wsCon
 }
 
 // wsRequest attempts to open a WebSocket connection to the given URL.
-func wsRequest(t *testing.T, url, browserOrigin string) error {
+func wsRequest(t *testing.T, url, browserOrigin string, extraHeaders ...string) error {
 	t.Helper()
 	t.Logf("checking WebSocket on %s (origin %q)", url, browserOrigin)
 
@@ -251,6 +305,9 @@ func wsRequest(t *testing.T, url, browserOrigin string) error {
 	if browserOrigin != "" {
 		headers.Set("Origin", browserOrigin)
 	}
+	for i := 0; i < len(extraHeaders); i += 2 {
+		headers.Set(extraHeaders[i], extraHeaders[i+1])
+	}
 	conn, _, err := websocket.DefaultDialer.Dial(url, headers)
 	if conn != nil {
 		conn.Close()
@@ -18,6 +18,7 @@ package params
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 
@@ -73,6 +74,8 @@ var (
 		BerlinBlock:      big.NewInt(8_500_000),
 		PhoenixBlock:     big.NewInt(8_500_000), // XIP5Block
 		LondonBlock:      nil,
+		PirlGuardBlock:   big.NewInt(8_500_000),
+		PirlGuardLength:  15, // Reorgs deeper than this are checked for delayed release
 		Ethash:           new(EthashConfig),
 	}
 
@@ -443,6 +446,10 @@ type ChainConfig struct {
 
 	PhoenixBlock *big.Int `json:"phoenixBlock,omitempty"` // XIP5Block
 
+	// Pirl Guard reorg penalty, a node-local policy rather than a consensus rule
+	PirlGuardBlock  *big.Int `json:"pirlGuardBlock,omitempty"`  // Pirl Guard activation block (nil = disabled, 0 = always on)
+	PirlGuardLength uint64   `json:"pirlGuardLength,omitempty"` // Reorg depth below head tolerated without a penalty check
+
 	// Various consensus engines
 	Ethash  *EthashConfig  `json:"ethash,omitempty"`
 	Frkhash *FrkhashConfig `json:"frkhash,omitempty"`
@@ -458,7 +465,155 @@ func (c *EthashConfig) String() string {
 }
 
 // FrkhashConfig is the consensus engine configs for proof-of-work based sealing.
-type FrkhashConfig struct{}
+type FrkhashConfig struct {
+	// AlgorithmSchedule switches the proof-of-work seal function at the given
+	// fork blocks. Until the first scheduled fork the default algorithm is used.
+	AlgorithmSchedule []FrkhashAlgorithmFork `json:"algorithmSchedule,omitempty"`
+
+	// RewardSchedule replaces the protocol block rewards from the given fork
+	// blocks on. Until the first scheduled fork the protocol rewards are used.
+	RewardSchedule []FrkhashRewardFork `json:"rewardSchedule,omitempty"`
+}
+
+// FrkhashRewardFork configures the frkhash block rewards from a fork block on.
+type FrkhashRewardFork struct {
+	Block              *big.Int `json:"block"`                        // Activation block of the reward rules
+	BlockReward        *big.Int `json:"blockReward"`                  // Base reward in wei for mining a block
+	UncleRewardDivisor uint64   `json:"uncleRewardDivisor,omitempty"` // Divisor of the depth scaled uncle reward (0 = 8)
+
+	TreasuryAddress *common.Address `json:"treasuryAddress,omitempty"` // Recipient of the treasury share of each block reward
+	TreasuryPercent uint64          `json:"treasuryPercent,omitempty"` // Percentage of the block reward paid to the treasury
+
+	EraLength           uint64 `json:"eraLength,omitempty"`           // Number of blocks per reward era, counted from the fork block (0 = no eras)
+	EraReductionPercent uint64 `json:"eraReductionPercent,omitempty"` // Percentage the block reward is reduced by in each new era
+}
+
+// Reward returns the reward rules scheduled at block num, or nil if the protocol
+// rewards are to be used.
+func (c *FrkhashConfig) Reward(num *big.Int) *FrkhashRewardFork {
+	if c == nil {
+		return nil
+	}
+	var reward *FrkhashRewardFork
+	for i := range c.RewardSchedule {
+		if isForked(c.RewardSchedule[i].Block, num) {
+			reward = &c.RewardSchedule[i]
+		}
+	}
+	return reward
+}
+
+// check verifies that the reward rules are consistent.
+func (r *FrkhashRewardFork) check() error {
+	switch {
+	case r.Block == nil:
+		return errors.New("frkhash reward fork has no activation block")
+	case r.BlockReward == nil || r.BlockReward.Sign() < 0:
+		return fmt.Errorf("frkhash reward fork at %v has invalid block reward %v", r.Block, r.BlockReward)
+	case r.TreasuryPercent > 100:
+		return fmt.Errorf("frkhash reward fork at %v has treasury percentage %d above 100", r.Block, r.TreasuryPercent)
+	case r.TreasuryPercent > 0 && r.TreasuryAddress == nil:
+		return fmt.Errorf("frkhash reward fork at %v has a treasury percentage but no treasury address", r.Block)
+	case r.EraReductionPercent > 100:
+		return fmt.Errorf("frkhash reward fork at %v has era reduction percentage %d above 100", r.Block, r.EraReductionPercent)
+	case r.EraReductionPercent > 0 && r.EraLength == 0:
+		return fmt.Errorf("frkhash reward fork at %v has an era reduction but no era length", r.Block)
+	}
+	return nil
+}
+
+// equal returns whether two reward rules are identical.
+func (r *FrkhashRewardFork) equal(o *FrkhashRewardFork) bool {
+	if r == nil || o == nil {
+		return r == o
+	}
+	if (r.TreasuryAddress == nil) != (o.TreasuryAddress == nil) ||
+		(r.TreasuryAddress != nil && *r.TreasuryAddress != *o.TreasuryAddress) {
+		return false
+	}
+	return configNumEqual(r.Block, o.Block) && configNumEqual(r.BlockReward, o.BlockReward) &&
+		r.UncleRewardDivisor == o.UncleRewardDivisor && r.TreasuryPercent == o.TreasuryPercent &&
+		r.EraLength == o.EraLength && r.EraReductionPercent == o.EraReductionPercent
+}
+
+// FrkhashAlgorithmFork schedules a frkhash seal algorithm from a fork block on.
+type FrkhashAlgorithmFork struct {
+	Block     *big.Int `json:"block"`     // Activation block of the algorithm
+	Algorithm string   `json:"algorithm"` // Name of the algorithm in the frkhash registry
+}
+
+// Algorithm returns the name of the seal algorithm scheduled at block num, or
+// an empty string if the default algorithm is to be used.
+func (c *FrkhashConfig) Algorithm(num *big.Int) string {
+	if c == nil {
+		return ""
+	}
+	var name string
+	for _, fork := range c.AlgorithmSchedule {
+		if isForked(fork.Block, num) {
+			name = fork.Algorithm
+		}
+	}
+	return name
+}
+
+// CheckSchedule verifies that the algorithm and reward forks are listed in
+// ascending order and that the reward rules are consistent.
+func (c *FrkhashConfig) CheckSchedule() error {
+	if c == nil {
+		return nil
+	}
+	for i := range c.RewardSchedule {
+		fork := &c.RewardSchedule[i]
+		if err := fork.check(); err != nil {
+			return err
+		}
+		if i > 0 && c.RewardSchedule[i-1].Block.Cmp(fork.Block) >= 0 {
+			return fmt.Errorf("unsupported frkhash reward ordering: fork at %v scheduled after fork at %v",
+				fork.Block, c.RewardSchedule[i-1].Block)
+		}
+	}
+	for i, fork := range c.AlgorithmSchedule {
+		if fork.Block == nil {
+			return fmt.Errorf("frkhash algorithm %q has no activation block", fork.Algorithm)
+		}
+		if i > 0 && c.AlgorithmSchedule[i-1].Block.Cmp(fork.Block) >= 0 {
+			return fmt.Errorf("unsupported frkhash algorithm ordering: %v enabled at %v, but %v enabled at %v",
+				c.AlgorithmSchedule[i-1].Algorithm, c.AlgorithmSchedule[i-1].Block, fork.Algorithm, fork.Block)
+		}
+	}
+	return nil
+}
+
+// checkCompatible returns the first scheduled algorithm or reward fork at or
+// below head where the two schedules disagree, nil if they are compatible.
+func (c *FrkhashConfig) checkCompatible(newcfg *FrkhashConfig, head *big.Int) *big.Int {
+	var blocks []*big.Int
+	for _, cfg := range []*FrkhashConfig{c, newcfg} {
+		if cfg == nil {
+			continue
+		}
+		for _, fork := range cfg.AlgorithmSchedule {
+			blocks = append(blocks, fork.Block)
+		}
+		for _, fork := range cfg.RewardSchedule {
+			blocks = append(blocks, fork.Block)
+		}
+	}
+	var lowest *big.Int
+	for _, block := range blocks {
+		if !isForked(block, head) {
+			continue
+		}
+		if c.Algorithm(block) == newcfg.Algorithm(block) && c.Reward(block).equal(newcfg.Reward(block)) {
+			continue
+		}
+		if lowest == nil || block.Cmp(lowest) < 0 {
+			lowest = block
+		}
+	}
+	return lowest
+}
 
 // String implements the stringer interface, returning the consensus engine details.
 func (c *FrkhashConfig) String() string {
@@ -581,6 +736,51 @@ func (c *ChainConfig) IsPhoenix(num *big.Int) bool {
 	return isForked(c.PhoenixBlock, num)
 }
 
+// IsPirlGuard returns whether num is either equal to the Pirl Guard activation
+// block or greater.
+func (c *ChainConfig) IsPirlGuard(num *big.Int) bool {
+	return isForked(c.PirlGuardBlock, num)
+}
+
+// Fork is a protocol upgrade of the chain configuration.
+type Fork struct {
+	Name  string   // Name of the fork, matching its configuration field
+	Block *big.Int // Activation block of the fork (nil = not scheduled)
+	EIPs  []string // Protocol changes enabled by the fork
+}
+
+// Forks returns all the consensus forks of the chain configuration in their
+// activation order, including the ones not scheduled, followed by the frkhash
+// algorithm and reward transitions. Node-local policies such as the Pirl Guard
+// are not forks and are not included.
+func (c *ChainConfig) Forks() []Fork {
+	forks := []Fork{
+		{Name: "homestead", Block: c.HomesteadBlock, EIPs: []string{"EIP-2", "EIP-7", "EIP-8"}},
+		{Name: "daoFork", Block: c.DAOForkBlock},
+		{Name: "eip150", Block: c.EIP150Block, EIPs: []string{"EIP-150"}},
+		{Name: "eip155", Block: c.EIP155Block, EIPs: []string{"EIP-155"}},
+		{Name: "eip158", Block: c.EIP158Block, EIPs: []string{"EIP-160", "EIP-161", "EIP-170"}},
+		{Name: "byzantium", Block: c.ByzantiumBlock, EIPs: []string{"EIP-100", "EIP-140", "EIP-196", "EIP-197", "EIP-198", "EIP-211", "EIP-214", "EIP-649", "EIP-658"}},
+		{Name: "constantinople", Block: c.ConstantinopleBlock, EIPs: []string{"EIP-145", "EIP-1014", "EIP-1052", "EIP-1234", "EIP-1283"}},
+		{Name: "petersburg", Block: c.PetersburgBlock, EIPs: []string{"EIP-1716"}},
+		{Name: "istanbul", Block: c.IstanbulBlock, EIPs: []string{"EIP-152", "EIP-1108", "EIP-1344", "EIP-1884", "EIP-2028", "EIP-2200"}},
+		{Name: "muirGlacier", Block: c.MuirGlacierBlock, EIPs: []string{"EIP-2384"}},
+		{Name: "berlin", Block: c.BerlinBlock, EIPs: []string{"EIP-2565", "EIP-2718", "EIP-2929", "EIP-2930"}},
+		{Name: "phoenix", Block: c.PhoenixBlock, EIPs: []string{"XIP-5"}},
+		{Name: "london", Block: c.LondonBlock, EIPs: []string{"EIP-1559", "EIP-3198", "EIP-3529", "EIP-3541"}},
+		{Name: "catalyst", Block: c.CatalystBlock, EIPs: []string{"EIP-3675"}},
+	}
+	if c.Frkhash != nil {
+		for i, fork := range c.Frkhash.AlgorithmSchedule {
+			forks = append(forks, Fork{Name: fmt.Sprintf("frkhash.algorithmSchedule[%d]", i), Block: fork.Block})
+		}
+		for i, fork := range c.Frkhash.RewardSchedule {
+			forks = append(forks, Fork{Name: fmt.Sprintf("frkhash.rewardSchedule[%d]", i), Block: fork.Block})
+		}
+	}
+	return forks
+}
+
 // CheckCompatible checks whether scheduled fork transitions have been imported
 // with a mismatching chain configuration.
 func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *ConfigCompatError {
@@ -641,7 +841,7 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 			lastFork = cur
 		}
 	}
-	return nil
+	return c.Frkhash.CheckSchedule()
 }
 
 func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *ConfigCompatError {
@@ -694,6 +894,9 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.LondonBlock, newcfg.LondonBlock, head) {
 		return newCompatError("London fork block", c.LondonBlock, newcfg.LondonBlock)
 	}
+	if block := c.Frkhash.checkCompatible(newcfg.Frkhash, head); block != nil {
+		return newCompatError("Frkhash schedule fork block", block, block)
+	}
 	return nil
 }
 
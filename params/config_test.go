@@ -20,6 +20,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/expanse-org/go-expanse/common"
 )
 
 func TestCheckCompatible(t *testing.T) {
@@ -87,6 +89,55 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     30,
 			},
 		},
+		{
+			stored:  &ChainConfig{Frkhash: &FrkhashConfig{AlgorithmSchedule: []FrkhashAlgorithmFork{{big.NewInt(50), "sha3"}}}},
+			new:     &ChainConfig{Frkhash: &FrkhashConfig{AlgorithmSchedule: []FrkhashAlgorithmFork{{big.NewInt(60), "sha3"}}}},
+			head:    40,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{Frkhash: &FrkhashConfig{AlgorithmSchedule: []FrkhashAlgorithmFork{{big.NewInt(50), "sha3"}}}},
+			new:    &ChainConfig{Frkhash: &FrkhashConfig{AlgorithmSchedule: []FrkhashAlgorithmFork{{big.NewInt(50), "blake2b"}}}},
+			head:   60,
+			wantErr: &ConfigCompatError{
+				What:         "Frkhash schedule fork block",
+				StoredConfig: big.NewInt(50),
+				NewConfig:    big.NewInt(50),
+				RewindTo:     49,
+			},
+		},
+		{
+			stored: &ChainConfig{Frkhash: new(FrkhashConfig)},
+			new:    &ChainConfig{Frkhash: &FrkhashConfig{AlgorithmSchedule: []FrkhashAlgorithmFork{{big.NewInt(30), "sha3"}, {big.NewInt(50), "blake2b"}}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "Frkhash schedule fork block",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(30),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored: &ChainConfig{Frkhash: &FrkhashConfig{RewardSchedule: []FrkhashRewardFork{{Block: big.NewInt(50), BlockReward: big.NewInt(2e18)}}}},
+			new:    &ChainConfig{Frkhash: &FrkhashConfig{RewardSchedule: []FrkhashRewardFork{{Block: big.NewInt(50), BlockReward: big.NewInt(2e18)}}}},
+			head:   60,
+		},
+		{
+			stored: &ChainConfig{Frkhash: &FrkhashConfig{RewardSchedule: []FrkhashRewardFork{{Block: big.NewInt(50), BlockReward: big.NewInt(2e18)}}}},
+			new:    &ChainConfig{Frkhash: &FrkhashConfig{RewardSchedule: []FrkhashRewardFork{{Block: big.NewInt(50), BlockReward: big.NewInt(3e18)}}}},
+			head:   40,
+		},
+		{
+			stored: &ChainConfig{Frkhash: &FrkhashConfig{RewardSchedule: []FrkhashRewardFork{{Block: big.NewInt(50), BlockReward: big.NewInt(2e18)}}}},
+			new:    &ChainConfig{Frkhash: &FrkhashConfig{RewardSchedule: []FrkhashRewardFork{{Block: big.NewInt(50), BlockReward: big.NewInt(3e18)}}}},
+			head:   60,
+			wantErr: &ConfigCompatError{
+				What:         "Frkhash schedule fork block",
+				StoredConfig: big.NewInt(50),
+				NewConfig:    big.NewInt(50),
+				RewindTo:     49,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -96,3 +147,108 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestFrkhashAlgorithmSchedule(t *testing.T) {
+	config := &FrkhashConfig{AlgorithmSchedule: []FrkhashAlgorithmFork{
+		{Block: big.NewInt(10), Algorithm: "sha3"},
+		{Block: big.NewInt(20), Algorithm: "blake2b"},
+	}}
+	for num, want := range map[int64]string{0: "", 9: "", 10: "sha3", 19: "sha3", 20: "blake2b", 1000: "blake2b"} {
+		if have := config.Algorithm(big.NewInt(num)); have != want {
+			t.Errorf("block %d: algorithm mismatch: have %q, want %q", num, have, want)
+		}
+	}
+	if err := config.CheckSchedule(); err != nil {
+		t.Errorf("valid schedule rejected: %v", err)
+	}
+	config.AlgorithmSchedule[1].Block = big.NewInt(10)
+	if err := config.CheckSchedule(); err == nil {
+		t.Errorf("unordered schedule accepted")
+	}
+}
+
+func TestFrkhashRewardSchedule(t *testing.T) {
+	treasury := common.Address{0x01}
+	valid := FrkhashRewardFork{Block: big.NewInt(10), BlockReward: big.NewInt(4e18), TreasuryAddress: &treasury, TreasuryPercent: 10}
+
+	tests := []struct {
+		name   string
+		modify func(*FrkhashRewardFork)
+		valid  bool
+	}{
+		{"valid", func(r *FrkhashRewardFork) {}, true},
+		{"no block", func(r *FrkhashRewardFork) { r.Block = nil }, false},
+		{"no reward", func(r *FrkhashRewardFork) { r.BlockReward = nil }, false},
+		{"negative reward", func(r *FrkhashRewardFork) { r.BlockReward = big.NewInt(-1) }, false},
+		{"treasury above 100", func(r *FrkhashRewardFork) { r.TreasuryPercent = 101 }, false},
+		{"treasury without address", func(r *FrkhashRewardFork) { r.TreasuryAddress = nil }, false},
+		{"era reduction", func(r *FrkhashRewardFork) { r.EraLength, r.EraReductionPercent = 100, 20 }, true},
+		{"era reduction above 100", func(r *FrkhashRewardFork) { r.EraLength, r.EraReductionPercent = 100, 120 }, false},
+		{"era reduction without length", func(r *FrkhashRewardFork) { r.EraReductionPercent = 20 }, false},
+	}
+	for _, tt := range tests {
+		fork := valid
+		tt.modify(&fork)
+		config := &FrkhashConfig{RewardSchedule: []FrkhashRewardFork{fork}}
+		if err := config.CheckSchedule(); (err == nil) != tt.valid {
+			t.Errorf("%s: validity mismatch: have %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+	config := &FrkhashConfig{RewardSchedule: []FrkhashRewardFork{valid, valid}}
+	config.RewardSchedule[1].Block = big.NewInt(20)
+	for num, want := range map[int64]int64{0: -1, 9: -1, 10: 10, 19: 10, 20: 20, 1000: 20} {
+		have := int64(-1)
+		if rules := config.Reward(big.NewInt(num)); rules != nil {
+			have = rules.Block.Int64()
+		}
+		if have != want {
+			t.Errorf("block %d: reward fork mismatch: have %d, want %d", num, have, want)
+		}
+	}
+	config.RewardSchedule[1].Block = big.NewInt(5)
+	if err := config.CheckSchedule(); err == nil {
+		t.Errorf("unordered schedule accepted")
+	}
+}
+
+// Tests that every fork block of the chain configuration is reported as a fork,
+// so that the fork ID and the fork schedule cannot miss newly added forks.
+func TestForks(t *testing.T) {
+	config := new(ChainConfig)
+	forks := make(map[*big.Int]bool)
+
+	kind, value := reflect.TypeOf(*config), reflect.ValueOf(config).Elem()
+	for i := 0; i < kind.NumField(); i++ {
+		if field := kind.Field(i); field.Type == reflect.TypeOf(new(big.Int)) && field.Name != "ChainID" && field.Name != "PirlGuardBlock" {
+			block := big.NewInt(int64(i))
+			value.Field(i).Set(reflect.ValueOf(block))
+			forks[block] = true
+		}
+	}
+	// The frkhash seal algorithm and reward transitions are forks too
+	config.Frkhash = &FrkhashConfig{
+		AlgorithmSchedule: []FrkhashAlgorithmFork{
+			{Block: big.NewInt(100), Algorithm: "frankomoto"},
+			{Block: big.NewInt(101), Algorithm: "sha3-256"},
+		},
+		RewardSchedule: []FrkhashRewardFork{
+			{Block: big.NewInt(102), BlockReward: big.NewInt(4)},
+			{Block: big.NewInt(103), BlockReward: big.NewInt(2)},
+		},
+	}
+	for _, fork := range config.Frkhash.AlgorithmSchedule {
+		forks[fork.Block] = true
+	}
+	for _, fork := range config.Frkhash.RewardSchedule {
+		forks[fork.Block] = true
+	}
+	for _, fork := range config.Forks() {
+		if !forks[fork.Block] {
+			t.Errorf("fork %s: unknown or duplicate activation block %v", fork.Name, fork.Block)
+		}
+		delete(forks, fork.Block)
+	}
+	for block := range forks {
+		t.Errorf("fork block of field %d not reported", block)
+	}
+}
@@ -32,6 +32,15 @@ const (
 	// considered probably final and its rotated bits are calculated.
 	BloomConfirms = 256
 
+	// TransferIndexBlocks is the number of blocks a single transfer index section
+	// contains. Sections are built by re-executing their blocks, so they are kept
+	// short enough for the required state to still be around when processed.
+	TransferIndexBlocks uint64 = 64
+
+	// TransferIndexConfirms is the number of confirmation blocks before a transfer
+	// index section is considered probably final and its blocks are re-executed.
+	TransferIndexConfirms = 16
+
 	// CHTFrequency is the block frequency for creating CHTs
 	CHTFrequency = 32768
 
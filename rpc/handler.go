@@ -19,6 +19,7 @@ package rpc
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
@@ -60,6 +61,7 @@ type handler struct {
 	cancelRoot     func()                         // cancel function for rootCtx
 	conn           jsonWriter                     // where responses will be sent
 	log            log.Logger
+	limits         *limiter // resource limits of the server, nil for clients
 	allowSubscribe bool
 
 	subLock    sync.Mutex
@@ -71,7 +73,7 @@ type callProc struct {
 	notifiers []*Notifier
 }
 
-func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *serviceRegistry) *handler {
+func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *serviceRegistry, limits *limiter) *handler {
 	rootCtx, cancelRoot := context.WithCancel(connCtx)
 	h := &handler{
 		reg:            reg,
@@ -84,6 +86,7 @@ func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *
 		allowSubscribe: true,
 		serverSubs:     make(map[ID]*Subscription),
 		log:            log.Root(),
+		limits:         limits,
 	}
 	if conn.remoteAddr() != "" {
 		h.log = h.log.New("conn", conn.remoteAddr())
@@ -101,6 +104,14 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 		})
 		return
 	}
+	// Reject batches with more requests than allowed as a whole:
+	if limit := h.limits.batchItems(); limit > 0 && len(msgs) > limit {
+		batchLimitMeter.Mark(1)
+		h.startCallProc(func(cp *callProc) {
+			h.conn.writeJSON(cp.ctx, errorMessage(&invalidRequestError{fmt.Sprintf("batch too large (%d>%d)", len(msgs), limit)}))
+		})
+		return
+	}
 
 	// Handle non-call messages first:
 	calls := make([]*jsonrpcMessage, 0, len(msgs))
@@ -114,11 +125,29 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 	}
 	// Process calls on a goroutine because they may block indefinitely:
 	h.startCallProc(func(cp *callProc) {
-		answers := make([]*jsonrpcMessage, 0, len(msgs))
-		for _, msg := range calls {
-			if answer := h.handleCallMsg(cp, msg); answer != nil {
-				answers = append(answers, answer)
+		var (
+			answers = make([]*jsonrpcMessage, 0, len(msgs))
+			limit   = h.limits.batchResponseSize()
+			size    int
+		)
+		for i, msg := range calls {
+			answer := h.handleCallMsg(cp, msg)
+			if answer == nil {
+				continue
+			}
+			// If the answer would push the response over the limit, fail it along
+			// with the remaining calls without running them
+			if limit > 0 && size+answerSize(answer) > limit {
+				sizeLimitMeter.Mark(1)
+				for _, msg := range calls[i:] {
+					if msg.hasValidID() {
+						answers = append(answers, msg.errorResponse(&responseTooLargeError{limit}))
+					}
+				}
+				break
 			}
+			answers = append(answers, answer)
+			size += answerSize(answer)
 		}
 		h.addSubscriptions(cp.notifiers)
 		if len(answers) > 0 {
@@ -130,6 +159,16 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 	})
 }
 
+// answerSize returns the size of the result or error carried by an answer.
+func answerSize(answer *jsonrpcMessage) int {
+	size := len(answer.Result)
+	if answer.Error != nil {
+		blob, _ := json.Marshal(answer.Error)
+		size += len(blob)
+	}
+	return size
+}
+
 // handleMsg handles a single message.
 func (h *handler) handleMsg(msg *jsonrpcMessage) {
 	if ok := h.handleImmediate(msg); ok {
@@ -317,6 +356,9 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 
 // handleCall processes method calls.
 func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
+	if err := h.limits.allow(h.conn.remoteAddr(), h.conn.forwardedFor(), msg.Method); err != nil {
+		return msg.errorResponse(err)
+	}
 	if msg.isSubscribe() {
 		return h.handleSubscribe(cp, msg)
 	}
@@ -334,7 +376,7 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
 	start := time.Now()
-	answer := h.runMethod(cp.ctx, msg, callb, args)
+	answer := h.runCall(cp.ctx, msg, callb, args)
 
 	// Collect the statistics for RPC calls if metrics is enabled.
 	// We only care about pure rpc call. Filter out subscription.
@@ -393,6 +435,44 @@ func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *cal
 	return msg.response(result)
 }
 
+// runCall runs the Go callback for an RPC method call, failing it if it doesn't
+// finish within the method's execution timeout. The context of a timed out call
+// is canceled, but callbacks ignoring their context can't be stopped. Up to
+// maxTimedOutCalls of those are left running in the background, any further
+// timed out call holds back its error response until the callback returns.
+func (h *handler) runCall(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value) *jsonrpcMessage {
+	timeout := h.limits.timeout(msg.Method)
+	if timeout <= 0 {
+		return h.runMethod(ctx, msg, callb, args)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan *jsonrpcMessage, 1)
+	go func() {
+		done <- h.runMethod(ctx, msg, callb, args)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case answer := <-done:
+		return answer
+	case <-timer.C:
+		timeoutLimitMeter.Mark(1)
+		select {
+		case h.limits.timedOut <- struct{}{}:
+			go func() {
+				<-done
+				<-h.limits.timedOut
+			}()
+		default:
+			<-done
+		}
+		return msg.errorResponse(&timeoutError{msg.Method})
+	}
+}
+
 // unsubscribe is the callback function for all *_unsubscribe calls.
 func (h *handler) unsubscribe(ctx context.Context, id ID) (bool, error) {
 	h.subLock.Lock()
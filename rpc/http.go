@@ -57,6 +57,10 @@ func (hc *httpConn) remoteAddr() string {
 	return hc.url
 }
 
+func (hc *httpConn) forwardedFor() string {
+	return ""
+}
+
 func (hc *httpConn) readBatch() ([]*jsonrpcMessage, bool, error) {
 	<-hc.closeCh
 	return nil, false, io.EOF
@@ -211,7 +215,9 @@ type httpServerConn struct {
 func newHTTPServerConn(r *http.Request, w http.ResponseWriter) ServerCodec {
 	body := io.LimitReader(r.Body, maxRequestContentLength)
 	conn := &httpServerConn{Reader: body, Writer: w, r: r}
-	return NewCodec(conn)
+	codec := NewCodec(conn).(*jsonCodec)
+	codec.forwarded = r.Header.Get("X-Forwarded-For")
+	return codec
 }
 
 // Close does nothing and always returns nil.
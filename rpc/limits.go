@@ -0,0 +1,212 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/expanse-org/go-expanse/log"
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// maxLimitedBuckets is the number of token buckets tracked by the rate limiter.
+	// The least recently used buckets are dropped beyond it, refilling them.
+	maxLimitedBuckets = 16384
+
+	// maxTimedOutCalls is the number of timed out method calls allowed to keep
+	// running in the background. Beyond it, timed out calls are waited for before
+	// their timeout error is returned.
+	maxTimedOutCalls = 64
+)
+
+// Limits configures the resources a Server allows its clients to consume. The
+// zero value disables all limits.
+//
+// Request rates are enforced per remote IP address and therefore only apply to
+// connections with a known remote address (HTTP and WebSocket), but not to the
+// in-process and IPC ones. The X-Forwarded-For header of a request is only used
+// to identify the client if the request arrives from one of the TrustedProxies.
+type Limits struct {
+	BatchItems        int // Maximum number of requests in a batch (0 = unlimited)
+	BatchResponseSize int // Maximum size of the results of a batch in bytes (0 = unlimited)
+
+	RequestRate  float64            // Requests per second allowed per remote IP (0 = unlimited)
+	RequestBurst int                // Requests allowed at once above RequestRate (0 = one second worth)
+	MethodRates  map[string]float64 // Requests per second allowed per remote IP for single methods, bursting one second worth
+
+	TrustedProxies []string // IPs or CIDR ranges of reverse proxies whose X-Forwarded-For header is honoured
+
+	CallTimeout    time.Duration            // Maximum execution time of a method call (0 = unlimited)
+	MethodTimeouts map[string]time.Duration // Execution timeouts overriding CallTimeout for single methods
+}
+
+// limiter enforces the configured Limits on the clients of a server. A nil
+// limiter permits everything.
+type limiter struct {
+	config  Limits
+	proxies []*net.IPNet // Parsed trusted reverse proxy ranges
+	buckets *lru.Cache   // Token buckets keyed by remote IP or remote IP and method
+	lock    sync.Mutex   // Serialises the creation of new buckets
+
+	timedOut chan struct{} // Slots of the timed out calls still running in the background
+}
+
+// newLimiter creates a limiter enforcing the given limits. Invalid trusted proxy
+// entries are ignored.
+func newLimiter(config Limits) *limiter {
+	buckets, _ := lru.New(maxLimitedBuckets)
+	l := &limiter{
+		config:   config,
+		buckets:  buckets,
+		timedOut: make(chan struct{}, maxTimedOutCalls),
+	}
+	for _, entry := range config.TrustedProxies {
+		proxy, err := ParseTrustedProxy(entry)
+		if err != nil {
+			log.Warn("Ignoring invalid trusted RPC proxy", "proxy", entry, "err", err)
+			continue
+		}
+		l.proxies = append(l.proxies, proxy)
+	}
+	return l
+}
+
+// ParseTrustedProxy parses a trusted reverse proxy given either as a single IP
+// address or as a CIDR range.
+func ParseTrustedProxy(entry string) (*net.IPNet, error) {
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: entry}
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(entry)
+	return network, err
+}
+
+// batchItems returns the maximum number of requests allowed in a batch.
+func (l *limiter) batchItems() int {
+	if l == nil {
+		return 0
+	}
+	return l.config.BatchItems
+}
+
+// batchResponseSize returns the maximum size of the results of a batch.
+func (l *limiter) batchResponseSize() int {
+	if l == nil {
+		return 0
+	}
+	return l.config.BatchResponseSize
+}
+
+// timeout returns the maximum execution time of the given method.
+func (l *limiter) timeout(method string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	if timeout, ok := l.config.MethodTimeouts[method]; ok {
+		return timeout
+	}
+	return l.config.CallTimeout
+}
+
+// allow consumes a token from the buckets of the client, returning an error if
+// the request exceeds either the overall or the method's rate.
+func (l *limiter) allow(remote, forwarded, method string) error {
+	if l == nil || remote == "" {
+		return nil
+	}
+	ip := l.clientIP(remote, forwarded)
+	if limit := l.config.RequestRate; limit > 0 && !l.bucket(ip, limit, l.config.RequestBurst).Allow() {
+		rateLimitMeter.Mark(1)
+		return &rateLimitError{method}
+	}
+	if limit := l.config.MethodRates[method]; limit > 0 && !l.bucket(ip+" "+method, limit, 0).Allow() {
+		rateLimitMeter.Mark(1)
+		return &rateLimitError{method}
+	}
+	return nil
+}
+
+// clientIP resolves the address of the client issuing a request. Requests from
+// trusted proxies are attributed to the last address in their X-Forwarded-For
+// header not belonging to a trusted proxy itself, as any address before it may
+// have been forged by the client.
+func (l *limiter) clientIP(remote, forwarded string) string {
+	ip := remote
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		ip = host
+	}
+	if forwarded == "" || !l.trusted(ip) {
+		return ip
+	}
+	hops := strings.Split(forwarded, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break // Malformed header, stick to the last valid hop
+		}
+		ip = hop
+		if !l.trusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// trusted reports whether the given IP address belongs to a trusted proxy.
+func (l *limiter) trusted(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, proxy := range l.proxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// bucket retrieves the token bucket stored under key, creating it with the
+// given rate and burst if it doesn't exist yet.
+func (l *limiter) bucket(key string, limit float64, burst int) *rate.Limiter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if bucket, ok := l.buckets.Get(key); ok {
+		return bucket.(*rate.Limiter)
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(limit))
+	}
+	bucket := rate.NewLimiter(rate.Limit(limit), burst)
+	l.buckets.Add(key, bucket)
+	return bucket
+}
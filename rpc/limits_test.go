@@ -0,0 +1,234 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newLimitedTestServer starts a HTTP test server enforcing the given limits.
+func newLimitedTestServer(t *testing.T, limits Limits) (*Server, *httptest.Server) {
+	server := newTestServer()
+	server.SetLimits(limits)
+	httpsrv := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpsrv.Close()
+		server.Stop()
+	})
+	return server, httpsrv
+}
+
+// postJSON sends a raw JSON-RPC request and decodes the response into result.
+func postJSON(t *testing.T, url, body string, result interface{}) {
+	t.Helper()
+	resp, err := http.Post(url, contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	blob, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if err := json.Unmarshal(blob, result); err != nil {
+		t.Fatalf("invalid response %s: %v", blob, err)
+	}
+}
+
+// checkErrorCode fails the test if err is not a JSON-RPC error with the given code.
+func checkErrorCode(t *testing.T, err error, code int) {
+	t.Helper()
+	rpcErr, ok := err.(Error)
+	if !ok {
+		t.Fatalf("wrong error type %T (%v), want rpc error with code %d", err, err, code)
+	}
+	if rpcErr.ErrorCode() != code {
+		t.Fatalf("wrong error code %d (%v), want %d", rpcErr.ErrorCode(), err, code)
+	}
+}
+
+func TestServerBatchItemLimit(t *testing.T) {
+	_, httpsrv := newLimitedTestServer(t, Limits{BatchItems: 2})
+
+	call := `{"jsonrpc":"2.0","id":%d,"method":"test_echo","params":["x",1]}`
+	var (
+		batch2 = "[" + strings.Join([]string{fmt.Sprintf(call, 1), fmt.Sprintf(call, 2)}, ",") + "]"
+		batch3 = "[" + strings.Join([]string{fmt.Sprintf(call, 1), fmt.Sprintf(call, 2), fmt.Sprintf(call, 3)}, ",") + "]"
+	)
+	var answers []*jsonrpcMessage
+	postJSON(t, httpsrv.URL, batch2, &answers)
+	if len(answers) != 2 || answers[0].Error != nil || answers[1].Error != nil {
+		t.Fatalf("batch within limit failed: %+v", answers)
+	}
+	var answer jsonrpcMessage
+	postJSON(t, httpsrv.URL, batch3, &answer)
+	if answer.Error == nil || answer.Error.Code != -32600 {
+		t.Fatalf("oversized batch not rejected: %+v", answer)
+	}
+}
+
+func TestServerBatchResponseSizeLimit(t *testing.T) {
+	// The first answer is 43 bytes long, the second would exceed the limit
+	_, httpsrv := newLimitedTestServer(t, Limits{BatchResponseSize: 60})
+
+	batch := `[
+		{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["aaaaaaaaaa",1]},
+		{"jsonrpc":"2.0","id":2,"method":"test_echo","params":["b",2]},
+		{"jsonrpc":"2.0","method":"test_echo","params":["c",3]},
+		{"jsonrpc":"2.0","id":3,"method":"test_echo","params":["d",4]}
+	]`
+	var answers []*jsonrpcMessage
+	postJSON(t, httpsrv.URL, batch, &answers)
+	if len(answers) != 3 {
+		t.Fatalf("wrong number of answers: have %d, want 3", len(answers))
+	}
+	if answers[0].Error != nil {
+		t.Fatalf("first call failed: %v", answers[0].Error)
+	}
+	for _, answer := range answers[1:] {
+		if answer.Error == nil || answer.Error.Code != -32003 {
+			t.Fatalf("call %s beyond the size limit not rejected: %+v", answer.ID, answer)
+		}
+	}
+}
+
+func TestServerBatchResponseSizeLimitErrors(t *testing.T) {
+	// Errors count towards the limit too, leaving no room for the second answer
+	_, httpsrv := newLimitedTestServer(t, Limits{BatchResponseSize: 100})
+
+	batch := `[
+		{"jsonrpc":"2.0","id":1,"method":"test_missing","params":[]},
+		{"jsonrpc":"2.0","id":2,"method":"test_echo","params":["b",2]}
+	]`
+	var answers []*jsonrpcMessage
+	postJSON(t, httpsrv.URL, batch, &answers)
+	if len(answers) != 2 {
+		t.Fatalf("wrong number of answers: have %d, want 2", len(answers))
+	}
+	if answers[0].Error == nil || answers[0].Error.Code != -32601 {
+		t.Fatalf("missing method not reported: %+v", answers[0])
+	}
+	if answers[1].Error == nil || answers[1].Error.Code != -32003 {
+		t.Fatalf("call beyond the size limit not rejected: %+v", answers[1])
+	}
+}
+
+func TestServerTrustedProxies(t *testing.T) {
+	l := newLimiter(Limits{TrustedProxies: []string{"10.0.0.1", "192.168.0.0/16", "invalid"}})
+
+	tests := []struct {
+		remote, forwarded, want string
+	}{
+		{"1.2.3.4:5678", "", "1.2.3.4"},
+		{"1.2.3.4:5678", "5.6.7.8", "1.2.3.4"},           // Untrusted peers can't spoof their address
+		{"10.0.0.1:5678", "5.6.7.8", "5.6.7.8"},          // Trusted proxy
+		{"10.0.0.1:5678", "6.6.6.6, 5.6.7.8", "5.6.7.8"}, // Only the proxy appended hop is trusted
+		{"10.0.0.1:5678", "5.6.7.8, 192.168.1.1", "5.6.7.8"},
+		{"10.0.0.1:5678", "garbage", "10.0.0.1"},
+		{"10.0.0.2:5678", "5.6.7.8", "10.0.0.2"},
+	}
+	for i, test := range tests {
+		if ip := l.clientIP(test.remote, test.forwarded); ip != test.want {
+			t.Errorf("test %d: client IP mismatch: have %s, want %s", i, ip, test.want)
+		}
+	}
+}
+
+func TestServerRateLimit(t *testing.T) {
+	_, httpsrv := newLimitedTestServer(t, Limits{
+		RequestRate:  0.001,
+		RequestBurst: 3,
+		MethodRates:  map[string]float64{"test_rets": 0.001},
+	})
+	client, err := DialHTTP(httpsrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var result string
+	if err := client.Call(&result, "test_rets"); err != nil {
+		t.Fatalf("first method call failed: %v", err)
+	}
+	// The burst of the method limit is used up, the overall one is not
+	checkErrorCode(t, client.Call(&result, "test_rets"), -32005)
+	if err := client.Call(nil, "test_noArgsRets"); err != nil {
+		t.Fatalf("call within the overall rate failed: %v", err)
+	}
+	checkErrorCode(t, client.Call(nil, "test_noArgsRets"), -32005)
+}
+
+func TestServerCallTimeout(t *testing.T) {
+	_, httpsrv := newLimitedTestServer(t, Limits{
+		CallTimeout:    time.Minute,
+		MethodTimeouts: map[string]time.Duration{"test_sleep": 50 * time.Millisecond},
+	})
+	client, err := DialHTTP(httpsrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.Call(nil, "test_sleep", 10*time.Millisecond); err != nil {
+		t.Fatalf("short call failed: %v", err)
+	}
+	start := time.Now()
+	checkErrorCode(t, client.Call(nil, "test_sleep", time.Second), -32002)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("timed out call took too long: %v", elapsed)
+	}
+}
+
+func TestServerTimedOutCallLimit(t *testing.T) {
+	server, httpsrv := newLimitedTestServer(t, Limits{
+		MethodTimeouts: map[string]time.Duration{"test_sleep": 50 * time.Millisecond},
+	})
+	server.limits.timedOut = make(chan struct{}, 1)
+
+	client, err := DialHTTP(httpsrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// The first timed out call is left running in the background
+	start := time.Now()
+	checkErrorCode(t, client.Call(nil, "test_sleep", 500*time.Millisecond), -32002)
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("timed out call took too long: %v", elapsed)
+	}
+	// The second one has no room left and is waited for
+	start = time.Now()
+	checkErrorCode(t, client.Call(nil, "test_sleep", 500*time.Millisecond), -32002)
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Fatalf("timed out call returned before the callback: %v", elapsed)
+	}
+	// Once the background call returned, its slot is available again
+	time.Sleep(100 * time.Millisecond)
+	start = time.Now()
+	checkErrorCode(t, client.Call(nil, "test_sleep", 500*time.Millisecond), -32002)
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("timed out call took too long: %v", elapsed)
+	}
+}
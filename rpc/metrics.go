@@ -27,6 +27,11 @@ var (
 	successfulRequestGauge = metrics.NewRegisteredGauge("rpc/success", nil)
 	failedReqeustGauge     = metrics.NewRegisteredGauge("rpc/failure", nil)
 	rpcServingTimer        = metrics.NewRegisteredTimer("rpc/duration/all", nil)
+
+	batchLimitMeter   = metrics.NewRegisteredMeter("rpc/limits/batch", nil)
+	sizeLimitMeter    = metrics.NewRegisteredMeter("rpc/limits/size", nil)
+	rateLimitMeter    = metrics.NewRegisteredMeter("rpc/limits/rate", nil)
+	timeoutLimitMeter = metrics.NewRegisteredMeter("rpc/limits/timeout", nil)
 )
 
 func newRPCServingTimer(method string, valid bool) metrics.Timer {
@@ -53,6 +53,8 @@ type jsonWriter interface {
 	closed() <-chan interface{}
 	// RemoteAddr returns the peer address of the connection.
 	remoteAddr() string
+	// ForwardedFor returns the X-Forwarded-For header the connection was opened with.
+	forwardedFor() string
 }
 
 type BlockNumber int64